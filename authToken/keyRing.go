@@ -0,0 +1,308 @@
+package authToken
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms a key can use.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// minSecretLength is the shortest HMAC secret accepted, in bytes.
+const minSecretLength = 32
+
+// minRSABits is the smallest RSA modulus accepted.
+const minRSABits = 2048
+
+// Key is one signing key of a key file. HS256 keys carry a base64 encoded
+// Secret. RS256 and EdDSA keys name a PEM file with either the private key,
+// which can sign, or only the public key, which can still verify tokens
+// signed before a rotation. Relative paths are resolved against the
+// directory of the key file.
+type Key struct {
+	ID             string `json:"kid"`
+	Algorithm      string `json:"alg"`
+	Secret         string `json:"secret,omitempty"`
+	PrivateKeyFile string `json:"privateKeyFile,omitempty"`
+	PublicKeyFile  string `json:"publicKeyFile,omitempty"`
+}
+
+// keyFile is the JSON layout of a key file. Tokens are signed with the
+// Active key and verified with any listed key, so a new key can be added,
+// made active once every instance has it, and the old key removed after the
+// longest token lifetime has passed.
+type keyFile struct {
+	Active string `json:"active"`
+	Keys   []Key  `json:"keys"`
+}
+
+// signingKey is a loaded key. signKey is nil for verification-only keys.
+type signingKey struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeyRing holds the keys tokens are signed and verified with. Every token
+// carries the ID of its signing key in the "kid" header.
+type KeyRing struct {
+	mu     sync.RWMutex
+	path   string
+	active string
+	keys   map[string]signingKey
+}
+
+// LoadKeyRing reads the key file at path. Without a path a random Ed25519
+// key is generated; tokens signed with it stop being valid when the server
+// restarts.
+func LoadKeyRing(path string) (*KeyRing, error) {
+	ring := &KeyRing{path: path}
+	if path == "" {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate signing key: %v", err)
+		}
+		ring.active = "ephemeral"
+		ring.keys = map[string]signingKey{
+			ring.active: {method: jwt.SigningMethodEdDSA, signKey: private, verifyKey: public},
+		}
+		log.Println("WARN: No JWT key file configured; using a random key that is lost on restart.")
+		return ring, nil
+	}
+
+	if err := ring.Reload(); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// Reload re-reads the key file, which is how keys are rotated without a
+// restart. On error the current keys stay in use.
+func (k *KeyRing) Reload() error {
+	if k.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return fmt.Errorf("Failed to read JWT key file: %v", err)
+	}
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("Failed to parse JWT key file %s: %v", k.path, err)
+	}
+
+	keys := make(map[string]signingKey, len(file.Keys))
+	for _, key := range file.Keys {
+		if key.ID == "" {
+			return fmt.Errorf("JWT key file %s: key without kid", k.path)
+		}
+		if _, dup := keys[key.ID]; dup {
+			return fmt.Errorf("JWT key file %s: duplicate kid %s", k.path, key.ID)
+		}
+		loaded, err := k.loadKey(key)
+		if err != nil {
+			return fmt.Errorf("JWT key file %s: key %s: %v", k.path, key.ID, err)
+		}
+		keys[key.ID] = loaded
+	}
+	active, ok := keys[file.Active]
+	if !ok {
+		return fmt.Errorf("JWT key file %s: active key %q is not listed", k.path, file.Active)
+	}
+	if active.signKey == nil {
+		return fmt.Errorf("JWT key file %s: active key %q has no private key", k.path, file.Active)
+	}
+
+	k.mu.Lock()
+	k.active = file.Active
+	k.keys = keys
+	k.mu.Unlock()
+
+	log.Printf("INFO: Loaded %d JWT keys, signing with %s (%s)", len(keys), file.Active, active.method.Alg())
+	return nil
+}
+
+// loadKey decodes the key material of one key file entry.
+func (k *KeyRing) loadKey(key Key) (signingKey, error) {
+	if key.Algorithm != AlgHS256 && key.PrivateKeyFile == "" && key.PublicKeyFile == "" {
+		return signingKey{}, errors.New("privateKeyFile or publicKeyFile is required")
+	}
+
+	switch key.Algorithm {
+	case AlgHS256:
+		secret, err := base64.StdEncoding.DecodeString(key.Secret)
+		if err != nil {
+			return signingKey{}, fmt.Errorf("invalid base64: %v", err)
+		}
+		if len(secret) < minSecretLength {
+			return signingKey{}, fmt.Errorf("secret is shorter than %d bytes", minSecretLength)
+		}
+		return signingKey{method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}, nil
+
+	case AlgRS256:
+		if key.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(k.resolve(key.PrivateKeyFile))
+			if err != nil {
+				return signingKey{}, err
+			}
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return signingKey{}, err
+			}
+			if private.N.BitLen() < minRSABits {
+				return signingKey{}, fmt.Errorf("RSA key is shorter than %d bits", minRSABits)
+			}
+			return signingKey{method: jwt.SigningMethodRS256, signKey: private, verifyKey: &private.PublicKey}, nil
+		}
+		pem, err := os.ReadFile(k.resolve(key.PublicKeyFile))
+		if err != nil {
+			return signingKey{}, err
+		}
+		public, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return signingKey{}, err
+		}
+		return signingKey{method: jwt.SigningMethodRS256, verifyKey: public}, nil
+
+	case AlgEdDSA:
+		if key.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(k.resolve(key.PrivateKeyFile))
+			if err != nil {
+				return signingKey{}, err
+			}
+			private, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+			if err != nil {
+				return signingKey{}, err
+			}
+			public := private.(ed25519.PrivateKey).Public()
+			return signingKey{method: jwt.SigningMethodEdDSA, signKey: private, verifyKey: public}, nil
+		}
+		pem, err := os.ReadFile(k.resolve(key.PublicKeyFile))
+		if err != nil {
+			return signingKey{}, err
+		}
+		public, err := jwt.ParseEdPublicKeyFromPEM(pem)
+		if err != nil {
+			return signingKey{}, err
+		}
+		return signingKey{method: jwt.SigningMethodEdDSA, verifyKey: public}, nil
+	}
+	return signingKey{}, fmt.Errorf("unsupported alg %q, use %s, %s or %s", key.Algorithm, AlgHS256, AlgRS256, AlgEdDSA)
+}
+
+// resolve makes a path from the key file relative to the key file.
+func (k *KeyRing) resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(k.path), path)
+}
+
+// Sign returns the claims signed with the active key.
+func (k *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	kid, key := k.active, k.keys[k.active]
+	k.mu.RUnlock()
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key.signKey)
+}
+
+// Verify checks the token's signature against the key named by its kid
+// header and its expiry, and decodes it into claims. The token must use the
+// algorithm of that key, so a public key can never be used as an HMAC secret.
+func (k *KeyRing) Verify(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		k.mu.RLock()
+		key, ok := k.keys[kid]
+		k.mu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("Unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("Unexpected signing method %v for key %s", token.Header["alg"], kid)
+		}
+		return key.verifyKey, nil
+	},
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("Invalid token")
+	}
+	return nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	// RSA keys
+	Modulus  string `json:"n,omitempty"`
+	Exponent string `json:"e,omitempty"`
+	// Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys returns the public keys of the ring as a key set, so other
+// services can verify tokens without sharing a secret. HMAC keys are
+// secrets and are never published.
+func (k *KeyRing) PublicKeys() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	for kid, key := range k.keys {
+		if jwk, ok := publicJWK(kid, key.verifyKey); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
+
+// publicJWK encodes an asymmetric verification key.
+func publicJWK(kid string, key crypto.PublicKey) (JWK, bool) {
+	encode := base64.RawURLEncoding.EncodeToString
+	switch public := key.(type) {
+	case *rsa.PublicKey:
+		exponent := big.NewInt(int64(public.E)).Bytes()
+		return JWK{KeyType: "RSA", KeyID: kid, Algorithm: AlgRS256, Use: "sig", Modulus: encode(public.N.Bytes()), Exponent: encode(exponent)}, true
+	case ed25519.PublicKey:
+		return JWK{KeyType: "OKP", KeyID: kid, Algorithm: AlgEdDSA, Use: "sig", Curve: "Ed25519", X: encode(public)}, true
+	}
+	return JWK{}, false
+}
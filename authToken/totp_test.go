@@ -0,0 +1,107 @@
+package authToken
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 6238 test vectors,
+// "12345678901234567890", base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPMatchesRFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes; the 6 digit code is their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfcSecret, tt.code, time.Unix(tt.unix, 0), 0)
+		if !ok {
+			t.Errorf("ValidateTOTP(%s) at %d refused", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / 30; step != want {
+			t.Errorf("ValidateTOTP(%s) at %d step = %d, want %d", tt.code, tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPAllowsOneStepOfSkew(t *testing.T) {
+	// 287082 is the code of step 1, covering 30s to 59s
+	tests := []struct {
+		name string
+		unix int64
+		ok   bool
+	}{
+		{"one step early", 0, true},
+		{"on time", 45, true},
+		{"one step late", 89, true},
+		{"two steps late", 90, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(rfcSecret, "287082", time.Unix(tt.unix, 0), -1); ok != tt.ok {
+				t.Fatalf("ValidateTOTP() at %d = %v, want %v", tt.unix, ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRefusesReplays(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step, ok := ValidateTOTP(rfcSecret, "050471", now, 0)
+	if !ok {
+		t.Fatal("ValidateTOTP() refused a fresh code")
+	}
+
+	// The same code, or one of an earlier step, is refused once step is stored
+	if _, ok := ValidateTOTP(rfcSecret, "050471", now, step); ok {
+		t.Fatal("ValidateTOTP() accepted a replayed code")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, totpCodeAt(t, step-1), now, step); ok {
+		t.Fatal("ValidateTOTP() accepted the code of an earlier step")
+	}
+	// The next step's code is still accepted within the skew
+	if next, ok := ValidateTOTP(rfcSecret, totpCodeAt(t, step+1), now, step); !ok || next != step+1 {
+		t.Fatalf("ValidateTOTP() of the next step = %d, %v, want %d, true", next, ok, step+1)
+	}
+}
+
+func TestValidateTOTPRefusesMalformedInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, tt := range []struct{ name, secret, code string }{
+		{"short code", rfcSecret, "28708"},
+		{"eight digits", rfcSecret, "94287082"},
+		{"invalid secret", "not base32!", "287082"},
+	} {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, now, 0); ok {
+			t.Errorf("ValidateTOTP() with %s accepted", tt.name)
+		}
+	}
+
+	// Lower case and padded secrets are what some apps show; they still work
+	for _, secret := range []string{rfcSecret + "====", strings.ToLower(rfcSecret)} {
+		if _, ok := ValidateTOTP(secret, "287082", now, 0); !ok {
+			t.Errorf("ValidateTOTP() refused secret %s", secret)
+		}
+	}
+}
+
+// totpCodeAt returns the code of rfcSecret for step.
+func totpCodeAt(t *testing.T, step int64) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(key, step)
+}
@@ -0,0 +1,337 @@
+package config
+
+import (
+	"Task_04/iamRole"
+	"Task_04/storage"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is everything an instance needs to know about its environment. It
+// is loaded once at startup by Load: defaults first, then the YAML file,
+// then environment variables, so one binary can serve dev, staging and prod.
+type Config struct {
+	// ProjectID is the GCP project holding Firestore and the IAM policy.
+	ProjectID string `yaml:"projectID"`
+	// Port is the HTTP port the server listens on.
+	Port int `yaml:"port"`
+
+	Storage    Storage    `yaml:"storage"`
+	IAM        IAM        `yaml:"iam"`
+	BreakGlass BreakGlass `yaml:"breakGlass"`
+	Auth       Auth       `yaml:"auth"`
+	Notifier   Notifier   `yaml:"notifier"`
+}
+
+// Storage selects where documents are kept.
+type Storage struct {
+	// Backend is firestore, memory, postgres or sqlite3.
+	Backend string `yaml:"backend"`
+	// DSN is the data source name of the SQL backends.
+	DSN string `yaml:"dsn"`
+	// Collections are the Firestore collection names. The SQL backends use
+	// the fixed table names of their migrations.
+	Collections storage.Collections `yaml:"collections"`
+}
+
+// IAM selects where IAM policies are read and written.
+type IAM struct {
+	// Backend is google or fake.
+	Backend string `yaml:"backend"`
+	// StatePath is the file the fake backend keeps its bindings in.
+	StatePath string `yaml:"statePath"`
+	// SweepInterval is how often expired time-bound grants are removed.
+	SweepInterval time.Duration `yaml:"sweepInterval"`
+}
+
+// BreakGlass is the emergency access members of the on-call team can take
+// without approval. It is off while Roles is empty.
+type BreakGlass struct {
+	// Roles are the high-privilege roles a break-glass grant gives.
+	Roles []string `yaml:"roles"`
+	// OnCallTeam is the team whose members may break glass. The roles are
+	// granted through it, so in the team's projects.
+	OnCallTeam string `yaml:"onCallTeam"`
+	// MaxDuration caps how long a break-glass grant lasts.
+	MaxDuration time.Duration `yaml:"maxDuration"`
+}
+
+// maxBreakGlassDuration is the longest breakGlass.maxDuration accepted.
+const maxBreakGlassDuration = 12 * time.Hour
+
+// Auth holds the login and password policies.
+type Auth struct {
+	// JWTKeys is the key file tokens are signed with. Without one a random
+	// key is used, which only suits a single development instance.
+	JWTKeys        string         `yaml:"jwtKeys"`
+	Lockout        Lockout        `yaml:"lockout"`
+	PasswordPolicy PasswordPolicy `yaml:"passwordPolicy"`
+}
+
+// Lockout is the account lockout policy.
+type Lockout struct {
+	MaxFailedLogins int           `yaml:"maxFailedLogins"`
+	Base            time.Duration `yaml:"base"`
+	Max             time.Duration `yaml:"max"`
+}
+
+// PasswordPolicy is the strength policy of new passwords.
+type PasswordPolicy struct {
+	MinLength  int `yaml:"minLength"`
+	MaxLength  int `yaml:"maxLength"`
+	MinClasses int `yaml:"minClasses"`
+}
+
+// Notifier selects how invites and password resets are delivered.
+type Notifier struct {
+	// Backend is file or smtp.
+	Backend string `yaml:"backend"`
+	// File is where the file backend appends messages.
+	File string `yaml:"file"`
+	SMTP SMTP   `yaml:"smtp"`
+	// PublicURL is where employees reach this service; messages link to it.
+	PublicURL string `yaml:"publicURL"`
+}
+
+// SMTP is the mail server of the smtp notifier. Prefer EMS_SMTP_PASSWORD
+// over putting the password into the file.
+type SMTP struct {
+	Addr     string `yaml:"addr"`
+	From     string `yaml:"from"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Default returns the configuration used for anything not set explicitly.
+func Default() Config {
+	return Config{
+		ProjectID: "ems-web-application-409305",
+		Port:      8080,
+		Storage: Storage{
+			Backend:     "firestore",
+			Collections: storage.DefaultCollections(),
+		},
+		IAM:        IAM{Backend: "google", SweepInterval: 5 * time.Minute},
+		BreakGlass: BreakGlass{MaxDuration: time.Hour},
+		Auth: Auth{
+			Lockout:        Lockout{MaxFailedLogins: 5, Base: time.Minute, Max: 24 * time.Hour},
+			PasswordPolicy: PasswordPolicy{MinLength: 12, MaxLength: 72, MinClasses: 3},
+		},
+		Notifier: Notifier{
+			Backend:   "file",
+			File:      "notifications.log",
+			PublicURL: "http://localhost:8080",
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file at path (if
+// any) and the EMS_* environment variables, in that order, and validates it.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read config file: %v", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("Failed to parse config file %s: %v", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// applyEnv overrides the configuration with the environment variables that
+// are set and not empty.
+func (c *Config) applyEnv() error {
+	texts := map[string]*string{
+		"EMS_PROJECT_ID":                    &c.ProjectID,
+		"EMS_STORE":                         &c.Storage.Backend,
+		"EMS_DSN":                           &c.Storage.DSN,
+		"EMS_COLLECTION_EMPLOYEES":          &c.Storage.Collections.Employees,
+		"EMS_COLLECTION_DEPARTMENTS":        &c.Storage.Collections.Departments,
+		"EMS_COLLECTION_TEAMS":              &c.Storage.Collections.Teams,
+		"EMS_COLLECTION_IAM_OPERATIONS":     &c.Storage.Collections.IAMOperations,
+		"EMS_COLLECTION_REFRESH_TOKENS":     &c.Storage.Collections.RefreshTokens,
+		"EMS_COLLECTION_PASSWORD_TOKENS":    &c.Storage.Collections.PasswordTokens,
+		"EMS_COLLECTION_ROLE_REQUESTS":      &c.Storage.Collections.RoleRequests,
+		"EMS_COLLECTION_BREAK_GLASS_GRANTS": &c.Storage.Collections.BreakGlassGrants,
+		"EMS_COLLECTION_REVIEW_CAMPAIGNS":   &c.Storage.Collections.ReviewCampaigns,
+		"EMS_BREAK_GLASS_TEAM":              &c.BreakGlass.OnCallTeam,
+		"EMS_IAM":                           &c.IAM.Backend,
+		"EMS_IAM_STATE":                     &c.IAM.StatePath,
+		"EMS_JWT_KEYS":                      &c.Auth.JWTKeys,
+		"EMS_NOTIFIER":                      &c.Notifier.Backend,
+		"EMS_NOTIFY_FILE":                   &c.Notifier.File,
+		"EMS_SMTP_ADDR":                     &c.Notifier.SMTP.Addr,
+		"EMS_SMTP_FROM":                     &c.Notifier.SMTP.From,
+		"EMS_SMTP_USER":                     &c.Notifier.SMTP.Username,
+		"EMS_SMTP_PASSWORD":                 &c.Notifier.SMTP.Password,
+		"EMS_PUBLIC_URL":                    &c.Notifier.PublicURL,
+	}
+	for key, field := range texts {
+		if value := os.Getenv(key); value != "" {
+			*field = value
+		}
+	}
+
+	// EMS_BREAK_GLASS_ROLES is a comma-separated list
+	if value := os.Getenv("EMS_BREAK_GLASS_ROLES"); value != "" {
+		c.BreakGlass.Roles = nil
+		for _, role := range strings.Split(value, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				c.BreakGlass.Roles = append(c.BreakGlass.Roles, role)
+			}
+		}
+	}
+
+	ints := map[string]*int{
+		"EMS_PORT":                 &c.Port,
+		"EMS_MAX_FAILED_LOGINS":    &c.Auth.Lockout.MaxFailedLogins,
+		"EMS_PASSWORD_MIN_LENGTH":  &c.Auth.PasswordPolicy.MinLength,
+		"EMS_PASSWORD_MAX_LENGTH":  &c.Auth.PasswordPolicy.MaxLength,
+		"EMS_PASSWORD_MIN_CLASSES": &c.Auth.PasswordPolicy.MinClasses,
+	}
+	// PORT is what Cloud Run and App Engine set; EMS_PORT wins over it.
+	if os.Getenv("EMS_PORT") == "" {
+		ints["PORT"] = &c.Port
+	}
+	for key, field := range ints {
+		if value := os.Getenv(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("Invalid %s %q: %v", key, value, err)
+			}
+			*field = n
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"EMS_LOCKOUT_BASE":             &c.Auth.Lockout.Base,
+		"EMS_LOCKOUT_MAX":              &c.Auth.Lockout.Max,
+		"EMS_IAM_SWEEP_INTERVAL":       &c.IAM.SweepInterval,
+		"EMS_BREAK_GLASS_MAX_DURATION": &c.BreakGlass.MaxDuration,
+	}
+	for key, field := range durations {
+		if value := os.Getenv(key); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("Invalid %s %q: %v", key, value, err)
+			}
+			*field = d
+		}
+	}
+	return nil
+}
+
+// Validate reports every problem of the configuration at once.
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(iamRole.ValidateProjectID(c.ProjectID) == nil, "projectID %q is not a valid GCP project ID", c.ProjectID)
+	check(c.Port > 0 && c.Port < 65536, "port %d is out of range", c.Port)
+
+	check(oneOf(c.Storage.Backend, "firestore", "memory", "postgres", "sqlite3"), "storage.backend %q is not firestore, memory, postgres or sqlite3", c.Storage.Backend)
+	if c.Storage.Backend == "postgres" || c.Storage.Backend == "sqlite3" {
+		check(c.Storage.DSN != "", "storage.dsn is required for the %s backend", c.Storage.Backend)
+	}
+	collections := map[string]string{
+		"employees":        c.Storage.Collections.Employees,
+		"departments":      c.Storage.Collections.Departments,
+		"teams":            c.Storage.Collections.Teams,
+		"iamOperations":    c.Storage.Collections.IAMOperations,
+		"refreshTokens":    c.Storage.Collections.RefreshTokens,
+		"passwordTokens":   c.Storage.Collections.PasswordTokens,
+		"roleRequests":     c.Storage.Collections.RoleRequests,
+		"breakGlassGrants": c.Storage.Collections.BreakGlassGrants,
+		"reviewCampaigns":  c.Storage.Collections.ReviewCampaigns,
+	}
+	used := make(map[string]string)
+	for _, kind := range sortedKeys(collections) {
+		name := collections[kind]
+		check(name != "" && !strings.Contains(name, "/"), "storage.collections.%s %q must be a non-empty name without /", kind, name)
+		if other, dup := used[name]; dup && name != "" {
+			check(false, "storage.collections.%s and storage.collections.%s are both %q", other, kind, name)
+		}
+		used[name] = kind
+	}
+
+	check(oneOf(c.IAM.Backend, "google", "fake"), "iam.backend %q is not google or fake", c.IAM.Backend)
+	check(c.IAM.SweepInterval > 0, "iam.sweepInterval must be positive")
+
+	breakGlass := c.BreakGlass
+	for _, role := range breakGlass.Roles {
+		check(iamRole.ValidateRole(role) == nil, "breakGlass.roles: %q is not a valid IAM role name", role)
+	}
+	if len(breakGlass.Roles) > 0 {
+		check(breakGlass.OnCallTeam != "", "breakGlass.onCallTeam is required with breakGlass.roles")
+	}
+	check(breakGlass.MaxDuration > 0 && breakGlass.MaxDuration <= maxBreakGlassDuration,
+		"breakGlass.maxDuration must be positive and at most %s", maxBreakGlassDuration)
+
+	lockout := c.Auth.Lockout
+	check(lockout.MaxFailedLogins > 0, "auth.lockout.maxFailedLogins must be positive")
+	check(lockout.Base > 0 && lockout.Max >= lockout.Base, "auth.lockout needs 0 < base <= max")
+	policy := c.Auth.PasswordPolicy
+	check(policy.MinLength >= 8, "auth.passwordPolicy.minLength must be at least 8")
+	check(policy.MaxLength >= policy.MinLength && policy.MaxLength <= 72, "auth.passwordPolicy.maxLength must be between minLength and 72, the bcrypt limit")
+	check(policy.MinClasses >= 0 && policy.MinClasses <= 4, "auth.passwordPolicy.minClasses must be between 0 and 4")
+
+	check(oneOf(c.Notifier.Backend, "file", "smtp"), "notifier.backend %q is not file or smtp", c.Notifier.Backend)
+	if c.Notifier.Backend == "file" {
+		check(c.Notifier.File != "", "notifier.file is required for the file notifier")
+	}
+	if c.Notifier.Backend == "smtp" {
+		check(c.Notifier.SMTP.Addr != "" && c.Notifier.SMTP.From != "", "notifier.smtp.addr and notifier.smtp.from are required for the smtp notifier")
+	}
+	publicURL, err := url.Parse(c.Notifier.PublicURL)
+	check(err == nil && (publicURL.Scheme == "http" || publicURL.Scheme == "https") && publicURL.Host != "",
+		"notifier.publicURL %q must be an absolute http or https URL", c.Notifier.PublicURL)
+
+	if len(problems) > 0 {
+		return errors.New("Invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,225 @@
+package controllerFunctions
+
+import (
+	"Task_04/sharedpackage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Login errors. ErrInvalidCredentials does not say whether the user exists.
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrAccountLocked      = errors.New("account locked")
+)
+
+// Account lockout policy: after MaxFailedLogins wrong passwords in a row the
+// account is locked, for LockoutBase the first time and twice as long after
+// every further lockout, up to LockoutMax. A successful login resets both.
+var (
+	MaxFailedLogins = 5
+	LockoutBase     = time.Minute
+	LockoutMax      = 24 * time.Hour
+)
+
+// LockedError reports until when an account is locked. It matches ErrAccountLocked.
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("account locked until %s", e.Until.Format(time.RFC3339))
+}
+
+func (e *LockedError) Unwrap() error { return ErrAccountLocked }
+
+// dummyHash is compared against when the user does not exist, so unknown
+// and known usernames take the same time to reject.
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+func compareDummyHash(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// Login verifies the password of the employee with the given mailID against
+// the stored bcrypt hash and, once MFA is enabled, the TOTP or recovery code.
+// Failures count towards a temporary lockout.
+func (c *Controller) Login(username string, password string, code string) (*sharedpackage.Employee, error) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	employee, err := c.Employees.FindEmployeeByEmail(ctx, username)
+	if err != nil {
+		if isNotFound(err) {
+			compareDummyHash(password)
+			log.Printf("WARN: Login attempt for unknown user %s", username)
+			return nil, ErrInvalidCredentials
+		}
+		log.Printf("ERROR: Error getting document: %v", err)
+		return nil, fmt.Errorf("Error getting document: %w", err)
+	}
+
+	// Step 1: Refuse locked accounts without checking the password
+	if until, locked := lockedUntil(employee, now); locked {
+		log.Printf("WARN: Login attempt for locked account %s", employee.ID)
+		return nil, &LockedError{Until: until}
+	}
+
+	// Step 2: Verify the password
+	if err := bcrypt.CompareHashAndPassword([]byte(employee.Password), []byte(password)); err != nil {
+		return nil, c.recordFailedLogin(ctx, employee, now, ErrInvalidCredentials)
+	}
+
+	// Step 3: Verify the second factor against the stored MFA state, so
+	// that concurrent logins cannot replay a code; asking for it is not a failure
+	if employee.MFAEnabled {
+		if code == "" {
+			return nil, ErrMFARequired
+		}
+		rejected := false
+		updated, err := c.Employees.UpdateEmployeeMFA(ctx, employee.ID, func(stored *sharedpackage.Employee) error {
+			if rejected = !verifyMFACode(stored, code, now); rejected {
+				return ErrInvalidMFACode
+			}
+			return nil
+		})
+		if rejected {
+			return nil, c.recordFailedLogin(ctx, employee, now, ErrInvalidMFACode)
+		}
+		if err != nil {
+			log.Printf("ERROR: Failed to record MFA use of %s: %v", employee.ID, err)
+			return nil, fmt.Errorf("Failed to record login: %w", err)
+		}
+		employee.MFALastStep = updated.MFALastStep
+		employee.RecoveryCodes = updated.RecoveryCodes
+	}
+
+	// Step 4: Reset the failure counters after a successful login
+	if employee.FailedLogins != 0 || employee.Lockouts != 0 || employee.LockedUntil != "" {
+		if _, err := c.Employees.UpdateEmployeeLockout(ctx, employee.ID, resetLockout); err != nil {
+			log.Printf("ERROR: Failed to reset failed logins of %s: %v", employee.ID, err)
+			return nil, fmt.Errorf("Failed to record login: %w", err)
+		}
+		clearLockout(employee)
+	}
+
+	return employee, nil
+}
+
+// recordFailedLogin counts a failed login, locking the account once
+// MaxFailedLogins is reached, and returns the error to report: a LockedError
+// if the account is now locked and failure otherwise. The counters are
+// updated in the store, so concurrent failures are all counted.
+func (c *Controller) recordFailedLogin(ctx context.Context, employee *sharedpackage.Employee, now time.Time, failure error) error {
+	var until time.Time
+	locked, lockedNow := false, false
+	_, err := c.Employees.UpdateEmployeeLockout(ctx, employee.ID, func(stored *sharedpackage.Employee) error {
+		// A concurrent failure may have locked the account meanwhile
+		until, locked = lockedUntil(stored, now)
+		lockedNow = false
+		if locked {
+			return nil
+		}
+
+		stored.FailedLogins++
+		if stored.FailedLogins >= MaxFailedLogins {
+			until = now.Add(lockoutDuration(stored.Lockouts))
+			stored.Lockouts++
+			stored.FailedLogins = 0
+			stored.LockedUntil = until.Format(time.RFC3339)
+			locked, lockedNow = true, true
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to record failed login of %s: %v", employee.ID, err)
+		return fmt.Errorf("Failed to record failed login: %w", err)
+	}
+	if lockedNow {
+		log.Printf("WARN: Account %s locked until %s after %d failed logins", employee.ID, until.Format(time.RFC3339), MaxFailedLogins)
+	}
+	if locked {
+		return &LockedError{Until: until}
+	}
+	return failure
+}
+
+// UnlockEmployee lifts a lockout and resets the failed login counters.
+func (c *Controller) UnlockEmployee(empID string) (*sharedpackage.Employee, error) {
+	ctx := context.Background()
+
+	employee, err := c.Employees.UpdateEmployeeLockout(ctx, empID, resetLockout)
+	if err != nil {
+		if isNotFound(err) {
+			log.Printf("ERROR: Document with ID %s does not exist", empID)
+			return nil, notFound("Document with ID %s does not exist", empID)
+		}
+		log.Printf("ERROR: Error updating document: %v", err)
+		return nil, fmt.Errorf("Error updating document: %w", err)
+	}
+
+	log.Printf("INFO: Employee with ID %s unlocked", empID)
+	return employee, nil
+}
+
+// getEmployee loads an employee, reporting a missing one as not found.
+func (c *Controller) getEmployee(ctx context.Context, empID string) (*sharedpackage.Employee, error) {
+	employee, err := c.Employees.GetEmployee(ctx, empID)
+	if err != nil {
+		if isNotFound(err) {
+			log.Printf("ERROR: Document with ID %s does not exist", empID)
+			return nil, notFound("Document with ID %s does not exist", empID)
+		}
+		log.Printf("ERROR: Error getting document: %v", err)
+		return nil, fmt.Errorf("Error getting document: %w", err)
+	}
+	return employee, nil
+}
+
+// lockedUntil reports whether the employee is locked at now and until when.
+func lockedUntil(employee *sharedpackage.Employee, now time.Time) (time.Time, bool) {
+	if employee.LockedUntil == "" {
+		return time.Time{}, false
+	}
+	until, err := time.Parse(time.RFC3339, employee.LockedUntil)
+	if err != nil {
+		log.Printf("WARN: Ignoring malformed lockedUntil %q of %s", employee.LockedUntil, employee.ID)
+		return time.Time{}, false
+	}
+	return until, now.Before(until)
+}
+
+// lockoutDuration doubles LockoutBase for every earlier lockout, up to LockoutMax.
+func lockoutDuration(previousLockouts int) time.Duration {
+	duration := LockoutBase
+	for i := 0; i < previousLockouts && duration < LockoutMax; i++ {
+		duration *= 2
+	}
+	if duration > LockoutMax {
+		duration = LockoutMax
+	}
+	return duration
+}
+
+func clearLockout(employee *sharedpackage.Employee) {
+	employee.FailedLogins = 0
+	employee.Lockouts = 0
+	employee.LockedUntil = ""
+}
+
+// resetLockout is clearLockout as an UpdateEmployeeLockout update.
+func resetLockout(employee *sharedpackage.Employee) error {
+	clearLockout(employee)
+	return nil
+}
@@ -0,0 +1,393 @@
+package controllerFunctions
+
+import (
+	"Task_04/sharedpackage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ErrForbidden is returned when the caller may not perform the requested action.
+var ErrForbidden = errors.New("forbidden")
+
+// Action names an operation a caller can be allowed to perform.
+type Action string
+
+const (
+	ActionAssignRoles       Action = "assignRoles"
+	ActionRemoveRoles       Action = "removeRoles"
+	ActionRemoveMember      Action = "removeMember"
+	ActionManageCustomRoles Action = "manageCustomRoles"
+	ActionReadIAM           Action = "readIAM"
+	ActionReconcileIAM      Action = "reconcileIAM"
+
+	ActionRequestRoles       Action = "requestRoles"
+	ActionListRoleRequests   Action = "listRoleRequests"
+	ActionDecideRoleRequests Action = "decideRoleRequests"
+	ActionBreakGlass         Action = "breakGlass"
+	ActionReviewBreakGlass   Action = "reviewBreakGlass"
+	ActionLaunchReview       Action = "launchReview"
+	ActionListReviews        Action = "listReviews"
+	ActionReviewAccess       Action = "reviewAccess"
+
+	ActionCreateDepartment Action = "createDepartment"
+	ActionUpdateDepartment Action = "updateDepartment"
+	ActionDeleteDepartment Action = "deleteDepartment"
+	ActionListDepartments  Action = "listDepartments"
+
+	ActionCreateEmployee Action = "createEmployee"
+	ActionUpdateEmployee Action = "updateEmployee"
+	ActionDeleteEmployee Action = "deleteEmployee"
+	ActionListEmployees  Action = "listEmployees"
+	ActionUnlockEmployee Action = "unlockEmployee"
+	ActionRevokeSessions Action = "revokeSessions"
+	ActionResetMFA       Action = "resetMFA"
+	ActionInviteEmployee Action = "inviteEmployee"
+
+	ActionCreateTeam Action = "createTeam"
+	ActionUpdateTeam Action = "updateTeam"
+	ActionDeleteTeam Action = "deleteTeam"
+	ActionListTeams  Action = "listTeams"
+)
+
+// scope limits an allowed action to the targets a caller is responsible for.
+type scope int
+
+const (
+	scopeNone       scope = iota // not allowed
+	scopeAll                     // any target
+	scopeDepartment              // targets inside the caller's department
+	scopeTeam                    // targets inside the caller's teams, roles limited to the team's iamRoles
+	scopeSelf                    // the caller's own record
+)
+
+// employeeRole is the accessRules key for callers without a management role.
+const employeeRole = ""
+
+// accessRules is the authorization matrix: for every action, the scope each
+// job role may perform it in. Roles missing from an entry are refused.
+var accessRules = map[Action]map[string]scope{
+	ActionAssignRoles:       {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment, sharedpackage.RoleLead: scopeTeam},
+	ActionRemoveRoles:       {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionRemoveMember:      {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionManageCustomRoles: {sharedpackage.RoleAdmin: scopeAll},
+	ActionReadIAM:           {sharedpackage.RoleAdmin: scopeAll},
+	ActionReconcileIAM:      {sharedpackage.RoleAdmin: scopeAll},
+
+	ActionRequestRoles:     {sharedpackage.RoleAdmin: scopeSelf, sharedpackage.RoleHOD: scopeSelf, sharedpackage.RoleLead: scopeSelf, employeeRole: scopeSelf},
+	ActionListRoleRequests: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment, sharedpackage.RoleLead: scopeTeam, employeeRole: scopeSelf},
+	// Anyone a request is routed to may decide it; mayDecide checks the routing
+	ActionDecideRoleRequests: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeSelf, sharedpackage.RoleLead: scopeSelf, employeeRole: scopeSelf},
+	// Only the on-call team may break glass; BreakGlass checks membership
+	ActionBreakGlass:       {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeSelf, sharedpackage.RoleLead: scopeSelf, employeeRole: scopeSelf},
+	ActionReviewBreakGlass: {sharedpackage.RoleAdmin: scopeAll},
+	ActionLaunchReview:     {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionListReviews:      {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment, sharedpackage.RoleLead: scopeSelf, employeeRole: scopeSelf},
+	// Anyone an item is assigned to may review it; mayReview checks the assignment
+	ActionReviewAccess: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeSelf, sharedpackage.RoleLead: scopeSelf, employeeRole: scopeSelf},
+
+	ActionCreateDepartment: {sharedpackage.RoleAdmin: scopeAll},
+	ActionUpdateDepartment: {sharedpackage.RoleAdmin: scopeAll},
+	ActionDeleteDepartment: {sharedpackage.RoleAdmin: scopeAll},
+	ActionListDepartments:  {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+
+	ActionCreateEmployee: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionUpdateEmployee: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionDeleteEmployee: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionListEmployees:  {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment, sharedpackage.RoleLead: scopeTeam, employeeRole: scopeSelf},
+	ActionUnlockEmployee: {sharedpackage.RoleAdmin: scopeAll},
+	ActionRevokeSessions: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeSelf, sharedpackage.RoleLead: scopeSelf, employeeRole: scopeSelf},
+	ActionResetMFA:       {sharedpackage.RoleAdmin: scopeAll},
+	ActionInviteEmployee: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+
+	ActionCreateTeam: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionUpdateTeam: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionDeleteTeam: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionListTeams:  {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment, sharedpackage.RoleLead: scopeTeam},
+}
+
+// AccessRequest describes an action and the documents it touches. Empty
+// fields are not checked; listings leave every target empty and are narrowed
+// with the Visible* functions instead.
+type AccessRequest struct {
+	Action       Action
+	EmployeeID   string   // existing employee the action changes
+	DepartmentID string   // department the action targets or moves into
+	TeamIDs      []string // teams the action targets or moves into
+	Roles        []string // IAM roles the action grants
+	RoleGroups   []string // iamRoles group keys the roles are granted under
+}
+
+// Authorize returns ErrForbidden unless caller may perform the request.
+// Callers whose role requires MFA are refused everything until they enrolled.
+func (c *Controller) Authorize(caller *sharedpackage.Employee, req AccessRequest) error {
+	if MFARequired(caller) && !caller.MFAEnabled {
+		log.Printf("WARN: %s (%s) must enroll in MFA before %s", caller.ID, caller.Role, req.Action)
+		return fmt.Errorf("%w: %w", ErrForbidden, ErrMFAEnrollmentRequired)
+	}
+
+	allowed, err := c.allowed(caller, req)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		log.Printf("WARN: %s (%s) may not %s %+v", caller.ID, caller.Role, req.Action, req)
+		return fmt.Errorf("%w: %s may not %s", ErrForbidden, callerRole(caller), req.Action)
+	}
+	return nil
+}
+
+func (c *Controller) allowed(caller *sharedpackage.Employee, req AccessRequest) (bool, error) {
+	ctx := context.Background()
+
+	switch accessRules[req.Action][callerRole(caller)] {
+	case scopeAll:
+		return true, nil
+
+	case scopeSelf:
+		return req.EmployeeID == "" || req.EmployeeID == caller.ID, nil
+
+	case scopeDepartment:
+		dept := caller.DeptID
+		if dept == "" || (req.DepartmentID != "" && req.DepartmentID != dept) {
+			return false, nil
+		}
+		// New employees and teams must be created inside the department
+		if (req.Action == ActionCreateEmployee || req.Action == ActionCreateTeam) && req.DepartmentID == "" {
+			return false, nil
+		}
+		if req.EmployeeID != "" {
+			employee, ok, err := c.lookupEmployee(ctx, req.EmployeeID)
+			if !ok || employee.DeptID != dept {
+				return false, err
+			}
+		}
+		for _, teamID := range req.TeamIDs {
+			team, ok, err := c.lookupTeam(ctx, teamID)
+			if !ok || team.DepartmentID != dept {
+				return false, err
+			}
+		}
+		// Roles are only granted under the department itself or its teams
+		for _, group := range req.RoleGroups {
+			if group == dept {
+				continue
+			}
+			if !strings.HasPrefix(group, "team_") {
+				return false, nil
+			}
+			team, ok, err := c.lookupTeam(ctx, group)
+			if !ok || team.DepartmentID != dept {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case scopeTeam:
+		// Listings are narrowed by VisibleEmployees and VisibleTeams
+		if req.EmployeeID == "" && len(req.TeamIDs) == 0 {
+			return true, nil
+		}
+		// Changes must name the team they are made through
+		if len(req.TeamIDs) == 0 {
+			return false, nil
+		}
+		var teamRoles []string
+		for _, teamID := range req.TeamIDs {
+			if !contains(caller.TeamIDs, teamID) {
+				return false, nil
+			}
+			team, ok, err := c.lookupTeam(ctx, teamID)
+			if !ok || (req.DepartmentID != "" && team.DepartmentID != req.DepartmentID) {
+				return false, err
+			}
+			teamRoles = append(teamRoles, team.IAMRoles...)
+		}
+		for _, role := range req.Roles {
+			if !contains(teamRoles, role) {
+				return false, nil
+			}
+		}
+		for _, group := range req.RoleGroups {
+			if !contains(req.TeamIDs, group) {
+				return false, nil
+			}
+		}
+		if req.EmployeeID != "" {
+			employee, ok, err := c.lookupEmployee(ctx, req.EmployeeID)
+			if !ok || !sharesTeam(employee.TeamIDs, req.TeamIDs) {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// VisibleEmployees keeps the employees caller may read.
+func (c *Controller) VisibleEmployees(caller *sharedpackage.Employee, employees []sharedpackage.Employee) []sharedpackage.Employee {
+	visible := make([]sharedpackage.Employee, 0, len(employees))
+	for _, employee := range employees {
+		var keep bool
+		switch accessRules[ActionListEmployees][callerRole(caller)] {
+		case scopeAll:
+			keep = true
+		case scopeDepartment:
+			keep = caller.DeptID != "" && employee.DeptID == caller.DeptID
+		case scopeTeam:
+			keep = employee.ID == caller.ID || sharesTeam(employee.TeamIDs, caller.TeamIDs)
+		case scopeSelf:
+			keep = employee.ID == caller.ID
+		}
+		if keep {
+			visible = append(visible, employee)
+		}
+	}
+	return visible
+}
+
+// VisibleTeams keeps the teams caller may read.
+func (c *Controller) VisibleTeams(caller *sharedpackage.Employee, teams []sharedpackage.Team) []sharedpackage.Team {
+	visible := make([]sharedpackage.Team, 0, len(teams))
+	for _, team := range teams {
+		var keep bool
+		switch accessRules[ActionListTeams][callerRole(caller)] {
+		case scopeAll:
+			keep = true
+		case scopeDepartment:
+			keep = caller.DeptID != "" && team.DepartmentID == caller.DeptID
+		case scopeTeam:
+			keep = contains(caller.TeamIDs, team.ID)
+		}
+		if keep {
+			visible = append(visible, team)
+		}
+	}
+	return visible
+}
+
+// VisibleDepartments keeps the departments caller may read.
+func (c *Controller) VisibleDepartments(caller *sharedpackage.Employee, departments []sharedpackage.Department) []sharedpackage.Department {
+	visible := make([]sharedpackage.Department, 0, len(departments))
+	for _, department := range departments {
+		var keep bool
+		switch accessRules[ActionListDepartments][callerRole(caller)] {
+		case scopeAll:
+			keep = true
+		case scopeDepartment:
+			keep = caller.DeptID != "" && department.ID == caller.DeptID
+		}
+		if keep {
+			visible = append(visible, department)
+		}
+	}
+	return visible
+}
+
+// VisibleRoleRequests keeps the role requests caller may read: their own,
+// those routed to them and those in the scope of their job role.
+func (c *Controller) VisibleRoleRequests(caller *sharedpackage.Employee, requests []sharedpackage.RoleRequest) []sharedpackage.RoleRequest {
+	visible := make([]sharedpackage.RoleRequest, 0, len(requests))
+	for _, request := range requests {
+		keep := request.EmployeeID == caller.ID || request.ApproverID == caller.ID
+		switch accessRules[ActionListRoleRequests][callerRole(caller)] {
+		case scopeAll:
+			keep = true
+		case scopeDepartment:
+			keep = keep || (caller.DeptID != "" && request.DepartmentID == caller.DeptID)
+		case scopeTeam:
+			keep = keep || (request.TeamID != "" && contains(caller.TeamIDs, request.TeamID))
+		}
+		if keep {
+			visible = append(visible, request)
+		}
+	}
+	return visible
+}
+
+// VisibleReviewCampaigns keeps the review campaigns caller may read: whole
+// campaigns in the scope of their job role and, of the others, only the
+// items assigned to them.
+func (c *Controller) VisibleReviewCampaigns(caller *sharedpackage.Employee, campaigns []sharedpackage.ReviewCampaign) []sharedpackage.ReviewCampaign {
+	visible := make([]sharedpackage.ReviewCampaign, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		var whole bool
+		switch accessRules[ActionListReviews][callerRole(caller)] {
+		case scopeAll:
+			whole = true
+		case scopeDepartment:
+			whole = caller.DeptID != "" && campaign.DepartmentID == caller.DeptID
+		}
+		if whole {
+			visible = append(visible, campaign)
+			continue
+		}
+
+		var assigned []sharedpackage.ReviewItem
+		for _, item := range campaign.Items {
+			if item.ReviewerID == caller.ID {
+				assigned = append(assigned, item)
+			}
+		}
+		if len(assigned) > 0 {
+			campaign.Items = assigned
+			visible = append(visible, campaign)
+		}
+	}
+	return visible
+}
+
+// callerRole returns the accessRules key for caller.
+func callerRole(caller *sharedpackage.Employee) string {
+	switch caller.Role {
+	case sharedpackage.RoleAdmin, sharedpackage.RoleHOD, sharedpackage.RoleLead:
+		return caller.Role
+	}
+	return employeeRole
+}
+
+// lookupEmployee loads a target employee. A missing employee is refused
+// rather than reported, so callers cannot probe for IDs outside their scope.
+func (c *Controller) lookupEmployee(ctx context.Context, empID string) (*sharedpackage.Employee, bool, error) {
+	employee, err := c.Employees.GetEmployee(ctx, empID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("Error getting document: %w", err)
+	}
+	return employee, true, nil
+}
+
+// lookupTeam loads a target team; a missing team is refused like a missing employee.
+func (c *Controller) lookupTeam(ctx context.Context, teamID string) (*sharedpackage.Team, bool, error) {
+	team, err := c.Teams.GetTeam(ctx, teamID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("Error getting document: %w", err)
+	}
+	return team, true, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// sharesTeam reports whether a and b have a non-empty team ID in common.
+func sharesTeam(a []string, b []string) bool {
+	for _, teamID := range a {
+		if teamID != "" && contains(b, teamID) {
+			return true
+		}
+	}
+	return false
+}
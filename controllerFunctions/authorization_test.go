@@ -0,0 +1,251 @@
+package controllerFunctions
+
+import (
+	"Task_04/sharedpackage"
+	"Task_04/storage"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// wantScopes is the authorization matrix the API promises: every action with
+// the scope each job role may perform it in. Roles missing from an entry are
+// refused. It is kept apart from accessRules so a change to either shows up.
+var wantScopes = map[Action]map[string]scope{
+	ActionAssignRoles:       {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment, sharedpackage.RoleLead: scopeTeam},
+	ActionRemoveRoles:       {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionRemoveMember:      {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionManageCustomRoles: {sharedpackage.RoleAdmin: scopeAll},
+	ActionReadIAM:           {sharedpackage.RoleAdmin: scopeAll},
+	ActionReconcileIAM:      {sharedpackage.RoleAdmin: scopeAll},
+
+	ActionRequestRoles:       {sharedpackage.RoleAdmin: scopeSelf, sharedpackage.RoleHOD: scopeSelf, sharedpackage.RoleLead: scopeSelf, employeeRole: scopeSelf},
+	ActionListRoleRequests:   {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment, sharedpackage.RoleLead: scopeTeam, employeeRole: scopeSelf},
+	ActionDecideRoleRequests: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeSelf, sharedpackage.RoleLead: scopeSelf, employeeRole: scopeSelf},
+	ActionBreakGlass:         {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeSelf, sharedpackage.RoleLead: scopeSelf, employeeRole: scopeSelf},
+	ActionReviewBreakGlass:   {sharedpackage.RoleAdmin: scopeAll},
+	ActionLaunchReview:       {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionListReviews:        {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment, sharedpackage.RoleLead: scopeSelf, employeeRole: scopeSelf},
+	ActionReviewAccess:       {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeSelf, sharedpackage.RoleLead: scopeSelf, employeeRole: scopeSelf},
+
+	ActionCreateDepartment: {sharedpackage.RoleAdmin: scopeAll},
+	ActionUpdateDepartment: {sharedpackage.RoleAdmin: scopeAll},
+	ActionDeleteDepartment: {sharedpackage.RoleAdmin: scopeAll},
+	ActionListDepartments:  {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+
+	ActionCreateEmployee: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionUpdateEmployee: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionDeleteEmployee: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionListEmployees:  {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment, sharedpackage.RoleLead: scopeTeam, employeeRole: scopeSelf},
+	ActionUnlockEmployee: {sharedpackage.RoleAdmin: scopeAll},
+	ActionRevokeSessions: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeSelf, sharedpackage.RoleLead: scopeSelf, employeeRole: scopeSelf},
+	ActionResetMFA:       {sharedpackage.RoleAdmin: scopeAll},
+	ActionInviteEmployee: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+
+	ActionCreateTeam: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionUpdateTeam: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionDeleteTeam: {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment},
+	ActionListTeams:  {sharedpackage.RoleAdmin: scopeAll, sharedpackage.RoleHOD: scopeDepartment, sharedpackage.RoleLead: scopeTeam},
+}
+
+// The organisation the matrix is checked against: dept_1 with team_1 and
+// team_2, and dept_2 with team_3. The HOD heads dept_1 and the Lead leads
+// team_1, whose only IAM role is roles/viewer.
+var (
+	testAdmin    = sharedpackage.Employee{ID: "emp_admin", Role: sharedpackage.RoleAdmin, MFAEnabled: true}
+	testHOD      = sharedpackage.Employee{ID: "emp_hod", Role: sharedpackage.RoleHOD, DeptID: "dept_1", MFAEnabled: true}
+	testLead     = sharedpackage.Employee{ID: "emp_lead", Role: sharedpackage.RoleLead, DeptID: "dept_1", TeamIDs: []string{"team_1"}}
+	testEmployee = sharedpackage.Employee{ID: "emp_member", Role: "Engineer", DeptID: "dept_1", TeamIDs: []string{"team_1"}}
+	testPeer     = sharedpackage.Employee{ID: "emp_peer", Role: "Engineer", DeptID: "dept_1", TeamIDs: []string{"team_2"}}
+	testOutsider = sharedpackage.Employee{ID: "emp_outsider", Role: "Engineer", DeptID: "dept_2", TeamIDs: []string{"team_3"}}
+)
+
+func newAuthorizationController(t *testing.T) *Controller {
+	t.Helper()
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+
+	for _, department := range []sharedpackage.Department{
+		{ID: "dept_1", HeadID: testHOD.ID},
+		{ID: "dept_2"},
+	} {
+		if err := store.PutDepartment(ctx, department.ID, department); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, team := range []sharedpackage.Team{
+		{ID: "team_1", DepartmentID: "dept_1", LeadID: testLead.ID, IAMRoles: []string{"roles/viewer"}},
+		{ID: "team_2", DepartmentID: "dept_1", IAMRoles: []string{"roles/editor"}},
+		{ID: "team_3", DepartmentID: "dept_2", IAMRoles: []string{"roles/viewer"}},
+	} {
+		if err := store.PutTeam(ctx, team.ID, team); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, employee := range []sharedpackage.Employee{testAdmin, testHOD, testLead, testEmployee, testPeer, testOutsider} {
+		if err := store.PutEmployee(ctx, employee.ID, employee); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewController(store, "test-project")
+}
+
+// authorizationCase is one request and the scopes that allow it. Self-scoped
+// actions only ever act on the caller, so they ignore department and team
+// targets and check the employee alone.
+type authorizationCase struct {
+	name                   string
+	req                    AccessRequest
+	department, team, self bool
+}
+
+// scopeCases returns requests inside and outside the scopes of caller.
+func scopeCases(action Action, caller sharedpackage.Employee) []authorizationCase {
+	isMember := caller.ID == testEmployee.ID
+	return []authorizationCase{
+		{"listing", AccessRequest{Action: action}, caller.DeptID != "", true, true},
+		{"own record", AccessRequest{Action: action, EmployeeID: caller.ID, DepartmentID: caller.DeptID, TeamIDs: caller.TeamIDs}, caller.DeptID != "", len(caller.TeamIDs) > 0, true},
+
+		// Department
+		{"employee of dept_1", AccessRequest{Action: action, EmployeeID: testPeer.ID, DepartmentID: "dept_1"}, true, false, false},
+		{"team of dept_1", AccessRequest{Action: action, DepartmentID: "dept_1", TeamIDs: []string{"team_2"}}, true, false, true},
+		{"dept_2", AccessRequest{Action: action, DepartmentID: "dept_2"}, false, true, true},
+		{"employee of dept_2", AccessRequest{Action: action, EmployeeID: testOutsider.ID, DepartmentID: "dept_1"}, false, false, false},
+		{"team of dept_2", AccessRequest{Action: action, DepartmentID: "dept_1", TeamIDs: []string{"team_3"}}, false, false, true},
+		{"unknown employee", AccessRequest{Action: action, EmployeeID: "emp_missing", DepartmentID: "dept_1"}, false, false, false},
+
+		// Team
+		{"team_1 member with a team_1 role", AccessRequest{Action: action, EmployeeID: testEmployee.ID, TeamIDs: []string{"team_1"}, Roles: []string{"roles/viewer"}}, true, true, isMember},
+		{"team_1 member with a role team_1 lacks", AccessRequest{Action: action, EmployeeID: testEmployee.ID, TeamIDs: []string{"team_1"}, Roles: []string{"roles/owner"}}, true, false, isMember},
+		{"team_1 member without naming the team", AccessRequest{Action: action, EmployeeID: testEmployee.ID}, true, false, isMember},
+		{"team_2 member through team_1", AccessRequest{Action: action, EmployeeID: testPeer.ID, TeamIDs: []string{"team_1"}, Roles: []string{"roles/viewer"}}, true, false, false},
+		{"team the caller is not in", AccessRequest{Action: action, TeamIDs: []string{"team_2"}, Roles: []string{"roles/editor"}}, true, false, true},
+		{"team_1 as a team of dept_2", AccessRequest{Action: action, DepartmentID: "dept_2", TeamIDs: []string{"team_1"}}, false, false, true},
+	}
+}
+
+// allowedIn reports whether the case must be allowed for a caller granted scope.
+func (tc authorizationCase) allowedIn(action Action, granted scope) bool {
+	switch granted {
+	case scopeAll:
+		return true
+	case scopeDepartment:
+		// Creations inside a department must name it
+		if (action == ActionCreateEmployee || action == ActionCreateTeam) && tc.req.DepartmentID == "" {
+			return false
+		}
+		return tc.department
+	case scopeTeam:
+		return tc.team
+	case scopeSelf:
+		return tc.self
+	}
+	return false
+}
+
+func TestAuthorizeMatrix(t *testing.T) {
+	c := newAuthorizationController(t)
+
+	for action := range accessRules {
+		if _, ok := wantScopes[action]; !ok {
+			t.Errorf("accessRules has %s, which the matrix does not cover", action)
+		}
+	}
+
+	callers := map[string]sharedpackage.Employee{
+		sharedpackage.RoleAdmin: testAdmin,
+		sharedpackage.RoleHOD:   testHOD,
+		sharedpackage.RoleLead:  testLead,
+		employeeRole:            testEmployee,
+	}
+	for action, scopes := range wantScopes {
+		for role, caller := range callers {
+			granted := scopes[role]
+			if got := accessRules[action][role]; got != granted {
+				t.Errorf("accessRules[%s][%q] = %d, want %d", action, role, got, granted)
+			}
+
+			for _, tc := range scopeCases(action, caller) {
+				allowed := tc.allowedIn(action, granted)
+				t.Run(fmt.Sprintf("%s/%s/%s", action, caller.ID, tc.name), func(t *testing.T) {
+					err := c.Authorize(&caller, tc.req)
+					if allowed && err != nil {
+						t.Errorf("Authorize(%+v) = %v, want allowed", tc.req, err)
+					}
+					if !allowed && !errors.Is(err, ErrForbidden) {
+						t.Errorf("Authorize(%+v) = %v, want ErrForbidden", tc.req, err)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestAuthorizeSpecialCases(t *testing.T) {
+	c := newAuthorizationController(t)
+
+	cases := []struct {
+		name    string
+		caller  sharedpackage.Employee
+		req     AccessRequest
+		allowed bool
+	}{
+		{"HOD creates an employee in their department", testHOD, AccessRequest{Action: ActionCreateEmployee, DepartmentID: "dept_1"}, true},
+		{"HOD creates an employee without a department", testHOD, AccessRequest{Action: ActionCreateEmployee}, false},
+		{"HOD creates a team without a department", testHOD, AccessRequest{Action: ActionCreateTeam}, false},
+		{"HOD without a department", sharedpackage.Employee{ID: "emp_hod2", Role: sharedpackage.RoleHOD, MFAEnabled: true}, AccessRequest{Action: ActionListEmployees}, false},
+		{"Lead lists employees", testLead, AccessRequest{Action: ActionListEmployees}, true},
+		{"Lead assigns roles of two of their teams", sharedpackage.Employee{ID: testLead.ID, Role: sharedpackage.RoleLead, DeptID: "dept_1", TeamIDs: []string{"team_1", "team_2"}},
+			AccessRequest{Action: ActionAssignRoles, EmployeeID: testPeer.ID, TeamIDs: []string{"team_1", "team_2"}, Roles: []string{"roles/viewer", "roles/editor"}}, true},
+		{"Lead assigns roles to an unknown employee", testLead, AccessRequest{Action: ActionAssignRoles, EmployeeID: "emp_missing", TeamIDs: []string{"team_1"}}, false},
+		{"Lead assigns roles through an unknown team", sharedpackage.Employee{ID: testLead.ID, Role: sharedpackage.RoleLead, TeamIDs: []string{"team_9"}},
+			AccessRequest{Action: ActionAssignRoles, TeamIDs: []string{"team_9"}}, false},
+		{"HOD grants roles under their department and its teams", testHOD,
+			AccessRequest{Action: ActionUpdateEmployee, EmployeeID: testEmployee.ID, TeamIDs: []string{"team_1"}, RoleGroups: []string{"dept_1", "team_2"}}, true},
+		{"HOD grants roles under a team of another department", testHOD,
+			AccessRequest{Action: ActionUpdateEmployee, EmployeeID: testEmployee.ID, TeamIDs: []string{"team_1"}, RoleGroups: []string{"team_3"}}, false},
+		{"HOD grants roles under another department", testHOD,
+			AccessRequest{Action: ActionUpdateEmployee, EmployeeID: testEmployee.ID, TeamIDs: []string{"team_1"}, RoleGroups: []string{"dept_2"}}, false},
+		{"HOD grants roles under the default project", testHOD,
+			AccessRequest{Action: ActionUpdateEmployee, EmployeeID: testEmployee.ID, TeamIDs: []string{"team_1"}, RoleGroups: []string{"0"}}, false},
+		{"Lead grants roles under a team they did not name", testLead,
+			AccessRequest{Action: ActionAssignRoles, EmployeeID: testEmployee.ID, TeamIDs: []string{"team_1"}, Roles: []string{"roles/viewer"}, RoleGroups: []string{"team_2"}}, false},
+		{"employee with an unknown job role is a plain employee", sharedpackage.Employee{ID: "emp_x", Role: "Manager"}, AccessRequest{Action: ActionCreateTeam}, false},
+		{"unknown action", testAdmin, AccessRequest{Action: "launchRockets"}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := c.Authorize(&tc.caller, tc.req)
+			if tc.allowed && err != nil {
+				t.Errorf("Authorize = %v, want allowed", err)
+			}
+			if !tc.allowed && !errors.Is(err, ErrForbidden) {
+				t.Errorf("Authorize = %v, want ErrForbidden", err)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRequiresMFAEnrollment(t *testing.T) {
+	c := newAuthorizationController(t)
+
+	for _, role := range []string{sharedpackage.RoleAdmin, sharedpackage.RoleHOD} {
+		caller := sharedpackage.Employee{ID: "emp_new", Role: role, DeptID: "dept_1"}
+		err := c.Authorize(&caller, AccessRequest{Action: ActionListEmployees})
+		if !errors.Is(err, ErrForbidden) || !errors.Is(err, ErrMFAEnrollmentRequired) {
+			t.Errorf("%s without MFA: Authorize = %v, want ErrForbidden and ErrMFAEnrollmentRequired", role, err)
+		}
+
+		caller.MFAEnabled = true
+		if err := c.Authorize(&caller, AccessRequest{Action: ActionListEmployees}); err != nil {
+			t.Errorf("%s with MFA: Authorize = %v, want allowed", role, err)
+		}
+	}
+
+	// Roles MFA is not required for are not held up
+	lead := testLead
+	if err := c.Authorize(&lead, AccessRequest{Action: ActionListEmployees}); err != nil {
+		t.Errorf("Lead without MFA: Authorize = %v, want allowed", err)
+	}
+}
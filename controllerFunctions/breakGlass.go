@@ -0,0 +1,206 @@
+package controllerFunctions
+
+import (
+	"Task_04/notifier"
+	"Task_04/sharedpackage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Break-glass errors.
+var (
+	ErrInvalidBreakGlass    = errors.New("invalid break-glass request")
+	ErrBreakGlassReviewDone = errors.New("break-glass review already closed")
+)
+
+// BreakGlassRules is an emergency access policy.
+type BreakGlassRules struct {
+	// Roles are granted by every break-glass grant; none turns it off.
+	Roles []string
+	// OnCallTeam is the team whose members may break glass and which the
+	// roles are granted through.
+	OnCallTeam string
+	// MaxDuration caps how long a grant lasts.
+	MaxDuration time.Duration
+}
+
+// BreakGlassPolicy is the emergency access policy in force.
+var BreakGlassPolicy = BreakGlassRules{MaxDuration: time.Hour}
+
+// BreakGlass grants the break-glass roles to an on-call employee at once,
+// without approval, for duration capped at BreakGlassPolicy.MaxDuration; zero
+// means the cap. The grant is recorded and announced to the Admins, and its
+// review stays open until an Admin closes it.
+func (c *Controller) BreakGlass(caller *sharedpackage.Employee, empID string, justification string, duration time.Duration) (*sharedpackage.BreakGlassGrant, error) {
+	ctx := context.Background()
+	policy := BreakGlassPolicy
+
+	// Step 1: Check the policy and the request
+	if len(policy.Roles) == 0 || policy.OnCallTeam == "" {
+		return nil, fmt.Errorf("%w: break-glass access is not configured", ErrForbidden)
+	}
+	justification = strings.TrimSpace(justification)
+	if justification == "" {
+		return nil, fmt.Errorf("%w: a justification is required", ErrInvalidBreakGlass)
+	}
+	if duration < 0 {
+		return nil, fmt.Errorf("%w: duration %s is negative", ErrInvalidBreakGlass, duration)
+	}
+	if duration == 0 || duration > policy.MaxDuration {
+		if duration > policy.MaxDuration {
+			log.Printf("WARN: Break-glass duration %s capped at %s", duration, policy.MaxDuration)
+		}
+		duration = policy.MaxDuration
+	}
+	if empID == "" {
+		empID = caller.ID
+	}
+
+	// Step 2: Only members of the on-call team may be granted access
+	employee, err := c.getEmployee(ctx, empID)
+	if err != nil {
+		return nil, err
+	}
+	team, err := c.Teams.GetTeam(ctx, policy.OnCallTeam)
+	if err != nil {
+		if isNotFound(err) {
+			log.Printf("ERROR: On-call team %s does not exist", policy.OnCallTeam)
+			return nil, fmt.Errorf("On-call team %s does not exist: %w", policy.OnCallTeam, err)
+		}
+		log.Printf("ERROR: Error getting document: %v", err)
+		return nil, fmt.Errorf("Error getting document: %w", err)
+	}
+	if !contains(employee.TeamIDs, team.ID) {
+		log.Printf("WARN: %s tried to break glass for %s, who is not on call", caller.ID, empID)
+		return nil, fmt.Errorf("%w: %s is not a member of the on-call team %s", ErrForbidden, empID, team.ID)
+	}
+
+	// Step 3: Record the grant before making it, so none goes unreviewed
+	now := time.Now().UTC()
+	grant := sharedpackage.BreakGlassGrant{
+		EmployeeID:    empID,
+		GrantedBy:     caller.ID,
+		Roles:         append([]string(nil), policy.Roles...),
+		TeamID:        team.ID,
+		Justification: justification,
+		GrantedAt:     now,
+		ExpiresAt:     now.Add(duration).Truncate(time.Second),
+		Review:        sharedpackage.BreakGlassReview{Status: sharedpackage.ReviewOpen},
+	}
+	grant.ID, err = c.BreakGlassGrants.NextBreakGlassGrantID(ctx)
+	if err != nil {
+		log.Printf("ERROR: Failed to generate break-glass grant ID: %v", err)
+		return nil, fmt.Errorf("Failed to generate break-glass grant ID: %w", err)
+	}
+	if err := c.BreakGlassGrants.CreateBreakGlassGrant(ctx, grant); err != nil {
+		log.Printf("ERROR: Failed to record break-glass grant: %v", err)
+		return nil, fmt.Errorf("Failed to record break-glass grant: %w", err)
+	}
+
+	// Step 4: Grant the roles; a failed grant closes its own review
+	expiresAt := grant.ExpiresAt
+	if _, err := c.AssignIAMRole(team.DepartmentID, team.ID, empID, grant.Roles, employee.Role, &sharedpackage.RoleGrant{ExpiresAt: &expiresAt}); err != nil {
+		log.Printf("ERROR: Break-glass grant %s for %s failed: %v", grant.ID, empID, err)
+		closedAt := time.Now().UTC()
+		review := sharedpackage.BreakGlassReview{Status: sharedpackage.ReviewClosed, ClosedAt: &closedAt, Notes: "Not granted: " + err.Error()}
+		if _, closeErr := c.BreakGlassGrants.CloseBreakGlassReview(ctx, grant.ID, review); closeErr != nil {
+			log.Printf("ERROR: Failed to close review of failed break-glass grant %s: %v", grant.ID, closeErr)
+		}
+		return nil, err
+	}
+
+	// Step 5: Make sure it is noticed
+	log.Printf("WARN: BREAK-GLASS %s: %s granted %v to %s through %s until %s. Justification: %q",
+		grant.ID, caller.ID, grant.Roles, empID, team.ID, grant.ExpiresAt.Format(time.RFC3339), justification)
+	c.notifyAdmins(ctx, notifier.Message{
+		Subject: fmt.Sprintf("BREAK-GLASS %s: emergency access granted to %s", grant.ID, empID),
+		Body: fmt.Sprintf("%s %s (%s) was granted %s through %s without approval, until %s.\n\n"+
+			"Granted by: %s\nJustification: %s\n\nClose the review at %s/breakGlass/%s once the incident has been reviewed.\n",
+			employee.FirstName, employee.LastName, empID, strings.Join(grant.Roles, ", "), team.ID,
+			grant.ExpiresAt.Format(time.RFC3339), caller.ID, justification, c.PublicURL, grant.ID),
+	})
+	return &grant, nil
+}
+
+// ListBreakGlassGrants returns the break-glass grants, oldest first. A
+// non-empty status keeps only the grants whose review is in that state.
+func (c *Controller) ListBreakGlassGrants(status string) ([]sharedpackage.BreakGlassGrant, error) {
+	grants, err := c.BreakGlassGrants.ListBreakGlassGrants(context.Background())
+	if err != nil {
+		log.Printf("ERROR: Failed to list break-glass grants: %v", err)
+		return nil, fmt.Errorf("Failed to list break-glass grants: %w", err)
+	}
+
+	filtered := make([]sharedpackage.BreakGlassGrant, 0, len(grants))
+	for _, grant := range grants {
+		if status == "" || grant.Review.Status == status {
+			filtered = append(filtered, grant)
+		}
+	}
+	return filtered, nil
+}
+
+// GetBreakGlassGrant returns a break-glass grant.
+func (c *Controller) GetBreakGlassGrant(grantID string) (*sharedpackage.BreakGlassGrant, error) {
+	grant, err := c.BreakGlassGrants.GetBreakGlassGrant(context.Background(), grantID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, notFound("Break-glass grant with ID %s not found", grantID)
+		}
+		log.Printf("ERROR: Failed to get break-glass grant: %v", err)
+		return nil, fmt.Errorf("Failed to get break-glass grant: %w", err)
+	}
+	return grant, nil
+}
+
+// CloseBreakGlassReview closes the review of a break-glass grant with the
+// reviewer's notes. No one may close the review of their own grant.
+func (c *Controller) CloseBreakGlassReview(caller *sharedpackage.Employee, grantID string, notes string) (*sharedpackage.BreakGlassGrant, error) {
+	ctx := context.Background()
+
+	notes = strings.TrimSpace(notes)
+	if notes == "" {
+		return nil, fmt.Errorf("%w: review notes are required", ErrInvalidBreakGlass)
+	}
+	grant, err := c.GetBreakGlassGrant(grantID)
+	if err != nil {
+		return nil, err
+	}
+	if grant.EmployeeID == caller.ID || grant.GrantedBy == caller.ID {
+		return nil, fmt.Errorf("%w: %s may not review break-glass grant %s they took part in", ErrForbidden, caller.ID, grantID)
+	}
+
+	closedAt := time.Now().UTC()
+	review := sharedpackage.BreakGlassReview{Status: sharedpackage.ReviewClosed, ClosedBy: caller.ID, ClosedAt: &closedAt, Notes: notes}
+	closed, err := c.BreakGlassGrants.CloseBreakGlassReview(ctx, grantID, review)
+	if err != nil {
+		log.Printf("ERROR: Failed to close break-glass review %s: %v", grantID, err)
+		return nil, fmt.Errorf("Failed to close break-glass review: %w", err)
+	}
+	if !closed {
+		return nil, fmt.Errorf("%w: %s", ErrBreakGlassReviewDone, grantID)
+	}
+	grant.Review = review
+	log.Printf("INFO: %s closed the review of break-glass grant %s", caller.ID, grantID)
+	return grant, nil
+}
+
+// notifyAdmins sends msg to every Admin with a mail address. Failures are
+// logged by notify and do not stop the others.
+func (c *Controller) notifyAdmins(ctx context.Context, msg notifier.Message) {
+	employees, err := c.Employees.ListEmployees(ctx)
+	if err != nil {
+		log.Printf("ERROR: Cannot notify Admins of %q: %v", msg.Subject, err)
+		return
+	}
+	for _, employee := range employees {
+		if employee.Role == sharedpackage.RoleAdmin && employee.Email != "" {
+			msg.To = employee.Email
+			c.notify(ctx, msg)
+		}
+	}
+}
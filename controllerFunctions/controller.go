@@ -0,0 +1,112 @@
+package controllerFunctions
+
+import (
+	"Task_04/config"
+	"Task_04/notifier"
+	"Task_04/reconciler"
+	"Task_04/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Controller applies the employee, department and team business rules on top
+// of the injected storage backends.
+type Controller struct {
+	Employees   storage.EmployeeStore
+	Departments storage.DepartmentStore
+	Teams       storage.TeamStore
+	Operations  storage.OperationStore
+	// RefreshTokens keeps the refresh tokens of employee sessions.
+	RefreshTokens storage.RefreshTokenStore
+	// PasswordTokens keeps the tokens of password invites and resets.
+	PasswordTokens storage.PasswordTokenStore
+	// RoleRequests keeps the employees' requests for IAM roles.
+	RoleRequests storage.RoleRequestStore
+	// BreakGlassGrants keeps the emergency access grants and their reviews.
+	BreakGlassGrants storage.BreakGlassStore
+	// ReviewCampaigns keeps the access recertification campaigns.
+	ReviewCampaigns storage.ReviewCampaignStore
+
+	// Notifier delivers invites and password resets to employees, which
+	// point them at PublicURL.
+	Notifier  notifier.Notifier
+	PublicURL string
+
+	// Outbox applies the IAM operations recorded in Operations.
+	Outbox *reconciler.Worker
+
+	// ProjectID is the GCP project IAM roles are granted on.
+	ProjectID string
+}
+
+// NewController returns a Controller that keeps all documents in store.
+func NewController(store storage.Store, projectID string) *Controller {
+	return &Controller{
+		Employees:        store,
+		Departments:      store,
+		Teams:            store,
+		Operations:       store,
+		RefreshTokens:    store,
+		PasswordTokens:   store,
+		RoleRequests:     store,
+		BreakGlassGrants: store,
+		ReviewCampaigns:  store,
+		Outbox:           reconciler.NewWorker(store),
+		ProjectID:        projectID,
+	}
+}
+
+// InitializeStore returns a Controller backed by the configured storage
+// backend: "firestore" for the project's Firestore database, "memory" for a
+// process-local store that needs no GCP credentials, or "postgres" / "sqlite3"
+// for a SQL database reached through the DSN.
+func InitializeStore(cfg *config.Config) (*Controller, error) {
+	var store storage.Store
+	switch cfg.Storage.Backend {
+	case "", "firestore":
+		firestoreStore, err := storage.NewFirestoreStore(context.Background(), cfg.ProjectID, cfg.Storage.Collections)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			return nil, err
+		}
+		store = firestoreStore
+	case "memory":
+		log.Println("INFO: Using in-memory store; data is lost when the server stops.")
+		store = storage.NewMemoryStore()
+	case "postgres", "sqlite3":
+		sqlStore, err := storage.OpenSQLStore(context.Background(), cfg.Storage.Backend, cfg.Storage.DSN)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			return nil, err
+		}
+		store = sqlStore
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+
+	c := NewController(store, cfg.ProjectID)
+	c.PublicURL = cfg.Notifier.PublicURL
+	return c, nil
+}
+
+// isNotFound reports whether err means the requested document does not exist.
+func isNotFound(err error) bool {
+	return errors.Is(err, storage.ErrNotFound)
+}
+
+// notFoundError is a controller message for a missing document that still
+// matches storage.ErrNotFound, so handlers can answer 404.
+type notFoundError struct {
+	message string
+}
+
+func (e *notFoundError) Error() string { return e.message }
+
+func (e *notFoundError) Unwrap() error { return storage.ErrNotFound }
+
+// notFound formats a notFoundError.
+func notFound(format string, args ...interface{}) error {
+	return &notFoundError{message: fmt.Sprintf(format, args...)}
+}
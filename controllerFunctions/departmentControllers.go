@@ -1,186 +1,132 @@
 package controllerFunctions
 
 import (
+	"Task_04/iamRole"
 	"Task_04/sharedpackage"
 	"context"
 	"fmt"
 	"log"
-	"strconv"
 	"strings"
 	"time"
-
-	"cloud.google.com/go/firestore"
-	"google.golang.org/api/iterator"
 )
 
-// generateIncrementingDocID generates an incrementing document ID for the given collection.
-func generateIncrementingDocID(collection *firestore.CollectionRef) (string, error) {
-	// Query the collection to find the highest existing document ID
-	iter := collection.Documents(context.Background())
-	defer iter.Stop()
-
-	existingIDs := make(map[string]bool)
-	highestID := 0
-
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return "", err
-		}
-
-		// Extract the numeric part of the document ID
-		idStr := doc.Ref.ID[len("dept_"):]
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			continue // Ignore non-numeric IDs
-		}
-
-		// Update the highestID if the current ID is greater
-		if id > highestID {
-			highestID = id
-		}
-
-		// Store existing IDs in a map
-		existingIDs[doc.Ref.ID] = true
+// AddDepartment stores a new department, makes headID its HOD and assigns the
+// department roles in the department's projects, or the default project if
+// projectIDs is empty. The head must already have an employee document.
+func (c *Controller) AddDepartment(departmentName string, roles []string, headID string, projectIDs []string) (*sharedpackage.Department, error) {
+	ctx := context.Background()
+	if err := validateProjects(projectIDs); err != nil {
+		return nil, err
 	}
-
-	// Generate a new incrementing document ID
-	for {
-		newID := highestID + 1
-		newIDStr := fmt.Sprintf("dept_%d", newID)
-
-		// Check if the generated ID already exists
-		if !existingIDs[newIDStr] {
-			return newIDStr, nil
+	for _, role := range roles {
+		if err := iamRole.ValidateRole(role); err != nil {
+			log.Printf("ERROR: %v", err)
+			return nil, err
 		}
-
-		highestID++
 	}
 
-	// This should not be reached
-}
+	// An unknown head is refused before anything is stored
+	employee, err := c.getEmployee(ctx, headID)
+	if err != nil {
+		return nil, err
+	}
 
-// AddDepartment adds a new department document to the Firestore "departments" collection.
-func AddDepartment(departmentName string, roles []string, headID string) (map[string]interface{}, error) {
-	ctx := context.Background()
 	currentTime := time.Now()
 	formattedTime := currentTime.Format("Mon, 02 Jan 2006 15:04:05 MST")
-	// Check if Firestore client is initialized
-	if FirestoreClient == nil {
-		log.Println("ERROR: Firestore client not initialized")
-		return nil, fmt.Errorf("Firestore client not initialized")
-	}
-
-	// Specify the path to the "departments" collection
-	departmentsCollection := FirestoreClient.Collection("departments")
-	employeeCollection := FirestoreClient.Collection("employees")
 
 	// Generate an incrementing document ID
-	newDocID, err := generateIncrementingDocID(departmentsCollection)
+	newDocID, err := c.Departments.NextDepartmentID(ctx)
 	if err != nil {
 		log.Printf("ERROR: Unable to generate a unique document ID: %v", err)
-		return nil, fmt.Errorf("Unable to generate a unique document ID: %v", err)
+		return nil, fmt.Errorf("Unable to generate a unique document ID: %w", err)
 	}
 
-	// Create a map representing the department data
-	departmentData := map[string]interface{}{
-		"departmentName": departmentName,
-		"iamRoles":       roles,
-		"headID":         headID,
-		"createdTime":    formattedTime,
-		"updatedTime":    "",
+	department := sharedpackage.Department{
+		DepartmentName: departmentName,
+		IAMRoles:       roles,
+		HeadID:         headID,
+		CreatedTime:    formattedTime,
+		UpdatedTime:    "",
+		ProjectIDs:     projectIDs,
 	}
 
 	// Add the department data to the "departments" collection with the generated document ID
-	_, err = departmentsCollection.Doc(newDocID).Set(ctx, departmentData)
-	if err != nil {
+	if err := c.Departments.PutDepartment(ctx, newDocID, department); err != nil {
 		log.Printf("ERROR: Failed to add department document: %v", err)
-		return nil, fmt.Errorf("Failed to add department document: %v", err)
+		return nil, fmt.Errorf("Failed to add department document: %w", err)
 	}
 
-	AssignIAMRole(newDocID, "", headID, roles, "HOD")
-
-	// Set the document data for the employee with merge
-	_, err = employeeCollection.Doc(headID).Set(ctx, map[string]interface{}{
-		"role":         "HOD",
-		"departmentID": newDocID,
-		"teamIDs":      []string{},
-	}, firestore.MergeAll)
-
+	// Make the employee HOD with the department roles, stored together with the IAM operations granting them
+	resolver := c.newProjectResolver()
+	previous, err := resolver.projectRoles(ctx, employee)
 	if err != nil {
-		log.Printf("ERROR: Failed to set employee document data: %v", err)
-		return nil, fmt.Errorf("Failed to set employee document data: %v", err)
+		return nil, err
 	}
-
-	log.Printf("INFO: Department document with ID %s and employee document updated successfully", newDocID)
-
-	// Retrieve and return the department document data
-	docSnapshot, err := departmentsCollection.Doc(newDocID).Get(ctx)
+	employee.Role = "HOD"
+	employee.DeptID = newDocID
+	employee.TeamIDs = []string{}
+	if employee.IAMRoles == nil {
+		employee.IAMRoles = make(map[string][]string)
+	}
+	employee.IAMRoles[newDocID] = dedupe(roles)
+	deltas, err := resolver.rebindDeltas(ctx, employee.Email, employee, previous)
 	if err != nil {
-		log.Printf("ERROR: Failed to retrieve department document: %v", err)
-		return nil, fmt.Errorf("Failed to retrieve department document: %v", err)
+		return nil, err
 	}
-
-	// Check if the document exists
-	if !docSnapshot.Exists() {
-		log.Printf("ERROR: Document with ID %s does not exist", newDocID)
-		return nil, fmt.Errorf("Document with ID %s does not exist", newDocID)
+	if err := c.putEmployeeWithBindings(ctx, headID, *employee, deltas); err != nil {
+		log.Printf("ERROR: Failed to set employee document data: %v", err)
+		return nil, fmt.Errorf("Failed to set employee document data: %w", err)
 	}
+	c.Outbox.Notify()
 
-	// Get the document data
-	documentData := docSnapshot.Data()
+	log.Printf("INFO: Department document with ID %s and employee document updated successfully", newDocID)
 
-	log.Printf("INFO: Retrieved department document with ID: %s", newDocID)
-	return documentData, nil
+	department.ID = newDocID
+	return &department, nil
 }
 
-func deleteTeams(deptID string) error {
+// deleteTeams deletes every team of the department and strips its lead.
+func (c *Controller) deleteTeams(deptID string) error {
 	ctx := context.Background()
-	teamCollection := FirestoreClient.Collection("teams")
-
-	// Step 1: Create a query to get all documents in the teams collection where deptID matches
-	teamQuery := teamCollection.Where("departmentID", "==", deptID)
 
-	// Step 2: Get all team documents
-	teamDocs, err := teamQuery.Documents(ctx).GetAll()
+	// Step 1: Get all teams where deptID matches
+	teams, err := c.Teams.FindTeamsByDepartment(ctx, deptID)
 	if err != nil {
 		log.Printf("ERROR: Failed to get team documents: %v", err)
-		return fmt.Errorf("Failed to get team documents: %v", err)
+		return fmt.Errorf("Failed to get team documents: %w", err)
 	}
 
-	// Step 3: Loop through the team documents
-	for _, teamDoc := range teamDocs {
-		// Step 4: Extract the leadID field from the team document
-		leadID, ok := teamDoc.Data()["leadID"].(string)
-		if !ok {
-			log.Printf("ERROR: Field 'leadID' not found or not a string in team document with ID: %s", teamDoc.Ref.ID)
-			// Continue to the next team document if leadID is not found or not a string
-			continue
+	// Step 2: Loop through the teams
+	for _, team := range teams {
+		leadID := team.LeadID
+
+		// Step 3: Remove function for specific logic with leadID; a team may have no lead
+		if leadID != "" {
+			if err := c.removeMember(leadID); err != nil {
+				log.Printf("ERROR: Failed to remove employee with leadID %s: %v", leadID, err)
+				// Handle the error as needed, e.g., log or return an error
+				continue
+			}
 		}
 
-		// Step 5: Remove function for specific logic with leadID
-		err := RemoveMember(leadID)
-		if err != nil {
-			log.Printf("ERROR: Failed to remove employee with leadID %s: %v", leadID, err)
-			// Handle the error as needed, e.g., log or return an error
+		// Step 4: Detach the members and revoke the roles held through the team
+		if err := c.detachGroup(ctx, team.ID); err != nil {
+			log.Printf("ERROR: Failed to detach employees of team %s: %v", team.ID, err)
 			continue
 		}
 
-		// Step 6: Delete the team document
-		if _, err := teamDoc.Ref.Delete(ctx); err != nil {
-			log.Printf("ERROR: Failed to delete team document with ID %s: %v", teamDoc.Ref.ID, err)
+		// Step 5: Delete the team document
+		if err := c.Teams.DeleteTeam(ctx, team.ID); err != nil {
+			log.Printf("ERROR: Failed to delete team document with ID %s: %v", team.ID, err)
 			// Handle the error as needed, e.g., log or return an error
 			continue
 		}
 
-		// Step 7: Print a success message for the deleted team document and removed employee
-		fmt.Printf("Deleted team document with ID: %s, and removed employee with leadID: %s\n", teamDoc.Ref.ID, leadID)
+		// Step 6: Print a success message for the deleted team document and removed employee
+		fmt.Printf("Deleted team document with ID: %s, and removed employee with leadID: %s\n", team.ID, leadID)
 	}
 
-	// Step 8: Return nil if the function completes without errors
+	// Step 7: Return nil if the function completes without errors
 	return nil
 }
 
@@ -203,261 +149,269 @@ func removeElement(slice []string, elementToRemove string) []string {
 	return slice
 }
 
-func removeEmployees(deptID string, headID string) error {
-
+// removeEmployees strips the head and detaches the members of a department or team.
+func (c *Controller) removeEmployees(deptID string, headID string) error {
 	ctx := context.Background()
-	employeeCollection1 := FirestoreClient.Collection("employees")
-	var employeeQuery firestore.Query
+
 	// Check if deptID is a departmentID or teamID
-	if strings.HasPrefix(deptID, "dept_") {
-		// Step 1: Create a query to get all documents in the employees collection where deptID matches
-		employeeQuery = employeeCollection1.Where("departmentID", "==", deptID)
-	} else if strings.HasPrefix(deptID, "team_") {
-		// Step 1: Create a query to get all documents in the employees collection where deptID matches
-		employeeQuery = employeeCollection1.Where("teamIDs", "array-contains", deptID)
-	} else {
+	if !strings.HasPrefix(deptID, "dept_") && !strings.HasPrefix(deptID, "team_") {
 		// Handle invalid deptID
 		return fmt.Errorf("Invalid deptID: %s", deptID)
 	}
 
-	// Step 2: Remove function for specific logic with headID
-	if err := RemoveMember(headID); err != nil {
+	// Step 1: Remove function for specific logic with headID
+	if err := c.removeMember(headID); err != nil {
 		log.Printf("ERROR: Failed to remove employee with leadID %s: %v", headID, err)
 		// Handle the error as needed, e.g., log or return an error
-		return fmt.Errorf("Failed to remove employee with leadID %s: %v", headID, err)
+		return fmt.Errorf("Failed to remove employee with leadID %s: %w", headID, err)
 	}
 	log.Printf("INFO: Removed employee successfully with leadID: %s", headID)
 
-	// Step 3: Get all employee documents
-	employeeDocs, err := employeeQuery.Documents(ctx).GetAll()
-	if err != nil {
-		log.Fatalf("ERROR: Failed to get employee documents: %v", err)
-		return fmt.Errorf("Failed to get employee documents: %v", err)
+	// Step 2: Detach the members and revoke the roles held through the department or team
+	if err := c.detachGroup(ctx, deptID); err != nil {
+		log.Printf("ERROR: Failed to detach employees of %s: %v", deptID, err)
+		return fmt.Errorf("Failed to detach employees of %s: %w", deptID, err)
 	}
 
-	// Step 4: Loop through the employee documents
-	for _, employeeDoc := range employeeDocs {
-		var employee sharedpackage.Employee
+	// Step 3: Return nil if the function completes without errors
+	return nil
+}
 
-		// Convert Firestore document data to the Employee struct
-		if err := employeeDoc.DataTo(&employee); err != nil {
-			log.Printf("ERROR: Error converting document data: %v", err)
-			return fmt.Errorf("Error converting document data: %v", err)
-		}
+// detachGroup takes every employee off the department or team group: members
+// lose it and their job role, and everyone holding roles through it loses
+// those roles. Each employee is written once, together with the IAM
+// operations moving its bindings to the roles it keeps.
+func (c *Controller) detachGroup(ctx context.Context, group string) error {
+	employees, err := c.Employees.ListEmployees(ctx)
+	if err != nil {
+		log.Printf("ERROR: Failed to get employee documents: %v", err)
+		return fmt.Errorf("Failed to get employee documents: %w", err)
+	}
 
-		if strings.HasPrefix(deptID, "dept_") {
-			// Step 5: Create a map with the modified fields
-			updateData := map[string]interface{}{
-				"departmentID": "",         // Set departmentID to an empty string
-				"teamIDs":      []string{}, // Set teamID to an empty slice
-				"role":         "",
+	resolver := c.newProjectResolver()
+	for _, employee := range employees {
+		if !inGroup(&employee, group) {
+			continue
+		}
+		_, err := c.updateMembership(ctx, employee.ID, resolver, func(employee *sharedpackage.Employee) (map[string][]sharedpackage.BindingDelta, error) {
+			if !inGroup(employee, group) {
+				return nil, nil
 			}
-			// Step 6: Update the employee document with the modified fields
-			if _, err := employeeDoc.Ref.Set(ctx, updateData, firestore.MergeAll); err != nil {
-				log.Printf("ERROR: Failed to update employee document with ID %s: %v", employeeDoc.Ref.ID, err)
-				// Handle the error as needed
-				continue
+			previous, err := resolver.projectRoles(ctx, employee)
+			if err != nil {
+				return nil, err
 			}
-			// Step 7: Print a success message for the updated employee document
-			log.Printf("INFO: Updated employee document with ID: %s", employeeDoc.Ref.ID)
-			return nil
-		} else {
-			for i := 0; i < len(employee.TeamIDs); i++ {
-				if employee.TeamIDs[i] == deptID {
-					employee.TeamIDs = removeElement(employee.TeamIDs, deptID)
+
+			if strings.HasPrefix(group, "dept_") {
+				if employee.DeptID == group {
+					// Clear the department, teams and job role
+					employee.DeptID = ""
+					employee.TeamIDs = []string{}
+					employee.Role = ""
 				}
+			} else if contains(employee.TeamIDs, group) {
+				employee.TeamIDs = removeElement(employee.TeamIDs, group)
+				if len(employee.TeamIDs) == 0 {
+					employee.DeptID = ""
+				}
+				employee.Role = ""
 			}
-			if len(employee.TeamIDs) == 0 {
-				employee.DeptID = ""
-			}
-			// Step 5: Create a map with the modified fields
-			updateData := map[string]interface{}{
-				"departmentID": employee.DeptID,
-				"teamIDs":      employee.TeamIDs, // Set teamID to an empty slice
-				"role":         "",
+			delete(employee.IAMRoles, group)
+
+			if employee.Email == "" {
+				return nil, nil
 			}
-			// Step 6: Update the employee document with the modified fields
-			if _, err := employeeDoc.Ref.Set(ctx, updateData, firestore.MergeAll); err != nil {
-				log.Printf("ERROR: Failed to update employee document with ID %s: %v", employeeDoc.Ref.ID, err)
-				// Handle the error as needed
+			return resolver.rebindDeltas(ctx, employee.Email, employee, previous)
+		})
+		if err != nil {
+			if isNotFound(err) {
 				continue
 			}
-			return nil
+			log.Printf("ERROR: Failed to update employee document with ID %s: %v", employee.ID, err)
+			return fmt.Errorf("Failed to update employee document with ID %s: %w", employee.ID, err)
 		}
-
+		log.Printf("INFO: Detached employee %s from %s", employee.ID, group)
 	}
-
-	// Step 8: Return nil if the function completes without errors
 	return nil
 }
 
-func DeleteDepartment(docID string) error {
-	ctx := context.Background()
+// inGroup reports whether the employee is a member of the department or team
+// group or holds roles through it.
+func inGroup(employee *sharedpackage.Employee, group string) bool {
+	if _, held := employee.IAMRoles[group]; held {
+		return true
+	}
+	return employee.DeptID == group || contains(employee.TeamIDs, group)
+}
 
-	// Step 1: Get the departments collection
-	departmentsCollection := FirestoreClient.Collection("departments")
+// DeleteDepartment deletes the department together with its teams and detaches its employees.
+func (c *Controller) DeleteDepartment(docID string) error {
+	ctx := context.Background()
 
-	// Step 2: Delete teams associated with the department
-	if err := deleteTeams(docID); err != nil {
+	// Step 1: Delete teams associated with the department
+	if err := c.deleteTeams(docID); err != nil {
 		log.Printf("ERROR: Failed to delete teams: %v", err)
 		// You can choose to return the error or handle it based on your requirements
-		return fmt.Errorf("Failed to delete teams: %v", err)
+		return fmt.Errorf("Failed to delete teams: %w", err)
 	}
 
-	// Step 3: Specify the path to the document
-	docRef := departmentsCollection.Doc(docID)
-
-	// Step 4: Check if the document exists
-	docSnapshot, err := docRef.Get(ctx)
+	// Step 2: Check if the document exists
+	department, err := c.Departments.GetDepartment(ctx, docID)
 	if err != nil {
+		if isNotFound(err) {
+			log.Printf("Document with ID %s does not exist", docID)
+			return notFound("Document with ID %s does not exist", docID)
+		}
 		log.Printf("Error getting document: %v", err)
-		return fmt.Errorf("Error getting document: %v", err)
-	}
-
-	if !docSnapshot.Exists() {
-		log.Printf("Document with ID %s does not exist", docID)
-		return fmt.Errorf("Document with ID %s does not exist", docID)
-	}
-
-	// Step 5: Extract the value of the "headID" field
-	headID, ok := docSnapshot.Data()["headID"].(string)
-	if !ok {
-		log.Printf("Field 'headID' not found or not a string")
-		return fmt.Errorf("Field 'headID' not found or not a string")
+		return fmt.Errorf("Error getting document: %w", err)
 	}
 
+	// Step 3: Extract the value of the "headID" field
+	headID := department.HeadID
 	log.Printf("INFO: Extracted 'headID' from document: %s", headID)
 
-	// Step 6: Handle the error from removeAccess
-	if err := removeEmployees(docID, headID); err != nil {
+	// Step 4: Handle the error from removeAccess
+	if err := c.removeEmployees(docID, headID); err != nil {
 		log.Printf("ERROR: Failed to remove access: %v", err)
 		// You can choose to return the error or handle it based on your requirements
-		return fmt.Errorf("Failed to remove access: %v", err)
+		return fmt.Errorf("Failed to remove access: %w", err)
 	}
 
-	// Step 7: Delete the document
-	_, err = docRef.Delete(ctx)
-	if err != nil {
+	// Step 5: Delete the document
+	if err := c.Departments.DeleteDepartment(ctx, docID); err != nil {
 		log.Printf("ERROR: Error deleting document: %v", err)
-		return fmt.Errorf("Error deleting document: %v", err)
+		return fmt.Errorf("Error deleting document: %w", err)
 	}
 
 	log.Printf("INFO: Deleted document with ID %s successfully", docID)
 
-	// Step 8: Return nil if the function completes without errors
+	// Step 6: Let the outbox worker revoke the bindings of every stripped lead, head and member
+	c.Outbox.Notify()
 	return nil
 }
 
-func UpdateDepartment(deptID string, dept sharedpackage.Department) (*sharedpackage.Department, error) {
+// UpdateDepartment changes the department's name, head, IAM roles or
+// projects. When the projects change, the bindings of everyone holding roles
+// through the department, or a team using its projects, move along.
+func (c *Controller) UpdateDepartment(deptID string, dept sharedpackage.Department) (*sharedpackage.Department, error) {
 	ctx := context.Background()
-	departmentCollection := FirestoreClient.Collection("departments")
-	employeeCollection := FirestoreClient.Collection("employees")
+	if err := validateProjects(dept.ProjectIDs); err != nil {
+		return nil, err
+	}
 
-	docDepartment := departmentCollection.Doc(deptID)
-	// Step 4: Check if the document exists
-	docSnapshotTeam, err := docDepartment.Get(ctx)
+	// Step 1: Check if the department exists
+	departmentData, err := c.Departments.GetDepartment(ctx, deptID)
 	if err != nil {
+		if isNotFound(err) {
+			log.Printf("Document with ID %s does not exist", deptID)
+			return nil, notFound("Document with ID %s does not exist", deptID)
+		}
 		log.Printf("Error getting document: %v", err)
-		return nil, fmt.Errorf("Error getting document: %v", err)
+		return nil, fmt.Errorf("Error getting document: %w", err)
 	}
 
-	if !docSnapshotTeam.Exists() {
-		log.Printf("Document with ID %s does not exist", deptID)
-		return nil, fmt.Errorf("Document with ID %s does not exist", deptID)
-	}
-
-	var departmentData sharedpackage.Department
-	// Convert Firestore document data to the Employee struct
-	if err := docSnapshotTeam.DataTo(&departmentData); err != nil {
-		log.Printf("ERROR: Error converting document data: %v", err)
-		return nil, fmt.Errorf("Error converting document data: %v", err)
-	}
-
-	// Step 5: Extract the value of the "headID" field
+	// Step 2: Extract the value of the "headID" field
 	headID := departmentData.HeadID
 
-	docEmployee := employeeCollection.Doc(headID)
-	// Step 4: Check if the document exists
-	docSnapshotEmployee, err := docEmployee.Get(ctx)
+	// Step 3: Check if the current head exists
+	employee, err := c.Employees.GetEmployee(ctx, headID)
 	if err != nil {
+		if isNotFound(err) {
+			log.Printf("Document with ID %s does not exist", deptID)
+			return nil, notFound("Document with ID %s does not exist", deptID)
+		}
 		log.Printf("Error getting document: %v", err)
-		return nil, fmt.Errorf("Error getting document: %v", err)
+		return nil, fmt.Errorf("Error getting document: %w", err)
 	}
 
-	if !docSnapshotEmployee.Exists() {
-		log.Printf("Document with ID %s does not exist", deptID)
-		return nil, fmt.Errorf("Document with ID %s does not exist", deptID)
-	}
-	var employee sharedpackage.Employee
-	// Convert Firestore document data to the Employee struct
-	if err := docSnapshotEmployee.DataTo(&employee); err != nil {
-		log.Printf("ERROR: Error converting document data: %v", err)
-		return nil, fmt.Errorf("Error converting document data: %v", err)
+	// Step 4: Work out the department roles the head holds after the update
+	deptRoles := employee.IAMRoles[deptID]
+	rolesChanged := len(dept.IAMRoles) != 0
+	if rolesChanged {
+		for _, role := range dept.IAMRoles {
+			if err := iamRole.ValidateRole(role); err != nil {
+				log.Printf("ERROR: %v", err)
+				return nil, err
+			}
+		}
+		deptRoles = mergeSlices(dept.IAMRoles, employee.IAMRoles[deptID])
+		dept.IAMRoles = deptRoles
+	} else {
+		dept.IAMRoles = departmentData.IAMRoles
 	}
 
-	if dept.HeadID != "" {
-		docEmployee2 := employeeCollection.Doc(dept.HeadID)
-
-		docSnapshotEmployee2, err := docEmployee2.Get(ctx)
+	// Step 5: Build the final documents of the heads, then store each once with its IAM operations
+	resolver := c.newProjectResolver()
+	if dept.HeadID != "" && dept.HeadID != headID {
+		newHead, err := c.Employees.GetEmployee(ctx, dept.HeadID)
 		if err != nil {
+			if isNotFound(err) {
+				log.Printf("Document with ID %s does not exist", dept.HeadID)
+				return nil, notFound("Document with ID %s does not exist", dept.HeadID)
+			}
 			log.Printf("Error getting document: %v", err)
-			return nil, fmt.Errorf("Error getting document: %v", err)
+			return nil, fmt.Errorf("Error getting document: %w", err)
 		}
-
-		if !docSnapshotEmployee2.Exists() {
-			log.Printf("Document with ID %s does not exist", dept.HeadID)
-			return nil, fmt.Errorf("Document with ID %s does not exist", dept.HeadID)
+		previous, err := resolver.projectRoles(ctx, newHead)
+		if err != nil {
+			return nil, err
 		}
-		var employee1 sharedpackage.Employee
-		// Convert Firestore document data to the Employee struct
-		if err := docSnapshotEmployee2.DataTo(&employee1); err != nil {
-			log.Printf("ERROR: Error converting document data: %v", err)
-			return nil, fmt.Errorf("Error converting document data: %v", err)
+
+		// The new head takes over the job role and IAM roles of the old one
+		newHead.DeptID = employee.DeptID
+		newHead.Role = employee.Role
+		newHead.IAMRoles, newHead.RoleGrants = copyRoles(employee)
+		newHead.IAMRoles[deptID] = deptRoles
+		grant, err := resolver.rebindDeltas(ctx, newHead.Email, newHead, previous)
+		if err != nil {
+			return nil, err
 		}
-		employee1.DeptID = employee.DeptID
-		employee1.Role = employee.Role
-		employee1.IAMRoles = employee.IAMRoles
-		data, err := AssignIAMRole(employee1.DeptID, "", dept.HeadID, employee1.IAMRoles[deptID], employee1.Role)
+		revoke, err := c.stripMember(ctx, resolver, employee)
 		if err != nil {
-			log.Printf("ERROR: Error while assigning IAM role: %v", err)
-			return nil, fmt.Errorf("Error assigning IAM role: %v", err)
+			return nil, err
+		}
+
+		if err := c.putEmployeeWithBindings(ctx, headID, *employee, revoke); err != nil {
+			log.Printf("ERROR: Error updating document: %v", err)
+			return nil, fmt.Errorf("Error updating document: %w", err)
 		}
-		log.Printf("INFO: Assigned IAM roles to %v: %v", dept.HeadID, data)
-		RemoveMember(headID)
-		employee.DeptID = ""
-		// Update the document with the modified field
-		if _, err := docEmployee2.Set(ctx, employee1); err != nil {
+		if err := c.putEmployeeWithBindings(ctx, dept.HeadID, *newHead, grant); err != nil {
 			log.Printf("ERROR: Error updating document: %v", err)
-			return nil, fmt.Errorf("Error updating document: %v", err)
+			return nil, fmt.Errorf("Error updating document: %w", err)
 		}
+		log.Printf("INFO: %s took over as head of %s from %s", dept.HeadID, deptID, headID)
 	} else {
-		dept.HeadID = departmentData.HeadID
-	}
-	if len(dept.IAMRoles) != 0 {
-		employee.IAMRoles[deptID] = mergeSlices(dept.IAMRoles, employee.IAMRoles[deptID])
-		role := employee.Role
-		deptID := employee.DeptID
-		RemoveMember(headID)
-		data, err := AssignIAMRole(deptID, deptID, dept.HeadID, employee.IAMRoles[deptID], role)
+		dept.HeadID = headID
+	}
+	if dept.HeadID == headID && rolesChanged {
+		previous, err := resolver.projectRoles(ctx, employee)
 		if err != nil {
-			log.Printf("ERROR: Error while assigning IAM role: %v", err)
-			return nil, fmt.Errorf("Error assigning IAM role: %v", err)
+			return nil, err
 		}
-		log.Printf("INFO: Assigned IAM roles to %v: %v", dept.HeadID, data)
-		employee.Role = role
-		employee.DeptID = deptID
-		// Update the document with the modified field
-		if _, err := docEmployee.Set(ctx, employee); err != nil {
+		if employee.IAMRoles == nil {
+			employee.IAMRoles = make(map[string][]string)
+		}
+		employee.IAMRoles[deptID] = deptRoles
+		deltas, err := resolver.rebindDeltas(ctx, employee.Email, employee, previous)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.putEmployeeWithBindings(ctx, headID, *employee, deltas); err != nil {
 			log.Printf("ERROR: Error updating document: %v", err)
-			return nil, fmt.Errorf("Error updating document: %v", err)
+			return nil, fmt.Errorf("Error updating document: %w", err)
 		}
-		dept.IAMRoles = employee.IAMRoles[deptID]
-	} else {
-		dept.IAMRoles = departmentData.IAMRoles
+		log.Printf("INFO: Head %s of %s now holds %v", headID, deptID, deptRoles)
 	}
 	if dept.DepartmentName == "" {
 		dept.DepartmentName = departmentData.DepartmentName
 	}
+	if dept.ProjectIDs == nil {
+		dept.ProjectIDs = departmentData.ProjectIDs
+	}
+	previousProjects, err := c.newProjectResolver().groupProjects(ctx, deptID)
+	if err != nil {
+		return nil, err
+	}
 
 	currentTime := time.Now()
 	updatedTime := currentTime.Format("Mon, 02 Jan 2006 15:04:05 MST")
@@ -465,42 +419,44 @@ func UpdateDepartment(deptID string, dept sharedpackage.Department) (*sharedpack
 	dept.CreatedTime = departmentData.CreatedTime
 
 	// Update the Firestore document with merged data
-	_, err = docDepartment.Set(ctx, dept)
-	if err != nil {
+	if err := c.Departments.PutDepartment(ctx, deptID, dept); err != nil {
 		log.Printf("Error updating data in document with ID %s: %v", deptID, err)
-		return nil, fmt.Errorf("Error updating data in document: %v", err)
+		return nil, fmt.Errorf("Error updating data in document: %w", err)
+	}
+
+	// Move the bindings if the department now targets other projects
+	if !sameProjects(dept.ProjectIDs, departmentData.ProjectIDs) {
+		groups := []string{deptID}
+		teams, err := c.Teams.FindTeamsByDepartment(ctx, deptID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get team documents: %v", err)
+			return nil, fmt.Errorf("Failed to get team documents: %w", err)
+		}
+		for _, team := range teams {
+			if len(team.ProjectIDs) == 0 {
+				groups = append(groups, team.ID)
+			}
+		}
+		if err := c.retargetGroups(ctx, groups, previousProjects); err != nil {
+			return nil, err
+		}
+		log.Printf("INFO: Department %s now targets projects %v", deptID, dept.ProjectIDs)
 	}
 
 	log.Printf("Employee with ID %s updated successfully", deptID)
+	c.Outbox.Notify()
+	dept.ID = deptID
 	return &dept, nil
 }
 
-func ListDepartments() (*[]sharedpackage.Department, error) {
-    ctx := context.Background()
-
-    iter := FirestoreClient.Collection("departments").Documents(ctx)
-
-    var departments []sharedpackage.Department
-
-    for {
-        doc, err := iter.Next()
-        if err == iterator.Done {
-            break
-        }
-        if err != nil {
-            log.Printf("ERROR: Error iterating over documents: %v", err)
-            return nil, err
-        }
-
-        var departmentData sharedpackage.Department
-        if err := doc.DataTo(&departmentData); err != nil {
-            log.Printf("ERROR: Error converting document data: %v", err)
-            return nil, err
-        }
-
-        departments = append(departments, departmentData)
-        log.Printf("INFO: Processed department.")
-    }
+// ListDepartments returns every department.
+func (c *Controller) ListDepartments() (*[]sharedpackage.Department, error) {
+	departments, err := c.Departments.ListDepartments(context.Background())
+	if err != nil {
+		log.Printf("ERROR: Error iterating over documents: %v", err)
+		return nil, err
+	}
+	log.Printf("INFO: Processed %d departments.", len(departments))
 
-    return &departments, nil
+	return &departments, nil
 }
@@ -0,0 +1,61 @@
+package controllerFunctions
+
+import (
+	"Task_04/sharedpackage"
+	"context"
+	"testing"
+)
+
+func TestDeleteDepartmentRevokesItsMembersRoles(t *testing.T) {
+	c, store, fake := newIAMController(t)
+	ctx := context.Background()
+	if err := store.PutEmployee(ctx, "emp_free", sharedpackage.Employee{Email: "head@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddDepartment("Research", []string{"roles/viewer"}, "emp_free", []string{"project-three"}); err != nil {
+		t.Fatalf("AddDepartment() error = %v", err)
+	}
+	putTeamLead(t, store, "emp_lead", "lead@example.com", []string{"team_1"})
+	if _, err := c.AssignIAMRole("dept_1", "", iamTestEmployee, []string{"roles/browser"}, "Engineer", nil); err != nil {
+		t.Fatalf("AssignIAMRole() error = %v", err)
+	}
+	if _, err := c.AssignIAMRole("dept_1", "team_2", iamTestEmployee, []string{"roles/editor"}, "Engineer", nil); err != nil {
+		t.Fatalf("AssignIAMRole() error = %v", err)
+	}
+	department, err := store.GetDepartment(ctx, "dept_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	department.HeadID = "emp_lead"
+	if err := store.PutDepartment(ctx, "dept_1", *department); err != nil {
+		t.Fatal(err)
+	}
+	drainOutbox(t, c, store)
+
+	if err := c.DeleteDepartment("dept_1"); err != nil {
+		t.Fatalf("DeleteDepartment() error = %v", err)
+	}
+
+	employee, err := store.GetEmployee(ctx, iamTestEmployee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, group := range []string{"dept_1", "team_1", "team_2"} {
+		if _, held := employee.IAMRoles[group]; held {
+			t.Errorf("iamRoles still hold %s: %v", group, employee.IAMRoles)
+		}
+	}
+	if employee.DeptID != "" || len(employee.TeamIDs) != 0 || employee.Role != "" {
+		t.Errorf("member = %+v, want no department, teams or job role", employee)
+	}
+
+	drainOutbox(t, c, store)
+	for _, projectID := range []string{"project-one", "project-two"} {
+		if got := rolesOf(fake, projectID, iamTestMail); len(got) != 0 {
+			t.Errorf("member roles on %s = %v, want none", projectID, got)
+		}
+	}
+	if got := rolesOf(fake, "project-three", "head@example.com"); len(got) != 1 {
+		t.Errorf("head of the other department lost its roles: %v", got)
+	}
+}
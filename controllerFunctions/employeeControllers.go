@@ -4,18 +4,15 @@ import (
 	"Task_04/iamRole"
 	"Task_04/sharedpackage"
 	"context"
+	"errors"
 	"fmt"
-	"strconv"
-
-	// "errors"
 	"log"
-
-	"cloud.google.com/go/firestore"
-	"google.golang.org/api/iterator"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
+// ErrInvalidRoleGroup is returned when iamRoles are keyed by a group the
+// employee does not belong to.
+var ErrInvalidRoleGroup = errors.New("iamRoles group is not the employee's department or team")
+
 func mergeMaps(mapA, mapB map[string][]string) map[string][]string {
 	mergedMap := make(map[string][]string)
 
@@ -63,199 +60,192 @@ func mergeSlices(sliceA, sliceB []string) []string {
 	return result
 }
 
-// generateIncrementingEmployeeID generates an incrementing document ID for the given collection.
-func generateIncrementingEmployeeID(collection *firestore.CollectionRef) (string, error) {
-	// Query the collection to find the highest existing document ID
-	iter := collection.Documents(context.Background())
-	defer iter.Stop()
-
-	existingIDs := make(map[string]bool)
-	highestID := 0
-
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return "", err
-		}
-
-		// Extract the numeric part of the document ID
-		idStr := doc.Ref.ID[len("emp_"):]
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			continue // Ignore non-numeric IDs
-		}
-
-		// Update the highestID if the current ID is greater
-		if id > highestID {
-			highestID = id
-		}
-
-		// Store existing IDs in a map
-		existingIDs[doc.Ref.ID] = true
+// copyRoles returns copies of the employee's iamRoles and roleGrants that
+// share no map or slice with them.
+func copyRoles(employee *sharedpackage.Employee) (map[string][]string, map[string]map[string]sharedpackage.RoleGrant) {
+	iamRoles := make(map[string][]string, len(employee.IAMRoles))
+	for group, roles := range employee.IAMRoles {
+		iamRoles[group] = append([]string(nil), roles...)
 	}
-
-	// Generate a new incrementing document ID
-	for {
-		newID := highestID + 1
-		newIDStr := fmt.Sprintf("emp_%d", newID)
-
-		// Check if the generated ID already exists
-		if !existingIDs[newIDStr] {
-			return newIDStr, nil
+	var roleGrants map[string]map[string]sharedpackage.RoleGrant
+	if len(employee.RoleGrants) > 0 {
+		roleGrants = make(map[string]map[string]sharedpackage.RoleGrant, len(employee.RoleGrants))
+		for group, grants := range employee.RoleGrants {
+			roleGrants[group] = make(map[string]sharedpackage.RoleGrant, len(grants))
+			for role, grant := range grants {
+				roleGrants[group][role] = grant
+			}
 		}
-
-		highestID++
 	}
-
-	// This should not be reached
+	return iamRoles, roleGrants
 }
 
-func CreateEmployee(employee sharedpackage.Employee) (*sharedpackage.Employee, error) {
+// CreateEmployee validates the employee's department and teams, stores the
+// employee under a new incrementing ID and assigns the team IAM roles.
+func (c *Controller) CreateEmployee(employee sharedpackage.Employee) (*sharedpackage.Employee, error) {
 	ctx := context.Background()
 	log.Printf("CreateEmployee INFO: Employee details received successfully.")
 
-	// Reference to the "departments" collection
-	departmentCollection := FirestoreClient.Collection("departments").Doc(employee.DeptID)
-	// Reference to the "employees" collection
-	employeeCollection := FirestoreClient.Collection("employees")
-
 	// Check if the department document exists
-	docSnapshot, err := departmentCollection.Get(ctx)
+	department, err := c.Departments.GetDepartment(ctx, employee.DeptID)
 	if err != nil {
-		if grpcStatus, ok := status.FromError(err); ok && grpcStatus.Code() == codes.NotFound {
+		if isNotFound(err) {
 			log.Printf("CreateEmployee ERROR: Department with ID %s not found: %v", employee.DeptID, err)
-			return nil, fmt.Errorf("Department with ID %s not found", employee.DeptID)
+			return nil, notFound("Department with ID %s not found", employee.DeptID)
 		}
 		log.Printf("CreateEmployee ERROR: Unable to retrieve department with ID %s: %v", employee.DeptID, err)
 		return nil, err
 	}
-	log.Printf("CreateEmployee INFO: Department with ID %s found: %v", employee.DeptID, docSnapshot)
+	log.Printf("CreateEmployee INFO: Department with ID %s found: %v", employee.DeptID, department)
 
 	// Check if the team documents exist
 	for i := 0; i < len(employee.TeamIDs); i++ {
-		teamsCollection := FirestoreClient.Collection("teams").Doc(employee.TeamIDs[i])
-		docSnapshot1, err := teamsCollection.Get(ctx)
+		team, err := c.Teams.GetTeam(ctx, employee.TeamIDs[i])
 		if err != nil {
-			if grpcStatus, ok := status.FromError(err); ok && grpcStatus.Code() == codes.NotFound {
+			if isNotFound(err) {
 				log.Printf("CreateEmployee ERROR: Team with ID %s not found: %v", employee.TeamIDs[i], err)
-				return nil, fmt.Errorf("Team with ID %s not found", employee.TeamIDs[i])
+				return nil, notFound("Team with ID %s not found", employee.TeamIDs[i])
 			}
 			log.Printf("CreateEmployee ERROR: Unable to retrieve team with ID %s: %v", employee.TeamIDs[i], err)
 			return nil, err
 		}
-		log.Printf("CreateEmployee INFO: Team with ID %s found: %v", employee.TeamIDs[i], docSnapshot1)
+		log.Printf("CreateEmployee INFO: Team with ID %s found: %v", employee.TeamIDs[i], team)
 	}
 
 	// Generate an incrementing document ID
-	newDocID, err := generateIncrementingEmployeeID(employeeCollection)
+	newDocID, err := c.Employees.NextEmployeeID(ctx)
 	if err != nil {
 		log.Printf("ERROR: Unable to generate a unique document ID: %v", err)
-		return nil, fmt.Errorf("Unable to generate a unique document ID: %v", err)
+		return nil, fmt.Errorf("Unable to generate a unique document ID: %w", err)
 	}
 
-	// Add the employee data to the "employees" collection with the generated document ID
-	_, err = employeeCollection.Doc(newDocID).Set(ctx, employee)
-	if err != nil {
-		log.Printf("ERROR: Failed to add employee document: %v", err)
-		return nil, fmt.Errorf("Failed to add employee document: %v", err)
+	// A new account starts without failed logins or MFA
+	clearLockout(&employee)
+	clearMFA(&employee)
+
+	// Keep the IAM roles of the employee's teams; the bindings of every team
+	// are built up front so the document and its IAM operations are stored together
+	iamRoles := make(map[string][]string, len(employee.TeamIDs))
+	for _, teamID := range employee.TeamIDs {
+		for _, role := range employee.IAMRoles[teamID] {
+			if err := iamRole.ValidateRole(role); err != nil {
+				log.Printf("CreateEmployee ERROR: %v", err)
+				return nil, err
+			}
+		}
+		iamRoles[teamID] = dedupe(employee.IAMRoles[teamID])
 	}
+	employee.IAMRoles = iamRoles
+	employee.RoleGrants = nil
 
-	// Assign IAM roles based on teams (replace with your actual implementation)
-	for i := 0; i < len(employee.TeamIDs); i++ {
-		AssignIAMRole(employee.DeptID, employee.TeamIDs[i], newDocID, employee.IAMRoles[employee.TeamIDs[i]], employee.Role)
+	deltas := make(map[string][]sharedpackage.BindingDelta)
+	if employee.Email != "" {
+		byProject, err := c.newProjectResolver().projectGrants(ctx, &employee)
+		if err != nil {
+			return nil, err
+		}
+		for projectID, grants := range byProject {
+			deltas[projectID] = grantDeltas(employee.Email, grants)
+		}
+	}
+
+	// Add the employee together with one IAM operation per project; the outbox worker grants them
+	if err := c.putEmployeeWithBindings(ctx, newDocID, employee, deltas); err != nil {
+		log.Printf("ERROR: Failed to add employee document: %v", err)
+		return nil, fmt.Errorf("Failed to add employee document: %w", err)
 	}
+	employee.ID = newDocID
+	c.Outbox.Notify()
 
 	log.Printf("CreateEmployee INFO: Employee added to Firestore: %+v", employee)
 	// Return the employee or any other relevant information
 	return &employee, nil
 }
 
-func DeleteEmployee(empID string) (*sharedpackage.Employee, error) {
+// DeleteEmployee revokes the employee's IAM roles and deletes the employee document.
+func (c *Controller) DeleteEmployee(empID string) (*sharedpackage.Employee, error) {
 	ctx := context.Background()
-	docRef := FirestoreClient.Collection("employees").Doc(empID)
 
 	// Check if the document exists before attempting to delete
-	docSnapshot, err := docRef.Get(ctx)
+	employee, err := c.Employees.GetEmployee(ctx, empID)
 	if err != nil {
-		if status, ok := status.FromError(err); ok && status.Code() == codes.NotFound {
+		if isNotFound(err) {
 			log.Printf("Document with ID %s not found: %v", empID, err)
-			return nil, fmt.Errorf("Document with ID %s not found", empID)
+			return nil, notFound("Document with ID %s not found", empID)
 		}
 		log.Printf("Error retrieving document with ID %s: %v", empID, err)
-		return nil, fmt.Errorf("Error retrieving document: %v", err)
-	}
-
-	var employee sharedpackage.Employee
-	if err := docSnapshot.DataTo(&employee); err != nil {
-		log.Printf("Error decoding document: %v", err)
-		return nil, fmt.Errorf("Error decoding document: %v", err)
+		return nil, fmt.Errorf("Error retrieving document: %w", err)
 	}
 
-	err = RemoveMember(empID)
+	err = c.RemoveMember(empID)
 	if err != nil {
 		log.Printf("ERROR: Failed to remove employee with leadID %s: %v", empID, err)
 		// Handle the error as needed, e.g., log or return an error
-		return nil, fmt.Errorf("Failed to remove employee with leadID %s: %v", empID, err)
+		return nil, fmt.Errorf("Failed to remove employee with leadID %s: %w", empID, err)
 	}
 	log.Printf("INFO: Removed employee successfully with leadID: %s", empID)
 
+	// Log the employee out everywhere
+	if err := c.RevokeSessions(empID); err != nil {
+		return nil, err
+	}
+
 	// Document exists, proceed with deletion
-	_, err = docRef.Delete(ctx)
-	if err != nil {
+	if err := c.Employees.DeleteEmployee(ctx, empID); err != nil {
 		log.Printf("Error deleting document with ID %s: %v", empID, err)
-		return nil, fmt.Errorf("Error deleting document: %v", err)
+		return nil, fmt.Errorf("Error deleting document: %w", err)
 	}
 
 	log.Printf("Document with ID %s deleted successfully", empID)
-	return &employee, nil
+	return employee, nil
 }
 
-func UpdateEmployee(empID string, updatedEmp sharedpackage.Employee) (*sharedpackage.Employee, error) {
+// UpdateEmployee merges the non-empty fields of updatedEmp into the stored
+// employee. The password is only ever changed through ResetPassword.
+func (c *Controller) UpdateEmployee(empID string, updatedEmp sharedpackage.Employee) (*sharedpackage.Employee, error) {
 	ctx := context.Background()
-	var employee sharedpackage.Employee
-	docRef := FirestoreClient.Collection("employees").Doc(empID)
 
 	// Check if the document exists before attempting to update
-	docSnapshot, err := docRef.Get(ctx)
+	employee, err := c.Employees.GetEmployee(ctx, empID)
 	if err != nil {
-		if status, ok := status.FromError(err); ok && status.Code() == codes.NotFound {
+		if isNotFound(err) {
 			log.Printf("Employee with ID %s not found: %v", empID, err)
-			return nil, fmt.Errorf("Employee with ID %s not found", empID)
+			return nil, notFound("Employee with ID %s not found", empID)
 		}
 		log.Printf("Error retrieving document with ID %s: %v", empID, err)
-		return nil, fmt.Errorf("Error retrieving document: %v", err)
+		return nil, fmt.Errorf("Error retrieving document: %w", err)
 	}
+	previousEmail := employee.Email
 
-	// Decode Firestore document data to Employee struct
-	if err := docSnapshot.DataTo(&employee); err != nil {
-		log.Printf("Error decoding document: %v", err)
-		return nil, fmt.Errorf("Error decoding document: %v", err)
+	// Note the projects the current roles are granted in, to revoke them there
+	resolver := c.newProjectResolver()
+	previous, err := resolver.projectRoles(ctx, employee)
+	if err != nil {
+		return nil, err
 	}
 
 	// Update TeamIDs and IAMRoles based on conditions
+	reassignRoles := false
 	if updatedEmp.DeptID != "" {
-		docRef1 := FirestoreClient.Collection("departments").Doc(updatedEmp.DeptID)
-		docSnapshot1, err := docRef1.Get(ctx)
+		department, err := c.Departments.GetDepartment(ctx, updatedEmp.DeptID)
 		if err != nil {
-			if status.Code(err) == codes.NotFound {
+			if isNotFound(err) {
 				// Document not found
-				return nil, fmt.Errorf("UpdateEmployee ERROR: Document ID %v you entered is not present in document collection: %v", updatedEmp.DeptID, err)
+				return nil, notFound("UpdateEmployee ERROR: Document ID %v you entered is not present in document collection: %v", updatedEmp.DeptID, err)
 			}
 
 			// Handle other errors
 			log.Printf("UpdateEmployee ERROR: Error checking document existence: %v", err)
-			return nil, fmt.Errorf("Error checking document existence: %v", err)
+			return nil, fmt.Errorf("Error checking document existence: %w", err)
 		}
 
-		log.Printf("UpdateEmployee INFO: Document ID found!!: %v", docSnapshot1)
+		log.Printf("UpdateEmployee INFO: Document ID found!!: %v", department)
 
 		if len(updatedEmp.TeamIDs) == 0 {
 			log.Printf("UpdateEmployee ERROR: Please enter teamIDs")
 			return nil, fmt.Errorf("Please enter teamIDs")
 		}
+		employee.DeptID = updatedEmp.DeptID
 		employee.TeamIDs = updatedEmp.TeamIDs
 
 		if len(updatedEmp.IAMRoles) == 0 {
@@ -268,15 +258,7 @@ func UpdateEmployee(empID string, updatedEmp sharedpackage.Employee) (*sharedpac
 
 		employee.IAMRoles = updatedEmp.IAMRoles
 
-		// Remove and Assign IAM roles
-		RemoveMember(empID)
-		for key := range employee.IAMRoles {
-			err := iamRole.AssignIAM(projectID, employee.IAMRoles[key], employee.Email)
-			if err != nil {
-				log.Printf("UpdateEmployee ERROR: Failed to assign IAM role: %v", err)
-				return nil, fmt.Errorf("Failed to assign IAM role: %v", err)
-			}
-		}
+		reassignRoles = true
 	} else {
 		if len(updatedEmp.TeamIDs) != 0 {
 			employee.TeamIDs = mergeSlices(updatedEmp.TeamIDs, employee.TeamIDs)
@@ -289,15 +271,15 @@ func UpdateEmployee(empID string, updatedEmp sharedpackage.Employee) (*sharedpac
 
 			// Merge IAMRoles maps
 			employee.IAMRoles = mergeMaps(updatedEmp.IAMRoles, employee.IAMRoles)
-			// Remove and Assign IAM roles
-			RemoveMember(empID)
-			for key := range employee.IAMRoles {
-				err := iamRole.AssignIAM(projectID, employee.IAMRoles[key], employee.Email)
-				if err != nil {
-					log.Printf("UpdateEmployee ERROR: Failed to assign IAM role: %v", err)
-					return nil, fmt.Errorf("Failed to assign IAM role: %v", err)
-				}
-			}
+			reassignRoles = true
+		}
+	}
+
+	// Roles may only be granted through the employee's own department and teams
+	if reassignRoles {
+		if err := checkRoleGroups(employee, updatedEmp.IAMRoles); err != nil {
+			log.Printf("UpdateEmployee ERROR: %v", err)
+			return nil, err
 		}
 	}
 
@@ -310,50 +292,54 @@ func UpdateEmployee(empID string, updatedEmp sharedpackage.Employee) (*sharedpac
 	if updatedEmp.Email != "" {
 		employee.Email = updatedEmp.Email
 	}
-	if updatedEmp.Password != "" {
-		employee.Password = updatedEmp.Password
-	}
 	if updatedEmp.Role != "" {
 		employee.Role = updatedEmp.Role
 	}
 
+	// Remove and re-assign IAM roles in one operation per project recorded with the update
+	var deltas map[string][]sharedpackage.BindingDelta
+	if reassignRoles {
+		deltas, err = resolver.rebindDeltas(ctx, previousEmail, employee, previous)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Update the Firestore document with merged data
-	_, err = docRef.Set(ctx, employee)
-	if err != nil {
+	if err := c.putEmployeeWithBindings(ctx, empID, *employee, deltas); err != nil {
 		log.Printf("Error updating data in document with ID %s: %v", empID, err)
-		return nil, fmt.Errorf("Error updating data in document: %v", err)
+		return nil, fmt.Errorf("Error updating data in document: %w", err)
 	}
 
 	log.Printf("Employee with ID %s updated successfully", empID)
-	return &employee, nil
+	c.Outbox.Notify()
+	return employee, nil
 }
 
-func ListEmployee() ([]sharedpackage.Employee, error) {
-	ctx := context.Background()
-
-	iter := FirestoreClient.Collection("employees").Documents(ctx)
-
-	var employees []sharedpackage.Employee
-
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
+// checkRoleGroups refuses iamRoles keyed by anything but the employee's
+// department or one of its teams, and malformed role names.
+func checkRoleGroups(employee *sharedpackage.Employee, iamRoles map[string][]string) error {
+	for group, roles := range iamRoles {
+		if group == "" || (group != employee.DeptID && !contains(employee.TeamIDs, group)) {
+			return fmt.Errorf("%w: %q is not the department or a team of employee %s", ErrInvalidRoleGroup, group, employee.ID)
 		}
-		if err != nil {
-			log.Printf("ERROR: Error iterating over documents: %v", err)
-			return nil, err
-		}
-
-		var employeeData sharedpackage.Employee
-		if err := doc.DataTo(&employeeData); err != nil {
-			log.Printf("ERROR: Error converting document data: %v", err)
-			return nil, err
+		for _, role := range roles {
+			if err := iamRole.ValidateRole(role); err != nil {
+				return err
+			}
 		}
+	}
+	return nil
+}
 
-		employees = append(employees, employeeData)
-		log.Printf("INFO: Processed employee.")
+// ListEmployee returns every employee.
+func (c *Controller) ListEmployee() ([]sharedpackage.Employee, error) {
+	employees, err := c.Employees.ListEmployees(context.Background())
+	if err != nil {
+		log.Printf("ERROR: Error iterating over documents: %v", err)
+		return nil, err
 	}
+	log.Printf("INFO: Processed %d employees.", len(employees))
 
 	return employees, nil
 }
@@ -0,0 +1,57 @@
+package controllerFunctions
+
+import (
+	"Task_04/iamRole"
+	"Task_04/sharedpackage"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUpdateEmployeeRefusesRolesOutsideItsGroups(t *testing.T) {
+	c, store, _ := newIAMController(t)
+	ctx := context.Background()
+	if err := store.PutDepartment(ctx, "dept_2", sharedpackage.Department{ID: "dept_2", ProjectIDs: []string{"project-three"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutTeam(ctx, "team_3", sharedpackage.Team{ID: "team_3", DepartmentID: "dept_2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		update  sharedpackage.Employee
+		wantErr error
+	}{
+		{"team of another department", sharedpackage.Employee{TeamIDs: []string{"team_1"}, IAMRoles: map[string][]string{"team_3": {"roles/owner"}}}, ErrInvalidRoleGroup},
+		{"another department", sharedpackage.Employee{TeamIDs: []string{"team_1"}, IAMRoles: map[string][]string{"dept_2": {"roles/owner"}}}, ErrInvalidRoleGroup},
+		{"default project", sharedpackage.Employee{TeamIDs: []string{"team_1"}, IAMRoles: map[string][]string{"0": {"roles/owner"}}}, ErrInvalidRoleGroup},
+		{"team left by the move", sharedpackage.Employee{DeptID: "dept_1", TeamIDs: []string{"team_2"}, IAMRoles: map[string][]string{"team_2": {"roles/viewer"}, "team_1": {"roles/owner"}}}, ErrInvalidRoleGroup},
+		{"malformed role", sharedpackage.Employee{TeamIDs: []string{"team_1"}, IAMRoles: map[string][]string{"team_1": {"owner"}}}, iamRole.ErrInvalidRole},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.UpdateEmployee(iamTestEmployee, tt.update); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateEmployee() error = %v, want %v", err, tt.wantErr)
+			}
+			if pending := pendingProjects(t, store); len(pending) != 0 {
+				t.Fatalf("pending operations = %v, want none", pending)
+			}
+		})
+	}
+
+	// Roles under the employee's own department and teams are granted
+	update := sharedpackage.Employee{TeamIDs: []string{"team_1"}, IAMRoles: map[string][]string{"team_1": {"roles/viewer"}, "dept_1": {"roles/browser"}}}
+	employee, err := c.UpdateEmployee(iamTestEmployee, update)
+	if err != nil {
+		t.Fatalf("UpdateEmployee() error = %v", err)
+	}
+	if len(employee.IAMRoles["team_1"]) != 1 || len(employee.IAMRoles["dept_1"]) != 1 {
+		t.Fatalf("iamRoles = %v, want team_1 and dept_1 roles", employee.IAMRoles)
+	}
+	for _, projectID := range pendingProjects(t, store) {
+		if projectID == "project-three" {
+			t.Fatalf("operation queued for project-three of dept_2")
+		}
+	}
+}
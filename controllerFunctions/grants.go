@@ -0,0 +1,315 @@
+package controllerFunctions
+
+import (
+	"Task_04/iamRole"
+	"Task_04/reconciler"
+	"Task_04/sharedpackage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidExpiry rejects time-bound grants that would already be expired.
+var ErrInvalidExpiry = errors.New("invalid grant expiry")
+
+// validateGrant rejects a grant whose expiry is not in the future or whose
+// condition IAM would refuse, alone or combined with the expiry.
+func validateGrant(grant *sharedpackage.RoleGrant, now time.Time) error {
+	if grant == nil {
+		return nil
+	}
+	if grant.ExpiresAt != nil && !grant.ExpiresAt.After(now) {
+		return fmt.Errorf("%w: %s is not in the future", ErrInvalidExpiry, grant.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	if err := iamRole.ValidateCondition(grant.Condition); err != nil {
+		return err
+	}
+	return iamRole.ValidateCondition(iamRole.GrantCondition(grant.Condition, grant.ExpiresAt))
+}
+
+// restricted reports whether grant limits a role by expiry or condition.
+func restricted(grant *sharedpackage.RoleGrant) bool {
+	return grant != nil && (grant.ExpiresAt != nil || iamRole.ConditionKey(grant.Condition) != "")
+}
+
+// roleCondition returns the condition the role the employee holds through
+// group is bound under, or nil for an unrestricted grant.
+func roleCondition(employee *sharedpackage.Employee, group string, role string) *sharedpackage.Condition {
+	if grant, ok := employee.RoleGrants[group][role]; ok {
+		return iamRole.GrantCondition(grant.Condition, grant.ExpiresAt)
+	}
+	return nil
+}
+
+// grantDeltas returns the deltas that add each of grants to the user.
+func grantDeltas(userMail string, grants []reconciler.Grant) []sharedpackage.BindingDelta {
+	deltas := make([]sharedpackage.BindingDelta, 0, len(grants))
+	for _, grant := range grants {
+		deltas = append(deltas, sharedpackage.BindingDelta{
+			Action:    sharedpackage.BindingAdd,
+			Role:      grant.Role,
+			Member:    iamRole.Member(userMail),
+			Condition: grant.Condition,
+		})
+	}
+	return deltas
+}
+
+// updateRoleGrant records grant for a role the employee holds through group.
+// held says whether the role was held there before. An unrestricted role
+// stays unrestricted, and an unrestricted grant lifts every restriction. A
+// grant under another condition replaces the held one; under the same
+// condition the expiry is only ever extended.
+func updateRoleGrant(employee *sharedpackage.Employee, group string, role string, grant *sharedpackage.RoleGrant, held bool) {
+	current, hasGrant := employee.RoleGrants[group][role]
+
+	switch {
+	case held && !(hasGrant && restricted(&current)):
+		return
+	case !restricted(grant):
+		delete(employee.RoleGrants[group], role)
+		return
+	case held && iamRole.ConditionKey(current.Condition) == iamRole.ConditionKey(grant.Condition):
+		if current.ExpiresAt == nil || (grant.ExpiresAt != nil && !grant.ExpiresAt.After(*current.ExpiresAt)) {
+			return
+		}
+	}
+
+	if employee.RoleGrants == nil {
+		employee.RoleGrants = make(map[string]map[string]sharedpackage.RoleGrant)
+	}
+	if employee.RoleGrants[group] == nil {
+		employee.RoleGrants[group] = make(map[string]sharedpackage.RoleGrant)
+	}
+	recorded := sharedpackage.RoleGrant{}
+	if grant.ExpiresAt != nil {
+		expiresAt := grant.ExpiresAt.UTC().Truncate(time.Second)
+		recorded.ExpiresAt = &expiresAt
+	}
+	if iamRole.ConditionKey(grant.Condition) != "" {
+		condition := *grant.Condition
+		recorded.Condition = &condition
+	}
+	employee.RoleGrants[group][role] = recorded
+}
+
+// pruneRoleGrants drops the grants of roles the employee no longer holds.
+func pruneRoleGrants(employee *sharedpackage.Employee) {
+	for group, grants := range employee.RoleGrants {
+		for role := range grants {
+			if !contains(employee.IAMRoles[group], role) {
+				delete(grants, role)
+			}
+		}
+		if len(grants) == 0 {
+			delete(employee.RoleGrants, group)
+		}
+	}
+	if len(employee.RoleGrants) == 0 {
+		employee.RoleGrants = nil
+	}
+}
+
+// ExpiredGrant is a time-bound role the expiry sweeper removed.
+type ExpiredGrant struct {
+	EmployeeID string    `json:"employeeID"`
+	Group      string    `json:"group"`
+	Role       string    `json:"role"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	// StillLive lists the projects whose live IAM policy still grants the
+	// role to the employee other than through the expired binding, e.g.
+	// because the binding was edited by hand.
+	StillLive []string `json:"stillLive,omitempty"`
+}
+
+// SweepExpiredGrants removes time-bound roles whose expiry has passed from
+// the employees and their conditional bindings from IAM, whatever other
+// condition they were granted under. Each employee is re-read while its
+// roles are updated, so concurrent changes to it are kept. Roles the live
+// policy still grants in another way are flagged in the result and logged.
+func (c *Controller) SweepExpiredGrants() ([]ExpiredGrant, error) {
+	ctx := context.Background()
+	now := time.Now()
+
+	employees, err := c.Employees.ListEmployees(ctx)
+	if err != nil {
+		log.Printf("ERROR: Error iterating over documents: %v", err)
+		return nil, fmt.Errorf("Error iterating over documents: %w", err)
+	}
+
+	resolver := c.newProjectResolver()
+	live := make(map[string][]sharedpackage.Binding)
+	expired := []ExpiredGrant{}
+	for i := range employees {
+		empID := employees[i].ID
+
+		// Step 1: Resolve the projects of the groups with expired grants up
+		// front; the store is not read while the employee is being updated
+		groupProjects := make(map[string][]string)
+		for _, group := range sortedGroups(employees[i].RoleGrants) {
+			for _, grant := range employees[i].RoleGrants[group] {
+				if grant.ExpiresAt != nil && !grant.ExpiresAt.After(now) {
+					if groupProjects[group], err = resolver.groupProjects(ctx, group); err != nil {
+						return nil, err
+					}
+					break
+				}
+			}
+		}
+		if len(groupProjects) == 0 {
+			continue
+		}
+
+		// Step 2: Take the expired roles off the current employee, together
+		// with the removal of their bindings
+		var found []ExpiredGrant
+		var conditions []*sharedpackage.Condition
+		employee, err := c.Operations.UpdateEmployeeRolesWithOperations(ctx, empID, func(employee *sharedpackage.Employee) ([]sharedpackage.IAMOperation, error) {
+			found, conditions = nil, nil
+			deltas := make(map[string][]sharedpackage.BindingDelta)
+			for _, group := range sortedGroups(employee.RoleGrants) {
+				projects, resolved := groupProjects[group]
+				if !resolved {
+					// Not expired when listed; the next sweep removes it
+					continue
+				}
+				grants := employee.RoleGrants[group]
+				roles := make([]string, 0, len(grants))
+				for role := range grants {
+					roles = append(roles, role)
+				}
+				sort.Strings(roles)
+
+				for _, role := range roles {
+					grant := grants[role]
+					if grant.ExpiresAt == nil || grant.ExpiresAt.After(now) {
+						continue
+					}
+					condition := iamRole.GrantCondition(grant.Condition, grant.ExpiresAt)
+					if employee.Email != "" {
+						for _, projectID := range projects {
+							deltas[projectID] = append(deltas[projectID], sharedpackage.BindingDelta{
+								Action:    sharedpackage.BindingRemove,
+								Role:      role,
+								Member:    iamRole.Member(employee.Email),
+								Condition: condition,
+							})
+						}
+					}
+					if employee.IAMRoles != nil {
+						employee.IAMRoles[group] = removeElementsFromB([]string{role}, employee.IAMRoles[group])
+					}
+					delete(grants, role)
+					found = append(found, ExpiredGrant{EmployeeID: empID, Group: group, Role: role, ExpiresAt: *grant.ExpiresAt})
+					conditions = append(conditions, condition)
+				}
+			}
+			pruneRoleGrants(employee)
+			return bindingOperations(empID, deltas), nil
+		})
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			log.Printf("ERROR: Error updating document: %v", err)
+			return nil, fmt.Errorf("Error updating document: %w", err)
+		}
+		if len(found) == 0 {
+			continue
+		}
+
+		// Step 3: Flag roles IAM still grants without the expired condition
+		remaining, err := resolver.projectGrants(ctx, employee)
+		if err != nil {
+			return nil, err
+		}
+		for j := range found {
+			for _, projectID := range groupProjects[found[j].Group] {
+				bindings, cached := live[projectID]
+				if !cached {
+					if bindings, err = iamRole.ProjectBindings(projectID); err != nil {
+						log.Printf("WARN: Cannot check %s for live expired grants: %v", projectID, err)
+					}
+					live[projectID] = bindings
+				}
+				if stillGranted(bindings, employee.Email, found[j].Role, conditions[j], remaining[projectID]) {
+					found[j].StillLive = append(found[j].StillLive, projectID)
+				}
+			}
+			if len(found[j].StillLive) > 0 {
+				log.Printf("WARN: Expired grant of %s to %s through %s is still live in IAM on %v", found[j].Role, empID, found[j].Group, found[j].StillLive)
+			}
+		}
+		log.Printf("INFO: Removed %d expired IAM grants of %s", len(found), empID)
+		expired = append(expired, found...)
+	}
+
+	if len(expired) > 0 {
+		c.Outbox.Notify()
+	}
+	return expired, nil
+}
+
+// stillGranted reports whether bindings grant role to userMail other than
+// under the expired condition or one of the grants the employee still holds.
+func stillGranted(bindings []sharedpackage.Binding, userMail string, role string, expired *sharedpackage.Condition, remaining []reconciler.Grant) bool {
+	if userMail == "" {
+		return false
+	}
+	member := iamRole.Member(userMail)
+	for _, binding := range bindings {
+		if binding.Role != role || iamRole.ConditionKey(binding.Condition) == iamRole.ConditionKey(expired) {
+			continue
+		}
+		expected := false
+		for _, grant := range remaining {
+			if grant.Role == role && iamRole.ConditionKey(grant.Condition) == iamRole.ConditionKey(binding.Condition) {
+				expected = true
+			}
+		}
+		if expected {
+			continue
+		}
+		for _, m := range binding.Members {
+			if strings.EqualFold(m, member) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sortedGroups returns the group keys of grants in ascending order.
+func sortedGroups(grants map[string]map[string]sharedpackage.RoleGrant) []string {
+	groups := make([]string, 0, len(grants))
+	for group := range grants {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// RunExpirySweeper sweeps expired grants and closes overdue access review
+// campaigns every interval until ctx is cancelled.
+func (c *Controller) RunExpirySweeper(ctx context.Context, interval time.Duration) {
+	log.Println("INFO: IAM grant expiry sweeper started.")
+	for {
+		if _, err := c.SweepExpiredGrants(); err != nil {
+			log.Printf("ERROR: Failed to sweep expired IAM grants: %v", err)
+		}
+		if _, err := c.CloseOverdueCampaigns(); err != nil {
+			log.Printf("ERROR: Failed to close overdue review campaigns: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("INFO: IAM grant expiry sweeper stopped.")
+			return
+		case <-time.After(interval):
+		}
+	}
+}
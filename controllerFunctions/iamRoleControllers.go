@@ -2,19 +2,15 @@ package controllerFunctions
 
 import (
 	"Task_04/iamRole"
+	"Task_04/reconciler"
 	"Task_04/sharedpackage"
 	"context"
-	"errors"
 	"fmt"
 	"log"
-
-	"cloud.google.com/go/firestore"
-	"google.golang.org/api/iterator"
+	"sort"
+	"time"
 )
 
-var FirestoreClient *firestore.Client
-var projectID = "ems-web-application-409305"
-
 func removeElementsFromB(A []string, B []string) []string {
 	result := make([]string, 0, len(B))
 
@@ -34,97 +30,86 @@ func removeElementsFromB(A []string, B []string) []string {
 	return result
 }
 
-// InitializeFirestore initializes the Firestore client.
-func InitializeFirestore() error {
-	ctx := context.Background()
-
-	client, err := firestore.NewClient(ctx, projectID)
+// AuthenticatedEmployee returns the employee a verified token was issued to.
+func (c *Controller) AuthenticatedEmployee(username string) (*sharedpackage.Employee, error) {
+	employee, err := c.Employees.FindEmployeeByEmail(context.Background(), username)
 	if err != nil {
-		return fmt.Errorf("Failed to create Firestore client: %v", err)
+		if isNotFound(err) {
+			return nil, notFound("User %s not found", username)
+		}
+		log.Printf("ERROR: Error getting document: %v", err)
+		return nil, fmt.Errorf("Error getting document: %w", err)
 	}
-
-	FirestoreClient = client
-	log.Println("INFO: Firestore client successfully initialized.")
-	return nil
+	return employee, nil
 }
 
-func LoginUser(username string) (*string, error) {
-	ctx := context.Background()
+// putEmployeeWithBindings writes the employee together with one outbox
+// operation per project carrying that project's binding changes, so IAM
+// follows the document. Grants of roles the employee lost are dropped.
+func (c *Controller) putEmployeeWithBindings(ctx context.Context, empID string, employee sharedpackage.Employee, deltas map[string][]sharedpackage.BindingDelta) error {
+	pruneRoleGrants(&employee)
+	return c.Operations.PutEmployeeWithOperations(ctx, empID, employee, bindingOperations(empID, deltas))
+}
 
-	// Check if Firestore client is initialized
-	if FirestoreClient == nil {
-		log.Println("ERROR: Firestore client not initialized")
-		return nil, errors.New("Firestore client not initialized")
+// bindingOperations returns one IAM operation per project of deltas, in
+// project order.
+func bindingOperations(empID string, deltas map[string][]sharedpackage.BindingDelta) []sharedpackage.IAMOperation {
+	projects := make([]string, 0, len(deltas))
+	for projectID := range deltas {
+		projects = append(projects, projectID)
 	}
-
-	// Create a query to search for documents where the specified field equals the specified value
-	query := FirestoreClient.Collection("employees").Where("mailID", "==", username)
-
-	// Execute the query
-	iter := query.Documents(ctx)
-	defer iter.Stop()
-
-	// Iterate through the results
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			// No more documents to iterate
-			break
-		}
-		if err != nil {
-			fmt.Println("Error getting document:", err)
-			return nil, err
-		}
-
-		// Check if the "password" field exists in the document data
-		// Use type assertion to get the value and check if it exists
-		password, ok := doc.Data()["password"].(string)
-		if !ok {
-			fmt.Println("Password field not found or not a string in the document")
-			return nil, errors.New("Password field not found or not a string in the document")
-		}
-
-		// If the password field is found, return it
-		return &password, nil
+	sort.Strings(projects)
+
+	ops := make([]sharedpackage.IAMOperation, 0, len(projects))
+	for _, projectID := range projects {
+		ops = append(ops, sharedpackage.IAMOperation{
+			ProjectID:  projectID,
+			EmployeeID: empID,
+			Deltas:     deltas[projectID],
+		})
 	}
+	return ops
+}
 
-	// If no document is found with the specified username, return an error
-	return nil, errors.New("ERROR: User not found")
+// AssignIAMRole adds new roles to an employee document in the Firestore
+// database. A grant with an expiry makes them time-bound; nil grants them
+// indefinitely.
+func (c *Controller) AssignIAMRole(deptID string, teamID string, empID string, newRoles []string, role string, grant *sharedpackage.RoleGrant) (*sharedpackage.Employee, error) {
+	employee, err := c.assignIAMRole(deptID, teamID, empID, newRoles, role, grant)
+	if err != nil {
+		return nil, err
+	}
+	c.Outbox.Notify()
+	return employee, nil
 }
 
-// AddToDBAndAssign adds new roles to an employee document in the Firestore database.
-func AssignIAMRole(deptID string, teamID string, empID string, newRoles []string, role string) (*sharedpackage.Employee, error) {
+// assignIAMRole does the work of AssignIAMRole without waking the outbox
+// worker, so callers making several changes have them applied together.
+func (c *Controller) assignIAMRole(deptID string, teamID string, empID string, newRoles []string, role string, grant *sharedpackage.RoleGrant) (*sharedpackage.Employee, error) {
 	ctx := context.Background()
 	var key string
-	// Check if Firestore client is initialized
-	if FirestoreClient == nil {
-		log.Println("ERROR: Firestore client not initialized")
-		return nil, errors.New("Firestore client not initialized")
-	}
-
-	// Specify the path to the document
-	docRef := FirestoreClient.Collection("employees").Doc(empID)
 
-	// Get the document snapshot
-	docSnapshot, err := docRef.Get(ctx)
-	if err != nil {
-		log.Printf("ERROR: Error getting document: %v", err)
-		return nil, fmt.Errorf("Error getting document: %v", err)
+	// Reject malformed role names and past expiries before anything is stored
+	for _, newRole := range newRoles {
+		if err := iamRole.ValidateRole(newRole); err != nil {
+			log.Printf("ERROR: %v", err)
+			return nil, err
+		}
 	}
-
-	// Check if the document exists
-	if !docSnapshot.Exists() {
-		log.Printf("ERROR: Document with ID %s does not exist", empID)
-		return nil, fmt.Errorf("Document with ID %s does not exist", empID)
+	if err := validateGrant(grant, time.Now()); err != nil {
+		log.Printf("ERROR: %v", err)
+		return nil, err
 	}
+	requested := append([]string(nil), newRoles...)
 
-	// Initialize an empty Employee struct
-	var employee sharedpackage.Employee
-
-	// Convert Firestore document data to the Employee struct
-	if err := docSnapshot.DataTo(&employee); err != nil {
-		log.Printf("ERROR: Error converting document data: %v", err)
-		return nil, fmt.Errorf("Error converting document data: %v", err)
+	employee, err := c.Employees.GetEmployee(ctx, empID)
+	if err != nil {
+		if isNotFound(err) {
+			log.Printf("ERROR: Document with ID %s does not exist", empID)
+			return nil, notFound("Document with ID %s does not exist", empID)
+		}
+		log.Printf("ERROR: Error getting document: %v", err)
+		return nil, fmt.Errorf("Error getting document: %w", err)
 	}
 
 	log.Printf("INFO: Found employee with ID: %s", empID)
@@ -145,12 +130,44 @@ func AssignIAMRole(deptID string, teamID string, empID string, newRoles []string
 		key = teamID
 	}
 
+	if employee.IAMRoles == nil {
+		employee.IAMRoles = make(map[string][]string)
+	}
+
+	// Note which requested roles the group already grants, and under which condition
+	held := make(map[string]*sharedpackage.Condition)
+	for _, newRole := range requested {
+		if contains(employee.IAMRoles[key], newRole) {
+			held[newRole] = roleCondition(employee, key, newRole)
+		}
+	}
+
+	// The roles are granted in every project the group targets
+	resolver := c.newProjectResolver()
+	projects, err := resolver.groupProjects(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
 	// Iterate over all keys in employee.IAMRoles
-	for _, roles := range employee.IAMRoles {
-		// Create a map to store unique roles from the existing slice
+	for group, roles := range employee.IAMRoles {
+		// A role held through a group of other projects is no duplicate
+		groupProjects, err := resolver.groupProjects(ctx, group)
+		if err != nil {
+			return nil, err
+		}
+		if !overlaps(groupProjects, projects) {
+			continue
+		}
+
+		// Create a map to store unique roles from the existing slice; roles
+		// restricted there by an expiry or condition do not make a grant
+		// through this group redundant
 		existingRolesMap := make(map[string]struct{})
 		for _, role := range roles {
-			existingRolesMap[role] = struct{}{}
+			if group == key || roleCondition(employee, group, role) == nil {
+				existingRolesMap[role] = struct{}{}
+			}
 		}
 
 		// Check if any role from newRoles exists in the existingRolesMap
@@ -192,52 +209,87 @@ func AssignIAMRole(deptID string, teamID string, empID string, newRoles []string
 		log.Printf("INFO: Created new field with key %v and vale %v.", key, newRoles)
 	}
 
-	// Update the document with the modified IAMRoles field
-	// if _, err := docRef.Set(ctx, map[string]interface{}{"iamRoles": employee.IAMRoles}, firestore.MergeAll); err != nil {
-	// 	log.Printf("ERROR: Error updating document: %v", err)
-	// 	return nil, fmt.Errorf("Error updating document: %v", err)
-	// }
+	// Record the expiry of the requested roles the group grants now
+	var replaced []sharedpackage.BindingDelta
+	for _, newRole := range requested {
+		if !contains(employee.IAMRoles[key], newRole) {
+			continue
+		}
+		previous, wasHeld := held[newRole]
+		updateRoleGrant(employee, key, newRole, grant, wasHeld)
+		if wasHeld && iamRole.ConditionKey(previous) != iamRole.ConditionKey(roleCondition(employee, key, newRole)) {
+			replaced = append(replaced, sharedpackage.BindingDelta{Action: sharedpackage.BindingRemove, Role: newRole, Member: iamRole.Member(employee.Email), Condition: previous})
+		}
+	}
 
-	_, err = docRef.Set(ctx, employee)
-	if err != nil {
+	grants := make([]reconciler.Grant, 0, len(employee.IAMRoles[key]))
+	for _, keyRole := range employee.IAMRoles[key] {
+		grants = append(grants, reconciler.Grant{Role: keyRole, Condition: roleCondition(employee, key, keyRole)})
+	}
+	deltas := make(map[string][]sharedpackage.BindingDelta, len(projects))
+	for _, projectID := range projects {
+		deltas[projectID] = append(append([]sharedpackage.BindingDelta(nil), replaced...), grantDeltas(employee.Email, grants)...)
+	}
+	if err := c.putEmployeeWithBindings(ctx, empID, *employee, deltas); err != nil {
 		log.Printf("ERROR: Failed to add team document: %v", err)
-		return nil, fmt.Errorf("Failed to add team document: %v", err)
+		return nil, fmt.Errorf("Failed to add team document: %w", err)
 	}
 
-	// Call the function directly without specifying the package name
-	iamRole.AssignIAM(projectID, employee.IAMRoles[key], employee.Email)
-	return &employee, nil
+	return employee, nil
 }
 
-// Remove deletes an employee document from the Firestore database.
-func RemoveMember(empID string) error {
-	// Specify the path to the document
+// RemoveMember strips an employee from the Firestore database.
+func (c *Controller) RemoveMember(empID string) error {
+	if err := c.removeMember(empID); err != nil {
+		return err
+	}
+	c.Outbox.Notify()
+	return nil
+}
+
+// removeMember does the work of RemoveMember without waking the outbox worker.
+func (c *Controller) removeMember(empID string) error {
 	ctx := context.Background()
-	docRef := FirestoreClient.Collection("employees").Doc(empID)
 
-	// Get the document snapshot
-	docSnapshot, err := docRef.Get(ctx)
+	employee, err := c.Employees.GetEmployee(ctx, empID)
 	if err != nil {
+		if isNotFound(err) {
+			log.Printf("ERROR: Document with ID %s does not exist", empID)
+			return notFound("Document with ID %s does not exist", empID)
+		}
 		log.Printf("ERROR: Error getting document: %v", err)
-		return fmt.Errorf("Error getting document: %v", err)
+		return fmt.Errorf("Error getting document: %w", err)
 	}
 
-	// Check if the document exists
-	if !docSnapshot.Exists() {
-		log.Printf("ERROR: Document with ID %s does not exist", empID)
-		return fmt.Errorf("Document with ID %s does not exist", empID)
+	revoke, err := c.stripMember(ctx, c.newProjectResolver(), employee)
+	if err != nil {
+		return err
 	}
 
-	// Initialize an empty Employee struct
-	var employee sharedpackage.Employee
-
-	// Convert Firestore document data to the Employee struct
-	if err := docSnapshot.DataTo(&employee); err != nil {
-		log.Printf("ERROR: Error converting document data: %v", err)
-		return fmt.Errorf("Error converting document data: %v", err)
+	// Update the document with the modified field
+	if err := c.putEmployeeWithBindings(ctx, empID, *employee, revoke); err != nil {
+		log.Printf("ERROR: Error updating document: %v", err)
+		return fmt.Errorf("Error updating document: %w", err)
 	}
 
-	iamRole.RemoveIAM(projectID, employee.Email)
+	log.Printf("INFO: Document with ID %s successfully deleted", empID)
+
+	return nil
+}
+
+// stripMember clears the employee's IAM roles, job role, department and
+// teams and returns the deltas revoking their bindings in every project their
+// groups targeted, and the default project.
+func (c *Controller) stripMember(ctx context.Context, r *projectResolver, employee *sharedpackage.Employee) (map[string][]sharedpackage.BindingDelta, error) {
+	// Revoke in every project the employee's groups target
+	previous, err := r.projectRoles(ctx, employee)
+	if err != nil {
+		return nil, err
+	}
+	revoke := map[string][]sharedpackage.BindingDelta{c.ProjectID: {iamRole.RevokeAllDelta(employee.Email)}}
+	for projectID := range previous {
+		revoke[projectID] = []sharedpackage.BindingDelta{iamRole.RevokeAllDelta(employee.Email)}
+	}
 
 	// Delete all keys from the map
 	for key := range employee.IAMRoles {
@@ -250,46 +302,29 @@ func RemoveMember(empID string) error {
 	employee.Role = ""
 	employee.TeamIDs = make([]string, 0)
 	employee.DeptID = ""
-
-	// Update the document with the modified field
-	if _, err := docRef.Set(ctx, employee); err != nil {
-		log.Printf("ERROR: Error updating document: %v", err)
-		return fmt.Errorf("Error updating document: %v", err)
-	}
-
-	log.Printf("INFO: Document with ID %s successfully deleted", empID)
-
-	return nil
+	return revoke, nil
 }
 
-func RemoveIAMRoles(empID string, info sharedpackage.RemoveRoles) (*sharedpackage.Employee, error) {
+// RemoveIAMRoles removes the given roles from one group of the employee's IAM roles.
+func (c *Controller) RemoveIAMRoles(empID string, info sharedpackage.RemoveRoles) (*sharedpackage.Employee, error) {
 	ctx := context.Background()
-	docRef := FirestoreClient.Collection("employees").Doc(empID)
 
-	// Get the document snapshot
-	docSnapshot, err := docRef.Get(ctx)
+	employee, err := c.Employees.GetEmployee(ctx, empID)
 	if err != nil {
+		if isNotFound(err) {
+			log.Printf("ERROR: Document with ID %s does not exist", empID)
+			return nil, notFound("Document with ID %s does not exist", empID)
+		}
 		log.Printf("ERROR: Error getting document: %v", err)
-		return nil, fmt.Errorf("Error getting document: %v", err)
+		return nil, fmt.Errorf("Error getting document: %w", err)
 	}
 
-	// Check if the document exists
-	if !docSnapshot.Exists() {
-		log.Printf("ERROR: Document with ID %s does not exist", empID)
-		return nil, fmt.Errorf("Document with ID %s does not exist", empID)
-	}
-
-	// Initialize an empty Employee struct
-	var employee sharedpackage.Employee
-
-	// Convert Firestore document data to the Employee struct
-	if err := docSnapshot.DataTo(&employee); err != nil {
-		log.Printf("ERROR: Error converting document data: %v", err)
-		return nil, fmt.Errorf("Error converting document data: %v", err)
+	resolver := c.newProjectResolver()
+	previous, err := resolver.projectRoles(ctx, employee)
+	if err != nil {
+		return nil, err
 	}
 
-	// Assuming employee.IAMRoles is a map[string][]string
-
 	// Loop through the map using range
 	for key, value := range employee.IAMRoles {
 		// Check if the key matches the GroupID
@@ -301,20 +336,131 @@ func RemoveIAMRoles(empID string, info sharedpackage.RemoveRoles) (*sharedpackag
 		}
 	}
 
-	// Remove IAM roles using your iamRole.RemoveIAM function
-	iamRole.RemoveIAM(projectID, employee.Email)
-
-	// Loop through the map using range
-	for _, roles := range employee.IAMRoles {
-		// Assign IAM roles using your iamRole.AssignIAM function
-		iamRole.AssignIAM(projectID, roles, employee.Email)
+	// Revoke every binding and re-grant the remaining roles in one operation per project
+	deltas, err := resolver.rebindDeltas(ctx, employee.Email, employee, previous)
+	if err != nil {
+		return nil, err
 	}
 
 	// Update the document with the modified field
-	if _, err := docRef.Set(ctx, employee); err != nil {
+	if err := c.putEmployeeWithBindings(ctx, empID, *employee, deltas); err != nil {
 		log.Printf("ERROR: Error updating document: %v", err)
-		return nil, fmt.Errorf("Error updating document: %v", err)
+		return nil, fmt.Errorf("Error updating document: %w", err)
+	}
+	c.Outbox.Notify()
+
+	return employee, nil
+}
+
+// expectedBindings works out, for the default project and every project a
+// department or team targets, the roles each employee should hold there.
+func (c *Controller) expectedBindings(ctx context.Context) (map[string]reconciler.Expected, error) {
+	employees, err := c.Employees.ListEmployees(ctx)
+	if err != nil {
+		log.Printf("ERROR: Error iterating over documents: %v", err)
+		return nil, fmt.Errorf("Failed to list employees: %w", err)
+	}
+	departments, err := c.Departments.ListDepartments(ctx)
+	if err != nil {
+		log.Printf("ERROR: Error iterating over documents: %v", err)
+		return nil, fmt.Errorf("Failed to list departments: %w", err)
+	}
+	teams, err := c.Teams.ListTeams(ctx)
+	if err != nil {
+		log.Printf("ERROR: Error iterating over documents: %v", err)
+		return nil, fmt.Errorf("Failed to list teams: %w", err)
+	}
+
+	// Step 1: Every targeted project is checked, even without members
+	expected := map[string]reconciler.Expected{c.ProjectID: {}}
+	resolver := c.newProjectResolver()
+	for i := range departments {
+		resolver.departments[departments[i].ID] = &departments[i]
+		for _, projectID := range departments[i].ProjectIDs {
+			expected[projectID] = reconciler.Expected{}
+		}
+	}
+	for i := range teams {
+		resolver.teams[teams[i].ID] = &teams[i]
+		for _, projectID := range teams[i].ProjectIDs {
+			expected[projectID] = reconciler.Expected{}
+		}
 	}
 
-	return &employee, nil
+	// Step 2: Every employee is known in every project, with the roles their groups target there
+	for i := range employees {
+		if employees[i].Email == "" {
+			continue
+		}
+		byProject, err := resolver.projectGrants(ctx, &employees[i])
+		if err != nil {
+			return nil, err
+		}
+		member := iamRole.Member(employees[i].Email)
+		for projectID := range expected {
+			expected[projectID][member] = append(expected[projectID][member], byProject[projectID]...)
+		}
+	}
+	return expected, nil
+}
+
+// sortedProjects returns the projects of expected in ascending order.
+func sortedProjects(expected map[string]reconciler.Expected) []string {
+	projects := make([]string, 0, len(expected))
+	for projectID := range expected {
+		projects = append(projects, projectID)
+	}
+	sort.Strings(projects)
+	return projects
+}
+
+// IAMDrift compares the live IAM policy of every targeted project with the
+// employees' iamRoles.
+func (c *Controller) IAMDrift() ([]*reconciler.DriftReport, error) {
+	ctx := context.Background()
+
+	expected, err := c.expectedBindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]*reconciler.DriftReport, 0, len(expected))
+	for _, projectID := range sortedProjects(expected) {
+		report, err := reconciler.DetectDrift(ctx, c.Operations, projectID, expected[projectID])
+		if err != nil {
+			log.Printf("ERROR: Failed to detect IAM drift: %v", err)
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// ReconcileIAM brings the IAM policy of every targeted project in line with
+// the employees' iamRoles. Pending outbox operations are applied first so
+// they are not reported as drift.
+func (c *Controller) ReconcileIAM(dryRun bool) ([]*reconciler.ReconcileResult, error) {
+	ctx := context.Background()
+
+	if !dryRun {
+		if err := c.Outbox.Drain(ctx); err != nil {
+			log.Printf("WARN: IAM outbox not drained before reconciling: %v", err)
+		}
+	}
+
+	expected, err := c.expectedBindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*reconciler.ReconcileResult, 0, len(expected))
+	for _, projectID := range sortedProjects(expected) {
+		result, err := reconciler.Reconcile(ctx, c.Operations, projectID, expected[projectID], dryRun)
+		if err != nil {
+			log.Printf("ERROR: Failed to reconcile IAM: %v", err)
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
 }
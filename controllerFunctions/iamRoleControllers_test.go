@@ -0,0 +1,225 @@
+package controllerFunctions
+
+import (
+	"Task_04/iamRole"
+	"Task_04/sharedpackage"
+	"Task_04/storage"
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+const (
+	iamTestEmployee = "emp_1"
+	iamTestMail     = "member@example.com"
+)
+
+// newIAMController returns a Controller on a MemoryStore whose IAM changes
+// reach a fresh FakeProvider. dept_1 grants in the default project-one, as
+// does its team_2; team_1 targets project-one and project-two.
+func newIAMController(t *testing.T) (*Controller, *storage.MemoryStore, *iamRole.FakeProvider) {
+	t.Helper()
+	ctx := context.Background()
+
+	fake, err := iamRole.NewFakeProvider("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	iamRole.SetPolicyProvider(fake)
+	t.Cleanup(func() { iamRole.SetPolicyProvider(nil) })
+
+	store := storage.NewMemoryStore()
+	if err := store.PutDepartment(ctx, "dept_1", sharedpackage.Department{ID: "dept_1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, team := range []sharedpackage.Team{
+		{ID: "team_1", DepartmentID: "dept_1", ProjectIDs: []string{"project-one", "project-two"}},
+		{ID: "team_2", DepartmentID: "dept_1"},
+	} {
+		if err := store.PutTeam(ctx, team.ID, team); err != nil {
+			t.Fatal(err)
+		}
+	}
+	employee := sharedpackage.Employee{
+		Email:    iamTestMail,
+		Role:     "Engineer",
+		DeptID:   "dept_1",
+		TeamIDs:  []string{"team_1", "team_2"},
+		IAMRoles: map[string][]string{"0": {}},
+	}
+	if err := store.PutEmployee(ctx, iamTestEmployee, employee); err != nil {
+		t.Fatal(err)
+	}
+	return NewController(store, "project-one"), store, fake
+}
+
+// pendingProjects returns the project of every pending IAM operation, sorted.
+func pendingProjects(t *testing.T, store *storage.MemoryStore) []string {
+	t.Helper()
+	ops, err := store.PendingOperations(context.Background(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	projects := make([]string, 0, len(ops))
+	for _, op := range ops {
+		projects = append(projects, op.ProjectID)
+	}
+	sort.Strings(projects)
+	return projects
+}
+
+// drainOutbox applies every pending IAM operation to the fake provider.
+func drainOutbox(t *testing.T, c *Controller, store *storage.MemoryStore) {
+	t.Helper()
+	if err := c.Outbox.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	if pending := pendingProjects(t, store); len(pending) != 0 {
+		t.Fatalf("operations still pending for %v", pending)
+	}
+}
+
+// memberRoles returns the roles the test employee is bound to in the project.
+func memberRoles(fake *iamRole.FakeProvider, projectID string) []string {
+	return rolesOf(fake, projectID, iamTestMail)
+}
+
+func TestAssignIAMRoleGrantsInEveryProjectOfTheGroup(t *testing.T) {
+	c, store, fake := newIAMController(t)
+
+	employee, err := c.AssignIAMRole("dept_1", "team_1", iamTestEmployee, []string{"roles/viewer", "roles/editor"}, "Engineer", nil)
+	if err != nil {
+		t.Fatalf("AssignIAMRole() error = %v", err)
+	}
+	if want := []string{"roles/viewer", "roles/editor"}; !reflect.DeepEqual(employee.IAMRoles["team_1"], want) {
+		t.Fatalf("iamRoles[team_1] = %v, want %v", employee.IAMRoles["team_1"], want)
+	}
+
+	// One operation per project the team targets
+	if got, want := pendingProjects(t, store), []string{"project-one", "project-two"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pending operations = %v, want %v", got, want)
+	}
+
+	drainOutbox(t, c, store)
+	for _, projectID := range []string{"project-one", "project-two"} {
+		if got, want := memberRoles(fake, projectID), []string{"roles/editor", "roles/viewer"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("roles on %s = %v, want %v", projectID, got, want)
+		}
+	}
+	if calls := fake.SetPolicyCalls(); calls != 2 {
+		t.Fatalf("SetPolicy calls = %d, want one per project", calls)
+	}
+}
+
+func TestAssignIAMRoleRejectsMalformedRoles(t *testing.T) {
+	c, store, fake := newIAMController(t)
+
+	_, err := c.AssignIAMRole("dept_1", "team_1", iamTestEmployee, []string{"viewer"}, "Engineer", nil)
+	if !errors.Is(err, iamRole.ErrInvalidRole) {
+		t.Fatalf("AssignIAMRole() error = %v, want ErrInvalidRole", err)
+	}
+
+	employee, err := store.GetEmployee(context.Background(), iamTestEmployee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles, ok := employee.IAMRoles["team_1"]; ok {
+		t.Fatalf("iamRoles[team_1] = %v, want nothing stored", roles)
+	}
+	if pending := pendingProjects(t, store); len(pending) != 0 {
+		t.Fatalf("pending operations = %v, want none", pending)
+	}
+	if calls := fake.SetPolicyCalls(); calls != 0 {
+		t.Fatalf("SetPolicy calls = %d, want none", calls)
+	}
+}
+
+func TestRemoveIAMRolesRebindsRemainingRoles(t *testing.T) {
+	c, store, fake := newIAMController(t)
+
+	if _, err := c.AssignIAMRole("dept_1", "team_1", iamTestEmployee, []string{"roles/viewer", "roles/editor"}, "Engineer", nil); err != nil {
+		t.Fatalf("AssignIAMRole() error = %v", err)
+	}
+	drainOutbox(t, c, store)
+
+	employee, err := c.RemoveIAMRoles(iamTestEmployee, sharedpackage.RemoveRoles{GroupID: "team_1", IAMRoles: []string{"roles/editor"}})
+	if err != nil {
+		t.Fatalf("RemoveIAMRoles() error = %v", err)
+	}
+	if want := []string{"roles/viewer"}; !reflect.DeepEqual(employee.IAMRoles["team_1"], want) {
+		t.Fatalf("iamRoles[team_1] = %v, want %v", employee.IAMRoles["team_1"], want)
+	}
+
+	drainOutbox(t, c, store)
+	for _, projectID := range []string{"project-one", "project-two"} {
+		if got, want := memberRoles(fake, projectID), []string{"roles/viewer"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("roles on %s = %v, want %v", projectID, got, want)
+		}
+	}
+}
+
+func TestOutboxWritesEachProjectOnce(t *testing.T) {
+	c, store, fake := newIAMController(t)
+
+	// Three changes queue operations on project-one twice and project-two once
+	if _, err := c.AssignIAMRole("dept_1", "team_1", iamTestEmployee, []string{"roles/viewer", "roles/editor"}, "Engineer", nil); err != nil {
+		t.Fatalf("AssignIAMRole() error = %v", err)
+	}
+	if _, err := c.AssignIAMRole("dept_1", "team_2", iamTestEmployee, []string{"roles/browser"}, "Engineer", nil); err != nil {
+		t.Fatalf("AssignIAMRole() error = %v", err)
+	}
+	if got, want := pendingProjects(t, store), []string{"project-one", "project-one", "project-two"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pending operations = %v, want %v", got, want)
+	}
+
+	drainOutbox(t, c, store)
+	if calls := fake.SetPolicyCalls(); calls != 2 {
+		t.Fatalf("SetPolicy calls = %d, want one per project", calls)
+	}
+	if got, want := memberRoles(fake, "project-one"), []string{"roles/browser", "roles/editor", "roles/viewer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("roles on project-one = %v, want %v", got, want)
+	}
+	if got, want := memberRoles(fake, "project-two"), []string{"roles/editor", "roles/viewer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("roles on project-two = %v, want %v", got, want)
+	}
+}
+
+func TestConditionalGrantsSurviveOtherRoleChanges(t *testing.T) {
+	c, store, _ := newIAMController(t)
+
+	expiresAt := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	expiry := iamRole.ExpiryCondition(expiresAt)
+	if _, err := c.AssignIAMRole("dept_1", "team_2", iamTestEmployee, []string{"roles/editor"}, "Engineer", &sharedpackage.RoleGrant{ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("AssignIAMRole() error = %v", err)
+	}
+
+	// Granting and removing another role rebinds the employee; the
+	// time-bound editor binding must come back under its condition
+	if _, err := c.AssignIAMRole("dept_1", "team_2", iamTestEmployee, []string{"roles/viewer"}, "Engineer", nil); err != nil {
+		t.Fatalf("AssignIAMRole() error = %v", err)
+	}
+	if _, err := c.RemoveIAMRoles(iamTestEmployee, sharedpackage.RemoveRoles{GroupID: "team_2", IAMRoles: []string{"roles/viewer"}}); err != nil {
+		t.Fatalf("RemoveIAMRoles() error = %v", err)
+	}
+	drainOutbox(t, c, store)
+
+	bindings, err := iamRole.ProjectBindings("project-one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []sharedpackage.Binding{{Role: "roles/editor", Members: []string{iamRole.Member(iamTestMail)}, Condition: expiry}}
+	if !reflect.DeepEqual(bindings, want) {
+		t.Fatalf("bindings = %+v, want %+v", bindings, want)
+	}
+
+	employee, err := store.GetEmployee(context.Background(), iamTestEmployee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grant := employee.RoleGrants["team_2"]["roles/editor"]; grant.ExpiresAt == nil || !grant.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("roleGrants[team_2][roles/editor] = %+v, want expiry %s", grant, expiresAt)
+	}
+}
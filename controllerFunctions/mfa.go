@@ -0,0 +1,203 @@
+package controllerFunctions
+
+import (
+	"Task_04/authToken"
+	"Task_04/sharedpackage"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// MFA errors.
+var (
+	ErrMFARequired           = errors.New("multi-factor code required")
+	ErrInvalidMFACode        = errors.New("invalid multi-factor code")
+	ErrMFAAlreadyEnabled     = errors.New("multi-factor authentication already enabled")
+	ErrMFANotEnrolled        = errors.New("multi-factor authentication not enrolled")
+	ErrMFAEnrollmentRequired = errors.New("multi-factor enrollment required")
+)
+
+// MFA policy: employees with one of MFARoles must enroll before they may
+// perform any other request. MFAIssuer names the service in authenticator apps.
+var (
+	MFARoles          = []string{sharedpackage.RoleAdmin, sharedpackage.RoleHOD}
+	MFAIssuer         = "EMS"
+	RecoveryCodeCount = 10
+)
+
+// MFAEnrollment is what an authenticator app needs to enroll.
+type MFAEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthURI"`
+}
+
+// MFARequired reports whether the employee's role requires MFA.
+func MFARequired(employee *sharedpackage.Employee) bool {
+	return contains(MFARoles, employee.Role)
+}
+
+// EnrollMFA starts MFA enrollment with a new TOTP secret. It is not enabled
+// until ConfirmMFA verifies a first code. An enabled MFA can only be
+// replaced after an admin reset, so a stolen session cannot move it to
+// another device.
+func (c *Controller) EnrollMFA(empID string) (*MFAEnrollment, error) {
+	ctx := context.Background()
+
+	secret, err := authToken.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	employee, err := c.updateMFA(ctx, empID, func(employee *sharedpackage.Employee) error {
+		if employee.MFAEnabled {
+			return ErrMFAAlreadyEnabled
+		}
+		employee.MFASecret = secret
+		employee.MFALastStep = 0
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: Started MFA enrollment of %s", empID)
+	return &MFAEnrollment{Secret: secret, OTPAuthURI: authToken.TOTPURI(MFAIssuer, employee.Email, secret)}, nil
+}
+
+// ConfirmMFA enables MFA once code matches the enrolled secret and returns
+// the recovery codes. They are only ever shown here; the employee keeps
+// their SHA-256 hashes.
+func (c *Controller) ConfirmMFA(empID string, code string) ([]string, error) {
+	ctx := context.Background()
+	now := time.Now()
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.updateMFA(ctx, empID, func(employee *sharedpackage.Employee) error {
+		if employee.MFAEnabled {
+			return ErrMFAAlreadyEnabled
+		}
+		if employee.MFASecret == "" {
+			return ErrMFANotEnrolled
+		}
+		step, ok := authToken.ValidateTOTP(employee.MFASecret, code, now, employee.MFALastStep)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		employee.MFAEnabled = true
+		employee.MFALastStep = step
+		employee.RecoveryCodes = hashes
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: MFA enabled for %s", empID)
+	return codes, nil
+}
+
+// ResetMFA removes the employee's MFA, e.g. after a lost phone. Privileged
+// employees have to enroll again before they can do anything else.
+func (c *Controller) ResetMFA(empID string) (*sharedpackage.Employee, error) {
+	ctx := context.Background()
+
+	employee, err := c.updateMFA(ctx, empID, resetMFA)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("WARN: MFA reset for %s", empID)
+	return employee, nil
+}
+
+// updateMFA applies update to the MFA fields of the stored employee in one
+// atomic store update. Errors from update are returned as they are and a
+// missing employee is reported as not found.
+func (c *Controller) updateMFA(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	var rejected error
+	employee, err := c.Employees.UpdateEmployeeMFA(ctx, empID, func(employee *sharedpackage.Employee) error {
+		rejected = update(employee)
+		return rejected
+	})
+	switch {
+	case err == nil:
+		return employee, nil
+	case rejected != nil:
+		return nil, rejected
+	case isNotFound(err):
+		log.Printf("ERROR: Document with ID %s does not exist", empID)
+		return nil, notFound("Document with ID %s does not exist", empID)
+	default:
+		log.Printf("ERROR: Error updating document: %v", err)
+		return nil, fmt.Errorf("Error updating document: %w", err)
+	}
+}
+
+// verifyMFACode checks a TOTP code, or else a recovery code, and records
+// its use on employee: the TOTP step so it cannot be replayed, or the
+// removal of the recovery code. Login runs it inside UpdateEmployeeMFA, so
+// concurrent logins cannot use the same code twice.
+func verifyMFACode(employee *sharedpackage.Employee, code string, now time.Time) bool {
+	if step, ok := authToken.ValidateTOTP(employee.MFASecret, code, now, employee.MFALastStep); ok {
+		employee.MFALastStep = step
+		return true
+	}
+
+	hash := hashRecoveryCode(code)
+	for i, stored := range employee.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			employee.RecoveryCodes = append(employee.RecoveryCodes[:i:i], employee.RecoveryCodes[i+1:]...)
+			log.Printf("WARN: %s logged in with a recovery code, %d left", employee.ID, len(employee.RecoveryCodes))
+			return true
+		}
+	}
+	return false
+}
+
+func clearMFA(employee *sharedpackage.Employee) {
+	employee.MFAEnabled = false
+	employee.MFASecret = ""
+	employee.MFALastStep = 0
+	employee.RecoveryCodes = nil
+}
+
+// resetMFA is clearMFA as an UpdateEmployeeMFA update.
+func resetMFA(employee *sharedpackage.Employee) error {
+	clearMFA(employee)
+	return nil
+}
+
+// newRecoveryCodes returns RecoveryCodeCount random codes, formatted as
+// xxxxx-xxxxx, and their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, fmt.Errorf("Failed to generate recovery codes: %w", err)
+		}
+		code := strings.ToLower(encoding.EncodeToString(raw))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case and separators.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,170 @@
+package controllerFunctions
+
+import (
+	"Task_04/sharedpackage"
+	"Task_04/storage"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	authTestEmployee = "emp_auth"
+	authTestMail     = "auth@example.com"
+	authTestPassword = "Correct-Horse-42"
+)
+
+// newAuthController returns a Controller on a MemoryStore holding one Admin
+// who logs in as authTestMail with authTestPassword.
+func newAuthController(t *testing.T) (*Controller, *storage.MemoryStore) {
+	t.Helper()
+	hashed, err := HashPassword(authTestPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemoryStore()
+	employee := sharedpackage.Employee{
+		FirstName: "Ada",
+		LastName:  "Lovelace",
+		Email:     authTestMail,
+		Password:  hashed,
+		Role:      sharedpackage.RoleAdmin,
+	}
+	if err := store.PutEmployee(context.Background(), authTestEmployee, employee); err != nil {
+		t.Fatal(err)
+	}
+	return NewController(store, "project-one"), store
+}
+
+// totpAt returns the TOTP code of secret for the time step of now plus skew steps.
+func totpAt(t *testing.T, secret string, now time.Time, skew int64) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(now.Unix()/30+skew))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// enableMFA enrolls and confirms MFA for the test employee with the code of
+// now and returns the secret and the recovery codes.
+func enableMFA(t *testing.T, c *Controller, now time.Time) (string, []string) {
+	t.Helper()
+	enrollment, err := c.EnrollMFA(authTestEmployee)
+	if err != nil {
+		t.Fatalf("EnrollMFA() error = %v", err)
+	}
+	codes, err := c.ConfirmMFA(authTestEmployee, totpAt(t, enrollment.Secret, now, 0))
+	if err != nil {
+		t.Fatalf("ConfirmMFA() error = %v", err)
+	}
+	return enrollment.Secret, codes
+}
+
+func TestConfirmMFA(t *testing.T) {
+	c, store := newAuthController(t)
+
+	enrollment, err := c.EnrollMFA(authTestEmployee)
+	if err != nil {
+		t.Fatalf("EnrollMFA() error = %v", err)
+	}
+	if _, err := c.ConfirmMFA(authTestEmployee, "000000"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("ConfirmMFA() with a wrong code error = %v, want ErrInvalidMFACode", err)
+	}
+
+	codes, err := c.ConfirmMFA(authTestEmployee, totpAt(t, enrollment.Secret, time.Now(), 0))
+	if err != nil {
+		t.Fatalf("ConfirmMFA() error = %v", err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("recovery codes = %d, want %d", len(codes), RecoveryCodeCount)
+	}
+
+	// Only the hashes are stored, and an enabled MFA cannot be re-enrolled
+	employee, err := store.GetEmployee(context.Background(), authTestEmployee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !employee.MFAEnabled || len(employee.RecoveryCodes) != RecoveryCodeCount || employee.RecoveryCodes[0] == codes[0] {
+		t.Fatalf("employee = %+v, want MFA enabled with hashed recovery codes", employee)
+	}
+	if _, err := c.EnrollMFA(authTestEmployee); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Fatalf("EnrollMFA() after confirming error = %v, want ErrMFAAlreadyEnabled", err)
+	}
+}
+
+func TestLoginRefusesReplayedTOTP(t *testing.T) {
+	c, _ := newAuthController(t)
+	now := time.Now()
+	secret, _ := enableMFA(t, c, now)
+
+	if _, err := c.Login(authTestMail, authTestPassword, ""); !errors.Is(err, ErrMFARequired) {
+		t.Fatalf("Login() without a code error = %v, want ErrMFARequired", err)
+	}
+
+	// The code used to confirm is spent; the next step's code is still
+	// within the skew and is accepted once
+	if _, err := c.Login(authTestMail, authTestPassword, totpAt(t, secret, now, 0)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("Login() with the confirming code error = %v, want ErrInvalidMFACode", err)
+	}
+	next := totpAt(t, secret, now, 1)
+	if _, err := c.Login(authTestMail, authTestPassword, next); err != nil {
+		t.Fatalf("Login() with the next code error = %v", err)
+	}
+	if _, err := c.Login(authTestMail, authTestPassword, next); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("Login() replaying the next code error = %v, want ErrInvalidMFACode", err)
+	}
+}
+
+func TestLoginUsesRecoveryCodesOnce(t *testing.T) {
+	c, store := newAuthController(t)
+	_, codes := enableMFA(t, c, time.Now())
+
+	// Recovery codes ignore case and separators, and work once
+	if _, err := c.Login(authTestMail, authTestPassword, strings.ToUpper(strings.ReplaceAll(codes[3], "-", ""))); err != nil {
+		t.Fatalf("Login() with a recovery code error = %v", err)
+	}
+	if _, err := c.Login(authTestMail, authTestPassword, codes[3]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("Login() reusing a recovery code error = %v, want ErrInvalidMFACode", err)
+	}
+
+	stored, err := store.GetEmployee(context.Background(), authTestEmployee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.RecoveryCodes) != RecoveryCodeCount-1 {
+		t.Fatalf("recovery codes left = %d, want %d", len(stored.RecoveryCodes), RecoveryCodeCount-1)
+	}
+}
+
+func TestResetMFA(t *testing.T) {
+	c, _ := newAuthController(t)
+	enableMFA(t, c, time.Now())
+
+	employee, err := c.ResetMFA(authTestEmployee)
+	if err != nil {
+		t.Fatalf("ResetMFA() error = %v", err)
+	}
+	if employee.MFAEnabled || employee.MFASecret != "" || employee.MFALastStep != 0 || len(employee.RecoveryCodes) != 0 {
+		t.Fatalf("employee = %+v, want MFA cleared", employee)
+	}
+	if _, err := c.Login(authTestMail, authTestPassword, ""); err != nil {
+		t.Fatalf("Login() after the reset error = %v", err)
+	}
+	if _, err := c.EnrollMFA(authTestEmployee); err != nil {
+		t.Fatalf("EnrollMFA() after the reset error = %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package controllerFunctions
+
+import (
+	"Task_04/notifier"
+	"Task_04/sharedpackage"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password errors.
+var (
+	ErrWeakPassword         = errors.New("password does not meet the policy")
+	ErrInvalidPasswordToken = errors.New("invalid or expired password token")
+	ErrNoNotifier           = errors.New("no notifier configured")
+)
+
+// PasswordRules is a password strength policy.
+type PasswordRules struct {
+	MinLength int
+	// MaxLength guards bcrypt, which ignores everything after 72 bytes.
+	MaxLength int
+	// MinClasses is how many of lower case, upper case, digits and other
+	// characters a password must mix.
+	MinClasses int
+}
+
+// PasswordPolicy is the policy every new password must meet.
+var PasswordPolicy = PasswordRules{MinLength: 12, MaxLength: 72, MinClasses: 3}
+
+// How long invite and reset tokens stay valid.
+var (
+	InviteTokenTTL = 72 * time.Hour
+	ResetTokenTTL  = time.Hour
+)
+
+// Reset throttling: at most MaxResetRequests reset messages are sent to one
+// account per ResetRequestWindow. Further requests are ignored like those
+// for unknown addresses.
+var (
+	MaxResetRequests   = 3
+	ResetRequestWindow = time.Hour
+)
+
+// CheckPassword returns ErrWeakPassword, with the reason, unless password
+// meets PasswordPolicy. Passwords containing the employee's names or mail
+// address are refused as well.
+func CheckPassword(password string, employee *sharedpackage.Employee) error {
+	rules := PasswordPolicy
+	if len(password) < rules.MinLength {
+		return fmt.Errorf("%w: use at least %d characters", ErrWeakPassword, rules.MinLength)
+	}
+	if rules.MaxLength > 0 && len(password) > rules.MaxLength {
+		return fmt.Errorf("%w: use at most %d bytes", ErrWeakPassword, rules.MaxLength)
+	}
+
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			classes++
+		}
+	}
+	if classes < rules.MinClasses {
+		return fmt.Errorf("%w: mix at least %d of lower case, upper case, digits and symbols", ErrWeakPassword, rules.MinClasses)
+	}
+
+	if employee != nil {
+		mailbox, _, _ := strings.Cut(employee.Email, "@")
+		lowered := strings.ToLower(password)
+		for _, personal := range []string{employee.FirstName, employee.LastName, mailbox} {
+			if len(personal) >= 3 && strings.Contains(lowered, strings.ToLower(personal)) {
+				return fmt.Errorf("%w: do not use your name or mail address", ErrWeakPassword)
+			}
+		}
+	}
+	return nil
+}
+
+// HashPassword returns the bcrypt hash stored for a password.
+func HashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("Error while hashing password: %w", err)
+	}
+	return string(hashed), nil
+}
+
+// InviteEmployee sends the employee a token to set their first password.
+func (c *Controller) InviteEmployee(empID string) error {
+	ctx := context.Background()
+
+	employee, err := c.getEmployee(ctx, empID)
+	if err != nil {
+		return err
+	}
+	secret, err := c.issuePasswordToken(ctx, employee, sharedpackage.PasswordInvite, InviteTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	msg := notifier.Message{
+		To:      employee.Email,
+		Subject: "Set your EMS password",
+		Body: fmt.Sprintf("Hello %s,\n\nan EMS account was created for you. To choose your password, send the token below "+
+			"together with your new password to %s/auth/password within %s.\n\nToken: %s\n",
+			employee.FirstName, c.PublicURL, formatTTL(InviteTokenTTL), secret),
+	}
+	return c.notify(ctx, msg)
+}
+
+// RequestPasswordReset sends a reset token to the employee with the given
+// mail address. Unknown addresses and requests beyond MaxResetRequests are
+// ignored without an error, so the request can neither be used to find out
+// who has an account nor to flood a mailbox.
+func (c *Controller) RequestPasswordReset(username string) error {
+	ctx := context.Background()
+
+	employee, err := c.Employees.FindEmployeeByEmail(ctx, username)
+	if err != nil {
+		if isNotFound(err) {
+			log.Printf("WARN: Password reset requested for unknown user %s", username)
+			return nil
+		}
+		log.Printf("ERROR: Error getting document: %v", err)
+		return fmt.Errorf("Error getting document: %w", err)
+	}
+
+	sent, err := c.PasswordTokens.CountPasswordTokens(ctx, employee.ID, sharedpackage.PasswordReset, time.Now().Add(-ResetRequestWindow))
+	if err != nil {
+		log.Printf("ERROR: Failed to count password tokens of %s: %v", employee.ID, err)
+		return fmt.Errorf("Failed to count password tokens: %w", err)
+	}
+	if sent >= MaxResetRequests {
+		log.Printf("WARN: Password reset for %s throttled after %d requests within %s", employee.ID, sent, ResetRequestWindow)
+		return nil
+	}
+
+	secret, err := c.issuePasswordToken(ctx, employee, sharedpackage.PasswordReset, ResetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	msg := notifier.Message{
+		To:      employee.Email,
+		Subject: "Reset your EMS password",
+		Body: fmt.Sprintf("Hello %s,\n\na password reset was requested for your EMS account. To choose a new password, send the "+
+			"token below together with your new password to %s/auth/password within %s.\n\nToken: %s\n\n"+
+			"If you did not ask for this, ignore this message; your password stays unchanged.\n",
+			employee.FirstName, c.PublicURL, formatTTL(ResetTokenTTL), secret),
+	}
+	return c.notify(ctx, msg)
+}
+
+// ResetPassword sets the password of the employee a password token was sent
+// to. The token is used up, any other token of the employee stops working,
+// a lockout is lifted and every session is ended.
+func (c *Controller) ResetPassword(secret string, password string) error {
+	ctx := context.Background()
+	tokenID := hashToken(secret)
+
+	// Step 1: Check the token without using it up
+	token, err := c.PasswordTokens.GetPasswordToken(ctx, tokenID)
+	if err != nil {
+		if isNotFound(err) {
+			return ErrInvalidPasswordToken
+		}
+		log.Printf("ERROR: Failed to get password token: %v", err)
+		return fmt.Errorf("Failed to get password token: %w", err)
+	}
+	if token.Used || time.Now().After(token.ExpiresAt) {
+		return ErrInvalidPasswordToken
+	}
+	employee, err := c.Employees.GetEmployee(ctx, token.EmployeeID)
+	if err != nil {
+		if isNotFound(err) {
+			return ErrInvalidPasswordToken
+		}
+		log.Printf("ERROR: Error getting document: %v", err)
+		return fmt.Errorf("Error getting document: %w", err)
+	}
+
+	// Step 2: A weak password leaves the token usable for another try
+	if err := CheckPassword(password, employee); err != nil {
+		return err
+	}
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// Step 3: Use the token up; losing this race means it was used meanwhile
+	unused, err := c.PasswordTokens.UsePasswordToken(ctx, tokenID)
+	if err != nil {
+		log.Printf("ERROR: Failed to use password token: %v", err)
+		return fmt.Errorf("Failed to use password token: %w", err)
+	}
+	if !unused {
+		return ErrInvalidPasswordToken
+	}
+
+	// Step 4: Store the password and end everything issued before; only
+	// the password and lockout fields are written, so changes made since
+	// Step 1 survive
+	_, err = c.Employees.UpdateEmployeePassword(ctx, employee.ID, func(stored *sharedpackage.Employee) error {
+		stored.Password = hashed
+		clearLockout(stored)
+		return nil
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return ErrInvalidPasswordToken
+		}
+		log.Printf("ERROR: Error updating document: %v", err)
+		return fmt.Errorf("Error updating document: %w", err)
+	}
+	if err := c.PasswordTokens.UseEmployeePasswordTokens(ctx, employee.ID, ""); err != nil {
+		log.Printf("ERROR: Failed to invalidate password tokens of %s: %v", employee.ID, err)
+		return fmt.Errorf("Failed to invalidate password tokens: %w", err)
+	}
+	if err := c.RevokeSessions(employee.ID); err != nil {
+		return err
+	}
+
+	log.Printf("INFO: Password of %s set via %s token", employee.ID, token.Purpose)
+	return nil
+}
+
+// issuePasswordToken stores a new password token for the employee and
+// returns the token to send. Earlier tokens of the same purpose stop
+// working, so only the latest message of each kind can be used; a reset
+// request leaves a pending invite usable.
+func (c *Controller) issuePasswordToken(ctx context.Context, employee *sharedpackage.Employee, purpose string, ttl time.Duration) (string, error) {
+	if err := c.PasswordTokens.UseEmployeePasswordTokens(ctx, employee.ID, purpose); err != nil {
+		log.Printf("ERROR: Failed to invalidate password tokens of %s: %v", employee.ID, err)
+		return "", fmt.Errorf("Failed to invalidate password tokens: %w", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("Failed to generate password token: %w", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now().UTC()
+	token := sharedpackage.PasswordToken{
+		ID:         hashToken(secret),
+		EmployeeID: employee.ID,
+		Purpose:    purpose,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if err := c.PasswordTokens.CreatePasswordToken(ctx, token); err != nil {
+		log.Printf("ERROR: Failed to store password token: %v", err)
+		return "", fmt.Errorf("Failed to store password token: %w", err)
+	}
+	return secret, nil
+}
+
+// formatTTL renders a token lifetime for a message, e.g. "72 hours".
+func formatTTL(ttl time.Duration) string {
+	switch {
+	case ttl == time.Hour:
+		return "1 hour"
+	case ttl > time.Hour:
+		return fmt.Sprintf("%d hours", int(ttl.Hours()))
+	default:
+		return fmt.Sprintf("%d minutes", int(ttl.Minutes()))
+	}
+}
+
+// notify sends msg through the configured notifier.
+func (c *Controller) notify(ctx context.Context, msg notifier.Message) error {
+	if c.Notifier == nil {
+		log.Printf("ERROR: Cannot send %q to %s: %v", msg.Subject, msg.To, ErrNoNotifier)
+		return ErrNoNotifier
+	}
+	if err := c.Notifier.Send(ctx, msg); err != nil {
+		log.Printf("ERROR: Failed to send %q to %s: %v", msg.Subject, msg.To, err)
+		return fmt.Errorf("Failed to send notification: %w", err)
+	}
+	log.Printf("INFO: Sent %q to %s", msg.Subject, msg.To)
+	return nil
+}
@@ -0,0 +1,188 @@
+package controllerFunctions
+
+import (
+	"Task_04/notifier"
+	"Task_04/sharedpackage"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingNotifier keeps every message instead of sending it.
+type recordingNotifier struct {
+	mu       sync.Mutex
+	messages []notifier.Message
+}
+
+func (n *recordingNotifier) Send(ctx context.Context, msg notifier.Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+// sent returns how many messages were sent.
+func (n *recordingNotifier) sent() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.messages)
+}
+
+// lastToken returns the password token of the latest message.
+func (n *recordingNotifier) lastToken(t *testing.T) string {
+	t.Helper()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.messages) == 0 {
+		t.Fatal("no message sent")
+	}
+	_, rest, found := strings.Cut(n.messages[len(n.messages)-1].Body, "Token: ")
+	if !found {
+		t.Fatal("message carries no token")
+	}
+	token, _, _ := strings.Cut(rest, "\n")
+	return token
+}
+
+func TestCheckPassword(t *testing.T) {
+	employee := &sharedpackage.Employee{FirstName: "Ada", LastName: "Lovelace", Email: "countess@example.com"}
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"strong", "Analytical-Engine-1843", false},
+		{"three classes", "analytical engine 1843", false},
+		{"too short", "Ab1-short", true},
+		{"beyond bcrypt's 72 bytes", "Aa1-" + strings.Repeat("x", 69), true},
+		{"two classes", "analyticalengine1843", true},
+		{"last name", "Ada-LOVELACE-1815", true},
+		{"mailbox", "Countess-of-1815", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPassword(tt.password, employee)
+			if tt.wantErr != errors.Is(err, ErrWeakPassword) || tt.wantErr != (err != nil) {
+				t.Fatalf("CheckPassword(%q) error = %v, want error %v", tt.password, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResetPasswordUsesTheTokenOnce(t *testing.T) {
+	c, store := newAuthController(t)
+	mail := &recordingNotifier{}
+	c.Notifier = mail
+	ctx := context.Background()
+
+	// A locked account is unlocked by the reset
+	if _, err := store.UpdateEmployeeLockout(ctx, authTestEmployee, func(employee *sharedpackage.Employee) error {
+		employee.FailedLogins, employee.Lockouts = MaxFailedLogins, 1
+		employee.LockedUntil = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.RequestPasswordReset(authTestMail); err != nil {
+		t.Fatalf("RequestPasswordReset() error = %v", err)
+	}
+	token := mail.lastToken(t)
+
+	// A weak password leaves the token usable
+	if err := c.ResetPassword(token, "weak"); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("ResetPassword() with a weak password error = %v, want ErrWeakPassword", err)
+	}
+	const password = "Brand-New-Secret-7"
+	if err := c.ResetPassword(token, password); err != nil {
+		t.Fatalf("ResetPassword() error = %v", err)
+	}
+	if err := c.ResetPassword(token, "Another-Secret-8"); !errors.Is(err, ErrInvalidPasswordToken) {
+		t.Fatalf("ResetPassword() reusing the token error = %v, want ErrInvalidPasswordToken", err)
+	}
+
+	if _, err := c.Login(authTestMail, authTestPassword, ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login() with the old password error = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := c.Login(authTestMail, password, ""); err != nil {
+		t.Fatalf("Login() with the new password error = %v", err)
+	}
+}
+
+func TestResetPasswordRefusesExpiredTokens(t *testing.T) {
+	c, _ := newAuthController(t)
+	mail := &recordingNotifier{}
+	c.Notifier = mail
+
+	ttl := ResetTokenTTL
+	ResetTokenTTL = -time.Minute
+	t.Cleanup(func() { ResetTokenTTL = ttl })
+
+	if err := c.RequestPasswordReset(authTestMail); err != nil {
+		t.Fatalf("RequestPasswordReset() error = %v", err)
+	}
+	if err := c.ResetPassword(mail.lastToken(t), "Brand-New-Secret-7"); !errors.Is(err, ErrInvalidPasswordToken) {
+		t.Fatalf("ResetPassword() with an expired token error = %v, want ErrInvalidPasswordToken", err)
+	}
+	if err := c.ResetPassword("unknown", "Brand-New-Secret-7"); !errors.Is(err, ErrInvalidPasswordToken) {
+		t.Fatalf("ResetPassword() with an unknown token error = %v, want ErrInvalidPasswordToken", err)
+	}
+}
+
+func TestPasswordTokensAreSuperseded(t *testing.T) {
+	c, _ := newAuthController(t)
+	mail := &recordingNotifier{}
+	c.Notifier = mail
+
+	if err := c.InviteEmployee(authTestEmployee); err != nil {
+		t.Fatalf("InviteEmployee() error = %v", err)
+	}
+	invite := mail.lastToken(t)
+	if err := c.RequestPasswordReset(authTestMail); err != nil {
+		t.Fatalf("RequestPasswordReset() error = %v", err)
+	}
+	first := mail.lastToken(t)
+	if err := c.RequestPasswordReset(authTestMail); err != nil {
+		t.Fatalf("RequestPasswordReset() error = %v", err)
+	}
+	second := mail.lastToken(t)
+
+	// A new reset replaces the earlier reset but not the invite
+	if err := c.ResetPassword(first, "Brand-New-Secret-7"); !errors.Is(err, ErrInvalidPasswordToken) {
+		t.Fatalf("ResetPassword() with a superseded token error = %v, want ErrInvalidPasswordToken", err)
+	}
+	if err := c.ResetPassword(second, "Brand-New-Secret-7"); err != nil {
+		t.Fatalf("ResetPassword() with the latest token error = %v", err)
+	}
+
+	// Setting the password ends every other token, the invite included
+	if err := c.ResetPassword(invite, "Another-Secret-8"); !errors.Is(err, ErrInvalidPasswordToken) {
+		t.Fatalf("ResetPassword() with the invite after a reset error = %v, want ErrInvalidPasswordToken", err)
+	}
+}
+
+func TestRequestPasswordResetIsThrottled(t *testing.T) {
+	c, _ := newAuthController(t)
+	mail := &recordingNotifier{}
+	c.Notifier = mail
+
+	for i := 0; i < MaxResetRequests+2; i++ {
+		if err := c.RequestPasswordReset(authTestMail); err != nil {
+			t.Fatalf("RequestPasswordReset() error = %v", err)
+		}
+	}
+	if sent := mail.sent(); sent != MaxResetRequests {
+		t.Fatalf("messages sent = %d, want %d", sent, MaxResetRequests)
+	}
+
+	// Unknown addresses are ignored the same way
+	if err := c.RequestPasswordReset("nobody@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset() for an unknown address error = %v", err)
+	}
+	if sent := mail.sent(); sent != MaxResetRequests {
+		t.Fatalf("messages sent = %d, want %d", sent, MaxResetRequests)
+	}
+}
@@ -0,0 +1,105 @@
+package controllerFunctions
+
+import (
+	"Task_04/iamRole"
+	"Task_04/reconciler"
+	"Task_04/sharedpackage"
+	"Task_04/storage"
+	"context"
+	"fmt"
+	"log"
+)
+
+// planOutboxLimit bounds how many pending outbox operations a plan reads.
+const planOutboxLimit = 1000
+
+// Plan is what a request would change, worked out without applying anything.
+type Plan struct {
+	DryRun          bool                     `json:"dryRun"`
+	BindingChanges  []iamRole.BindingChange  `json:"bindingChanges"`
+	DocumentChanges []storage.DocumentChange `json:"documentChanges"`
+	// Result is what the request would have returned.
+	Result interface{} `json:"result,omitempty"`
+}
+
+// DryRun runs change against a copy of the stores and reports the document
+// and IAM binding changes it would make. The copy is discarded afterwards, so
+// nothing is written and no IAM policy is touched. Because change runs the
+// same controller code as the real request, cascades such as a department
+// deletion are planned exactly as they would be applied.
+func (c *Controller) DryRun(change func(*Controller) (interface{}, error)) (*Plan, error) {
+	ctx := context.Background()
+	log.Println("INFO: Dry run: changes below are planned, not applied.")
+
+	// Step 1: Copy the stores; the copy remembers the originals of the documents it writes
+	scratch, err := storage.Snapshot(ctx, c.Employees, c.Departments, c.Teams)
+	if err != nil {
+		log.Printf("ERROR: Failed to copy documents for dry run: %v", err)
+		return nil, err
+	}
+
+	// Step 2: Run the change against the copy
+	planner := &Controller{
+		Employees:        scratch,
+		Departments:      scratch,
+		Teams:            scratch,
+		Operations:       scratch,
+		RefreshTokens:    scratch,
+		PasswordTokens:   scratch,
+		RoleRequests:     scratch,
+		BreakGlassGrants: scratch,
+		ReviewCampaigns:  scratch,
+		Outbox:           reconciler.NewWorker(scratch),
+		ProjectID:        c.ProjectID,
+	}
+	result, err := change(planner)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		DryRun:          true,
+		BindingChanges:  []iamRole.BindingChange{},
+		DocumentChanges: scratch.Changes(),
+		Result:          result,
+	}
+	if plan.DocumentChanges == nil {
+		plan.DocumentChanges = []storage.DocumentChange{}
+	}
+
+	// Step 3: Work out the binding changes the recorded operations would make
+	planned, err := scratch.PendingOperations(ctx, planOutboxLimit)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := c.Operations.PendingOperations(ctx, planOutboxLimit)
+	if err != nil {
+		log.Printf("ERROR: Failed to read IAM outbox: %v", err)
+		return nil, fmt.Errorf("Failed to read IAM outbox: %w", err)
+	}
+
+	var projects []string
+	plannedDeltas := make(map[string][]sharedpackage.BindingDelta)
+	for _, op := range planned {
+		if _, seen := plannedDeltas[op.ProjectID]; !seen {
+			projects = append(projects, op.ProjectID)
+		}
+		plannedDeltas[op.ProjectID] = append(plannedDeltas[op.ProjectID], op.Deltas...)
+	}
+	pendingDeltas := make(map[string][]sharedpackage.BindingDelta)
+	for _, op := range pending {
+		pendingDeltas[op.ProjectID] = append(pendingDeltas[op.ProjectID], op.Deltas...)
+	}
+
+	for _, projectID := range projects {
+		changes, err := iamRole.PlanBindings(projectID, pendingDeltas[projectID], plannedDeltas[projectID])
+		if err != nil {
+			log.Printf("ERROR: Failed to plan IAM changes for project %s: %v", projectID, err)
+			return nil, fmt.Errorf("Failed to plan IAM changes for project %s: %w", projectID, err)
+		}
+		plan.BindingChanges = append(plan.BindingChanges, changes...)
+	}
+
+	log.Printf("INFO: Dry run planned %d binding changes and %d document changes", len(plan.BindingChanges), len(plan.DocumentChanges))
+	return plan, nil
+}
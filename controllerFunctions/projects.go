@@ -0,0 +1,340 @@
+package controllerFunctions
+
+import (
+	"Task_04/iamRole"
+	"Task_04/reconciler"
+	"Task_04/sharedpackage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// projectResolver works out which GCP projects the groups of an employee's
+// iamRoles are granted in. A team's own projectIDs win over those of its
+// department; groups without any, or whose department or team is gone, use
+// the controller's default project. Lookups are cached, so a resolver is
+// meant to live for a single request. A frozen resolver only answers from its
+// cache, for use inside store transactions, which must not read the store.
+type projectResolver struct {
+	c           *Controller
+	departments map[string]*sharedpackage.Department
+	teams       map[string]*sharedpackage.Team
+	frozen      bool
+}
+
+// unresolvedGroupError is returned by a frozen resolver for a department or
+// team it has not looked up yet.
+type unresolvedGroupError struct {
+	group string
+}
+
+func (e *unresolvedGroupError) Error() string {
+	return fmt.Sprintf("group %s was not resolved before the update", e.group)
+}
+
+func (c *Controller) newProjectResolver() *projectResolver {
+	return &projectResolver{
+		c:           c,
+		departments: make(map[string]*sharedpackage.Department),
+		teams:       make(map[string]*sharedpackage.Team),
+	}
+}
+
+// groupProjects returns the projects the iamRoles group key targets.
+func (r *projectResolver) groupProjects(ctx context.Context, key string) ([]string, error) {
+	switch {
+	case strings.HasPrefix(key, "team_"):
+		team, err := r.team(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if team != nil {
+			if len(team.ProjectIDs) > 0 {
+				return team.ProjectIDs, nil
+			}
+			return r.departmentProjects(ctx, team.DepartmentID)
+		}
+	case strings.HasPrefix(key, "dept_"):
+		return r.departmentProjects(ctx, key)
+	}
+	return []string{r.c.ProjectID}, nil
+}
+
+func (r *projectResolver) departmentProjects(ctx context.Context, deptID string) ([]string, error) {
+	if deptID != "" {
+		department, err := r.department(ctx, deptID)
+		if err != nil {
+			return nil, err
+		}
+		if department != nil && len(department.ProjectIDs) > 0 {
+			return department.ProjectIDs, nil
+		}
+	}
+	return []string{r.c.ProjectID}, nil
+}
+
+// department returns the department or nil if it does not exist.
+func (r *projectResolver) department(ctx context.Context, deptID string) (*sharedpackage.Department, error) {
+	if department, cached := r.departments[deptID]; cached {
+		return department, nil
+	}
+	if r.frozen {
+		return nil, &unresolvedGroupError{group: deptID}
+	}
+	department, err := r.c.Departments.GetDepartment(ctx, deptID)
+	if err != nil && !isNotFound(err) {
+		log.Printf("ERROR: Error getting document: %v", err)
+		return nil, fmt.Errorf("Error getting document: %w", err)
+	}
+	r.departments[deptID] = department
+	return department, nil
+}
+
+// team returns the team or nil if it does not exist.
+func (r *projectResolver) team(ctx context.Context, teamID string) (*sharedpackage.Team, error) {
+	if team, cached := r.teams[teamID]; cached {
+		return team, nil
+	}
+	if r.frozen {
+		return nil, &unresolvedGroupError{group: teamID}
+	}
+	team, err := r.c.Teams.GetTeam(ctx, teamID)
+	if err != nil && !isNotFound(err) {
+		log.Printf("ERROR: Error getting document: %v", err)
+		return nil, fmt.Errorf("Error getting document: %w", err)
+	}
+	r.teams[teamID] = team
+	return team, nil
+}
+
+// projectGrants groups the employee's IAM roles by the project they are
+// granted in, each with the condition it is bound under.
+func (r *projectResolver) projectGrants(ctx context.Context, employee *sharedpackage.Employee) (map[string][]reconciler.Grant, error) {
+	keys := make([]string, 0, len(employee.IAMRoles))
+	for key := range employee.IAMRoles {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	byProject := make(map[string][]reconciler.Grant)
+	seen := make(map[string]map[string]bool)
+	for _, key := range keys {
+		projects, err := r.groupProjects(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, projectID := range projects {
+			if seen[projectID] == nil {
+				seen[projectID] = make(map[string]bool)
+			}
+			for _, role := range employee.IAMRoles[key] {
+				grant := reconciler.Grant{Role: role, Condition: roleCondition(employee, key, role)}
+				bound := role + "\x00" + iamRole.ConditionKey(grant.Condition)
+				if role != "" && !seen[projectID][bound] {
+					seen[projectID][bound] = true
+					byProject[projectID] = append(byProject[projectID], grant)
+				}
+			}
+		}
+	}
+	return byProject, nil
+}
+
+// projectRoles groups the employee's IAM roles by the project they are
+// granted in.
+func (r *projectResolver) projectRoles(ctx context.Context, employee *sharedpackage.Employee) (map[string][]string, error) {
+	grants, err := r.projectGrants(ctx, employee)
+	if err != nil {
+		return nil, err
+	}
+	byProject := make(map[string][]string, len(grants))
+	for projectID, projectGrants := range grants {
+		for _, grant := range projectGrants {
+			if !contains(byProject[projectID], grant.Role) {
+				byProject[projectID] = append(byProject[projectID], grant.Role)
+			}
+		}
+	}
+	return byProject, nil
+}
+
+// rebindDeltas returns, per project, the deltas that revoke every binding of
+// revokeMail and grant the roles the employee's iamRoles target there. The
+// projects in previous, usually the employee's projectRoles before a change,
+// and the default project are cleared even if no group targets them now.
+func (r *projectResolver) rebindDeltas(ctx context.Context, revokeMail string, employee *sharedpackage.Employee, previous map[string][]string) (map[string][]sharedpackage.BindingDelta, error) {
+	current, err := r.projectGrants(ctx, employee)
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := map[string][]sharedpackage.BindingDelta{
+		r.c.ProjectID: {iamRole.RevokeAllDelta(revokeMail)},
+	}
+	for projectID := range previous {
+		deltas[projectID] = []sharedpackage.BindingDelta{iamRole.RevokeAllDelta(revokeMail)}
+	}
+	for projectID, grants := range current {
+		deltas[projectID] = append([]sharedpackage.BindingDelta{iamRole.RevokeAllDelta(revokeMail)}, grantDeltas(employee.Email, grants)...)
+	}
+	return deltas, nil
+}
+
+// maxMembershipAttempts bounds how often updateMembership retries after the
+// employee gained a group it had not resolved.
+const maxMembershipAttempts = 3
+
+// updateMembership re-reads the employee and stores the role, department,
+// teams and IAM roles update leaves it with, together with one outbox
+// operation per project of the deltas update returns, in one transaction.
+// The employee's groups are resolved before the transaction, in which r is
+// frozen; callers resolve any group update adds the same way. update may run
+// more than once and must only change the employee it is given.
+func (c *Controller) updateMembership(ctx context.Context, empID string, r *projectResolver, update func(employee *sharedpackage.Employee) (map[string][]sharedpackage.BindingDelta, error)) (*sharedpackage.Employee, error) {
+	for attempt := 1; ; attempt++ {
+		employee, err := c.getEmployee(ctx, empID)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.projectGrants(ctx, employee); err != nil {
+			return nil, err
+		}
+
+		r.frozen = true
+		employee, err = c.Operations.UpdateEmployeeRolesWithOperations(ctx, empID, func(employee *sharedpackage.Employee) ([]sharedpackage.IAMOperation, error) {
+			deltas, err := update(employee)
+			if err != nil {
+				return nil, err
+			}
+			pruneRoleGrants(employee)
+			return bindingOperations(empID, deltas), nil
+		})
+		r.frozen = false
+
+		// The employee gained a group meanwhile; resolve it and try again
+		var unresolved *unresolvedGroupError
+		if errors.As(err, &unresolved) && attempt < maxMembershipAttempts {
+			if _, err := r.groupProjects(ctx, unresolved.group); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			if isNotFound(err) {
+				return nil, notFound("Document with ID %s does not exist", empID)
+			}
+			log.Printf("ERROR: Error updating document: %v", err)
+			return nil, fmt.Errorf("Error updating document: %w", err)
+		}
+		return employee, nil
+	}
+}
+
+// retargetGroups moves the bindings of every employee holding roles in one of
+// groups to the projects the groups target now, after their department's or
+// team's projectIDs changed. previous are the projects they targeted before.
+func (c *Controller) retargetGroups(ctx context.Context, groups []string, previous []string) error {
+	employees, err := c.Employees.ListEmployees(ctx)
+	if err != nil {
+		log.Printf("ERROR: Error iterating over documents: %v", err)
+		return fmt.Errorf("Error iterating over documents: %w", err)
+	}
+
+	before := make(map[string][]string, len(previous))
+	for _, projectID := range previous {
+		before[projectID] = nil
+	}
+
+	r := c.newProjectResolver()
+	for _, employee := range employees {
+		affected := false
+		for _, group := range groups {
+			if len(employee.IAMRoles[group]) > 0 {
+				affected = true
+			}
+		}
+		if !affected || employee.Email == "" {
+			continue
+		}
+
+		deltas, err := r.rebindDeltas(ctx, employee.Email, &employee, before)
+		if err != nil {
+			return err
+		}
+		if err := c.putEmployeeWithBindings(ctx, employee.ID, employee, deltas); err != nil {
+			log.Printf("ERROR: Error updating document: %v", err)
+			return fmt.Errorf("Error updating document: %w", err)
+		}
+		log.Printf("INFO: Moved IAM bindings of %s to projects of %v", employee.ID, groups)
+	}
+	return nil
+}
+
+// validateProjects rejects targets that name neither a GCP project nor a
+// folder or the organization.
+func validateProjects(projectIDs []string) error {
+	for _, projectID := range projectIDs {
+		if err := iamRole.ValidateResource(projectID); err != nil {
+			log.Printf("ERROR: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// overlaps reports whether a and b have a project in common.
+func overlaps(a []string, b []string) bool {
+	for _, projectID := range a {
+		if contains(b, projectID) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameProjects reports whether a and b list the same projects in any order.
+func sameProjects(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, projectID := range a {
+		if !contains(b, projectID) {
+			return false
+		}
+	}
+	return true
+}
+
+// EmployeeBindings is the IAM roles of an employee, grouped by the project
+// they are granted in.
+type EmployeeBindings struct {
+	EmployeeID string              `json:"employeeID"`
+	Projects   map[string][]string `json:"projects"`
+}
+
+// EmployeeBindings returns the IAM roles of the employee grouped by project.
+// Employees caller may not read are reported as not found.
+func (c *Controller) EmployeeBindings(caller *sharedpackage.Employee, empID string) (*EmployeeBindings, error) {
+	ctx := context.Background()
+
+	employee, err := c.getEmployee(ctx, empID)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.VisibleEmployees(caller, []sharedpackage.Employee{*employee})) == 0 {
+		log.Printf("WARN: %s may not read the bindings of %s", caller.ID, empID)
+		return nil, notFound("Employee with ID %s not found", empID)
+	}
+
+	byProject, err := c.newProjectResolver().projectRoles(ctx, employee)
+	if err != nil {
+		return nil, err
+	}
+	for _, roles := range byProject {
+		sort.Strings(roles)
+	}
+	return &EmployeeBindings{EmployeeID: empID, Projects: byProject}, nil
+}
@@ -0,0 +1,461 @@
+package controllerFunctions
+
+import (
+	"Task_04/notifier"
+	"Task_04/sharedpackage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Access review errors.
+var (
+	ErrInvalidReviewCampaign = errors.New("invalid review campaign")
+	ErrReviewItemDecided     = errors.New("review item already decided")
+)
+
+// Decisions a reviewer can make on a review item.
+const (
+	DecisionKeep   = "keep"
+	DecisionRevoke = "revoke"
+)
+
+// LaunchReviewCampaign opens an access review of every IAM role granted
+// through a department and its teams, or through one team if teamID is set.
+// Each (employee, group key, role) becomes an item assigned to the group's
+// Lead, else the department's HOD; items no one but the reviewed employee
+// could review are left to the Admins. Items still pending at deadline are
+// revoked if autoRevoke is set and expire otherwise.
+func (c *Controller) LaunchReviewCampaign(caller *sharedpackage.Employee, name string, deptID string, teamID string, deadline time.Time, autoRevoke bool) (*sharedpackage.ReviewCampaign, error) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	// Step 1: Check what is asked for
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: a name is required", ErrInvalidReviewCampaign)
+	}
+	if !deadline.After(now) {
+		return nil, fmt.Errorf("%w: deadline %s is not in the future", ErrInvalidReviewCampaign, deadline.UTC().Format(time.RFC3339))
+	}
+
+	// Step 2: Work out the groups under review
+	var teams []sharedpackage.Team
+	if teamID != "" {
+		team, err := c.Teams.GetTeam(ctx, teamID)
+		if err != nil {
+			if isNotFound(err) {
+				return nil, notFound("Team with ID %s not found", teamID)
+			}
+			log.Printf("ERROR: Error getting document: %v", err)
+			return nil, fmt.Errorf("Error getting document: %w", err)
+		}
+		if deptID != "" && deptID != team.DepartmentID {
+			return nil, fmt.Errorf("%w: %s does not belong to %s", ErrInvalidReviewCampaign, teamID, deptID)
+		}
+		deptID = team.DepartmentID
+		teams = append(teams, *team)
+	} else if deptID == "" {
+		return nil, fmt.Errorf("%w: a departmentID or teamID is required", ErrInvalidReviewCampaign)
+	}
+
+	department, err := c.Departments.GetDepartment(ctx, deptID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, notFound("Department with ID %s not found", deptID)
+		}
+		log.Printf("ERROR: Error getting document: %v", err)
+		return nil, fmt.Errorf("Error getting document: %w", err)
+	}
+	if teamID == "" {
+		teams, err = c.Teams.FindTeamsByDepartment(ctx, deptID)
+		if err != nil {
+			log.Printf("ERROR: Error iterating over documents: %v", err)
+			return nil, fmt.Errorf("Error iterating over documents: %w", err)
+		}
+	}
+
+	// Step 3: Assign every group to its reviewer
+	employees, err := c.Employees.ListEmployees(ctx)
+	if err != nil {
+		log.Printf("ERROR: Error iterating over documents: %v", err)
+		return nil, fmt.Errorf("Error iterating over documents: %w", err)
+	}
+	known := make(map[string]bool, len(employees))
+	for _, employee := range employees {
+		known[employee.ID] = true
+	}
+	headID := ""
+	if known[department.HeadID] {
+		headID = department.HeadID
+	}
+	reviewers := make(map[string][]string)
+	if teamID == "" {
+		reviewers[department.ID] = []string{headID}
+	}
+	for _, team := range teams {
+		if known[team.LeadID] {
+			reviewers[team.ID] = []string{team.LeadID, headID}
+		} else {
+			reviewers[team.ID] = []string{headID}
+		}
+	}
+
+	// Step 4: One item per role held through a group under review
+	sort.SliceStable(employees, func(i, j int) bool { return employees[i].ID < employees[j].ID })
+	var items []sharedpackage.ReviewItem
+	for _, employee := range employees {
+		groups := make([]string, 0, len(employee.IAMRoles))
+		for group := range employee.IAMRoles {
+			if _, ok := reviewers[group]; ok {
+				groups = append(groups, group)
+			}
+		}
+		sort.Strings(groups)
+
+		for _, group := range groups {
+			roles := dedupe(employee.IAMRoles[group])
+			sort.Strings(roles)
+			for _, role := range roles {
+				items = append(items, sharedpackage.ReviewItem{
+					ID:             fmt.Sprintf("item_%d", len(items)+1),
+					EmployeeID:     employee.ID,
+					Group:          group,
+					Role:           role,
+					ReviewerID:     reviewerFor(reviewers[group], employee.ID),
+					ReviewDecision: sharedpackage.ReviewDecision{Decision: sharedpackage.ItemPending},
+				})
+			}
+		}
+	}
+
+	campaign := sharedpackage.ReviewCampaign{
+		Name:         name,
+		DepartmentID: deptID,
+		TeamID:       teamID,
+		Deadline:     deadline.UTC(),
+		AutoRevoke:   autoRevoke,
+		CreatedBy:    caller.ID,
+		CreatedAt:    now,
+		Status:       sharedpackage.CampaignOpen,
+		Items:        items,
+	}
+	if len(items) == 0 {
+		campaign.Status = sharedpackage.CampaignClosed
+		campaign.ClosedAt = &now
+	}
+	campaign.ID, err = c.ReviewCampaigns.NextReviewCampaignID(ctx)
+	if err != nil {
+		log.Printf("ERROR: Failed to generate review campaign ID: %v", err)
+		return nil, fmt.Errorf("Failed to generate review campaign ID: %w", err)
+	}
+	if err := c.ReviewCampaigns.CreateReviewCampaign(ctx, campaign); err != nil {
+		log.Printf("ERROR: Failed to store review campaign: %v", err)
+		return nil, fmt.Errorf("Failed to store review campaign: %w", err)
+	}
+	log.Printf("INFO: %s launched review campaign %s of %s with %d items, due %s", caller.ID, campaign.ID,
+		campaignScope(&campaign), len(items), campaign.Deadline.Format(time.RFC3339))
+
+	// Step 5: Ask the reviewers for their decisions
+	c.notifyReviewers(ctx, &campaign)
+	return &campaign, nil
+}
+
+// reviewerFor returns the first of candidates who is not the reviewed
+// employee, or "" for the Admins.
+func reviewerFor(candidates []string, empID string) string {
+	for _, reviewerID := range candidates {
+		if reviewerID != "" && reviewerID != empID {
+			return reviewerID
+		}
+	}
+	return ""
+}
+
+// ListReviewCampaigns returns the review campaigns caller may read, oldest
+// first. A non-empty status keeps only the campaigns in that state.
+func (c *Controller) ListReviewCampaigns(caller *sharedpackage.Employee, status string) ([]sharedpackage.ReviewCampaign, error) {
+	campaigns, err := c.ReviewCampaigns.ListReviewCampaigns(context.Background())
+	if err != nil {
+		log.Printf("ERROR: Failed to list review campaigns: %v", err)
+		return nil, fmt.Errorf("Failed to list review campaigns: %w", err)
+	}
+
+	visible := c.VisibleReviewCampaigns(caller, campaigns)
+	if status == "" {
+		return visible, nil
+	}
+	filtered := make([]sharedpackage.ReviewCampaign, 0, len(visible))
+	for _, campaign := range visible {
+		if campaign.Status == status {
+			filtered = append(filtered, campaign)
+		}
+	}
+	return filtered, nil
+}
+
+// GetReviewCampaign returns a review campaign as caller may read it.
+// Campaigns caller may not read are reported as not found.
+func (c *Controller) GetReviewCampaign(caller *sharedpackage.Employee, campaignID string) (*sharedpackage.ReviewCampaign, error) {
+	campaign, err := c.ReviewCampaigns.GetReviewCampaign(context.Background(), campaignID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, notFound("Review campaign with ID %s not found", campaignID)
+		}
+		log.Printf("ERROR: Failed to get review campaign: %v", err)
+		return nil, fmt.Errorf("Failed to get review campaign: %w", err)
+	}
+	visible := c.VisibleReviewCampaigns(caller, []sharedpackage.ReviewCampaign{*campaign})
+	if len(visible) == 0 {
+		log.Printf("WARN: %s may not read review campaign %s", caller.ID, campaignID)
+		return nil, notFound("Review campaign with ID %s not found", campaignID)
+	}
+	return &visible[0], nil
+}
+
+// ReviewItem records caller's decision on an item of an open campaign:
+// DecisionKeep leaves the role in place, DecisionRevoke removes it through
+// RemoveIAMRoles. If the removal fails the item is pending again, so it can
+// be retried. The campaign closes once no item is pending.
+func (c *Controller) ReviewItem(caller *sharedpackage.Employee, campaignID string, itemID string, decision string, comment string) (*sharedpackage.ReviewItem, error) {
+	ctx := context.Background()
+
+	// Step 1: Check the decision and that caller may make it
+	var outcome string
+	switch decision {
+	case DecisionKeep:
+		outcome = sharedpackage.ItemKept
+	case DecisionRevoke:
+		outcome = sharedpackage.ItemRevoked
+	default:
+		return nil, fmt.Errorf("%w: decision %q is neither %q nor %q", ErrInvalidReviewCampaign, decision, DecisionKeep, DecisionRevoke)
+	}
+	campaign, err := c.GetReviewCampaign(caller, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	var item *sharedpackage.ReviewItem
+	for i := range campaign.Items {
+		if campaign.Items[i].ID == itemID {
+			item = &campaign.Items[i]
+		}
+	}
+	if item == nil {
+		return nil, notFound("Review item %s not found in %s", itemID, campaignID)
+	}
+	if !mayReview(caller, item) {
+		log.Printf("WARN: %s may not review item %s of %s assigned to %q", caller.ID, itemID, campaignID, item.ReviewerID)
+		return nil, fmt.Errorf("%w: review item %s is not assigned to %s", ErrForbidden, itemID, caller.ID)
+	}
+	if campaign.Status != sharedpackage.CampaignOpen {
+		return nil, fmt.Errorf("%w: %s is %s", ErrReviewItemDecided, campaignID, campaign.Status)
+	}
+	if item.Decision != sharedpackage.ItemPending {
+		return nil, fmt.Errorf("%w: %s is %s", ErrReviewItemDecided, itemID, item.Decision)
+	}
+
+	// Step 2: Claim the item, so a concurrent decision cannot also apply
+	now := time.Now().UTC()
+	recorded := sharedpackage.ReviewDecision{Decision: outcome, DecidedBy: caller.ID, DecidedAt: &now, Comment: strings.TrimSpace(comment)}
+	if err := c.decideReviewItem(ctx, campaignID, item, recorded); err != nil {
+		return nil, err
+	}
+
+	// Step 3: Revoke the role, or put the item back if that fails
+	if outcome == sharedpackage.ItemRevoked {
+		if err := c.revokeReviewedRole(ctx, campaignID, item); err != nil {
+			return nil, err
+		}
+	}
+	item.ReviewDecision = recorded
+	log.Printf("INFO: %s decided to %s %s of %s through %s in review campaign %s", caller.ID, decision, item.Role, item.EmployeeID, item.Group, campaignID)
+
+	c.closeReviewedCampaign(ctx, campaignID)
+	return item, nil
+}
+
+// mayReview reports whether caller may decide the item: its reviewer or any
+// Admin, but never the reviewed employee.
+func mayReview(caller *sharedpackage.Employee, item *sharedpackage.ReviewItem) bool {
+	if caller.ID == item.EmployeeID {
+		return false
+	}
+	return caller.ID == item.ReviewerID || callerRole(caller) == sharedpackage.RoleAdmin
+}
+
+// decideReviewItem stores decision unless the item was decided meanwhile.
+func (c *Controller) decideReviewItem(ctx context.Context, campaignID string, item *sharedpackage.ReviewItem, decision sharedpackage.ReviewDecision) error {
+	decided, err := c.ReviewCampaigns.DecideReviewItem(ctx, campaignID, item.ID, sharedpackage.ItemPending, decision)
+	if err != nil {
+		log.Printf("ERROR: Failed to store decision on review item %s of %s: %v", item.ID, campaignID, err)
+		return fmt.Errorf("Failed to store decision on review item: %w", err)
+	}
+	if !decided {
+		return fmt.Errorf("%w: %s was decided meanwhile", ErrReviewItemDecided, item.ID)
+	}
+	return nil
+}
+
+// revokeReviewedRole removes the item's role through RemoveIAMRoles and
+// reopens the item if that fails. A deleted employee holds no role left to
+// revoke.
+func (c *Controller) revokeReviewedRole(ctx context.Context, campaignID string, item *sharedpackage.ReviewItem) error {
+	_, err := c.RemoveIAMRoles(item.EmployeeID, sharedpackage.RemoveRoles{GroupID: item.Group, IAMRoles: []string{item.Role}})
+	if err == nil {
+		return nil
+	}
+	if isNotFound(err) {
+		log.Printf("INFO: Employee %s of review item %s no longer exists, nothing to revoke", item.EmployeeID, item.ID)
+		return nil
+	}
+	log.Printf("ERROR: Failed to revoke %s of %s for review item %s of %s: %v", item.Role, item.EmployeeID, item.ID, campaignID, err)
+	reopen := sharedpackage.ReviewDecision{Decision: sharedpackage.ItemPending}
+	if _, revertErr := c.ReviewCampaigns.DecideReviewItem(ctx, campaignID, item.ID, sharedpackage.ItemRevoked, reopen); revertErr != nil {
+		log.Printf("ERROR: Failed to reopen review item %s of %s: %v", item.ID, campaignID, revertErr)
+	}
+	return err
+}
+
+// closeReviewedCampaign closes the campaign once none of its items is pending.
+func (c *Controller) closeReviewedCampaign(ctx context.Context, campaignID string) {
+	campaign, err := c.ReviewCampaigns.GetReviewCampaign(ctx, campaignID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get review campaign %s: %v", campaignID, err)
+		return
+	}
+	for _, item := range campaign.Items {
+		if item.Decision == sharedpackage.ItemPending {
+			return
+		}
+	}
+	closed, err := c.ReviewCampaigns.CloseReviewCampaign(ctx, campaignID, time.Now().UTC())
+	if err != nil {
+		log.Printf("ERROR: Failed to close review campaign %s: %v", campaignID, err)
+		return
+	}
+	if closed {
+		log.Printf("INFO: Review campaign %s is complete and closed", campaignID)
+	}
+}
+
+// CloseOverdueCampaigns closes the open campaigns whose deadline has passed.
+// Their pending items are revoked through RemoveIAMRoles if the campaign
+// auto-revokes, or marked expired otherwise. A campaign with a role that
+// could not be revoked stays open, so the next sweep retries it.
+func (c *Controller) CloseOverdueCampaigns() ([]sharedpackage.ReviewCampaign, error) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	campaigns, err := c.ReviewCampaigns.ListReviewCampaigns(ctx)
+	if err != nil {
+		log.Printf("ERROR: Failed to list review campaigns: %v", err)
+		return nil, fmt.Errorf("Failed to list review campaigns: %w", err)
+	}
+
+	closed := []sharedpackage.ReviewCampaign{}
+	for i := range campaigns {
+		campaign := &campaigns[i]
+		if campaign.Status != sharedpackage.CampaignOpen || campaign.Deadline.After(now) {
+			continue
+		}
+
+		// Step 1: Settle the items no one reviewed
+		outcome := sharedpackage.ItemExpired
+		if campaign.AutoRevoke {
+			outcome = sharedpackage.ItemRevoked
+		}
+		settled := true
+		for j := range campaign.Items {
+			item := &campaign.Items[j]
+			if item.Decision != sharedpackage.ItemPending {
+				continue
+			}
+			decision := sharedpackage.ReviewDecision{Decision: outcome, DecidedAt: &now, Comment: "Not reviewed by the deadline"}
+			decided, err := c.ReviewCampaigns.DecideReviewItem(ctx, campaign.ID, item.ID, sharedpackage.ItemPending, decision)
+			if err != nil {
+				log.Printf("ERROR: Failed to settle review item %s of %s: %v", item.ID, campaign.ID, err)
+				settled = false
+				continue
+			}
+			if !decided {
+				continue
+			}
+			if outcome == sharedpackage.ItemRevoked {
+				if err := c.revokeReviewedRole(ctx, campaign.ID, item); err != nil {
+					settled = false
+					continue
+				}
+				log.Printf("INFO: Revoked %s of %s through %s, not reviewed in campaign %s", item.Role, item.EmployeeID, item.Group, campaign.ID)
+			}
+			item.ReviewDecision = decision
+		}
+		if !settled {
+			continue
+		}
+
+		// Step 2: Close the campaign
+		ok, err := c.ReviewCampaigns.CloseReviewCampaign(ctx, campaign.ID, now)
+		if err != nil {
+			log.Printf("ERROR: Failed to close review campaign %s: %v", campaign.ID, err)
+			continue
+		}
+		if ok {
+			campaign.Status = sharedpackage.CampaignClosed
+			campaign.ClosedAt = &now
+			log.Printf("INFO: Closed overdue review campaign %s", campaign.ID)
+			closed = append(closed, *campaign)
+		}
+	}
+	return closed, nil
+}
+
+// notifyReviewers tells every reviewer of the campaign how many items await
+// them; items without a reviewer are announced to the Admins.
+func (c *Controller) notifyReviewers(ctx context.Context, campaign *sharedpackage.ReviewCampaign) {
+	pending := make(map[string]int)
+	for _, item := range campaign.Items {
+		pending[item.ReviewerID]++
+	}
+	subject := fmt.Sprintf("Access review %s awaits your decisions", campaign.ID)
+	body := func(greeting string, count int) string {
+		text := fmt.Sprintf("%s\n\n%d IAM roles granted through %s are up for review in %q.\n", greeting, count, campaignScope(campaign), campaign.Name)
+		text += fmt.Sprintf("Keep or revoke each of them at %s/reviewCampaigns/%s by %s.\n", c.PublicURL, campaign.ID, campaign.Deadline.Format(time.RFC3339))
+		if campaign.AutoRevoke {
+			text += "Roles not reviewed by then are revoked.\n"
+		}
+		return text
+	}
+
+	reviewerIDs := make([]string, 0, len(pending))
+	for reviewerID := range pending {
+		reviewerIDs = append(reviewerIDs, reviewerID)
+	}
+	sort.Strings(reviewerIDs)
+	for _, reviewerID := range reviewerIDs {
+		if reviewerID == "" {
+			c.notifyAdmins(ctx, notifier.Message{Subject: subject, Body: body("Hello,", pending[reviewerID])})
+			continue
+		}
+		reviewer, ok, _ := c.lookupEmployee(ctx, reviewerID)
+		if !ok || reviewer.Email == "" {
+			continue
+		}
+		c.notify(ctx, notifier.Message{
+			To:      reviewer.Email,
+			Subject: subject,
+			Body:    body(fmt.Sprintf("Hello %s,", reviewer.FirstName), pending[reviewerID]),
+		})
+	}
+}
+
+// campaignScope names the group a campaign reviews, e.g. "team_1".
+func campaignScope(campaign *sharedpackage.ReviewCampaign) string {
+	if campaign.TeamID != "" {
+		return campaign.TeamID
+	}
+	return campaign.DepartmentID
+}
@@ -0,0 +1,353 @@
+package controllerFunctions
+
+import (
+	"Task_04/iamRole"
+	"Task_04/notifier"
+	"Task_04/sharedpackage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Role request errors.
+var (
+	ErrInvalidRoleRequest = errors.New("invalid role request")
+	ErrRoleRequestDecided = errors.New("role request already decided")
+)
+
+// RequestRoles files a request by requester for roles in one of their teams
+// or their department and routes it to an approver. Nothing is granted until
+// the request is approved.
+func (c *Controller) RequestRoles(requester *sharedpackage.Employee, filed sharedpackage.RoleRequest) (*sharedpackage.RoleRequest, error) {
+	ctx := context.Background()
+
+	// Step 1: Check what is asked for
+	if len(filed.Roles) == 0 {
+		return nil, fmt.Errorf("%w: no roles requested", ErrInvalidRoleRequest)
+	}
+	for _, role := range filed.Roles {
+		if err := iamRole.ValidateRole(role); err != nil {
+			log.Printf("ERROR: %v", err)
+			return nil, err
+		}
+	}
+	if strings.TrimSpace(filed.Justification) == "" {
+		return nil, fmt.Errorf("%w: a justification is required", ErrInvalidRoleRequest)
+	}
+	if filed.Duration != "" {
+		duration, err := time.ParseDuration(filed.Duration)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("%w: duration %q is not a positive duration such as 72h", ErrInvalidRoleRequest, filed.Duration)
+		}
+	}
+
+	request := sharedpackage.RoleRequest{
+		EmployeeID:    requester.ID,
+		Roles:         dedupe(filed.Roles),
+		DepartmentID:  filed.DepartmentID,
+		TeamID:        filed.TeamID,
+		Justification: strings.TrimSpace(filed.Justification),
+		Duration:      filed.Duration,
+		CreatedAt:     time.Now().UTC(),
+		RoleDecision:  sharedpackage.RoleDecision{Status: sharedpackage.RequestPending},
+	}
+
+	// Step 2: The scope must be one of the requester's teams or their department
+	var team *sharedpackage.Team
+	if request.TeamID != "" {
+		var err error
+		team, err = c.Teams.GetTeam(ctx, request.TeamID)
+		if err != nil {
+			if isNotFound(err) {
+				return nil, notFound("Team with ID %s not found", request.TeamID)
+			}
+			log.Printf("ERROR: Error getting document: %v", err)
+			return nil, fmt.Errorf("Error getting document: %w", err)
+		}
+		if !contains(requester.TeamIDs, team.ID) {
+			return nil, fmt.Errorf("%w: %s is not a member of %s", ErrForbidden, requester.ID, team.ID)
+		}
+		if request.DepartmentID != "" && request.DepartmentID != team.DepartmentID {
+			return nil, fmt.Errorf("%w: %s does not belong to %s", ErrInvalidRoleRequest, team.ID, request.DepartmentID)
+		}
+		request.DepartmentID = team.DepartmentID
+	} else {
+		if request.DepartmentID == "" {
+			return nil, fmt.Errorf("%w: a teamID or departmentID is required", ErrInvalidRoleRequest)
+		}
+		if request.DepartmentID != requester.DeptID {
+			return nil, fmt.Errorf("%w: %s is not a member of %s", ErrForbidden, requester.ID, request.DepartmentID)
+		}
+	}
+
+	// Step 3: Route it to the team's Lead or the department's HOD
+	approverID, err := c.routeRoleRequest(ctx, requester, &request, team)
+	if err != nil {
+		return nil, err
+	}
+	request.ApproverID = approverID
+
+	request.ID, err = c.RoleRequests.NextRoleRequestID(ctx)
+	if err != nil {
+		log.Printf("ERROR: Failed to generate role request ID: %v", err)
+		return nil, fmt.Errorf("Failed to generate role request ID: %w", err)
+	}
+	if err := c.RoleRequests.CreateRoleRequest(ctx, request); err != nil {
+		log.Printf("ERROR: Failed to store role request: %v", err)
+		return nil, fmt.Errorf("Failed to store role request: %w", err)
+	}
+	log.Printf("INFO: %s requested %v in %s, routed to %q", requester.ID, request.Roles, roleRequestScope(&request), request.ApproverID)
+
+	if request.ApproverID == "" {
+		log.Printf("INFO: Role request %s waits for an Admin", request.ID)
+	} else if approver, ok, _ := c.lookupEmployee(ctx, request.ApproverID); ok && approver.Email != "" {
+		c.notify(ctx, notifier.Message{
+			To:      approver.Email,
+			Subject: fmt.Sprintf("Access request %s awaits your decision", request.ID),
+			Body: fmt.Sprintf("Hello %s,\n\n%s %s requests %s in %s%s.\n\nJustification: %s\n\n"+
+				"Approve or deny it at %s/accessRequests/%s.\n",
+				approver.FirstName, requester.FirstName, requester.LastName, strings.Join(request.Roles, ", "),
+				roleRequestScope(&request), durationText(request.Duration), request.Justification, c.PublicURL, request.ID),
+		})
+	}
+	return &request, nil
+}
+
+// routeRoleRequest returns who decides the request: the team's Lead, if the
+// team grants every requested role, else the department's HOD. Requests no
+// one but the requester could decide are left to the Admins.
+func (c *Controller) routeRoleRequest(ctx context.Context, requester *sharedpackage.Employee, request *sharedpackage.RoleRequest, team *sharedpackage.Team) (string, error) {
+	if team != nil && team.LeadID != "" && team.LeadID != requester.ID {
+		teamRoles := true
+		for _, role := range request.Roles {
+			if !contains(team.IAMRoles, role) {
+				teamRoles = false
+			}
+		}
+		_, exists, err := c.lookupEmployee(ctx, team.LeadID)
+		if err != nil {
+			return "", err
+		}
+		if teamRoles && exists {
+			return team.LeadID, nil
+		}
+	}
+
+	department, err := c.Departments.GetDepartment(ctx, request.DepartmentID)
+	if err != nil {
+		if isNotFound(err) {
+			return "", notFound("Department with ID %s not found", request.DepartmentID)
+		}
+		log.Printf("ERROR: Error getting document: %v", err)
+		return "", fmt.Errorf("Error getting document: %w", err)
+	}
+	if department.HeadID != "" && department.HeadID != requester.ID {
+		_, exists, err := c.lookupEmployee(ctx, department.HeadID)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return department.HeadID, nil
+		}
+	}
+	return "", nil
+}
+
+// ListRoleRequests returns the role requests caller may read, oldest first.
+// A non-empty status keeps only the requests in that state.
+func (c *Controller) ListRoleRequests(caller *sharedpackage.Employee, status string) ([]sharedpackage.RoleRequest, error) {
+	requests, err := c.RoleRequests.ListRoleRequests(context.Background())
+	if err != nil {
+		log.Printf("ERROR: Failed to list role requests: %v", err)
+		return nil, fmt.Errorf("Failed to list role requests: %w", err)
+	}
+
+	visible := c.VisibleRoleRequests(caller, requests)
+	if status == "" {
+		return visible, nil
+	}
+	filtered := make([]sharedpackage.RoleRequest, 0, len(visible))
+	for _, request := range visible {
+		if request.Status == status {
+			filtered = append(filtered, request)
+		}
+	}
+	return filtered, nil
+}
+
+// GetRoleRequest returns a role request. Requests caller may not read are
+// reported as not found.
+func (c *Controller) GetRoleRequest(caller *sharedpackage.Employee, requestID string) (*sharedpackage.RoleRequest, error) {
+	request, err := c.RoleRequests.GetRoleRequest(context.Background(), requestID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, notFound("Access request with ID %s not found", requestID)
+		}
+		log.Printf("ERROR: Failed to get role request: %v", err)
+		return nil, fmt.Errorf("Failed to get role request: %w", err)
+	}
+	if len(c.VisibleRoleRequests(caller, []sharedpackage.RoleRequest{*request})) == 0 {
+		log.Printf("WARN: %s may not read role request %s", caller.ID, requestID)
+		return nil, notFound("Access request with ID %s not found", requestID)
+	}
+	return request, nil
+}
+
+// ApproveRoleRequest approves a pending request and grants its roles through
+// AssignIAMRole, for the requested duration. If the grant fails the request
+// is pending again, so it can be retried.
+func (c *Controller) ApproveRoleRequest(caller *sharedpackage.Employee, requestID string, comment string) (*sharedpackage.RoleRequest, error) {
+	ctx := context.Background()
+
+	request, err := c.decidableRoleRequest(caller, requestID)
+	if err != nil {
+		return nil, err
+	}
+	requester, err := c.getEmployee(ctx, request.EmployeeID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 1: Claim the request, so a concurrent decision cannot also apply
+	now := time.Now().UTC()
+	decision := sharedpackage.RoleDecision{Status: sharedpackage.RequestApproved, DecidedBy: caller.ID, DecidedAt: &now, Comment: comment}
+	var grant *sharedpackage.RoleGrant
+	if request.Duration != "" {
+		duration, err := time.ParseDuration(request.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("%w: duration %q: %v", ErrInvalidRoleRequest, request.Duration, err)
+		}
+		expiresAt := now.Add(duration).Truncate(time.Second)
+		decision.ExpiresAt = &expiresAt
+		grant = &sharedpackage.RoleGrant{ExpiresAt: &expiresAt}
+	}
+	if err := c.decideRoleRequest(ctx, request, decision); err != nil {
+		return nil, err
+	}
+
+	// Step 2: Grant the roles, or put the request back if that fails
+	if _, err := c.AssignIAMRole(request.DepartmentID, request.TeamID, request.EmployeeID, request.Roles, requester.Role, grant); err != nil {
+		log.Printf("ERROR: Failed to grant approved role request %s: %v", request.ID, err)
+		if _, revertErr := c.RoleRequests.DecideRoleRequest(ctx, request.ID, sharedpackage.RequestApproved, sharedpackage.RoleDecision{Status: sharedpackage.RequestPending}); revertErr != nil {
+			log.Printf("ERROR: Failed to reopen role request %s: %v", request.ID, revertErr)
+		}
+		return nil, err
+	}
+	request.RoleDecision = decision
+	log.Printf("INFO: %s approved role request %s of %s", caller.ID, request.ID, request.EmployeeID)
+
+	c.notifyRequester(ctx, requester, request)
+	return request, nil
+}
+
+// DenyRoleRequest denies a pending request; nothing is granted.
+func (c *Controller) DenyRoleRequest(caller *sharedpackage.Employee, requestID string, comment string) (*sharedpackage.RoleRequest, error) {
+	ctx := context.Background()
+
+	request, err := c.decidableRoleRequest(caller, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	decision := sharedpackage.RoleDecision{Status: sharedpackage.RequestDenied, DecidedBy: caller.ID, DecidedAt: &now, Comment: comment}
+	if err := c.decideRoleRequest(ctx, request, decision); err != nil {
+		return nil, err
+	}
+	request.RoleDecision = decision
+	log.Printf("INFO: %s denied role request %s of %s", caller.ID, request.ID, request.EmployeeID)
+
+	if requester, ok, _ := c.lookupEmployee(ctx, request.EmployeeID); ok {
+		c.notifyRequester(ctx, requester, request)
+	}
+	return request, nil
+}
+
+// decidableRoleRequest returns the request if it is pending and caller may
+// decide it.
+func (c *Controller) decidableRoleRequest(caller *sharedpackage.Employee, requestID string) (*sharedpackage.RoleRequest, error) {
+	request, err := c.GetRoleRequest(caller, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if !mayDecide(caller, request) {
+		log.Printf("WARN: %s may not decide role request %s routed to %q", caller.ID, request.ID, request.ApproverID)
+		return nil, fmt.Errorf("%w: role request %s is not routed to %s", ErrForbidden, request.ID, caller.ID)
+	}
+	if request.Status != sharedpackage.RequestPending {
+		return nil, fmt.Errorf("%w: %s is %s", ErrRoleRequestDecided, request.ID, request.Status)
+	}
+	return request, nil
+}
+
+// decideRoleRequest stores decision unless the request was decided meanwhile.
+func (c *Controller) decideRoleRequest(ctx context.Context, request *sharedpackage.RoleRequest, decision sharedpackage.RoleDecision) error {
+	decided, err := c.RoleRequests.DecideRoleRequest(ctx, request.ID, sharedpackage.RequestPending, decision)
+	if err != nil {
+		log.Printf("ERROR: Failed to store decision on role request %s: %v", request.ID, err)
+		return fmt.Errorf("Failed to store decision on role request: %w", err)
+	}
+	if !decided {
+		return fmt.Errorf("%w: %s was decided meanwhile", ErrRoleRequestDecided, request.ID)
+	}
+	return nil
+}
+
+// mayDecide reports whether caller may decide the request: its approver or
+// any Admin, but never the requester.
+func mayDecide(caller *sharedpackage.Employee, request *sharedpackage.RoleRequest) bool {
+	if caller.ID == request.EmployeeID {
+		return false
+	}
+	return caller.ID == request.ApproverID || callerRole(caller) == sharedpackage.RoleAdmin
+}
+
+// notifyRequester tells the requester about the decision on their request.
+func (c *Controller) notifyRequester(ctx context.Context, requester *sharedpackage.Employee, request *sharedpackage.RoleRequest) {
+	if requester.Email == "" {
+		return
+	}
+	body := fmt.Sprintf("Hello %s,\n\nyour access request %s for %s in %s was %s by %s.\n",
+		requester.FirstName, request.ID, strings.Join(request.Roles, ", "), roleRequestScope(request), request.Status, request.DecidedBy)
+	if request.ExpiresAt != nil {
+		body += fmt.Sprintf("The roles expire at %s.\n", request.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	if request.Comment != "" {
+		body += fmt.Sprintf("\nComment: %s\n", request.Comment)
+	}
+	c.notify(ctx, notifier.Message{
+		To:      requester.Email,
+		Subject: fmt.Sprintf("Access request %s %s", request.ID, request.Status),
+		Body:    body,
+	})
+}
+
+// roleRequestScope names the group a request is for, e.g. "team_1".
+func roleRequestScope(request *sharedpackage.RoleRequest) string {
+	if request.TeamID != "" {
+		return request.TeamID
+	}
+	return request.DepartmentID
+}
+
+// durationText describes how long requested roles are granted for.
+func durationText(duration string) string {
+	if duration == "" {
+		return " indefinitely"
+	}
+	return " for " + duration
+}
+
+// dedupe returns values without repeats, in their first order.
+func dedupe(values []string) []string {
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !contains(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,126 @@
+package controllerFunctions
+
+import (
+	"Task_04/sharedpackage"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// RefreshTokenTTL is how long a refresh token can be exchanged for new tokens.
+var RefreshTokenTTL = 30 * 24 * time.Hour
+
+// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens.
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// hashToken returns the ID a refresh or password token is stored under: the
+// SHA-256 hash of the token, so the token itself is never stored.
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueRefreshToken starts a new session for the employee and returns the
+// token to hand to the client together with its stored record.
+func (c *Controller) IssueRefreshToken(empID string) (string, *sharedpackage.RefreshToken, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("Failed to generate refresh token: %w", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now().UTC()
+	token := sharedpackage.RefreshToken{
+		ID:         hashToken(secret),
+		EmployeeID: empID,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	}
+	if err := c.RefreshTokens.CreateRefreshToken(context.Background(), token); err != nil {
+		log.Printf("ERROR: Failed to store refresh token: %v", err)
+		return "", nil, fmt.Errorf("Failed to store refresh token: %w", err)
+	}
+	return secret, &token, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one. Every token
+// can be used once; presenting a token that was already used means it was
+// copied, so all sessions of its employee are revoked.
+func (c *Controller) RotateRefreshToken(secret string) (*sharedpackage.Employee, string, *sharedpackage.RefreshToken, error) {
+	ctx := context.Background()
+	tokenID := hashToken(secret)
+
+	// Step 1: Check the presented token
+	token, err := c.RefreshTokens.GetRefreshToken(ctx, tokenID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, "", nil, ErrInvalidRefreshToken
+		}
+		log.Printf("ERROR: Failed to get refresh token: %v", err)
+		return nil, "", nil, fmt.Errorf("Failed to get refresh token: %w", err)
+	}
+	if time.Now().After(token.ExpiresAt) {
+		return nil, "", nil, ErrInvalidRefreshToken
+	}
+
+	// Step 2: Use it up; losing this race also counts as reuse
+	active := false
+	if !token.Revoked {
+		if active, err = c.RefreshTokens.RevokeRefreshToken(ctx, tokenID); err != nil {
+			log.Printf("ERROR: Failed to revoke refresh token: %v", err)
+			return nil, "", nil, fmt.Errorf("Failed to revoke refresh token: %w", err)
+		}
+	}
+	if !active {
+		log.Printf("WARN: Reuse of refresh token of %s, revoking all sessions", token.EmployeeID)
+		if err := c.RevokeSessions(token.EmployeeID); err != nil {
+			return nil, "", nil, err
+		}
+		return nil, "", nil, ErrInvalidRefreshToken
+	}
+
+	// Step 3: Only issue a new token to an employee who may still log in
+	employee, err := c.Employees.GetEmployee(ctx, token.EmployeeID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, "", nil, ErrInvalidRefreshToken
+		}
+		log.Printf("ERROR: Error getting document: %v", err)
+		return nil, "", nil, fmt.Errorf("Error getting document: %w", err)
+	}
+	if until, locked := lockedUntil(employee, time.Now().UTC()); locked {
+		return nil, "", nil, &LockedError{Until: until}
+	}
+
+	newSecret, newToken, err := c.IssueRefreshToken(employee.ID)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return employee, newSecret, newToken, nil
+}
+
+// Logout ends the session of a refresh token. Unknown tokens are ignored.
+func (c *Controller) Logout(secret string) error {
+	if _, err := c.RefreshTokens.RevokeRefreshToken(context.Background(), hashToken(secret)); err != nil {
+		log.Printf("ERROR: Failed to revoke refresh token: %v", err)
+		return fmt.Errorf("Failed to revoke refresh token: %w", err)
+	}
+	return nil
+}
+
+// RevokeSessions ends every session of the employee. Access tokens already
+// issued stay valid until they expire, at most one access token lifetime.
+func (c *Controller) RevokeSessions(empID string) error {
+	if err := c.RefreshTokens.RevokeEmployeeRefreshTokens(context.Background(), empID); err != nil {
+		log.Printf("ERROR: Failed to revoke sessions of %s: %v", empID, err)
+		return fmt.Errorf("Failed to revoke sessions: %w", err)
+	}
+	log.Printf("INFO: Revoked all sessions of %s", empID)
+	return nil
+}
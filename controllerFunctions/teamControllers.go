@@ -1,348 +1,318 @@
 package controllerFunctions
 
 import (
+	"Task_04/iamRole"
+	"Task_04/reconciler"
 	"Task_04/sharedpackage"
 	"context"
 	"fmt"
 	"log"
-	"strconv"
 	"time"
-
-	"cloud.google.com/go/firestore"
-	"google.golang.org/api/iterator"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
-// generateIncrementingTeamID generates an incrementing document ID for the given collection.
-func generateIncrementingTeamID(collection *firestore.CollectionRef) (string, error) {
-	// Query the collection to find the highest existing document ID
-	iter := collection.Documents(context.Background())
-	defer iter.Stop()
-
-	existingIDs := make(map[string]bool)
-	highestID := 0
-
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return "", err
-		}
-
-		// Extract the numeric part of the document ID
-		idStr := doc.Ref.ID[len("team_"):]
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			continue // Ignore non-numeric IDs
-		}
-
-		// Update the highestID if the current ID is greater
-		if id > highestID {
-			highestID = id
-		}
-
-		// Store existing IDs in a map
-		existingIDs[doc.Ref.ID] = true
-	}
-
-	// Generate a new incrementing document ID
-	for {
-		newID := highestID + 1
-		newIDStr := fmt.Sprintf("team_%d", newID)
-
-		// Check if the generated ID already exists
-		if !existingIDs[newIDStr] {
-			return newIDStr, nil
-		}
-
-		highestID++
+// CreateTeam stores a new team, makes its lead a "Lead" and assigns the team
+// roles in the team's projects, or else its department's.
+func (c *Controller) CreateTeam(team sharedpackage.Team) (*sharedpackage.Team, error) {
+	ctx := context.Background()
+	if err := validateProjects(team.ProjectIDs); err != nil {
+		return nil, err
 	}
 
-	// This should not be reached
-}
-
-func CreateTeam(team sharedpackage.Team) (*sharedpackage.Team, error) {
-	ctx := context.Background()
 	currentTime := time.Now()
 	formattedTime := currentTime.Format("Mon, 02 Jan 2006 15:04:05 MST")
 
-	// Specify the path to the "departments" collection
-	teamCollection := FirestoreClient.Collection("teams")
-	employeeCollection := FirestoreClient.Collection("employees")
-
 	// Generate an incrementing document ID
-	newDocID, err := generateIncrementingTeamID(teamCollection)
+	newDocID, err := c.Teams.NextTeamID(ctx)
 	if err != nil {
 		log.Printf("ERROR: Unable to generate a unique document ID: %v", err)
-		return nil, fmt.Errorf("Unable to generate a unique document ID: %v", err)
+		return nil, fmt.Errorf("Unable to generate a unique document ID: %w", err)
 	}
 
 	if team.DepartmentID != "" {
-		docRef := FirestoreClient.Collection("departments").Doc(team.DepartmentID)
-		_, err := docRef.Get(ctx)
+		_, err := c.Departments.GetDepartment(ctx, team.DepartmentID)
 		if err != nil {
-			if status.Code(err) == codes.NotFound {
+			if isNotFound(err) {
 				// Document not found
 				log.Printf("CreateTeam ERROR: Document ID %v you entered is not present in departments collection: %v", team.DepartmentID, err)
-				return nil, fmt.Errorf("Document ID %v you entered is not present in departments collection: %v", team.DepartmentID, err)
+				return nil, notFound("Document ID %v you entered is not present in departments collection: %v", team.DepartmentID, err)
 			}
 
 			// Handle other errors
 			log.Printf("CreateTeam ERROR: Error checking document existence: %v", err)
-			return nil, fmt.Errorf("Error checking document existence: %v", err)
+			return nil, fmt.Errorf("Error checking document existence: %w", err)
 		}
 
 		log.Printf("CreateTeam INFO: Document ID found!!")
 	}
 
+	for _, role := range team.IAMRoles {
+		if err := iamRole.ValidateRole(role); err != nil {
+			log.Printf("ERROR: %v", err)
+			return nil, err
+		}
+	}
+
+	// The lead is written after the team so the team it points at exists
+	var lead *sharedpackage.Employee
 	if team.LeadID != "" {
 		// Get the existing document data
-		existingData, err := employeeCollection.Doc(team.LeadID).Get(ctx)
-		if err != nil {
+		employee, err := c.Employees.GetEmployee(ctx, team.LeadID)
+		if err != nil && !isNotFound(err) {
 			// Handle the error
 			log.Printf("ERROR: Failed to get employee document: %v", err)
 			return nil, err
 		}
 
 		// Check if the document exists
-		if existingData.Exists() {
-			// Extract existing departmentID and teamIDs if available
-			existingDepartmentIDInterface, err := existingData.DataAt("departmentID")
-			if err != nil {
-				// Handle the error
-				log.Printf("ERROR: Failed to get departmentID: %v", err)
+		if err == nil {
+			if err := checkFreeForLead(employee); err != nil {
 				return nil, err
 			}
+			team.CreatedTime = formattedTime
+			lead = employee
+		} else {
+			// Document does not exist
+			log.Println("INFO: Employee document does not exist.")
+		}
+	}
 
-			existingTeamIDsInterface, err := existingData.DataAt("teamIDs")
-			if err != nil {
-				// Handle the error
-				log.Printf("ERROR: Failed to get teamIDs: %v", err)
+	// Add the team data to the "teams" collection with the generated document ID
+	if err := c.Teams.PutTeam(ctx, newDocID, team); err != nil {
+		log.Printf("ERROR: Failed to add team document: %v", err)
+		return nil, fmt.Errorf("Failed to add team document: %w", err)
+	}
+
+	// Make the employee Lead with the team roles, stored together with the IAM operations granting them
+	if lead != nil {
+		resolver := c.newProjectResolver()
+		projects, err := resolver.groupProjects(ctx, newDocID)
+		if err != nil {
+			return nil, err
+		}
+		_, err = c.updateMembership(ctx, team.LeadID, resolver, func(employee *sharedpackage.Employee) (map[string][]sharedpackage.BindingDelta, error) {
+			if err := checkFreeForLead(employee); err != nil {
 				return nil, err
 			}
-
-			// Type assert to get the actual types
-			existingDepartmentID, ok := existingDepartmentIDInterface.(string)
-			if !ok {
-				// Handle the type assertion failure
-				log.Printf("ERROR: Failed to assert departmentID as string")
-				return nil, fmt.Errorf("Failed to assert departmentID as string")
+			employee.Role = "Lead"
+			employee.DeptID = team.DepartmentID
+			employee.TeamIDs = []string{newDocID}
+			if employee.IAMRoles == nil {
+				employee.IAMRoles = make(map[string][]string)
 			}
+			employee.IAMRoles[newDocID] = dedupe(team.IAMRoles)
 
-			existingTeamIDs, ok := existingTeamIDsInterface.([]interface{})
-			if !ok {
-				// Handle the type assertion failure
-				log.Printf("ERROR: Failed to assert teamIDs as []interface{}")
-				return nil, fmt.Errorf("Failed to assert teamIDs as []interface{}")
+			deltas := make(map[string][]sharedpackage.BindingDelta, len(projects))
+			if employee.Email == "" {
+				return deltas, nil
 			}
-
-			// Check whether departmentID and teamIDs are empty
-			if existingDepartmentID == "" && len(existingTeamIDs) == 0 {
-				// Both departmentID and teamIDs are empty
-				log.Println("INFO: DepartmentID and TeamIDs are empty.")
-				team.CreatedTime = formattedTime
-				// Set the document data for the employee with merge
-				_, err = employeeCollection.Doc(team.LeadID).Set(ctx, map[string]interface{}{
-					"role":         "Lead",
-					"departmentID": team.DepartmentID,
-					"teamIDs":      firestore.ArrayUnion(newDocID),
-				}, firestore.MergeAll)
-			} else if existingDepartmentID != "" && len(existingTeamIDs) == 0 {
-				// Either departmentID or teamIDs is not empty
-				log.Printf("ERROR: Employee %v id HOD of department %v.", team.LeadID, existingDepartmentID)
-				return nil, fmt.Errorf("Cannot assign lead role to HOD.")
-			} else {
-				log.Printf("ERROR: Employee %v is already in a different department and team.", team.LeadID)
-				return nil, fmt.Errorf("Employee is already in a different department and team.")
+			grants := make([]reconciler.Grant, 0, len(employee.IAMRoles[newDocID]))
+			for _, role := range employee.IAMRoles[newDocID] {
+				grants = append(grants, reconciler.Grant{Role: role})
 			}
-		} else {
-			// Document does not exist
-			log.Println("INFO: Employee document does not exist.")
+			for _, projectID := range projects {
+				deltas[projectID] = grantDeltas(employee.Email, grants)
+			}
+			return deltas, nil
+		})
+		if err != nil {
+			log.Printf("ERROR: Failed to assign team roles: %v", err)
+			return nil, fmt.Errorf("Failed to assign team roles: %w", err)
 		}
+		c.Outbox.Notify()
 	}
 
 	log.Printf("INFO: Department document with ID %s and employee document updated successfully", newDocID)
-	AssignIAMRole(team.DepartmentID, newDocID, team.LeadID, team.IAMRoles, "Lead")
-	// Add the team data to the "teams" collection with the generated document ID
-	_, err = teamCollection.Doc(newDocID).Set(ctx, team)
-	if err != nil {
-		log.Printf("ERROR: Failed to add team document: %v", err)
-		return nil, fmt.Errorf("Failed to add team document: %v", err)
-	}
 
+	team.ID = newDocID
 	return &team, nil
 }
 
-func DeleteTeam(teamID string) (*sharedpackage.Team, error) {
+// checkFreeForLead refuses to make an employee who is already in a
+// department or team the lead of a new team.
+func checkFreeForLead(employee *sharedpackage.Employee) error {
+	switch {
+	case employee.DeptID == "" && len(employee.TeamIDs) == 0:
+		return nil
+	case employee.DeptID != "" && len(employee.TeamIDs) == 0:
+		log.Printf("ERROR: Employee %v id HOD of department %v.", employee.ID, employee.DeptID)
+		return fmt.Errorf("Cannot assign lead role to HOD.")
+	default:
+		log.Printf("ERROR: Employee %v is already in a different department and team.", employee.ID)
+		return fmt.Errorf("Employee is already in a different department and team.")
+	}
+}
+
+// DeleteTeam deletes the team, strips its lead and detaches its members.
+func (c *Controller) DeleteTeam(teamID string) (*sharedpackage.Team, error) {
 	var deletedTeam sharedpackage.Team
 	ctx := context.Background()
 
-	// Step 1: Get the departments collection
-	teamsCollection := FirestoreClient.Collection("teams")
-
-	// Step 2: Delete teams associated with the department
-	if err := deleteTeams(teamID); err != nil {
+	// Step 1: Delete teams associated with the department
+	if err := c.deleteTeams(teamID); err != nil {
 		log.Printf("ERROR: Failed to delete teams: %v", err)
 		// You can choose to return the error or handle it based on your requirements
-		return nil, fmt.Errorf("Failed to delete teams: %v", err)
+		return nil, fmt.Errorf("Failed to delete teams: %w", err)
 	}
 
-	// Step 3: Specify the path to the document
-	docRef := teamsCollection.Doc(teamID)
-
-	// Step 4: Check if the document exists
-	docSnapshot, err := docRef.Get(ctx)
+	// Step 2: Check if the document exists
+	team, err := c.Teams.GetTeam(ctx, teamID)
 	if err != nil {
+		if isNotFound(err) {
+			log.Printf("Document with ID %s does not exist", teamID)
+			return nil, notFound("Document with ID %s does not exist", teamID)
+		}
 		log.Printf("Error getting document: %v", err)
-		return nil, fmt.Errorf("Error getting document: %v", err)
-	}
-
-	if !docSnapshot.Exists() {
-		log.Printf("Document with ID %s does not exist", teamID)
-		return nil, fmt.Errorf("Document with ID %s does not exist", teamID)
-	}
-
-	// Step 5: Extract the value of the "headID" field
-	leadID, ok := docSnapshot.Data()["leadID"].(string)
-	if !ok {
-		log.Printf("Field 'headID' not found or not a string")
-		return nil, fmt.Errorf("Field 'headID' not found or not a string")
+		return nil, fmt.Errorf("Error getting document: %w", err)
 	}
 
+	// Step 3: Extract the value of the "leadID" field
+	leadID := team.LeadID
 	log.Printf("INFO: Extracted 'leadID' from document: %s", leadID)
-	// Step 6: Handle the error from removeAccess
-	if err := removeEmployees(teamID, leadID); err != nil {
+
+	// Step 4: Handle the error from removeAccess
+	if err := c.removeEmployees(teamID, leadID); err != nil {
 		log.Printf("ERROR: Failed to remove access: %v", err)
 		// You can choose to return the error or handle it based on your requirements
-		return nil, fmt.Errorf("Failed to remove access: %v", err)
+		return nil, fmt.Errorf("Failed to remove access: %w", err)
 	}
 
-	// Step 7: Delete the document
-	_, err = docRef.Delete(ctx)
-	if err != nil {
+	// Step 5: Delete the document
+	if err := c.Teams.DeleteTeam(ctx, teamID); err != nil {
 		log.Printf("ERROR: Error deleting document: %v", err)
-		return nil, fmt.Errorf("Error deleting document: %v", err)
+		return nil, fmt.Errorf("Error deleting document: %w", err)
 	}
 
+	// Step 6: Let the outbox worker revoke the bindings of the stripped lead and members
+	c.Outbox.Notify()
+
 	return &deletedTeam, nil
 }
 
-func UpdateTeam(teamID string, team sharedpackage.Team) (*sharedpackage.Team, error) {
+// UpdateTeam changes the team's name, lead, IAM roles or projects. When the
+// projects change, the bindings of everyone holding roles through the team
+// move along.
+func (c *Controller) UpdateTeam(teamID string, team sharedpackage.Team) (*sharedpackage.Team, error) {
 	ctx := context.Background()
-	teamCollection := FirestoreClient.Collection("teams")
-	employeeCollection := FirestoreClient.Collection("employees")
+	if err := validateProjects(team.ProjectIDs); err != nil {
+		return nil, err
+	}
 
-	docTeam := teamCollection.Doc(teamID)
-	// Step 4: Check if the document exists
-	docSnapshotTeam, err := docTeam.Get(ctx)
+	// Step 1: Check if the team exists
+	teamData, err := c.Teams.GetTeam(ctx, teamID)
 	if err != nil {
+		if isNotFound(err) {
+			log.Printf("Document with ID %s does not exist", teamID)
+			return nil, notFound("Document with ID %s does not exist", teamID)
+		}
 		log.Printf("Error getting document: %v", err)
-		return nil, fmt.Errorf("Error getting document: %v", err)
-	}
-
-	if !docSnapshotTeam.Exists() {
-		log.Printf("Document with ID %s does not exist", teamID)
-		return nil, fmt.Errorf("Document with ID %s does not exist", teamID)
+		return nil, fmt.Errorf("Error getting document: %w", err)
 	}
 
-	var teamData sharedpackage.Team
-	// Convert Firestore document data to the Employee struct
-	if err := docSnapshotTeam.DataTo(&teamData); err != nil {
-		log.Printf("ERROR: Error converting document data: %v", err)
-		return nil, fmt.Errorf("Error converting document data: %v", err)
-	}
-
-	// Step 5: Extract the value of the "headID" field
+	// Step 2: Extract the value of the "leadID" field
 	leadID := teamData.LeadID
 
-	docEmployee := employeeCollection.Doc(leadID)
-	// Step 4: Check if the document exists
-	docSnapshotEmployee, err := docEmployee.Get(ctx)
-	if err != nil {
+	// Step 3: Check if the current lead exists
+	if _, err := c.Employees.GetEmployee(ctx, leadID); err != nil {
+		if isNotFound(err) {
+			log.Printf("Document with ID %s does not exist", teamID)
+			return nil, notFound("Document with ID %s does not exist", teamID)
+		}
 		log.Printf("Error getting document: %v", err)
-		return nil, fmt.Errorf("Error getting document: %v", err)
+		return nil, fmt.Errorf("Error getting document: %w", err)
 	}
 
-	if !docSnapshotEmployee.Exists() {
-		log.Printf("Document with ID %s does not exist", teamID)
-		return nil, fmt.Errorf("Document with ID %s does not exist", teamID)
+	// Step 4: Check the team roles the lead gains
+	rolesChanged := len(team.IAMRoles) != 0
+	for _, role := range team.IAMRoles {
+		if err := iamRole.ValidateRole(role); err != nil {
+			log.Printf("ERROR: %v", err)
+			return nil, err
+		}
 	}
-	var employee sharedpackage.Employee
-	// Convert Firestore document data to the Employee struct
-	if err := docSnapshotEmployee.DataTo(&employee); err != nil {
-		log.Printf("ERROR: Error converting document data: %v", err)
-		return nil, fmt.Errorf("Error converting document data: %v", err)
+	addTeamRoles := func(lead *sharedpackage.Employee) {
+		if !rolesChanged {
+			return
+		}
+		if lead.IAMRoles == nil {
+			lead.IAMRoles = make(map[string][]string)
+		}
+		lead.IAMRoles[teamID] = mergeSlices(team.IAMRoles, lead.IAMRoles[teamID])
 	}
 
-	if team.LeadID != "" {
-		docEmployee2 := employeeCollection.Doc(team.LeadID)
+	// Step 5: Write each lead once, together with the IAM operations granting
+	// or revoking its roles
+	resolver := c.newProjectResolver()
+	if _, err := resolver.groupProjects(ctx, teamID); err != nil {
+		return nil, err
+	}
+	var lead *sharedpackage.Employee
+	if team.LeadID != "" && team.LeadID != leadID {
+		if _, err := c.getEmployee(ctx, team.LeadID); err != nil {
+			return nil, err
+		}
 
-		docSnapshotEmployee2, err := docEmployee2.Get(ctx)
+		// The old lead hands its job role, department, teams and IAM roles over
+		var handedOver sharedpackage.Employee
+		_, err := c.updateMembership(ctx, leadID, resolver, func(old *sharedpackage.Employee) (map[string][]sharedpackage.BindingDelta, error) {
+			handedOver = sharedpackage.Employee{Role: old.Role, DeptID: old.DeptID, TeamIDs: append([]string(nil), old.TeamIDs...)}
+			handedOver.IAMRoles, handedOver.RoleGrants = copyRoles(old)
+			return c.stripMember(ctx, resolver, old)
+		})
 		if err != nil {
-			log.Printf("Error getting document: %v", err)
-			return nil, fmt.Errorf("Error getting document: %v", err)
+			log.Printf("ERROR: Error while removing IAM roles: %v", err)
+			return nil, fmt.Errorf("Error removing IAM roles: %w", err)
 		}
 
-		if !docSnapshotEmployee2.Exists() {
-			log.Printf("Document with ID %s does not exist", team.LeadID)
-			return nil, fmt.Errorf("Document with ID %s does not exist", team.LeadID)
-		}
-		var employee1 sharedpackage.Employee
-		// Convert Firestore document data to the Employee struct
-		if err := docSnapshotEmployee2.DataTo(&employee1); err != nil {
-			log.Printf("ERROR: Error converting document data: %v", err)
-			return nil, fmt.Errorf("Error converting document data: %v", err)
-		}
-		employee1.DeptID = employee.DeptID
-		employee1.Role = employee.Role
-		employee1.TeamIDs = employee.TeamIDs
-		employee1.IAMRoles =employee.IAMRoles
-		data, err := AssignIAMRole(employee1.DeptID, employee1.TeamIDs[0], team.LeadID, employee1.IAMRoles[employee1.TeamIDs[0]], employee1.Role)
+		lead, err = c.updateMembership(ctx, team.LeadID, resolver, func(newLead *sharedpackage.Employee) (map[string][]sharedpackage.BindingDelta, error) {
+			previous, err := resolver.projectRoles(ctx, newLead)
+			if err != nil {
+				return nil, err
+			}
+			newLead.Role = handedOver.Role
+			newLead.DeptID = handedOver.DeptID
+			newLead.TeamIDs = append([]string(nil), handedOver.TeamIDs...)
+			newLead.IAMRoles, newLead.RoleGrants = copyRoles(&handedOver)
+			addTeamRoles(newLead)
+			return resolver.rebindDeltas(ctx, newLead.Email, newLead, previous)
+		})
 		if err != nil {
 			log.Printf("ERROR: Error while assigning IAM role: %v", err)
-			return nil, fmt.Errorf("Error assigning IAM role: %v", err)
-		}
-		log.Printf("INFO: Assigned IAM roles to %v: %v", team.LeadID, data)
-		RemoveMember(leadID)
-		employee.DeptID = ""
-		// Update the document with the modified field
-		if _, err := docEmployee2.Set(ctx, employee1); err != nil {
-			log.Printf("ERROR: Error updating document: %v", err)
-			return nil, fmt.Errorf("Error updating document: %v", err)
+			return nil, fmt.Errorf("Error assigning IAM role: %w", err)
 		}
+		log.Printf("INFO: %s took over as lead of %s from %s", team.LeadID, teamID, leadID)
 	} else {
-		team.LeadID = teamData.LeadID
-	}
-	if len(team.IAMRoles) != 0 {
-		employee.IAMRoles[teamID] = mergeSlices(team.IAMRoles, employee.IAMRoles[teamID])
-		role := employee.Role
-		teamIDs := employee.TeamIDs
-		deptID := employee.DeptID
-		RemoveMember(leadID)
-		data, err := AssignIAMRole(deptID, teamID, team.LeadID, employee.IAMRoles[teamID], role)
-		if err != nil {
-			log.Printf("ERROR: Error while assigning IAM role: %v", err)
-			return nil, fmt.Errorf("Error assigning IAM role: %v", err)
-		}
-		log.Printf("INFO: Assigned IAM roles to %v: %v", team.LeadID, data)
-		employee.Role = role
-		employee.TeamIDs = teamIDs
-		employee.DeptID = deptID
-		// Update the document with the modified field
-		if _, err := docEmployee.Set(ctx, employee); err != nil {
-			log.Printf("ERROR: Error updating document: %v", err)
-			return nil, fmt.Errorf("Error updating document: %v", err)
+		team.LeadID = leadID
+		if rolesChanged {
+			lead, err = c.updateMembership(ctx, leadID, resolver, func(current *sharedpackage.Employee) (map[string][]sharedpackage.BindingDelta, error) {
+				previous, err := resolver.projectRoles(ctx, current)
+				if err != nil {
+					return nil, err
+				}
+				addTeamRoles(current)
+				return resolver.rebindDeltas(ctx, current.Email, current, previous)
+			})
+			if err != nil {
+				log.Printf("ERROR: Error while assigning IAM role: %v", err)
+				return nil, fmt.Errorf("Error assigning IAM role: %w", err)
+			}
+			log.Printf("INFO: Lead %s of %s now holds %v", leadID, teamID, lead.IAMRoles[teamID])
 		}
-		team.IAMRoles = employee.IAMRoles[teamID]
+	}
+	if rolesChanged {
+		team.IAMRoles = lead.IAMRoles[teamID]
 	} else {
 		team.IAMRoles = teamData.IAMRoles
 	}
 	if team.TeamName == "" {
 		team.TeamName = teamData.TeamName
 	}
+	if team.ProjectIDs == nil {
+		team.ProjectIDs = teamData.ProjectIDs
+	}
+	previousProjects, err := c.newProjectResolver().groupProjects(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
 
 	currentTime := time.Now()
 	updatedTime := currentTime.Format("Mon, 02 Jan 2006 15:04:05 MST")
@@ -351,43 +321,34 @@ func UpdateTeam(teamID string, team sharedpackage.Team) (*sharedpackage.Team, er
 	team.DepartmentID = teamData.DepartmentID
 
 	// Update the Firestore document with merged data
-	_, err = docTeam.Set(ctx, team)
-	if err != nil {
+	if err := c.Teams.PutTeam(ctx, teamID, team); err != nil {
 		log.Printf("Error updating data in document with ID %s: %v", teamID, err)
-		return nil, fmt.Errorf("Error updating data in document: %v", err)
+		return nil, fmt.Errorf("Error updating data in document: %w", err)
+	}
+
+	// Move the bindings if the team now targets other projects
+	if !sameProjects(team.ProjectIDs, teamData.ProjectIDs) {
+		if err := c.retargetGroups(ctx, []string{teamID}, previousProjects); err != nil {
+			return nil, err
+		}
+		log.Printf("INFO: Team %s now targets projects %v", teamID, team.ProjectIDs)
 	}
 
 	log.Printf("Employee with ID %s updated successfully", teamID)
+	c.Outbox.Notify()
 
+	team.ID = teamID
 	return &team, nil
 }
 
-func ListTeams() (*[]sharedpackage.Team, error) {
-	ctx := context.Background()
-
-	iter := FirestoreClient.Collection("teams").Documents(ctx)
-
-	var teams []sharedpackage.Team
-
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			log.Printf("ERROR: Error iterating over documents: %v", err)
-			return nil, err
-		}
-
-		var teamData sharedpackage.Team
-		if err := doc.DataTo(&teamData); err != nil {
-			log.Printf("ERROR: Error converting document data: %v", err)
-			return nil, err
-		}
-
-		teams = append(teams, teamData)
-		log.Printf("INFO: Processed team.")
+// ListTeams returns every team.
+func (c *Controller) ListTeams() (*[]sharedpackage.Team, error) {
+	teams, err := c.Teams.ListTeams(context.Background())
+	if err != nil {
+		log.Printf("ERROR: Error iterating over documents: %v", err)
+		return nil, err
 	}
+	log.Printf("INFO: Processed %d teams.", len(teams))
 
 	return &teams, nil
 }
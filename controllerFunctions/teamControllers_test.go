@@ -0,0 +1,181 @@
+package controllerFunctions
+
+import (
+	"Task_04/iamRole"
+	"Task_04/sharedpackage"
+	"Task_04/storage"
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// putTeamLead makes empID, mailed at mail, the lead of team_1 holding
+// roles/viewer through it.
+func putTeamLead(t *testing.T, store *storage.MemoryStore, empID string, mail string, teamIDs []string) {
+	t.Helper()
+	ctx := context.Background()
+	lead := sharedpackage.Employee{
+		Email:    mail,
+		Role:     "Lead",
+		DeptID:   "dept_1",
+		TeamIDs:  teamIDs,
+		IAMRoles: map[string][]string{"team_1": {"roles/viewer"}},
+	}
+	if err := store.PutEmployee(ctx, empID, lead); err != nil {
+		t.Fatal(err)
+	}
+	team, err := store.GetTeam(ctx, "team_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	team.LeadID = empID
+	team.IAMRoles = []string{"roles/viewer"}
+	if err := store.PutTeam(ctx, "team_1", *team); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rolesOf returns the roles mail is bound to in the project, sorted.
+func rolesOf(fake *iamRole.FakeProvider, projectID string, mail string) []string {
+	var roles []string
+	for role, members := range fake.Bindings(projectID) {
+		for _, member := range members {
+			if member == iamRole.Member(mail) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+func TestUpdateTeamHandsTheLeadOver(t *testing.T) {
+	c, store, fake := newIAMController(t)
+	ctx := context.Background()
+	putTeamLead(t, store, "emp_lead", "lead@example.com", []string{"team_1"})
+	if _, err := c.UpdateTeam("team_1", sharedpackage.Team{IAMRoles: []string{"roles/viewer"}}); err != nil {
+		t.Fatalf("UpdateTeam() error = %v", err)
+	}
+	drainOutbox(t, c, store)
+
+	team, err := c.UpdateTeam("team_1", sharedpackage.Team{LeadID: iamTestEmployee, IAMRoles: []string{"roles/editor"}})
+	if err != nil {
+		t.Fatalf("UpdateTeam() error = %v", err)
+	}
+	if team.LeadID != iamTestEmployee {
+		t.Fatalf("leadID = %s, want %s", team.LeadID, iamTestEmployee)
+	}
+
+	// The new lead takes over the old lead's membership with the added role
+	lead, err := store.GetEmployee(ctx, iamTestEmployee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles := append([]string(nil), lead.IAMRoles["team_1"]...)
+	sort.Strings(roles)
+	if lead.Role != "Lead" || lead.DeptID != "dept_1" || !reflect.DeepEqual(roles, []string{"roles/editor", "roles/viewer"}) {
+		t.Fatalf("new lead = %+v, want Lead of dept_1 with viewer and editor", lead)
+	}
+
+	// The old lead is stripped
+	old, err := store.GetEmployee(ctx, "emp_lead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Role != "" || old.DeptID != "" || len(old.TeamIDs) != 0 || len(old.IAMRoles["team_1"]) != 0 {
+		t.Fatalf("old lead = %+v, want no membership", old)
+	}
+
+	// IAM follows both documents
+	drainOutbox(t, c, store)
+	for _, projectID := range []string{"project-one", "project-two"} {
+		if got, want := rolesOf(fake, projectID, iamTestMail), []string{"roles/editor", "roles/viewer"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("new lead roles on %s = %v, want %v", projectID, got, want)
+		}
+		if got := rolesOf(fake, projectID, "lead@example.com"); len(got) != 0 {
+			t.Errorf("old lead roles on %s = %v, want none", projectID, got)
+		}
+	}
+}
+
+func TestUpdateTeamLeadWithoutTeams(t *testing.T) {
+	c, store, fake := newIAMController(t)
+	putTeamLead(t, store, "emp_lead", "lead@example.com", nil)
+
+	if _, err := c.UpdateTeam("team_1", sharedpackage.Team{LeadID: iamTestEmployee}); err != nil {
+		t.Fatalf("UpdateTeam() error = %v", err)
+	}
+	drainOutbox(t, c, store)
+	if got, want := rolesOf(fake, "project-two", iamTestMail), []string{"roles/viewer"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("new lead roles on project-two = %v, want %v", got, want)
+	}
+}
+
+func TestCreateTeamMakesTheLeadThroughTheOutbox(t *testing.T) {
+	c, store, fake := newIAMController(t)
+	ctx := context.Background()
+	if err := store.PutEmployee(ctx, "emp_free", sharedpackage.Employee{Email: "free@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	team, err := c.CreateTeam(sharedpackage.Team{DepartmentID: "dept_1", LeadID: "emp_free", IAMRoles: []string{"roles/viewer"}, ProjectIDs: []string{"project-two"}})
+	if err != nil {
+		t.Fatalf("CreateTeam() error = %v", err)
+	}
+
+	lead, err := store.GetEmployee(ctx, "emp_free")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lead.Role != "Lead" || lead.DeptID != "dept_1" || !reflect.DeepEqual(lead.TeamIDs, []string{team.ID}) || !reflect.DeepEqual(lead.IAMRoles[team.ID], []string{"roles/viewer"}) {
+		t.Fatalf("lead = %+v, want Lead of %s with roles/viewer", lead, team.ID)
+	}
+	if got, want := pendingProjects(t, store), []string{"project-two"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pending operations = %v, want %v", got, want)
+	}
+
+	drainOutbox(t, c, store)
+	if got, want := rolesOf(fake, "project-two", "free@example.com"), []string{"roles/viewer"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("lead roles on project-two = %v, want %v", got, want)
+	}
+
+	// An employee already in a team is refused
+	if _, err := c.CreateTeam(sharedpackage.Team{DepartmentID: "dept_1", LeadID: iamTestEmployee}); err == nil {
+		t.Fatal("CreateTeam() with a busy lead succeeded, want an error")
+	}
+}
+
+func TestDeleteTeamRevokesItsMembersRoles(t *testing.T) {
+	c, store, fake := newIAMController(t)
+	ctx := context.Background()
+	putTeamLead(t, store, "emp_lead", "lead@example.com", []string{"team_1"})
+	if _, err := c.AssignIAMRole("dept_1", "team_1", iamTestEmployee, []string{"roles/editor"}, "Engineer", nil); err != nil {
+		t.Fatalf("AssignIAMRole() error = %v", err)
+	}
+	if _, err := c.AssignIAMRole("dept_1", "team_2", iamTestEmployee, []string{"roles/browser"}, "Engineer", nil); err != nil {
+		t.Fatalf("AssignIAMRole() error = %v", err)
+	}
+	drainOutbox(t, c, store)
+
+	if _, err := c.DeleteTeam("team_1"); err != nil {
+		t.Fatalf("DeleteTeam() error = %v", err)
+	}
+
+	// The member keeps team_2 and the roles held through it
+	employee, err := store.GetEmployee(ctx, iamTestEmployee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, held := employee.IAMRoles["team_1"]; held || !reflect.DeepEqual(employee.TeamIDs, []string{"team_2"}) || employee.DeptID != "dept_1" {
+		t.Fatalf("member = %+v, want only team_2 of dept_1", employee)
+	}
+
+	drainOutbox(t, c, store)
+	if got := rolesOf(fake, "project-two", iamTestMail); len(got) != 0 {
+		t.Errorf("member roles on project-two = %v, want none", got)
+	}
+	if got, want := rolesOf(fake, "project-one", iamTestMail), []string{"roles/browser"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("member roles on project-one = %v, want %v through team_2", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package handlerFunctions
+
+import (
+	"Task_04/controllerFunctions"
+	"Task_04/sharedpackage"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// tokenCookie is the cookie Login stores the JWT in.
+const tokenCookie = "token"
+
+// contextKey keys the values the handlers keep in a request context.
+type contextKey string
+
+// employeeKey holds the authenticated employee.
+const employeeKey contextKey = "employee"
+
+// EmployeeFromContext returns the employee AuthMiddleware authenticated.
+func EmployeeFromContext(ctx context.Context) (*sharedpackage.Employee, bool) {
+	employee, ok := ctx.Value(employeeKey).(*sharedpackage.Employee)
+	return employee, ok
+}
+
+// AuthMiddleware rejects requests without a valid JWT and puts the employee
+// the token was issued to into the request context. The token is read from
+// an "Authorization: Bearer" header or, failing that, the login cookie.
+func AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString, err := requestToken(r)
+		if err != nil {
+			unauthorized(w, err)
+			return
+		}
+
+		claims, err := parseToken(tokenString)
+		if err != nil {
+			unauthorized(w, err)
+			return
+		}
+
+		employee, err := controller.AuthenticatedEmployee(claims.Username)
+		if err != nil {
+			if statusFor(err) == http.StatusNotFound {
+				unauthorized(w, err)
+				return
+			}
+			http.Error(w, "Failed to authenticate", http.StatusInternalServerError)
+			log.Printf("ERROR: Failed to authenticate %s: %v", claims.Username, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), employeeKey, employee)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authorize answers 403 unless the authenticated caller may perform req, and
+// otherwise returns the caller.
+func authorize(w http.ResponseWriter, r *http.Request, req controllerFunctions.AccessRequest) (*sharedpackage.Employee, bool) {
+	caller, ok := EmployeeFromContext(r.Context())
+	if !ok {
+		unauthorized(w, errors.New("No authenticated employee in request context"))
+		return nil, false
+	}
+	if err := controller.Authorize(caller, req); err != nil {
+		message := "Forbidden"
+		if errors.Is(err, controllerFunctions.ErrMFAEnrollmentRequired) {
+			message = "Multi-factor enrollment required"
+		}
+		http.Error(w, message, statusFor(err))
+		log.Printf("ERROR: Refused %s for %s: %v", req.Action, caller.ID, err)
+		return nil, false
+	}
+	return caller, true
+}
+
+// nonEmpty drops blank IDs, which employee documents use for "no team".
+func nonEmpty(ids []string) []string {
+	var kept []string
+	for _, id := range ids {
+		if id != "" {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+// roleGroups returns the group keys of iamRoles, sorted.
+func roleGroups(iamRoles map[string][]string) []string {
+	groups := make([]string, 0, len(iamRoles))
+	for group := range iamRoles {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// requestToken extracts the raw JWT from the request.
+func requestToken(r *http.Request) (string, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return "", errors.New("Malformed Authorization header")
+		}
+		return token, nil
+	}
+
+	cookie, err := r.Cookie(tokenCookie)
+	if err != nil || cookie.Value == "" {
+		return "", errors.New("Missing token")
+	}
+	return cookie.Value, nil
+}
+
+// parseToken verifies the token's signature and expiry and returns its claims.
+func parseToken(tokenString string) (*sharedpackage.Claims, error) {
+	claims := &sharedpackage.Claims{}
+	if err := keys.Verify(tokenString, claims); err != nil {
+		return nil, err
+	}
+	if claims.Username == "" {
+		return nil, errors.New("Invalid token")
+	}
+	return claims, nil
+}
+
+// unauthorized answers 401 without revealing why the token was refused.
+func unauthorized(w http.ResponseWriter, err error) {
+	log.Printf("WARN: Unauthenticated request: %v", err)
+	w.Header().Set("WWW-Authenticate", `Bearer realm="ems"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
@@ -0,0 +1,144 @@
+package handlerFunctions
+
+import (
+	"Task_04/controllerFunctions"
+	"Task_04/sharedpackage"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// breakGlassRequest is the body of the break-glass request. Without an
+// employeeID the caller is granted access; without a duration the maximum.
+type breakGlassRequest struct {
+	EmployeeID    string `json:"employeeID"`
+	Justification string `json:"justification"`
+	Duration      string `json:"duration"`
+}
+
+// closeReviewRequest is the body of the request closing a break-glass review.
+type closeReviewRequest struct {
+	Notes string `json:"notes"`
+}
+
+// BreakGlassHandler grants the break-glass roles to an on-call employee
+// without approval.
+func BreakGlassHandler(w http.ResponseWriter, r *http.Request) {
+	var request breakGlassRequest
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("BreakGlassHandler ERROR: Error decoding request body: %v", err)
+		return
+	}
+
+	caller, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionBreakGlass, EmployeeID: request.EmployeeID})
+	if !ok {
+		return
+	}
+
+	var duration time.Duration
+	if request.Duration != "" {
+		var err error
+		if duration, err = time.ParseDuration(request.Duration); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid duration %q, use e.g. 30m", request.Duration), http.StatusBadRequest)
+			log.Printf("BreakGlassHandler ERROR: Invalid duration %q: %v", request.Duration, err)
+			return
+		}
+	}
+
+	grant, err := controller.BreakGlass(caller, request.EmployeeID, request.Justification, duration)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to break glass: %v", err), statusFor(err))
+		log.Printf("BreakGlassHandler ERROR: Failed to break glass: %v", err)
+		return
+	}
+
+	writeBreakGlassGrant(w, http.StatusCreated, grant)
+}
+
+// ListBreakGlassGrantsHandler returns the break-glass grants, optionally only
+// those whose review has the given ?status=, e.g. open.
+func ListBreakGlassGrantsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionReviewBreakGlass}); !ok {
+		return
+	}
+
+	grants, err := controller.ListBreakGlassGrants(r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list break-glass grants: %v", err), statusFor(err))
+		log.Printf("ListBreakGlassGrantsHandler ERROR: Failed to list break-glass grants: %v", err)
+		return
+	}
+
+	jsonData, err := json.Marshal(grants)
+	if err != nil {
+		http.Error(w, "Error encoding break-glass grants to JSON", http.StatusInternalServerError)
+		log.Printf("ListBreakGlassGrantsHandler ERROR: Error encoding break-glass grants to JSON: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// GetBreakGlassGrantHandler returns one break-glass grant.
+func GetBreakGlassGrantHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionReviewBreakGlass}); !ok {
+		return
+	}
+
+	grant, err := controller.GetBreakGlassGrant(mux.Vars(r)["grantID"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get break-glass grant: %v", err), statusFor(err))
+		log.Printf("GetBreakGlassGrantHandler ERROR: Failed to get break-glass grant: %v", err)
+		return
+	}
+
+	writeBreakGlassGrant(w, http.StatusOK, grant)
+}
+
+// CloseBreakGlassReviewHandler closes the review of a break-glass grant with
+// the reviewer's notes.
+func CloseBreakGlassReviewHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionReviewBreakGlass})
+	if !ok {
+		return
+	}
+	grantID := mux.Vars(r)["grantID"]
+
+	var request closeReviewRequest
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("CloseBreakGlassReviewHandler ERROR: Error decoding request body: %v", err)
+		return
+	}
+
+	grant, err := controller.CloseBreakGlassReview(caller, grantID, request.Notes)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to close break-glass review: %v", err), statusFor(err))
+		log.Printf("CloseBreakGlassReviewHandler ERROR: Failed to close review of %s: %v", grantID, err)
+		return
+	}
+
+	writeBreakGlassGrant(w, http.StatusOK, grant)
+}
+
+// writeBreakGlassGrant sends a break-glass grant as JSON.
+func writeBreakGlassGrant(w http.ResponseWriter, status int, grant *sharedpackage.BreakGlassGrant) {
+	jsonData, err := json.Marshal(grant)
+	if err != nil {
+		http.Error(w, "Error encoding break-glass grant to JSON", http.StatusInternalServerError)
+		log.Printf("ERROR: Error encoding break-glass grant to JSON: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonData)
+}
@@ -12,6 +12,10 @@ import (
 )
 
 func CreateDepartmentHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionCreateDepartment}); !ok {
+		return
+	}
+
 	var department sharedpackage.Department
 	decoder := json.NewDecoder(r.Body)
 	defer r.Body.Close()
@@ -40,9 +44,9 @@ func CreateDepartmentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add the department and get the data
-	data, err := controllerFunctions.AddDepartment(department.DepartmentName, department.IAMRoles, department.HeadID)
+	data, err := controller.AddDepartment(department.DepartmentName, department.IAMRoles, department.HeadID, department.ProjectIDs)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to add department: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to add department: %v", err), statusFor(err))
 		log.Printf("ERROR: Failed to add department: %v", err)
 		return
 	}
@@ -62,6 +66,10 @@ func CreateDepartmentHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteDepartmentHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionDeleteDepartment}); !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	departmentID, ok := vars["dept_id"]
 	if !ok {
@@ -71,9 +79,23 @@ func DeleteDepartmentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("INFO: Request received to delete department with ID: %s", departmentID)
 
-	err := controllerFunctions.DeleteDepartment(departmentID)
+	dryRun, err := dryRunRequested(r)
 	if err != nil {
-		http.Error(w, "Failed to delete department", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("WARN: %v in DeleteDepartmentHandler", err)
+		return
+	}
+	if dryRun {
+		plan, err := controller.DryRun(func(c *controllerFunctions.Controller) (interface{}, error) {
+			return nil, c.DeleteDepartment(departmentID)
+		})
+		respondWithPlan(w, plan, err)
+		return
+	}
+
+	err = controller.DeleteDepartment(departmentID)
+	if err != nil {
+		http.Error(w, "Failed to delete department", statusFor(err))
 		log.Printf("ERROR: Failed to delete department with ID %s: %v", departmentID, err)
 		return
 	}
@@ -85,6 +107,10 @@ func DeleteDepartmentHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func UpadateDepartmentHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionUpdateDepartment}); !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	departmentID, ok := vars["dept_id"]
 	if !ok {
@@ -105,9 +131,9 @@ func UpadateDepartmentHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("INFO: UpadateDepartmentHandler - Decoded request body fields: %+v", updateDept)
 
 	// Add the department and get the data
-	data, err := controllerFunctions.UpdateDepartment(departmentID, updateDept)
+	data, err := controller.UpdateDepartment(departmentID, updateDept)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to update employee: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to update employee: %v", err), statusFor(err))
 		log.Printf("UpadateDepartmentHandler ERROR: Failed to update employee: %v", err)
 		return
 	}
@@ -128,13 +154,20 @@ func UpadateDepartmentHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func ListDepartmentsHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionListDepartments})
+	if !ok {
+		return
+	}
+
 	// Retrieve all departments
-	departments, err := controllerFunctions.ListDepartments()
+	departments, err := controller.ListDepartments()
 	if err != nil {
 		log.Printf("ERROR: Failed to get departments: %v", err)
-		http.Error(w, "Failed to retrieve departments", http.StatusInternalServerError)
+		http.Error(w, "Failed to retrieve departments", statusFor(err))
 		return
 	}
+	visible := controller.VisibleDepartments(caller, *departments)
+	departments = &visible
 	log.Printf("INFO: Retrieved %d departments", len(*departments))
 
 	// Convert departments to JSON format
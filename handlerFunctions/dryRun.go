@@ -0,0 +1,43 @@
+package handlerFunctions
+
+import (
+	"Task_04/controllerFunctions"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// dryRunRequested reports whether the request asks for ?dryRun=true.
+func dryRunRequested(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("dryRun")
+	if value == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("Invalid dryRun value %q", value)
+	}
+	return dryRun, nil
+}
+
+// respondWithPlan writes the plan of a dry run, or the error that stopped it.
+func respondWithPlan(w http.ResponseWriter, plan *controllerFunctions.Plan, err error) {
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Dry run failed: %v", err), statusFor(err))
+		log.Printf("ERROR: Dry run failed: %v", err)
+		return
+	}
+
+	planJSON, err := json.Marshal(plan)
+	if err != nil {
+		http.Error(w, "Error encoding plan to JSON", http.StatusInternalServerError)
+		log.Printf("ERROR: Error encoding plan to JSON: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(planJSON)
+}
@@ -9,17 +9,25 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// employeeRequest is the body of a request creating or updating an
+// employee. The stored bcrypt hash is never (de)serialised, so a plain-text
+// password can only arrive through this field.
+type employeeRequest struct {
+	sharedpackage.Employee
+	Password string `json:"password"`
+}
+
 func CreateEmployeeHandler(w http.ResponseWriter, r *http.Request) {
-	var newEmployee sharedpackage.Employee
-	err := json.NewDecoder(r.Body).Decode(&newEmployee)
+	var request employeeRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
 		log.Printf("CreateEmployeeHandler ERROR: Error parsing request body: %v", err)
 		http.Error(w, "Error parsing request body", http.StatusBadRequest)
 		return
 	}
+	newEmployee := request.Employee
 
 	if newEmployee.FirstName == "" {
 		http.Error(w, "Please provide Firstname of employee  (firstName)", http.StatusBadRequest)
@@ -36,17 +44,12 @@ func CreateEmployeeHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println("CreateEmployeeHandler ERROR: Provide Email (email)")
 		return
 	}
-	if newEmployee.Password == "" {
-		http.Error(w, "Please provide password for employee  (password)", http.StatusBadRequest)
-		log.Println("CreateEmployeeHandler ERROR: Provide password (passowrd)")
-		return
-	}
 	if newEmployee.Role == "HOD" {
 		http.Error(w, "Cannot assign HOD role.", http.StatusBadRequest)
 		log.Println("CreateEmployee ERROR: Cannot assign HOD role.")
 		return
 	}
-	if newEmployee.Role == "admin" {
+	if newEmployee.Role == sharedpackage.RoleAdmin {
 		http.Error(w, "Cannot assign admin role.", http.StatusBadRequest)
 		log.Println("CreateEmployee ERROR: Cannot assign admin role.")
 		return
@@ -59,21 +62,48 @@ func CreateEmployeeHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("CreateEmployeeHandler INFO: New employee data received: %+v", newEmployee)
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newEmployee.Password), bcrypt.DefaultCost)
-	if err != nil {
-		log.Fatal("CreateEmployeeHandler ERROR: error while hashing password", err)
+	access := controllerFunctions.AccessRequest{
+		Action:       controllerFunctions.ActionCreateEmployee,
+		DepartmentID: newEmployee.DeptID,
+		TeamIDs:      nonEmpty(newEmployee.TeamIDs),
+	}
+	if _, ok := authorize(w, r, access); !ok {
+		return
 	}
 
-	newEmployee.Password = string(hashedPassword)
+	// Without a password the employee is invited to choose one
+	invite := request.Password == ""
+	if !invite {
+		if err := controllerFunctions.CheckPassword(request.Password, &newEmployee); err != nil {
+			http.Error(w, err.Error(), statusFor(err))
+			log.Printf("CreateEmployeeHandler ERROR: %v", err)
+			return
+		}
+		hashedPassword, err := controllerFunctions.HashPassword(request.Password)
+		if err != nil {
+			log.Printf("CreateEmployeeHandler ERROR: error while hashing password: %v", err)
+			http.Error(w, "Error while hashing password", http.StatusInternalServerError)
+			return
+		}
+		newEmployee.Password = hashedPassword
+	}
 
 	// Call AddEmployee function to store the new employee in Firestore
-	data, err := controllerFunctions.CreateEmployee(newEmployee)
+	data, err := controller.CreateEmployee(newEmployee)
 	if err != nil {
 		log.Printf("CreateEmployeeHandler ERROR: Error adding employee to Firestore: %v", err)
-		http.Error(w, "Error adding employee to Firestore", http.StatusInternalServerError)
+		http.Error(w, "Error adding employee to Firestore", statusFor(err))
 		return
 	}
 
+	if invite {
+		if err := controller.InviteEmployee(data.ID); err != nil {
+			http.Error(w, fmt.Sprintf("Employee %s created, but the invite could not be sent; resend it with /employees/%s/invite", data.ID, data.ID), statusFor(err))
+			log.Printf("CreateEmployeeHandler ERROR: Failed to invite employee %s: %v", data.ID, err)
+			return
+		}
+	}
+
 	// Convert the data to JSON
 	jsonData, err := json.Marshal(data)
 	if err != nil {
@@ -99,9 +129,13 @@ func DeleteEmployeeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("DeleteEmployeeHandler INFO: Request received to delete employee with ID: %s", employeeID)
 
-	data, err := controllerFunctions.DeleteEmployee(employeeID)
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionDeleteEmployee, EmployeeID: employeeID}); !ok {
+		return
+	}
+
+	data, err := controller.DeleteEmployee(employeeID)
 	if err != nil {
-		http.Error(w, "Failed to delete employee", http.StatusInternalServerError)
+		http.Error(w, "Failed to delete employee", statusFor(err))
 		log.Printf("DeleteEmployeeHandler ERROR: Failed to delete employee with ID %s: %v", employeeID, err)
 		return
 	}
@@ -130,13 +164,21 @@ func UpdateEmployeeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("UpdateEmployeeHandler INFO: Request received to delete employee with ID: %s", employeeID)
 
-	var updateEmp sharedpackage.Employee
-	err := json.NewDecoder(r.Body).Decode(&updateEmp)
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("UpdateEmployeeHandler WARN: %v", err)
+		return
+	}
+
+	var request employeeRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
 		log.Printf("CreateEmployeeHandler ERROR: Error parsing request body: %v", err)
 		http.Error(w, "Error parsing request body", http.StatusBadRequest)
 		return
 	}
+	updateEmp := request.Employee
 
 	log.Printf("INFO: UpdateEmployeeHandler - Decoded request body fields: %+v", updateEmp)
 
@@ -145,7 +187,7 @@ func UpdateEmployeeHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println("UpdateEmployeeHandler ERROR: Cannot assign HOD role.")
 		return
 	}
-	if updateEmp.Role == "admin" {
+	if updateEmp.Role == sharedpackage.RoleAdmin {
 		http.Error(w, "Cannot assign admin role.", http.StatusBadRequest)
 		log.Println("UpdateEmployeeHandler ERROR: Cannot assign admin role.")
 		return
@@ -155,19 +197,35 @@ func UpdateEmployeeHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println("UpdateEmployeeHandler ERROR: Cannot assign Lead role.")
 		return
 	}
-	if updateEmp.Password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(updateEmp.Password), bcrypt.DefaultCost)
-		if err != nil {
-			log.Fatal("UpdateEmployeeHandler ERROR: error while hashing password", err)
-		}
+	if request.Password != "" {
+		http.Error(w, "Passwords cannot be updated; use /auth/password/forgot or /employees/{empID}/invite", http.StatusBadRequest)
+		log.Println("UpdateEmployeeHandler ERROR: Refused password change.")
+		return
+	}
 
-		updateEmp.Password = string(hashedPassword)
+	access := controllerFunctions.AccessRequest{
+		Action:       controllerFunctions.ActionUpdateEmployee,
+		EmployeeID:   employeeID,
+		DepartmentID: updateEmp.DeptID,
+		TeamIDs:      nonEmpty(updateEmp.TeamIDs),
+		RoleGroups:   roleGroups(updateEmp.IAMRoles),
+	}
+	if _, ok := authorize(w, r, access); !ok {
+		return
+	}
+
+	if dryRun {
+		plan, err := controller.DryRun(func(c *controllerFunctions.Controller) (interface{}, error) {
+			return c.UpdateEmployee(employeeID, updateEmp)
+		})
+		respondWithPlan(w, plan, err)
+		return
 	}
 
 	// Add the department and get the data
-	data, err := controllerFunctions.UpdateEmployee(employeeID, updateEmp)
+	data, err := controller.UpdateEmployee(employeeID, updateEmp)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to update employee: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to update employee: %v", err), statusFor(err))
 		log.Printf("UpdateEmployeeHandler ERROR: Failed to update employee: %v", err)
 		return
 	}
@@ -187,14 +245,53 @@ func UpdateEmployeeHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// UnlockEmployeeHandler lifts the login lockout of an employee.
+func UnlockEmployeeHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionUnlockEmployee}); !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	employeeID, ok := vars["empID"]
+	if !ok {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		log.Println("UnlockEmployeeHandler WARN: Invalid URL")
+		return
+	}
+
+	data, err := controller.UnlockEmployee(employeeID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to unlock employee: %v", err), statusFor(err))
+		log.Printf("UnlockEmployeeHandler ERROR: Failed to unlock employee: %v", err)
+		return
+	}
+
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to marshal employee data to JSON: %v", err), http.StatusInternalServerError)
+		log.Printf("UnlockEmployeeHandler ERROR: Failed to marshal employee data to JSON: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
 func ListEmployeeHandler(w http.ResponseWriter, r *http.Request) {
 	// Retrieve all employees
-	employees, err := controllerFunctions.ListEmployee()
+	caller, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionListEmployees})
+	if !ok {
+		return
+	}
+
+	employees, err := controller.ListEmployee()
 	if err != nil {
 		log.Printf("ERROR: Failed to get employees: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		http.Error(w, "Internal Server Error", statusFor(err))
 		return
 	}
+	employees = controller.VisibleEmployees(caller, employees)
 	log.Printf("INFO: Retrieved %d employees", len(employees))
 
 	// Convert employees to JSON format
@@ -216,3 +313,61 @@ func ListEmployeeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Println("INFO: Sent employees JSON response")
 }
+
+// InviteEmployeeHandler sends an employee a new token to set their password,
+// e.g. when the first invite expired.
+func InviteEmployeeHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	employeeID, ok := vars["empID"]
+	if !ok {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		log.Println("InviteEmployeeHandler WARN: Invalid URL")
+		return
+	}
+
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionInviteEmployee, EmployeeID: employeeID}); !ok {
+		return
+	}
+
+	if err := controller.InviteEmployee(employeeID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to invite employee: %v", err), statusFor(err))
+		log.Printf("InviteEmployeeHandler ERROR: Failed to invite employee: %v", err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// EmployeeBindingsHandler shows the IAM roles of an employee grouped by the
+// project they are granted in.
+func EmployeeBindingsHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionListEmployees})
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	employeeID, ok := vars["empID"]
+	if !ok {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		log.Println("EmployeeBindingsHandler WARN: Invalid URL")
+		return
+	}
+
+	bindings, err := controller.EmployeeBindings(caller, employeeID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get IAM bindings: %v", err), statusFor(err))
+		log.Printf("EmployeeBindingsHandler ERROR: Failed to get IAM bindings: %v", err)
+		return
+	}
+
+	jsonData, err := json.Marshal(bindings)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to marshal IAM bindings to JSON: %v", err), http.StatusInternalServerError)
+		log.Printf("EmployeeBindingsHandler ERROR: Failed to marshal IAM bindings to JSON: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
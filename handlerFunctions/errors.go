@@ -0,0 +1,35 @@
+package handlerFunctions
+
+import (
+	"Task_04/controllerFunctions"
+	"Task_04/iamRole"
+	"Task_04/storage"
+	"errors"
+	"net/http"
+)
+
+// statusFor maps the typed errors returned by the controllers and the iamRole
+// package to an HTTP status code. Anything unrecognised is a server error.
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, iamRole.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, controllerFunctions.ErrForbidden), errors.Is(err, iamRole.ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, iamRole.ErrConflict), errors.Is(err, controllerFunctions.ErrMFAAlreadyEnabled),
+		errors.Is(err, controllerFunctions.ErrRoleRequestDecided), errors.Is(err, controllerFunctions.ErrBreakGlassReviewDone),
+		errors.Is(err, controllerFunctions.ErrReviewItemDecided):
+		return http.StatusConflict
+	case errors.Is(err, iamRole.ErrQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, iamRole.ErrInvalidRole), errors.Is(err, iamRole.ErrInvalidProject), errors.Is(err, iamRole.ErrInvalidCondition),
+		errors.Is(err, controllerFunctions.ErrInvalidMFACode),
+		errors.Is(err, controllerFunctions.ErrMFANotEnrolled), errors.Is(err, controllerFunctions.ErrWeakPassword),
+		errors.Is(err, controllerFunctions.ErrInvalidPasswordToken), errors.Is(err, controllerFunctions.ErrInvalidExpiry),
+		errors.Is(err, controllerFunctions.ErrInvalidRoleRequest), errors.Is(err, controllerFunctions.ErrInvalidBreakGlass),
+		errors.Is(err, controllerFunctions.ErrInvalidReviewCampaign), errors.Is(err, controllerFunctions.ErrInvalidRoleGroup):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -5,16 +5,20 @@ import (
 	"Task_04/iamRole"
 	"Task_04/sharedpackage"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
-	"time"
 )
 
-var projectID = "ems-web-application-409305"
-var jwtKey = []byte("secret_key")
+// controller carries out the requests received by the handlers.
+var controller *controllerFunctions.Controller
+
+// SetController injects the controller the handlers delegate to.
+func SetController(c *controllerFunctions.Controller) {
+	controller = c
+}
 
 // Login handles the login functionality.
 func Login(w http.ResponseWriter, r *http.Request) {
@@ -25,46 +29,27 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	expectedPassword, err := controllerFunctions.LoginUser(credentials.Username)
+	// Verify the password against the stored bcrypt hash
+	employee, err := controller.Login(credentials.Username, credentials.Password, credentials.Code)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// Check if the password matches the expected password
-	if credentials.Password != *expectedPassword {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
-	expirationTime := time.Now().Add(time.Minute * 5)
-
-	claims := &sharedpackage.Claims{
-		Username: credentials.Username,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
-
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// Set the JWT token as a cookie
-	http.SetCookie(w,
-		&http.Cookie{
-			Name:    "token",
-			Value:   tokenString,
-			Expires: expirationTime,
-		})
-
-	// Optionally, you can send a success response if needed
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Login successful"))
+		var locked *controllerFunctions.LockedError
+		switch {
+		case errors.As(err, &locked):
+			accountLocked(w, locked)
+		case errors.Is(err, controllerFunctions.ErrInvalidCredentials):
+			http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		case errors.Is(err, controllerFunctions.ErrMFARequired):
+			mfaRequired(w)
+		case errors.Is(err, controllerFunctions.ErrInvalidMFACode):
+			http.Error(w, "Invalid multi-factor code", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Login failed", statusFor(err))
+		}
+		log.Printf("WARN: Login failed for %s: %v", credentials.Username, err)
+		return
+	}
+
+	issueTokens(w, employee)
 }
 
 // AssignIAMRoleHandler handles the HTTP request to assign IAM roles to an employee.
@@ -79,6 +64,13 @@ func AssignIAMRoleHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("INFO: Request received for employee with ID: %s", employeeIDStr)
 
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("WARN: %v in AssignIAMRoleHandler", err)
+		return
+	}
+
 	// Parse the request body to get the updated fields
 	var request sharedpackage.AssignRole
 
@@ -124,9 +116,35 @@ func AssignIAMRoleHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := controllerFunctions.AssignIAMRole(request.DeptID, request.TeamID, employeeIDStr, request.IAMRoles, request.Role)
+	access := controllerFunctions.AccessRequest{
+		Action:       controllerFunctions.ActionAssignRoles,
+		EmployeeID:   employeeIDStr,
+		DepartmentID: request.DeptID,
+		Roles:        request.IAMRoles,
+	}
+	if request.TeamID != "" {
+		access.TeamIDs = []string{request.TeamID}
+	}
+	if _, ok := authorize(w, r, access); !ok {
+		return
+	}
+
+	var grant *sharedpackage.RoleGrant
+	if request.ExpiresAt != nil || request.Condition != nil {
+		grant = &sharedpackage.RoleGrant{ExpiresAt: request.ExpiresAt, Condition: request.Condition}
+	}
+
+	if dryRun {
+		plan, err := controller.DryRun(func(c *controllerFunctions.Controller) (interface{}, error) {
+			return c.AssignIAMRole(request.DeptID, request.TeamID, employeeIDStr, request.IAMRoles, request.Role, grant)
+		})
+		respondWithPlan(w, plan, err)
+		return
+	}
+
+	data, err := controller.AssignIAMRole(request.DeptID, request.TeamID, employeeIDStr, request.IAMRoles, request.Role, grant)
 	if err != nil {
-		http.Error(w, "Failed to assign IAM role", http.StatusInternalServerError)
+		http.Error(w, "Failed to assign IAM role", statusFor(err))
 		log.Printf("ERROR: Failed to assign IAM role: %v", err)
 		return
 	}
@@ -134,7 +152,9 @@ func AssignIAMRoleHandler(w http.ResponseWriter, r *http.Request) {
 	// Convert struct to JSON
 	jsonData, err := json.Marshal(data)
 	if err != nil {
-		log.Fatal(err)
+		http.Error(w, "Error encoding document to JSON", http.StatusInternalServerError)
+		log.Printf("ERROR: Error encoding document to JSON: %v", err)
+		return
 	}
 
 	log.Printf("INFO: %s", jsonData)
@@ -156,9 +176,13 @@ func RemoveMemberHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("INFO: Request received for employee with ID: %s", employeeIDStr)
 
-	err := controllerFunctions.RemoveMember(employeeIDStr)
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionRemoveMember, EmployeeID: employeeIDStr}); !ok {
+		return
+	}
+
+	err := controller.RemoveMember(employeeIDStr)
 	if err != nil {
-		http.Error(w, "Failed to remove employee", http.StatusInternalServerError)
+		http.Error(w, "Failed to remove employee", statusFor(err))
 		log.Printf("ERROR: Failed to remove employee: %v", err)
 		return
 	}
@@ -168,6 +192,10 @@ func RemoveMemberHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func CreateCustomRoleHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionManageCustomRoles}); !ok {
+		return
+	}
+
 	var request sharedpackage.CustomRole
 
 	decoder := json.NewDecoder(r.Body)
@@ -190,7 +218,7 @@ func CreateCustomRoleHandler(w http.ResponseWriter, r *http.Request) {
 	// Specify your projectID (replace "your-project-id" with your actual project ID)
 	role, err := iamRole.CreateRole(log.Writer(), request.ProjectID, request.Name, request.Title, request.Desc, request.Stage, request.Perm)
 	if err != nil {
-		http.Error(w, "Error creating role", http.StatusInternalServerError)
+		http.Error(w, "Error creating role", statusFor(err))
 		log.Printf("ERROR: Error creating role: %v", err)
 		return
 	}
@@ -205,6 +233,10 @@ func CreateCustomRoleHandler(w http.ResponseWriter, r *http.Request) {
 
 // DeleteCustomRoleHandler will delete custom role creates in roles.
 func DeleteCustomRoleHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionManageCustomRoles}); !ok {
+		return
+	}
+
 	// Retrieve query parameters from the request URL
 	name := r.URL.Query().Get("name")
 	projectID := r.URL.Query().Get("projectID")
@@ -218,7 +250,7 @@ func DeleteCustomRoleHandler(w http.ResponseWriter, r *http.Request) {
 
 	err := iamRole.DeleteRole(log.Writer(), projectID, name)
 	if err != nil {
-		http.Error(w, "Error deleting role", http.StatusInternalServerError)
+		http.Error(w, "Error deleting role", statusFor(err))
 		log.Printf("ERROR: Error deleting role: %v", err)
 		return
 	}
@@ -233,6 +265,10 @@ func DeleteCustomRoleHandler(w http.ResponseWriter, r *http.Request) {
 
 // UndeleteCustomerRoleHandler undeletes custom role which is previously deleted.
 func UndeleteCustomRoleHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionManageCustomRoles}); !ok {
+		return
+	}
+
 	// Retrieve query parameters from the request URL
 	name := r.URL.Query().Get("name")
 	projectID := r.URL.Query().Get("projectID")
@@ -246,7 +282,7 @@ func UndeleteCustomRoleHandler(w http.ResponseWriter, r *http.Request) {
 
 	err := iamRole.UndeleteRole(log.Writer(), projectID, name)
 	if err != nil {
-		http.Error(w, "Error undeleting role", http.StatusInternalServerError)
+		http.Error(w, "Error undeleting role", statusFor(err))
 		log.Printf("ERROR: Error undeleting role: %v", err)
 		return
 	}
@@ -259,6 +295,10 @@ func UndeleteCustomRoleHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func ListCustomRolesHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionManageCustomRoles}); !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	projectID, ok := vars["projectID"]
 	if !ok {
@@ -269,7 +309,7 @@ func ListCustomRolesHandler(w http.ResponseWriter, r *http.Request) {
 
 	roleNames, err := iamRole.ListCustomRoles(log.Writer(), projectID)
 	if err != nil {
-		http.Error(w, "Error listing roles", http.StatusInternalServerError)
+		http.Error(w, "Error listing roles", statusFor(err))
 		log.Printf("ERROR: Error listing roles: %v", err)
 		return
 	}
@@ -283,6 +323,10 @@ func ListCustomRolesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func UpdateCustomRolesHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionManageCustomRoles}); !ok {
+		return
+	}
+
 	// Retrieve query parameters from the request URL
 	name := r.URL.Query().Get("name")
 	projectID := r.URL.Query().Get("projectID")
@@ -310,7 +354,7 @@ func UpdateCustomRolesHandler(w http.ResponseWriter, r *http.Request) {
 	// Specify your projectID (replace "your-project-id" with your actual project ID)
 	role, err := iamRole.UpdateCustomRole(log.Writer(), projectID, name, request.Title, request.Desc, request.Stage, request.Perm)
 	if err != nil {
-		http.Error(w, "Error creating role", http.StatusInternalServerError)
+		http.Error(w, "Error creating role", statusFor(err))
 		log.Printf("ERROR: Error creating role: %v", err)
 		return
 	}
@@ -343,6 +387,13 @@ func RemoveIAMRolesHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("INFO: Request received for employee with ID: %s", employeeID)
 
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("WARN: %v in RemoveIAMRolesHandler", err)
+		return
+	}
+
 	var request sharedpackage.RemoveRoles
 
 	decoder := json.NewDecoder(r.Body)
@@ -356,10 +407,22 @@ func RemoveIAMRolesHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("INFO: RemoveIAMRolesHandler - Decoded request body fields: %+v", request)
 
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionRemoveRoles, EmployeeID: employeeID}); !ok {
+		return
+	}
+
+	if dryRun {
+		plan, err := controller.DryRun(func(c *controllerFunctions.Controller) (interface{}, error) {
+			return c.RemoveIAMRoles(employeeID, request)
+		})
+		respondWithPlan(w, plan, err)
+		return
+	}
+
 	// Specify your projectID (replace "your-project-id" with your actual project ID)
-	data, err := controllerFunctions.RemoveIAMRoles(employeeID, request)
+	data, err := controller.RemoveIAMRoles(employeeID, request)
 	if err != nil {
-		http.Error(w, "Error creating role", http.StatusInternalServerError)
+		http.Error(w, "Error creating role", statusFor(err))
 		log.Printf("ERROR: Error creating role: %v", err)
 		return
 	}
@@ -379,3 +442,98 @@ func RemoveIAMRolesHandler(w http.ResponseWriter, r *http.Request) {
 	// Log success
 	log.Printf("INFO: RemoveIAMRolesHandler - Role updated successfully: %+v", data)
 }
+
+// IAMDriftHandler reports, per project, how the live IAM policy differs from
+// the employees collection.
+func IAMDriftHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionReadIAM}); !ok {
+		return
+	}
+
+	reports, err := controller.IAMDrift()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to detect IAM drift: %v", err), statusFor(err))
+		log.Printf("ERROR: Failed to detect IAM drift: %v", err)
+		return
+	}
+
+	reportJSON, err := json.Marshal(reports)
+	if err != nil {
+		http.Error(w, "Error encoding drift report to JSON", http.StatusInternalServerError)
+		log.Printf("ERROR: Error encoding drift report to JSON: %v", err)
+		return
+	}
+
+	for _, report := range reports {
+		log.Printf("INFO: IAM drift in %s: %d missing, %d extra, %d unknown bindings", report.ProjectID, len(report.MissingBindings), len(report.ExtraBindings), len(report.UnknownMembers))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(reportJSON)
+}
+
+// ReconcileIAMHandler fixes the drift between the live IAM policy of every
+// targeted project and the employees collection. With ?dryRun=true it only reports the changes.
+func ReconcileIAMHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionReconcileIAM}); !ok {
+		return
+	}
+
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("WARN: %v in ReconcileIAMHandler", err)
+		return
+	}
+
+	results, err := controller.ReconcileIAM(dryRun)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reconcile IAM: %v", err), statusFor(err))
+		log.Printf("ERROR: Failed to reconcile IAM: %v", err)
+		return
+	}
+
+	resultJSON, err := json.Marshal(results)
+	if err != nil {
+		http.Error(w, "Error encoding reconcile result to JSON", http.StatusInternalServerError)
+		log.Printf("ERROR: Error encoding reconcile result to JSON: %v", err)
+		return
+	}
+
+	for _, result := range results {
+		log.Printf("INFO: IAM reconcile of %s (dryRun=%v): %d binding changes", result.ProjectID, dryRun, len(result.Deltas))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resultJSON)
+}
+
+// SweepExpiredGrantsHandler removes expired time-bound grants right away
+// instead of waiting for the background sweeper, and lists them.
+func SweepExpiredGrantsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionReconcileIAM}); !ok {
+		return
+	}
+
+	expired, err := controller.SweepExpiredGrants()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to sweep expired grants: %v", err), statusFor(err))
+		log.Printf("ERROR: Failed to sweep expired grants: %v", err)
+		return
+	}
+
+	expiredJSON, err := json.Marshal(expired)
+	if err != nil {
+		http.Error(w, "Error encoding expired grants to JSON", http.StatusInternalServerError)
+		log.Printf("ERROR: Error encoding expired grants to JSON: %v", err)
+		return
+	}
+
+	log.Printf("INFO: Swept %d expired IAM grants", len(expired))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(expiredJSON)
+}
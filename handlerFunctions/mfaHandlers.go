@@ -0,0 +1,120 @@
+package handlerFunctions
+
+import (
+	"Task_04/controllerFunctions"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// mfaCodeRequest is the body of the MFA confirmation request.
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// mfaRequired answers a login that needs a second factor with 401 and a body
+// clients can recognise, so they can ask for the code and retry.
+func mfaRequired(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(`{"mfaRequired":true}`))
+}
+
+// EnrollMFAHandler starts TOTP enrollment for the caller and returns the
+// secret and otpauth URI to add to an authenticator app. It is available
+// before enrollment, unlike every endpoint that calls authorize.
+func EnrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := EmployeeFromContext(r.Context())
+	if !ok {
+		unauthorized(w, errors.New("No authenticated employee in request context"))
+		return
+	}
+
+	enrollment, err := controller.EnrollMFA(caller.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to enroll MFA: %v", err), statusFor(err))
+		log.Printf("EnrollMFAHandler ERROR: Failed to enroll MFA: %v", err)
+		return
+	}
+
+	jsonData, err := json.Marshal(enrollment)
+	if err != nil {
+		http.Error(w, "Error encoding enrollment to JSON", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// ConfirmMFAHandler enables MFA for the caller with a first TOTP code and
+// returns the recovery codes, which are shown only this once.
+func ConfirmMFAHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := EmployeeFromContext(r.Context())
+	if !ok {
+		unauthorized(w, errors.New("No authenticated employee in request context"))
+		return
+	}
+
+	var request mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Code == "" {
+		http.Error(w, "Please provide the code from the authenticator app (code)", http.StatusBadRequest)
+		log.Println("ConfirmMFAHandler ERROR: Provide code (code)")
+		return
+	}
+
+	codes, err := controller.ConfirmMFA(caller.ID, request.Code)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to confirm MFA: %v", err), statusFor(err))
+		log.Printf("ConfirmMFAHandler ERROR: Failed to confirm MFA: %v", err)
+		return
+	}
+
+	jsonData, err := json.Marshal(map[string][]string{"recoveryCodes": codes})
+	if err != nil {
+		http.Error(w, "Error encoding recovery codes to JSON", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// ResetMFAHandler removes an employee's MFA so they can enroll a new device.
+func ResetMFAHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionResetMFA}); !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	employeeID, ok := vars["empID"]
+	if !ok {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		log.Println("ResetMFAHandler WARN: Invalid URL")
+		return
+	}
+
+	data, err := controller.ResetMFA(employeeID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reset MFA: %v", err), statusFor(err))
+		log.Printf("ResetMFAHandler ERROR: Failed to reset MFA: %v", err)
+		return
+	}
+
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to marshal employee data to JSON: %v", err), http.StatusInternalServerError)
+		log.Printf("ResetMFAHandler ERROR: Failed to marshal employee data to JSON: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
@@ -0,0 +1,52 @@
+package handlerFunctions
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// passwordResetRequest is the body of a forgotten password request.
+type passwordResetRequest struct {
+	Username string `json:"username"`
+}
+
+// setPasswordRequest is the body of a request setting a new password.
+type setPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ForgotPasswordHandler sends a password reset token to the employee. It
+// answers 202 whether or not the account exists.
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var request passwordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Username == "" {
+		http.Error(w, "Please provide the mail address of the account (username)", http.StatusBadRequest)
+		log.Println("ForgotPasswordHandler ERROR: Provide username (username)")
+		return
+	}
+
+	if err := controller.RequestPasswordReset(request.Username); err != nil {
+		http.Error(w, "Failed to send password reset", statusFor(err))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// SetPasswordHandler sets a password with the token of an invite or reset.
+func SetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var request setPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" || request.Password == "" {
+		http.Error(w, "Please provide the token you received (token) and a new password (password)", http.StatusBadRequest)
+		log.Println("SetPasswordHandler ERROR: Provide token and password")
+		return
+	}
+
+	if err := controller.ResetPassword(request.Token, request.Password); err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		log.Printf("SetPasswordHandler ERROR: %v", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,151 @@
+package handlerFunctions
+
+import (
+	"Task_04/controllerFunctions"
+	"Task_04/sharedpackage"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// launchReviewRequest is the body of the request launching an access review
+// of a department, with its teams, or of a single team.
+type launchReviewRequest struct {
+	Name         string    `json:"name"`
+	DepartmentID string    `json:"departmentID"`
+	TeamID       string    `json:"teamID"`
+	Deadline     time.Time `json:"deadline"`
+	AutoRevoke   bool      `json:"autoRevoke"`
+}
+
+// reviewItemRequest is the body of a reviewer's decision on a review item.
+type reviewItemRequest struct {
+	Decision string `json:"decision"`
+	Comment  string `json:"comment"`
+}
+
+// LaunchReviewCampaignHandler launches an access review campaign and assigns
+// its items to the Leads and HODs.
+func LaunchReviewCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	var request launchReviewRequest
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("LaunchReviewCampaignHandler ERROR: Error decoding request body: %v", err)
+		return
+	}
+
+	access := controllerFunctions.AccessRequest{Action: controllerFunctions.ActionLaunchReview, DepartmentID: request.DepartmentID}
+	if request.TeamID != "" {
+		access.TeamIDs = []string{request.TeamID}
+	}
+	caller, ok := authorize(w, r, access)
+	if !ok {
+		return
+	}
+
+	campaign, err := controller.LaunchReviewCampaign(caller, request.Name, request.DepartmentID, request.TeamID, request.Deadline, request.AutoRevoke)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to launch review campaign: %v", err), statusFor(err))
+		log.Printf("LaunchReviewCampaignHandler ERROR: Failed to launch review campaign: %v", err)
+		return
+	}
+
+	writeReviewCampaign(w, http.StatusCreated, campaign)
+}
+
+// ListReviewCampaignsHandler returns the review campaigns the caller may
+// read, optionally only those with the given ?status=, e.g. open. Reviewers
+// outside the campaign's scope only see the items assigned to them.
+func ListReviewCampaignsHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionListReviews})
+	if !ok {
+		return
+	}
+
+	campaigns, err := controller.ListReviewCampaigns(caller, r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list review campaigns: %v", err), statusFor(err))
+		log.Printf("ListReviewCampaignsHandler ERROR: Failed to list review campaigns: %v", err)
+		return
+	}
+
+	jsonData, err := json.Marshal(campaigns)
+	if err != nil {
+		http.Error(w, "Error encoding review campaigns to JSON", http.StatusInternalServerError)
+		log.Printf("ListReviewCampaignsHandler ERROR: Error encoding review campaigns to JSON: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// GetReviewCampaignHandler returns one review campaign.
+func GetReviewCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionListReviews})
+	if !ok {
+		return
+	}
+
+	campaign, err := controller.GetReviewCampaign(caller, mux.Vars(r)["campaignID"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get review campaign: %v", err), statusFor(err))
+		log.Printf("GetReviewCampaignHandler ERROR: Failed to get review campaign: %v", err)
+		return
+	}
+
+	writeReviewCampaign(w, http.StatusOK, campaign)
+}
+
+// ReviewItemHandler keeps or revokes the role of one review item.
+func ReviewItemHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionReviewAccess})
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+
+	var request reviewItemRequest
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("ReviewItemHandler ERROR: Error decoding request body: %v", err)
+		return
+	}
+
+	item, err := controller.ReviewItem(caller, vars["campaignID"], vars["itemID"], request.Decision, request.Comment)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to review item: %v", err), statusFor(err))
+		log.Printf("ReviewItemHandler ERROR: Failed to review %s of %s: %v", vars["itemID"], vars["campaignID"], err)
+		return
+	}
+
+	jsonData, err := json.Marshal(item)
+	if err != nil {
+		http.Error(w, "Error encoding review item to JSON", http.StatusInternalServerError)
+		log.Printf("ReviewItemHandler ERROR: Error encoding review item to JSON: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// writeReviewCampaign sends a review campaign as JSON.
+func writeReviewCampaign(w http.ResponseWriter, status int, campaign *sharedpackage.ReviewCampaign) {
+	jsonData, err := json.Marshal(campaign)
+	if err != nil {
+		http.Error(w, "Error encoding review campaign to JSON", http.StatusInternalServerError)
+		log.Printf("ERROR: Error encoding review campaign to JSON: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonData)
+}
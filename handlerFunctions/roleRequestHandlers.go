@@ -0,0 +1,140 @@
+package handlerFunctions
+
+import (
+	"Task_04/controllerFunctions"
+	"Task_04/sharedpackage"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// roleDecisionRequest is the optional body of the approve and deny requests.
+type roleDecisionRequest struct {
+	Comment string `json:"comment"`
+}
+
+// RequestRolesHandler files an access request of the caller for IAM roles in
+// one of their teams or their department.
+func RequestRolesHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionRequestRoles})
+	if !ok {
+		return
+	}
+
+	var request sharedpackage.RoleRequest
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("RequestRolesHandler ERROR: Error decoding request body: %v", err)
+		return
+	}
+
+	filed, err := controller.RequestRoles(caller, request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to file access request: %v", err), statusFor(err))
+		log.Printf("RequestRolesHandler ERROR: Failed to file access request: %v", err)
+		return
+	}
+
+	writeRoleRequest(w, http.StatusCreated, filed)
+}
+
+// ListRoleRequestsHandler returns the access requests the caller may read,
+// optionally only those with the given ?status=.
+func ListRoleRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionListRoleRequests})
+	if !ok {
+		return
+	}
+
+	requests, err := controller.ListRoleRequests(caller, r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list access requests: %v", err), statusFor(err))
+		log.Printf("ListRoleRequestsHandler ERROR: Failed to list access requests: %v", err)
+		return
+	}
+
+	jsonData, err := json.Marshal(requests)
+	if err != nil {
+		http.Error(w, "Error encoding access requests to JSON", http.StatusInternalServerError)
+		log.Printf("ListRoleRequestsHandler ERROR: Error encoding access requests to JSON: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// GetRoleRequestHandler returns one access request.
+func GetRoleRequestHandler(w http.ResponseWriter, r *http.Request) {
+	caller, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionListRoleRequests})
+	if !ok {
+		return
+	}
+
+	request, err := controller.GetRoleRequest(caller, mux.Vars(r)["requestID"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get access request: %v", err), statusFor(err))
+		log.Printf("GetRoleRequestHandler ERROR: Failed to get access request: %v", err)
+		return
+	}
+
+	writeRoleRequest(w, http.StatusOK, request)
+}
+
+// ApproveRoleRequestHandler approves an access request routed to the caller
+// and grants its roles.
+func ApproveRoleRequestHandler(w http.ResponseWriter, r *http.Request) {
+	decideRoleRequest(w, r, "approve", controller.ApproveRoleRequest)
+}
+
+// DenyRoleRequestHandler denies an access request routed to the caller.
+func DenyRoleRequestHandler(w http.ResponseWriter, r *http.Request) {
+	decideRoleRequest(w, r, "deny", controller.DenyRoleRequest)
+}
+
+// decideRoleRequest reads the optional comment and applies decide to the
+// access request named in the URL.
+func decideRoleRequest(w http.ResponseWriter, r *http.Request, verb string,
+	decide func(*sharedpackage.Employee, string, string) (*sharedpackage.RoleRequest, error)) {
+	caller, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionDecideRoleRequests})
+	if !ok {
+		return
+	}
+	requestID := mux.Vars(r)["requestID"]
+
+	var body roleDecisionRequest
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		log.Printf("ERROR: Error decoding request body: %v", err)
+		return
+	}
+
+	request, err := decide(caller, requestID, body.Comment)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to %s access request: %v", verb, err), statusFor(err))
+		log.Printf("ERROR: Failed to %s access request %s: %v", verb, requestID, err)
+		return
+	}
+
+	writeRoleRequest(w, http.StatusOK, request)
+}
+
+// writeRoleRequest sends an access request as JSON.
+func writeRoleRequest(w http.ResponseWriter, status int, request *sharedpackage.RoleRequest) {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		http.Error(w, "Error encoding access request to JSON", http.StatusInternalServerError)
+		log.Printf("ERROR: Error encoding access request to JSON: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonData)
+}
@@ -0,0 +1,219 @@
+package handlerFunctions
+
+import (
+	"Task_04/authToken"
+	"Task_04/controllerFunctions"
+	"Task_04/sharedpackage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// accessTokenTTL is how long an access token is valid. Clients renew it
+// with their refresh token.
+const accessTokenTTL = 5 * time.Minute
+
+// refreshCookie is the cookie the refresh token is stored in. It is only
+// sent to the /auth endpoints.
+const refreshCookie = "refresh_token"
+
+// keys signs and verifies the access tokens.
+var keys *authToken.KeyRing
+
+// SetKeyRing injects the keys access tokens are signed with.
+func SetKeyRing(k *authToken.KeyRing) {
+	keys = k
+}
+
+// tokenResponse is returned by Login and RefreshHandler.
+type tokenResponse struct {
+	AccessToken      string    `json:"accessToken"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// refreshRequest is the optional body of the refresh and logout requests;
+// without it the refresh cookie is used.
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// issueTokens starts a session for employee and sends its tokens, both in
+// the body and as cookies.
+func issueTokens(w http.ResponseWriter, employee *sharedpackage.Employee) {
+	secret, refresh, err := controller.IssueRefreshToken(employee.ID)
+	if err != nil {
+		http.Error(w, "Failed to start session", statusFor(err))
+		return
+	}
+	sendTokens(w, employee, secret, refresh)
+}
+
+// sendTokens signs an access token for employee and sends it together with
+// the refresh token.
+func sendTokens(w http.ResponseWriter, employee *sharedpackage.Employee, secret string, refresh *sharedpackage.RefreshToken) {
+	now := time.Now()
+	expirationTime := now.Add(accessTokenTTL)
+	claims := &sharedpackage.Claims{
+		Username: employee.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   employee.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+		},
+	}
+	tokenString, err := keys.Sign(claims)
+	if err != nil {
+		log.Printf("ERROR: Failed to sign token: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Value:    tokenString,
+		Path:     "/",
+		Expires:  expirationTime,
+		HttpOnly: true,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookie,
+		Value:    secret,
+		Path:     "/auth",
+		Expires:  refresh.ExpiresAt,
+		HttpOnly: true,
+	})
+
+	response, err := json.Marshal(tokenResponse{
+		AccessToken:      tokenString,
+		ExpiresAt:        expirationTime.UTC(),
+		RefreshToken:     secret,
+		RefreshExpiresAt: refresh.ExpiresAt,
+	})
+	if err != nil {
+		http.Error(w, "Error encoding tokens to JSON", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// accountLocked answers 423 and tells the client when to try again.
+func accountLocked(w http.ResponseWriter, locked *controllerFunctions.LockedError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(locked.Until).Seconds())+1))
+	http.Error(w, "Account locked, try again later", http.StatusLocked)
+}
+
+// refreshSecret reads the refresh token from the request body or cookie.
+func refreshSecret(r *http.Request) (string, error) {
+	var request refreshRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			return "", fmt.Errorf("Error parsing request body: %v", err)
+		}
+	}
+	if request.RefreshToken != "" {
+		return request.RefreshToken, nil
+	}
+	cookie, err := r.Cookie(refreshCookie)
+	if err != nil || cookie.Value == "" {
+		return "", errors.New("Missing refresh token")
+	}
+	return cookie.Value, nil
+}
+
+// RefreshHandler exchanges a refresh token for a new access and refresh token.
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	secret, err := refreshSecret(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("WARN: RefreshHandler: %v", err)
+		return
+	}
+
+	employee, newSecret, refresh, err := controller.RotateRefreshToken(secret)
+	if err != nil {
+		var locked *controllerFunctions.LockedError
+		switch {
+		case errors.As(err, &locked):
+			accountLocked(w, locked)
+		case errors.Is(err, controllerFunctions.ErrInvalidRefreshToken):
+			unauthorized(w, err)
+		default:
+			http.Error(w, "Failed to refresh session", statusFor(err))
+		}
+		log.Printf("WARN: RefreshHandler: %v", err)
+		return
+	}
+
+	sendTokens(w, employee, newSecret, refresh)
+}
+
+// LogoutHandler ends the session of the presented refresh token and clears
+// the cookies.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	secret, err := refreshSecret(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("WARN: LogoutHandler: %v", err)
+		return
+	}
+
+	if err := controller.Logout(secret); err != nil {
+		http.Error(w, "Failed to log out", statusFor(err))
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: tokenCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+	http.SetCookie(w, &http.Cookie{Name: refreshCookie, Path: "/auth", MaxAge: -1, HttpOnly: true})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeSessionsHandler logs an employee out everywhere by revoking all of
+// their refresh tokens.
+func RevokeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	employeeID, ok := vars["empID"]
+	if !ok {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		log.Println("RevokeSessionsHandler WARN: Invalid URL")
+		return
+	}
+
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionRevokeSessions, EmployeeID: employeeID}); !ok {
+		return
+	}
+
+	if err := controller.RevokeSessions(employeeID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to revoke sessions: %v", err), statusFor(err))
+		log.Printf("RevokeSessionsHandler ERROR: Failed to revoke sessions: %v", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JWKSHandler publishes the public keys access tokens are signed with, so
+// other services can verify them.
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	jwksJSON, err := json.Marshal(keys.PublicKeys())
+	if err != nil {
+		http.Error(w, "Error encoding keys to JSON", http.StatusInternalServerError)
+		log.Printf("ERROR: Error encoding keys to JSON: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jwksJSON)
+}
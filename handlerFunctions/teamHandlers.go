@@ -39,10 +39,14 @@ func CreateTeamHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionCreateTeam, DepartmentID: team.DepartmentID}); !ok {
+		return
+	}
+
 	// Add the team and get the data
-	data, err := controllerFunctions.CreateTeam(team)
+	data, err := controller.CreateTeam(team)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to add team: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to add team: %v", err), statusFor(err))
 		log.Printf("ERROR: Failed to add team: %v", err)
 		return
 	}
@@ -71,9 +75,13 @@ func DeleteTeamHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("INFO: Request received to delete team with ID: %s", teamID)
 
-	data, err := controllerFunctions.DeleteTeam(teamID)
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionDeleteTeam, TeamIDs: []string{teamID}}); !ok {
+		return
+	}
+
+	data, err := controller.DeleteTeam(teamID)
 	if err != nil {
-		http.Error(w, "Failed to delete team", http.StatusInternalServerError)
+		http.Error(w, "Failed to delete team", statusFor(err))
 		log.Printf("ERROR: Failed to delete team with ID %s: %v", teamID, err)
 		return
 	}
@@ -121,10 +129,14 @@ func UpdateTeamHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionUpdateTeam, TeamIDs: []string{teamID}}); !ok {
+		return
+	}
+
 	// Add the department and get the data
-	data, err := controllerFunctions.UpdateTeam(teamID, updateTeam)
+	data, err := controller.UpdateTeam(teamID, updateTeam)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to update employee: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to update employee: %v", err), statusFor(err))
 		log.Printf("UpdateTeamHandler ERROR: Failed to update employee: %v", err)
 		return
 	}
@@ -145,13 +157,20 @@ func UpdateTeamHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func ListTeamHandler(w http.ResponseWriter, r *http.Request) {
+    caller, ok := authorize(w, r, controllerFunctions.AccessRequest{Action: controllerFunctions.ActionListTeams})
+    if !ok {
+        return
+    }
+
     // Retrieve all teams
-    teams, err := controllerFunctions.ListTeams()
+    teams, err := controller.ListTeams()
     if err != nil {
         log.Printf("ERROR: Failed to get teams: %v", err)
-        http.Error(w, "Failed to retrieve teams", http.StatusInternalServerError)
+        http.Error(w, "Failed to retrieve teams", statusFor(err))
         return
     }
+    visible := controller.VisibleTeams(caller, *teams)
+    teams = &visible
     log.Printf("INFO: Retrieved %d teams", len(*teams))
 
     // Convert teams to JSON format
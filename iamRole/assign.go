@@ -1,6 +1,7 @@
 package iamRole
 
 import (
+	"Task_04/sharedpackage"
 	"context"
 	"fmt"
 	"io"
@@ -15,116 +16,102 @@ import (
 //PREDIFINED ROLE PART WITH ROLE ASSIGNMENT
 
 // RemoveIAM removes the specified user from the IAM roles in the project.
-func RemoveIAM(proID string, userMail string) {
+func RemoveIAM(proID string, userMail string) error {
 	projectID := proID
-	member := "user:" + userMail
-
-	// Initializes the Cloud Resource Manager service
-	ctx := context.Background()
-	crmService, err := cloudresourcemanager.NewService(ctx)
-	if err != nil {
-		log.Fatalf("cloudresourcemanager.NewService: %v", err)
-	}
 
 	// Remove the specified member from IAM roles
-	removeMember(crmService, projectID, member)
-	log.Printf("INFO: Removed IAM roles for user %s in project %s", userMail, projectID)
+	if err := ApplyBindings(projectID, []sharedpackage.BindingDelta{RevokeAllDelta(userMail)}); err != nil {
+		log.Printf("ERROR: Failed to remove IAM roles for user %s on %s: %v", userMail, projectID, err)
+		return err
+	}
+	log.Printf("INFO: Removed IAM roles for user %s on %s", userMail, projectID)
+	return nil
 }
 
-// AssignIAM assigns the specified roles to the user in the project.
+// AssignIAM assigns the specified roles to the user in the project with a single policy write.
 func AssignIAM(proID string, roles []string, userMail string) error {
 	projectID := proID
-	member := "user:" + userMail
-
-	// Initializes the Cloud Resource Manager service
-	ctx := context.Background()
-	crmService, err := cloudresourcemanager.NewService(ctx)
-	if err != nil {
-		log.Fatalf("cloudresourcemanager.NewService: %v", err)
-		return fmt.Errorf("cloudresourcemanager.NewService: %v", err)
-	}
 
-	// Assign each specified role to the user
-	for _, role := range roles {
-		addBinding(crmService, projectID, member, role)
-		log.Printf("INFO: Assigned IAM role %s to user %s in project %s", role, userMail, projectID)
+	if err := ApplyBindings(projectID, GrantDeltas(userMail, roles)); err != nil {
+		log.Printf("ERROR: Failed to assign IAM roles %v to user %s on %s: %v", roles, userMail, projectID, err)
+		return err
 	}
+	log.Printf("INFO: Assigned IAM roles %v to user %s on %s", roles, userMail, projectID)
 	return nil
 }
 
-// addBinding adds the specified member to the project's IAM policy with the given role.
-func addBinding(crmService *cloudresourcemanager.Service, projectID, member, role string) {
-	policy := getPolicy(crmService, projectID)
-
-	// Find or create a binding for the specified role
-	binding := findOrCreateBinding(policy, role)
-	binding.Members = append(binding.Members, member)
-
-	setPolicy(crmService, projectID, policy)
-}
-
-// removeMember removes the specified user from all roles in the project's IAM policy.
-func removeMember(crmService *cloudresourcemanager.Service, projectID, member string) {
-	policy := getPolicy(crmService, projectID)
+// ProjectBindings returns the bindings of the project's live IAM policy.
+func ProjectBindings(projectID string) ([]sharedpackage.Binding, error) {
+	p, err := currentProvider()
+	if err != nil {
+		return nil, err
+	}
 
-	// Remove the specified member from all roles in the IAM policy
-	updatedBindings := removeMemberFromBindings(policy.Bindings, member)
-	policy.Bindings = updatedBindings
+	policy, err := getPolicy(p, projectID)
+	if err != nil {
+		return nil, err
+	}
 
-	setPolicy(crmService, projectID, policy)
+	bindings := make([]sharedpackage.Binding, 0, len(policy.Bindings))
+	for _, binding := range policy.Bindings {
+		bindings = append(bindings, sharedpackage.Binding{
+			Role:      binding.Role,
+			Members:   append([]string(nil), binding.Members...),
+			Condition: fromExpr(binding.Condition),
+		})
+	}
+	return bindings, nil
 }
 
-// getPolicy gets the IAM policy for the specified project.
-func getPolicy(crmService *cloudresourcemanager.Service, projectID string) *cloudresourcemanager.Policy {
+// getPolicy gets the IAM policy, including its etag, for the specified project.
+func getPolicy(p PolicyProvider, projectID string) (*cloudresourcemanager.Policy, error) {
 	ctx := context.Background()
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 
-	request := new(cloudresourcemanager.GetIamPolicyRequest)
-	policy, err := crmService.Projects.GetIamPolicy(projectID, request).Do()
+	policy, err := p.GetPolicy(ctx, projectID)
 	if err != nil {
-		log.Fatalf("Projects.GetIamPolicy: %v", err)
+		return nil, classify(err)
 	}
 
-	return policy
+	return policy, nil
 }
 
-// setPolicy sets the IAM policy for the specified project.
-func setPolicy(crmService *cloudresourcemanager.Service, projectID string, policy *cloudresourcemanager.Policy) {
+// setPolicy sets the IAM policy for the specified project. The write only
+// succeeds if policy.Etag still matches the stored policy.
+func setPolicy(p PolicyProvider, projectID string, policy *cloudresourcemanager.Policy) error {
 	ctx := context.Background()
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 
-	request := new(cloudresourcemanager.SetIamPolicyRequest)
-	request.Policy = policy
-
-	policy, err := crmService.Projects.SetIamPolicy(projectID, request).Do()
-	if err != nil {
-		log.Fatalf("Projects.SetIamPolicy: %v", err)
-	}
+	_, err := p.SetPolicy(ctx, projectID, policy)
+	return classify(err)
 }
 
-// findOrCreateBinding finds or creates a binding for the specified role in the policy.
-func findOrCreateBinding(policy *cloudresourcemanager.Policy, role string) *cloudresourcemanager.Binding {
+// findOrCreateBinding finds or creates the binding of role under condition
+// in the policy. A nil condition selects the unconditional binding.
+func findOrCreateBinding(policy *cloudresourcemanager.Policy, role string, condition *sharedpackage.Condition) *cloudresourcemanager.Binding {
 	for _, b := range policy.Bindings {
-		if b.Role == role {
+		if bindingMatches(b, role, condition) {
 			return b
 		}
 	}
 
 	// If the binding does not exist, create a new one
 	newBinding := &cloudresourcemanager.Binding{
-		Role:    role,
-		Members: []string{},
+		Role:      role,
+		Members:   []string{},
+		Condition: toExpr(condition),
 	}
 	policy.Bindings = append(policy.Bindings, newBinding)
 
 	return newBinding
 }
 
-// removeMemberFromBindings removes the specified member from all bindings.
+// removeMemberFromBindings removes the specified member from all bindings,
+// conditional or not.
 func removeMemberFromBindings(bindings []*cloudresourcemanager.Binding, member string) []*cloudresourcemanager.Binding {
 	var updatedBindings []*cloudresourcemanager.Binding
 
@@ -134,8 +121,9 @@ func removeMemberFromBindings(bindings []*cloudresourcemanager.Binding, member s
 		// If the binding still has members after removal, update the binding
 		if len(updatedMembers) > 0 {
 			updatedBinding := &cloudresourcemanager.Binding{
-				Role:    binding.Role,
-				Members: updatedMembers,
+				Role:      binding.Role,
+				Members:   updatedMembers,
+				Condition: binding.Condition,
 			}
 			updatedBindings = append(updatedBindings, updatedBinding)
 		}
@@ -159,32 +147,34 @@ func removeMemberFromSlice(slice []string, member string) []string {
 
 //CUSTOM ROLE PART
 
+// roleName returns the full resource name of a project's custom role.
+func roleName(projectID, name string) string {
+	return "projects/" + projectID + "/roles/" + name
+}
+
 // createRole creates a custom role.
 func CreateRole(w io.Writer, projectID, name, title, description, stage string, permissions []string) (*iam.Role, error) {
 	ctx := context.Background()
-	service, err := iam.NewService(ctx)
+	p, err := currentProvider()
 	if err != nil {
 		log.Printf("ERROR: Error creating IAM service: %v", err)
-		return nil, fmt.Errorf("iam.NewService: %w", err)
+		return nil, err
 	}
 
-	request := &iam.CreateRoleRequest{
-		Role: &iam.Role{
-			Title:               title,
-			Description:         description,
-			IncludedPermissions: permissions,
-			Stage:               stage,
-		},
-		RoleId: name,
+	request := &iam.Role{
+		Title:               title,
+		Description:         description,
+		IncludedPermissions: permissions,
+		Stage:               stage,
 	}
 
 	// Log request details
-	log.Printf("INFO: Creating custom role: %v", request)
+	log.Printf("INFO: Creating custom role %s: %v", name, request)
 
-	role, err := service.Projects.Roles.Create("projects/"+projectID, request).Do()
+	role, err := p.CreateRole(ctx, projectID, name, request)
 	if err != nil {
 		log.Printf("ERROR: Error creating custom role: %v", err)
-		return nil, fmt.Errorf("Projects.Roles.Create: %w", err)
+		return nil, classify(err)
 	}
 
 	// Log successful creation
@@ -199,14 +189,13 @@ func CreateRole(w io.Writer, projectID, name, title, description, stage string,
 // deleteRole deletes a custom role.
 func DeleteRole(w io.Writer, projectID, name string) error {
 	ctx := context.Background()
-	service, err := iam.NewService(ctx)
+	p, err := currentProvider()
 	if err != nil {
-		return fmt.Errorf("iam.NewService: %w", err)
+		return err
 	}
 
-	_, err = service.Projects.Roles.Delete("projects/" + projectID + "/roles/" + name).Do()
-	if err != nil {
-		return fmt.Errorf("Projects.Roles.Delete: %w", err)
+	if _, err := p.DeleteRole(ctx, roleName(projectID, name)); err != nil {
+		return classify(err)
 	}
 	fmt.Fprintf(w, "Deleted role: %v", name)
 	return nil
@@ -215,16 +204,14 @@ func DeleteRole(w io.Writer, projectID, name string) error {
 // UndeleteRole restores a deleted custom role.
 func UndeleteRole(w io.Writer, projectID, name string) error {
 	ctx := context.Background()
-	service, err := iam.NewService(ctx)
+	p, err := currentProvider()
 	if err != nil {
-		return fmt.Errorf("iam.NewService: %w", err)
+		return err
 	}
 
-	resource := "projects/" + projectID + "/roles/" + name
-	request := &iam.UndeleteRoleRequest{}
-	role, err := service.Projects.Roles.Undelete(resource, request).Do()
+	role, err := p.UndeleteRole(ctx, roleName(projectID, name))
 	if err != nil {
-		return fmt.Errorf("Projects.Roles.Undelete: %w", err)
+		return classify(err)
 	}
 
 	// Log the success message
@@ -235,20 +222,20 @@ func UndeleteRole(w io.Writer, projectID, name string) error {
 // listRoles lists a project's roles.
 func ListCustomRoles(w io.Writer, projectID string) ([]string, error) {
 	ctx := context.Background()
-	service, err := iam.NewService(ctx)
+	p, err := currentProvider()
 	if err != nil {
-		return nil, fmt.Errorf("iam.NewService: %w", err)
+		return nil, err
 	}
 
-	response, err := service.Projects.Roles.List("projects/" + projectID).Do()
+	roles, err := p.ListRoles(ctx, projectID)
 	if err != nil {
-		return nil, fmt.Errorf("Projects.Roles.List: %w", err)
+		return nil, classify(err)
 	}
 
 	var roleNames []string
 	num := 1
 	log.Printf("INFO: Listing Custom Roles: ")
-	for _, role := range response.Roles {
+	for _, role := range roles {
 		// Extract the last part of the role name
 		roleNameParts := strings.Split(role.Name, "/")
 		if len(roleNameParts) > 0 {
@@ -265,17 +252,17 @@ func ListCustomRoles(w io.Writer, projectID string) ([]string, error) {
 // UpdateCustomRole modifies a custom role.
 func UpdateCustomRole(w io.Writer, projectID, name, newTitle, newDescription, newStage string, newPermissions []string) (*iam.Role, error) {
 	ctx := context.Background()
-	service, err := iam.NewService(ctx)
+	p, err := currentProvider()
 	if err != nil {
-		return nil, fmt.Errorf("iam.NewService: %w", err)
+		return nil, err
 	}
 
-	resource := "projects/" + projectID + "/roles/" + name
+	resource := roleName(projectID, name)
 
 	// Retrieve the existing role
-	role, err := service.Projects.Roles.Get(resource).Do()
+	role, err := p.GetRole(ctx, resource)
 	if err != nil {
-		return nil, fmt.Errorf("Projects.Roles.Get: %w", err)
+		return nil, classify(err)
 	}
 
 	// Update role fields if new values are provided
@@ -296,13 +283,12 @@ func UpdateCustomRole(w io.Writer, projectID, name, newTitle, newDescription, ne
 	}
 
 	// Patch the role with updated information
-	role, err = service.Projects.Roles.Patch(resource, role).Do()
+	role, err = p.PatchRole(ctx, resource, role)
 	if err != nil {
-		return nil, fmt.Errorf("Projects.Roles.Patch: %w", err)
+		return nil, classify(err)
 	}
 
 	// Log and return the updated role
 	fmt.Fprintf(w, "Updated role: %v", role.Name)
 	return role, nil
 }
-
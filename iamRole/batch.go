@@ -0,0 +1,141 @@
+package iamRole
+
+import (
+	"Task_04/sharedpackage"
+	"fmt"
+	"log"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+// Member returns the IAM member string for a user's mail address.
+func Member(userMail string) string {
+	return "user:" + userMail
+}
+
+// GrantDeltas returns the deltas that add each of roles to the user.
+func GrantDeltas(userMail string, roles []string) []sharedpackage.BindingDelta {
+	deltas := make([]sharedpackage.BindingDelta, 0, len(roles))
+	for _, role := range roles {
+		deltas = append(deltas, sharedpackage.BindingDelta{Action: sharedpackage.BindingAdd, Role: role, Member: Member(userMail)})
+	}
+	return deltas
+}
+
+// RevokeDeltas returns the deltas that remove each of roles from the user.
+func RevokeDeltas(userMail string, roles []string) []sharedpackage.BindingDelta {
+	deltas := make([]sharedpackage.BindingDelta, 0, len(roles))
+	for _, role := range roles {
+		deltas = append(deltas, sharedpackage.BindingDelta{Action: sharedpackage.BindingRemove, Role: role, Member: Member(userMail)})
+	}
+	return deltas
+}
+
+// RevokeAllDelta returns the delta that removes the user from every role.
+func RevokeAllDelta(userMail string) sharedpackage.BindingDelta {
+	return sharedpackage.BindingDelta{Action: sharedpackage.BindingRemoveMember, Member: Member(userMail)}
+}
+
+// ApplyBindings applies deltas, in order, to the IAM policy of the project,
+// folder or organization named by projectID (see ValidateResource) in a
+// single etag-guarded read-modify-write. Deltas may mention any number of
+// members; the policy is only written if at least one of them changed it.
+func ApplyBindings(projectID string, deltas []sharedpackage.BindingDelta) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+	for _, delta := range deltas {
+		if err := validateDelta(delta); err != nil {
+			return err
+		}
+	}
+
+	p, err := currentProvider()
+	if err != nil {
+		return err
+	}
+
+	err = mutatePolicy(p, projectID, func(policy *cloudresourcemanager.Policy) bool {
+		changed := false
+		for _, delta := range deltas {
+			if applyDelta(policy, delta) {
+				changed = true
+			}
+		}
+		return changed
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to apply %d binding changes on %s: %v", len(deltas), projectID, err)
+		return err
+	}
+	log.Printf("INFO: Applied %d binding changes on %s", len(deltas), projectID)
+	return nil
+}
+
+// validateDelta rejects deltas that cannot be applied.
+func validateDelta(delta sharedpackage.BindingDelta) error {
+	if delta.Member == "" {
+		return fmt.Errorf("Binding delta %+v has no member", delta)
+	}
+	switch delta.Action {
+	case sharedpackage.BindingAdd, sharedpackage.BindingRemove:
+		if err := ValidateRole(delta.Role); err != nil {
+			return err
+		}
+	case sharedpackage.BindingRemoveMember:
+	default:
+		return fmt.Errorf("Unknown binding action %q", delta.Action)
+	}
+	return nil
+}
+
+// applyDelta applies one delta to policy and reports whether it changed anything.
+func applyDelta(policy *cloudresourcemanager.Policy, delta sharedpackage.BindingDelta) bool {
+	switch delta.Action {
+	case sharedpackage.BindingAdd:
+		binding := findOrCreateBinding(policy, delta.Role, delta.Condition)
+		for _, m := range binding.Members {
+			if m == delta.Member {
+				return false
+			}
+		}
+		binding.Members = append(binding.Members, delta.Member)
+		return true
+
+	case sharedpackage.BindingRemove:
+		for _, binding := range policy.Bindings {
+			if !bindingMatches(binding, delta.Role, delta.Condition) {
+				continue
+			}
+			updated := removeMemberFromSlice(binding.Members, delta.Member)
+			if len(updated) == len(binding.Members) {
+				return false
+			}
+			binding.Members = updated
+			policy.Bindings = dropEmptyBindings(policy.Bindings)
+			return true
+		}
+		return false
+
+	case sharedpackage.BindingRemoveMember:
+		updatedBindings := removeMemberFromBindings(policy.Bindings, delta.Member)
+		changed := len(updatedBindings) != len(policy.Bindings)
+		for i := 0; !changed && i < len(updatedBindings); i++ {
+			changed = len(updatedBindings[i].Members) != len(policy.Bindings[i].Members)
+		}
+		policy.Bindings = updatedBindings
+		return changed
+	}
+	return false
+}
+
+// dropEmptyBindings removes bindings left without members.
+func dropEmptyBindings(bindings []*cloudresourcemanager.Binding) []*cloudresourcemanager.Binding {
+	var kept []*cloudresourcemanager.Binding
+	for _, binding := range bindings {
+		if len(binding.Members) > 0 {
+			kept = append(kept, binding)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,217 @@
+package iamRole
+
+import (
+	"Task_04/sharedpackage"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+const testProject = "project-one"
+
+// useFakeProvider makes the package use a fresh in-memory FakeProvider for
+// the rest of the test.
+func useFakeProvider(t *testing.T) *FakeProvider {
+	t.Helper()
+	fake, err := NewFakeProvider("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetPolicyProvider(fake)
+	t.Cleanup(func() { SetPolicyProvider(nil) })
+	return fake
+}
+
+// fastRetries shortens the conflict backoff for the rest of the test.
+func fastRetries(t *testing.T) {
+	t.Helper()
+	initial, max := initialPolicyBackoff, maxPolicyBackoff
+	initialPolicyBackoff, maxPolicyBackoff = time.Millisecond, 2*time.Millisecond
+	t.Cleanup(func() { initialPolicyBackoff, maxPolicyBackoff = initial, max })
+}
+
+// conflictingProvider simulates another writer: before each of the first
+// conflicts policy writes it adds intruder to roles/owner behind the
+// caller's back, so the caller's etag is stale and the write fails with 409.
+type conflictingProvider struct {
+	*FakeProvider
+	conflicts int
+	intruder  string
+}
+
+func (p *conflictingProvider) SetPolicy(ctx context.Context, resource string, policy *cloudresourcemanager.Policy) (*cloudresourcemanager.Policy, error) {
+	if p.conflicts > 0 {
+		p.conflicts--
+		current, err := p.FakeProvider.GetPolicy(ctx, resource)
+		if err != nil {
+			return nil, err
+		}
+		current.Bindings = append(current.Bindings, &cloudresourcemanager.Binding{Role: "roles/owner", Members: []string{p.intruder}})
+		if _, err := p.FakeProvider.SetPolicy(ctx, resource, current); err != nil {
+			return nil, err
+		}
+	}
+	return p.FakeProvider.SetPolicy(ctx, resource, policy)
+}
+
+func TestApplyBindings(t *testing.T) {
+	fake := useFakeProvider(t)
+
+	// Step 1: Deltas for several members and roles are written at once
+	deltas := append(GrantDeltas("a@example.com", []string{"roles/viewer", "roles/editor"}), GrantDeltas("b@example.com", []string{"roles/viewer"})...)
+	if err := ApplyBindings(testProject, deltas); err != nil {
+		t.Fatalf("ApplyBindings() error = %v", err)
+	}
+	want := map[string][]string{
+		"roles/viewer": {"user:a@example.com", "user:b@example.com"},
+		"roles/editor": {"user:a@example.com"},
+	}
+	if got := fake.Bindings(testProject); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bindings = %v, want %v", got, want)
+	}
+	if calls := fake.SetPolicyCalls(); calls != 1 {
+		t.Fatalf("SetPolicy calls = %d, want 1", calls)
+	}
+
+	// Step 2: Deltas that change nothing do not write the policy
+	if err := ApplyBindings(testProject, GrantDeltas("a@example.com", []string{"roles/viewer"})); err != nil {
+		t.Fatalf("ApplyBindings() error = %v", err)
+	}
+	if calls := fake.SetPolicyCalls(); calls != 1 {
+		t.Fatalf("SetPolicy calls after a no-op = %d, want 1", calls)
+	}
+
+	// Step 3: Removing the last member drops the binding
+	if err := ApplyBindings(testProject, RevokeDeltas("a@example.com", []string{"roles/editor"})); err != nil {
+		t.Fatalf("ApplyBindings() error = %v", err)
+	}
+	want = map[string][]string{"roles/viewer": {"user:a@example.com", "user:b@example.com"}}
+	if got := fake.Bindings(testProject); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bindings after revoke = %v, want %v", got, want)
+	}
+
+	// Step 4: RevokeAllDelta removes the member from every role
+	if err := ApplyBindings(testProject, []sharedpackage.BindingDelta{RevokeAllDelta("b@example.com")}); err != nil {
+		t.Fatalf("ApplyBindings() error = %v", err)
+	}
+	want = map[string][]string{"roles/viewer": {"user:a@example.com"}}
+	if got := fake.Bindings(testProject); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bindings after revoke all = %v, want %v", got, want)
+	}
+}
+
+func TestApplyBindingsRejectsInvalidDeltas(t *testing.T) {
+	fake := useFakeProvider(t)
+
+	tests := []struct {
+		name  string
+		delta sharedpackage.BindingDelta
+	}{
+		{"no member", sharedpackage.BindingDelta{Action: sharedpackage.BindingAdd, Role: "roles/viewer"}},
+		{"malformed role", sharedpackage.BindingDelta{Action: sharedpackage.BindingAdd, Role: "viewer", Member: Member("a@example.com")}},
+		{"unknown action", sharedpackage.BindingDelta{Action: "replace", Role: "roles/viewer", Member: Member("a@example.com")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid := GrantDeltas("b@example.com", []string{"roles/viewer"})
+			if err := ApplyBindings(testProject, append(valid, tt.delta)); err == nil {
+				t.Fatal("ApplyBindings() succeeded, want an error")
+			}
+			if calls := fake.SetPolicyCalls(); calls != 0 {
+				t.Fatalf("SetPolicy calls = %d, want none for a rejected batch", calls)
+			}
+		})
+	}
+}
+
+func TestApplyBindingsRetriesEtagConflicts(t *testing.T) {
+	fastRetries(t)
+	fake := useFakeProvider(t)
+	SetPolicyProvider(&conflictingProvider{FakeProvider: fake, conflicts: 2, intruder: "user:intruder@example.com"})
+
+	if err := ApplyBindings(testProject, GrantDeltas("a@example.com", []string{"roles/viewer"})); err != nil {
+		t.Fatalf("ApplyBindings() error = %v", err)
+	}
+
+	// The concurrent writes are kept and ours is re-applied on top of them
+	want := map[string][]string{
+		"roles/owner":  {"user:intruder@example.com", "user:intruder@example.com"},
+		"roles/viewer": {"user:a@example.com"},
+	}
+	if got := fake.Bindings(testProject); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bindings = %v, want %v", got, want)
+	}
+	if calls := fake.SetPolicyCalls(); calls != 3 {
+		t.Fatalf("SetPolicy calls = %d, want 2 intruding writes and 1 of ours", calls)
+	}
+}
+
+func TestApplyBindingsGivesUpOnPersistentConflicts(t *testing.T) {
+	fastRetries(t)
+	fake := useFakeProvider(t)
+	SetPolicyProvider(&conflictingProvider{FakeProvider: fake, conflicts: maxPolicyAttempts, intruder: "user:intruder@example.com"})
+
+	err := ApplyBindings(testProject, GrantDeltas("a@example.com", []string{"roles/viewer"}))
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("ApplyBindings() error = %v, want ErrConflict", err)
+	}
+	if got := fake.Bindings(testProject)["roles/viewer"]; len(got) != 0 {
+		t.Fatalf("roles/viewer members = %v, want none after giving up", got)
+	}
+}
+
+func TestApplyBindingsKeepsConditionalBindings(t *testing.T) {
+	fake := useFakeProvider(t)
+	ctx := context.Background()
+
+	expiry := ExpiryCondition(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	conditional := &cloudresourcemanager.Policy{
+		Version: 3,
+		Bindings: []*cloudresourcemanager.Binding{
+			{Role: "roles/editor", Members: []string{Member("a@example.com")}, Condition: toExpr(expiry)},
+		},
+	}
+	if _, err := fake.SetPolicy(ctx, testProject, conditional); err != nil {
+		t.Fatal(err)
+	}
+
+	// Step 1: Unconditional grants and revokes of the same role leave the conditional binding alone
+	deltas := append(GrantDeltas("a@example.com", []string{"roles/editor"}), RevokeDeltas("a@example.com", []string{"roles/editor"})...)
+	deltas = append(deltas, GrantDeltas("b@example.com", []string{"roles/viewer"})...)
+	if err := ApplyBindings(testProject, deltas); err != nil {
+		t.Fatalf("ApplyBindings() error = %v", err)
+	}
+
+	policy, err := fake.GetPolicy(ctx, testProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Version != 3 {
+		t.Fatalf("policy version = %d, want 3 while it holds conditions", policy.Version)
+	}
+	bindings, err := ProjectBindings(testProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []sharedpackage.Binding{
+		{Role: "roles/editor", Members: []string{Member("a@example.com")}, Condition: expiry},
+		{Role: "roles/viewer", Members: []string{Member("b@example.com")}},
+	}
+	if !reflect.DeepEqual(bindings, want) {
+		t.Fatalf("bindings = %+v, want %+v", bindings, want)
+	}
+
+	// Step 2: Removing under the condition removes only the conditional binding
+	remove := sharedpackage.BindingDelta{Action: sharedpackage.BindingRemove, Role: "roles/editor", Member: Member("a@example.com"), Condition: expiry}
+	if err := ApplyBindings(testProject, []sharedpackage.BindingDelta{remove}); err != nil {
+		t.Fatalf("ApplyBindings() error = %v", err)
+	}
+	remaining := map[string][]string{"roles/viewer": {Member("b@example.com")}}
+	if got := fake.Bindings(testProject); !reflect.DeepEqual(got, remaining) {
+		t.Fatalf("bindings = %v, want %v", got, remaining)
+	}
+}
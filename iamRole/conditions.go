@@ -0,0 +1,164 @@
+package iamRole
+
+import (
+	"Task_04/sharedpackage"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+// conditionalPolicyVersion is the policy version required as soon as one
+// binding has a condition. Older versions cannot represent conditions, and
+// writing one would drop them.
+const conditionalPolicyVersion = 3
+
+// Limits IAM puts on the fields of a condition.
+const (
+	maxConditionTitle       = 100
+	maxConditionDescription = 256
+)
+
+// ExpiryCondition returns the condition of a binding that IAM stops
+// honouring at expiresAt.
+func ExpiryCondition(expiresAt time.Time) *sharedpackage.Condition {
+	stamp := expiresAt.UTC().Format(time.RFC3339)
+	return &sharedpackage.Condition{
+		Expression: expiryExpression(expiresAt),
+		Title:      "Expires " + stamp,
+	}
+}
+
+// expiryExpression is the CEL expression that holds until expiresAt.
+func expiryExpression(expiresAt time.Time) string {
+	return fmt.Sprintf(`request.time < timestamp("%s")`, expiresAt.UTC().Format(time.RFC3339))
+}
+
+// GrantCondition returns the condition a grant is bound under: condition,
+// ended at expiresAt if that is set. Without either it returns nil.
+func GrantCondition(condition *sharedpackage.Condition, expiresAt *time.Time) *sharedpackage.Condition {
+	switch {
+	case ConditionKey(condition) == "" && expiresAt == nil:
+		return nil
+	case ConditionKey(condition) == "":
+		return ExpiryCondition(*expiresAt)
+	case expiresAt == nil:
+		combined := *condition
+		return &combined
+	}
+
+	// The expiry goes into the description so the title stays the one given
+	description := "Expires " + expiresAt.UTC().Format(time.RFC3339) + "."
+	if condition.Description != "" {
+		description = condition.Description + " " + description
+	}
+	return &sharedpackage.Condition{
+		Expression:  "(" + condition.Expression + ") && " + expiryExpression(*expiresAt),
+		Title:       condition.Title,
+		Description: description,
+	}
+}
+
+// ValidateCondition rejects conditions IAM would refuse: a title and an
+// expression are required and the expression's brackets and string
+// literals must be closed. Whether the CEL compiles is left to the API.
+func ValidateCondition(condition *sharedpackage.Condition) error {
+	if condition == nil {
+		return nil
+	}
+	switch {
+	case strings.TrimSpace(condition.Title) == "":
+		return fmt.Errorf("%w: a title is required", ErrInvalidCondition)
+	case len(condition.Title) > maxConditionTitle:
+		return fmt.Errorf("%w: the title is longer than %d characters", ErrInvalidCondition, maxConditionTitle)
+	case len(condition.Description) > maxConditionDescription:
+		return fmt.Errorf("%w: the description is longer than %d characters", ErrInvalidCondition, maxConditionDescription)
+	case strings.TrimSpace(condition.Expression) == "":
+		return fmt.Errorf("%w: an expression is required", ErrInvalidCondition)
+	}
+
+	var open []rune
+	var quote rune
+	escaped := false
+	for _, r := range condition.Expression {
+		switch {
+		case quote != 0:
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == quote:
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(' || r == '[' || r == '{':
+			open = append(open, r)
+		case r == ')' || r == ']' || r == '}':
+			if len(open) == 0 || closing[open[len(open)-1]] != r {
+				return fmt.Errorf("%w: unbalanced %q in expression %q", ErrInvalidCondition, r, condition.Expression)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if quote != 0 {
+		return fmt.Errorf("%w: unterminated string in expression %q", ErrInvalidCondition, condition.Expression)
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("%w: unclosed %q in expression %q", ErrInvalidCondition, open[len(open)-1], condition.Expression)
+	}
+	return nil
+}
+
+var closing = map[rune]rune{'(': ')', '[': ']', '{': '}'}
+
+// ConditionKey identifies a condition for comparisons; nil and the empty
+// condition give "".
+func ConditionKey(condition *sharedpackage.Condition) string {
+	if condition == nil || *condition == (sharedpackage.Condition{}) {
+		return ""
+	}
+	return condition.Expression + "\x00" + condition.Title + "\x00" + condition.Description
+}
+
+// toExpr converts a condition to its API form.
+func toExpr(condition *sharedpackage.Condition) *cloudresourcemanager.Expr {
+	if ConditionKey(condition) == "" {
+		return nil
+	}
+	return &cloudresourcemanager.Expr{
+		Expression:  condition.Expression,
+		Title:       condition.Title,
+		Description: condition.Description,
+	}
+}
+
+// fromExpr converts an API condition.
+func fromExpr(expr *cloudresourcemanager.Expr) *sharedpackage.Condition {
+	if expr == nil {
+		return nil
+	}
+	return &sharedpackage.Condition{
+		Expression:  expr.Expression,
+		Title:       expr.Title,
+		Description: expr.Description,
+	}
+}
+
+// bindingMatches reports whether binding is the binding of role under condition.
+func bindingMatches(binding *cloudresourcemanager.Binding, role string, condition *sharedpackage.Condition) bool {
+	return binding.Role == role && ConditionKey(fromExpr(binding.Condition)) == ConditionKey(condition)
+}
+
+// upgradeVersion raises the policy to the version that can hold conditions
+// once any binding has one.
+func upgradeVersion(policy *cloudresourcemanager.Policy) {
+	for _, binding := range policy.Bindings {
+		if binding.Condition != nil && policy.Version < conditionalPolicyVersion {
+			policy.Version = conditionalPolicyVersion
+			return
+		}
+	}
+}
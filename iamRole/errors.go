@@ -0,0 +1,146 @@
+package iamRole
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error kinds returned by this package. Errors from the Resource Manager and
+// IAM APIs are wrapped so that errors.Is matches one of these sentinels while
+// the original API error stays reachable through errors.As.
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrConflict         = errors.New("conflict")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	ErrInvalidRole      = errors.New("invalid role")
+	ErrInvalidProject   = errors.New("invalid project")
+	ErrInvalidCondition = errors.New("invalid condition")
+)
+
+// classify wraps an API error with the matching error kind. Errors that fit
+// no kind are returned unchanged.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, kind := range []error{ErrNotFound, ErrPermissionDenied, ErrConflict, ErrQuotaExceeded, ErrInvalidRole, ErrInvalidProject, ErrInvalidCondition} {
+		if errors.Is(err, kind) {
+			return err
+		}
+	}
+
+	var kind error
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusNotFound:
+			kind = ErrNotFound
+		case http.StatusForbidden:
+			kind = ErrPermissionDenied
+		case http.StatusConflict, http.StatusPreconditionFailed:
+			kind = ErrConflict
+		case http.StatusTooManyRequests:
+			kind = ErrQuotaExceeded
+		case http.StatusBadRequest:
+			if mentionsCondition(apiErr.Message) {
+				kind = ErrInvalidCondition
+			} else if mentionsRole(apiErr.Message) {
+				kind = ErrInvalidRole
+			}
+		}
+	} else {
+		switch status.Code(err) {
+		case codes.NotFound:
+			kind = ErrNotFound
+		case codes.PermissionDenied:
+			kind = ErrPermissionDenied
+		case codes.Aborted, codes.AlreadyExists:
+			kind = ErrConflict
+		case codes.ResourceExhausted:
+			kind = ErrQuotaExceeded
+		case codes.InvalidArgument:
+			if message := status.Convert(err).Message(); mentionsCondition(message) {
+				kind = ErrInvalidCondition
+			} else if mentionsRole(message) {
+				kind = ErrInvalidRole
+			}
+		}
+	}
+
+	if kind == nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
+
+// mentionsRole reports whether a bad-request message is about a role, which
+// is how the APIs reject bindings to roles that do not exist.
+func mentionsRole(message string) bool {
+	return strings.Contains(strings.ToLower(message), "role")
+}
+
+// mentionsCondition reports whether a bad-request message is about an IAM
+// Condition, such as a CEL expression that does not compile.
+func mentionsCondition(message string) bool {
+	return strings.Contains(strings.ToLower(message), "condition")
+}
+
+// ValidateRole rejects role names that cannot appear in a binding: predefined
+// roles look like "roles/viewer" and custom roles like
+// "projects/my-project/roles/myRole" or "organizations/123/roles/myRole".
+func ValidateRole(role string) error {
+	if strings.HasPrefix(role, "roles/") && len(role) > len("roles/") {
+		return nil
+	}
+	parts := strings.Split(role, "/")
+	if len(parts) == 4 && (parts[0] == "projects" || parts[0] == "organizations") && parts[1] != "" && parts[2] == "roles" && parts[3] != "" {
+		return nil
+	}
+	return fmt.Errorf("%w: %q is not a predefined or custom role name", ErrInvalidRole, role)
+}
+
+// projectIDPattern is the format of a GCP project ID: 6 to 30 lower case
+// letters, digits or hyphens, starting with a letter and not ending with a
+// hyphen.
+var projectIDPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+
+// ValidateProjectID rejects strings that cannot be a GCP project ID.
+func ValidateProjectID(projectID string) error {
+	if projectIDPattern.MatchString(projectID) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q is not a valid project ID", ErrInvalidProject, projectID)
+}
+
+// Prefixes of the resource names of folders and the organization. Every other
+// assignment target is taken for a project ID.
+const (
+	FolderPrefix       = "folders/"
+	OrganizationPrefix = "organizations/"
+)
+
+// resourceNumberPattern is the numeric ID of a folder or organization.
+var resourceNumberPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// ValidateResource rejects assignment targets that are neither a project ID
+// nor the resource name of a folder ("folders/123") or the organization
+// ("organizations/123").
+func ValidateResource(resource string) error {
+	for _, prefix := range []string{FolderPrefix, OrganizationPrefix} {
+		if strings.HasPrefix(resource, prefix) {
+			if resourceNumberPattern.MatchString(strings.TrimPrefix(resource, prefix)) {
+				return nil
+			}
+			return fmt.Errorf("%w: %q is not a valid %s name", ErrInvalidProject, resource, strings.TrimSuffix(prefix, "s/"))
+		}
+	}
+	return ValidateProjectID(resource)
+}
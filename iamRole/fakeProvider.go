@@ -0,0 +1,261 @@
+package iamRole
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/googleapi"
+	iam "google.golang.org/api/iam/v1"
+)
+
+// FakeProvider is a local stand-in for Resource Manager and IAM. It keeps
+// policies and custom roles in memory and, when given a file path, mirrors
+// its state to that file as JSON so bindings survive restarts.
+type FakeProvider struct {
+	mu    sync.Mutex
+	path  string
+	state fakeState
+}
+
+// fakeState is the persisted part of a FakeProvider.
+type fakeState struct {
+	Policies      map[string]*cloudresourcemanager.Policy `json:"policies"`
+	Roles         map[string]*iam.Role                    `json:"roles"`
+	SetPolicyCall int                                     `json:"setPolicyCalls"`
+}
+
+var _ PolicyProvider = (*FakeProvider)(nil)
+
+// NewFakeProvider returns a FakeProvider. If path is non-empty, existing state
+// is loaded from it and every change is written back.
+func NewFakeProvider(path string) (*FakeProvider, error) {
+	f := &FakeProvider{
+		path: path,
+		state: fakeState{
+			Policies: make(map[string]*cloudresourcemanager.Policy),
+			Roles:    make(map[string]*iam.Role),
+		},
+	}
+	if path == "" {
+		return f, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read fake IAM state: %v", err)
+	}
+	if err := json.Unmarshal(data, &f.state); err != nil {
+		return nil, fmt.Errorf("Failed to parse fake IAM state %s: %v", path, err)
+	}
+	if f.state.Policies == nil {
+		f.state.Policies = make(map[string]*cloudresourcemanager.Policy)
+	}
+	if f.state.Roles == nil {
+		f.state.Roles = make(map[string]*iam.Role)
+	}
+	log.Printf("INFO: Loaded fake IAM state from %s", path)
+	return f, nil
+}
+
+// save writes the state to the backing file, if any. The caller holds f.mu.
+func (f *FakeProvider) save() error {
+	if f.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(f.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.path, data, 0o600)
+}
+
+// clone deep-copies an API object through its JSON form so callers never share state with the fake.
+func clone[T any](v *T) *T {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	out := new(T)
+	if err := json.Unmarshal(data, out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// apiError builds the error the real API would return for the given status.
+func apiError(code int, format string, args ...interface{}) error {
+	return &googleapi.Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// etagFor derives a policy etag from the number of writes the fake has seen.
+func etagFor(write int) string {
+	return base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(write)))
+}
+
+func (f *FakeProvider) GetPolicy(ctx context.Context, resource string) (*cloudresourcemanager.Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	policy, ok := f.state.Policies[resource]
+	if !ok {
+		return &cloudresourcemanager.Policy{Version: 1, Etag: etagFor(0)}, nil
+	}
+	return clone(policy), nil
+}
+
+// SetPolicy stores the policy. Like the real API it rejects a policy whose
+// etag does not match the stored one with 409 Conflict.
+func (f *FakeProvider) SetPolicy(ctx context.Context, resource string, policy *cloudresourcemanager.Policy) (*cloudresourcemanager.Policy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	current := etagFor(0)
+	if existing, ok := f.state.Policies[resource]; ok {
+		current = existing.Etag
+	}
+	if policy.Etag != "" && policy.Etag != current {
+		return nil, apiError(http.StatusConflict, "There were concurrent policy changes. Please retry the whole read-modify-write with exponential backoff.")
+	}
+	for _, b := range policy.Bindings {
+		if strings.HasPrefix(b.Role, "roles/") {
+			continue
+		}
+		if role, ok := f.state.Roles[b.Role]; !ok || role.Deleted {
+			return nil, apiError(http.StatusBadRequest, "Role (%s) does not exist in the resource's hierarchy.", b.Role)
+		}
+	}
+
+	stored := clone(policy)
+	stored.Etag = etagFor(f.state.SetPolicyCall + 1)
+	f.state.Policies[resource] = stored
+	f.state.SetPolicyCall++
+	if err := f.save(); err != nil {
+		return nil, err
+	}
+	return clone(stored), nil
+}
+
+func (f *FakeProvider) CreateRole(ctx context.Context, projectID, roleID string, role *iam.Role) (*iam.Role, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := "projects/" + projectID + "/roles/" + roleID
+	if _, exists := f.state.Roles[name]; exists {
+		return nil, apiError(http.StatusConflict, "Role %s already exists.", name)
+	}
+
+	stored := clone(role)
+	stored.Name = name
+	f.state.Roles[name] = stored
+	if err := f.save(); err != nil {
+		return nil, err
+	}
+	return clone(stored), nil
+}
+
+func (f *FakeProvider) GetRole(ctx context.Context, name string) (*iam.Role, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, ok := f.state.Roles[name]
+	if !ok {
+		return nil, apiError(http.StatusNotFound, "Role %s not found.", name)
+	}
+	return clone(role), nil
+}
+
+func (f *FakeProvider) PatchRole(ctx context.Context, name string, role *iam.Role) (*iam.Role, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.state.Roles[name]; !ok {
+		return nil, apiError(http.StatusNotFound, "Role %s not found.", name)
+	}
+
+	stored := clone(role)
+	stored.Name = name
+	f.state.Roles[name] = stored
+	if err := f.save(); err != nil {
+		return nil, err
+	}
+	return clone(stored), nil
+}
+
+func (f *FakeProvider) DeleteRole(ctx context.Context, name string) (*iam.Role, error) {
+	return f.setDeleted(name, true)
+}
+
+func (f *FakeProvider) UndeleteRole(ctx context.Context, name string) (*iam.Role, error) {
+	return f.setDeleted(name, false)
+}
+
+// setDeleted flips the soft-delete flag of a role the way the IAM API does.
+func (f *FakeProvider) setDeleted(name string, deleted bool) (*iam.Role, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	role, ok := f.state.Roles[name]
+	if !ok {
+		return nil, apiError(http.StatusNotFound, "Role %s not found.", name)
+	}
+	if role.Deleted == deleted {
+		return nil, apiError(http.StatusBadRequest, "Role %s is already in the requested state.", name)
+	}
+
+	role.Deleted = deleted
+	if err := f.save(); err != nil {
+		return nil, err
+	}
+	return clone(role), nil
+}
+
+func (f *FakeProvider) ListRoles(ctx context.Context, projectID string) ([]*iam.Role, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prefix := "projects/" + projectID + "/roles/"
+	var roles []*iam.Role
+	for name, role := range f.state.Roles {
+		if strings.HasPrefix(name, prefix) && !role.Deleted {
+			roles = append(roles, clone(role))
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+// Bindings returns the recorded members of every role in the project's policy.
+func (f *FakeProvider) Bindings(projectID string) map[string][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bindings := make(map[string][]string)
+	if policy, ok := f.state.Policies[projectID]; ok {
+		for _, b := range policy.Bindings {
+			members := append([]string(nil), b.Members...)
+			sort.Strings(members)
+			bindings[b.Role] = append(bindings[b.Role], members...)
+		}
+	}
+	return bindings
+}
+
+// SetPolicyCalls returns how many policy writes the fake has received.
+func (f *FakeProvider) SetPolicyCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state.SetPolicyCall
+}
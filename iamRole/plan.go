@@ -0,0 +1,86 @@
+package iamRole
+
+import (
+	"Task_04/sharedpackage"
+	"sort"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+)
+
+// BindingChange is one member gaining or losing one role in a project.
+type BindingChange struct {
+	ProjectID string `json:"projectID"`
+	Action    string `json:"action"` // sharedpackage.BindingAdd or sharedpackage.BindingRemove
+	Role      string `json:"role"`
+	Member    string `json:"member"`
+	// Condition is the condition of the binding, nil if it has none.
+	Condition *sharedpackage.Condition `json:"condition,omitempty"`
+}
+
+// PlanBindings reports how applying deltas would change the project's live
+// policy without writing it. The pending deltas, such as operations still
+// waiting in the outbox, are applied first so that only the effect of deltas
+// is reported.
+func PlanBindings(projectID string, pending []sharedpackage.BindingDelta, deltas []sharedpackage.BindingDelta) ([]BindingChange, error) {
+	for _, delta := range deltas {
+		if err := validateDelta(delta); err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := currentProvider()
+	if err != nil {
+		return nil, err
+	}
+	policy, err := getPolicy(p, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, delta := range pending {
+		applyDelta(policy, delta)
+	}
+	before := policyMembers(policy)
+	for _, delta := range deltas {
+		applyDelta(policy, delta)
+	}
+	after := policyMembers(policy)
+
+	var changes []BindingChange
+	for key, held := range after {
+		if _, ok := before[key]; !ok {
+			changes = append(changes, BindingChange{ProjectID: projectID, Action: sharedpackage.BindingAdd, Role: held.Role, Member: held.Member, Condition: held.Condition})
+		}
+	}
+	for key, held := range before {
+		if _, ok := after[key]; !ok {
+			changes = append(changes, BindingChange{ProjectID: projectID, Action: sharedpackage.BindingRemove, Role: held.Role, Member: held.Member, Condition: held.Condition})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Role != changes[j].Role {
+			return changes[i].Role < changes[j].Role
+		}
+		if changes[i].Member != changes[j].Member {
+			return changes[i].Member < changes[j].Member
+		}
+		if ConditionKey(changes[i].Condition) != ConditionKey(changes[j].Condition) {
+			return ConditionKey(changes[i].Condition) < ConditionKey(changes[j].Condition)
+		}
+		return changes[i].Action < changes[j].Action
+	})
+	return changes, nil
+}
+
+// policyMembers flattens a policy into its (role, member, condition)
+// triples, keyed for comparison.
+func policyMembers(policy *cloudresourcemanager.Policy) map[[3]string]BindingChange {
+	members := make(map[[3]string]BindingChange)
+	for _, binding := range policy.Bindings {
+		condition := fromExpr(binding.Condition)
+		for _, member := range binding.Members {
+			members[[3]string{binding.Role, member, ConditionKey(condition)}] = BindingChange{Role: binding.Role, Member: member, Condition: condition}
+		}
+	}
+	return members
+}
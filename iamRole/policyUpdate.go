@@ -0,0 +1,76 @@
+package iamRole
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Retry settings for policy writes that lose an etag race.
+var (
+	maxPolicyAttempts    = 5
+	initialPolicyBackoff = 200 * time.Millisecond
+	maxPolicyBackoff     = 5 * time.Second
+)
+
+// isConflict reports whether err means the policy changed since it was read:
+// HTTP 409 from the REST API or ABORTED from gRPC.
+func isConflict(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusConflict
+	}
+	return status.Code(err) == codes.Aborted
+}
+
+// mutatePolicy performs an etag-guarded read-modify-write of the project's
+// policy. mutate edits the freshly read policy and reports whether anything
+// changed; the policy is written back carrying the etag it was read with, so
+// a concurrent writer makes the write fail instead of being overwritten. On
+// such a conflict the policy is re-read and mutate re-applied, backing off
+// exponentially up to maxPolicyAttempts. A policy holding conditions is
+// written as version 3.
+func mutatePolicy(p PolicyProvider, projectID string, mutate func(policy *cloudresourcemanager.Policy) bool) error {
+	backoff := initialPolicyBackoff
+
+	for attempt := 1; ; attempt++ {
+		policy, err := getPolicy(p, projectID)
+		if err != nil {
+			return err
+		}
+
+		if !mutate(policy) {
+			return nil
+		}
+		upgradeVersion(policy)
+
+		err = setPolicy(p, projectID, policy)
+		if err == nil {
+			return nil
+		}
+		if !isConflict(err) {
+			return err
+		}
+		if attempt == maxPolicyAttempts {
+			return fmt.Errorf("IAM policy of %s kept changing concurrently; gave up after %d attempts: %w", projectID, attempt, err)
+		}
+
+		// Sleep for the backoff plus up to 50% jitter so racing writers spread out
+		sleep := backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+		log.Printf("WARN: IAM policy of %s changed during update (attempt %d/%d); retrying in %v", projectID, attempt, maxPolicyAttempts, sleep)
+		time.Sleep(sleep)
+
+		backoff *= 2
+		if backoff > maxPolicyBackoff {
+			backoff = maxPolicyBackoff
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package iamRole
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	crmv2 "google.golang.org/api/cloudresourcemanager/v2"
+	iam "google.golang.org/api/iam/v1"
+)
+
+// PolicyProvider is the subset of the Resource Manager and IAM APIs this
+// package relies on. Role names are full resource names such as
+// "projects/my-project/roles/myRole". Policies belong to a resource: a
+// project, named by its ID, a folder ("folders/123") or the organization
+// ("organizations/123").
+type PolicyProvider interface {
+	// GetPolicy returns the IAM policy of the resource.
+	GetPolicy(ctx context.Context, resource string) (*cloudresourcemanager.Policy, error)
+	// SetPolicy replaces the IAM policy of the resource and returns the stored policy.
+	SetPolicy(ctx context.Context, resource string, policy *cloudresourcemanager.Policy) (*cloudresourcemanager.Policy, error)
+
+	// CreateRole creates the custom role roleID in the project.
+	CreateRole(ctx context.Context, projectID, roleID string, role *iam.Role) (*iam.Role, error)
+	// GetRole returns the named custom role.
+	GetRole(ctx context.Context, name string) (*iam.Role, error)
+	// PatchRole overwrites the named custom role.
+	PatchRole(ctx context.Context, name string, role *iam.Role) (*iam.Role, error)
+	// DeleteRole soft-deletes the named custom role.
+	DeleteRole(ctx context.Context, name string) (*iam.Role, error)
+	// UndeleteRole restores a soft-deleted custom role.
+	UndeleteRole(ctx context.Context, name string) (*iam.Role, error)
+	// ListRoles returns the custom roles of the project.
+	ListRoles(ctx context.Context, projectID string) ([]*iam.Role, error)
+}
+
+var (
+	providerMu sync.Mutex
+	provider   PolicyProvider
+)
+
+// SetPolicyProvider replaces the provider used by every function in the package.
+func SetPolicyProvider(p PolicyProvider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	provider = p
+}
+
+// InitializeProvider selects the provider by name: "google" for the real
+// APIs or "fake" for a FakeProvider persisting to statePath (if set).
+func InitializeProvider(backend string, statePath string) error {
+	switch backend {
+	case "", "google":
+		p, err := NewGoogleProvider(context.Background())
+		if err != nil {
+			return err
+		}
+		SetPolicyProvider(p)
+	case "fake":
+		p, err := NewFakeProvider(statePath)
+		if err != nil {
+			return err
+		}
+		log.Println("INFO: Using fake IAM provider; no changes reach Google Cloud.")
+		SetPolicyProvider(p)
+	default:
+		return fmt.Errorf("unknown IAM backend %q", backend)
+	}
+	return nil
+}
+
+// currentProvider returns the configured provider, connecting to Google on first use.
+func currentProvider() (PolicyProvider, error) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+
+	if provider == nil {
+		p, err := NewGoogleProvider(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		provider = p
+	}
+	return provider, nil
+}
+
+// GoogleProvider implements PolicyProvider with the Cloud Resource Manager and IAM APIs.
+type GoogleProvider struct {
+	crmService    *cloudresourcemanager.Service
+	folderService *crmv2.Service
+	iamService    *iam.Service
+}
+
+var _ PolicyProvider = (*GoogleProvider)(nil)
+
+// NewGoogleProvider creates the API clients once using application default credentials.
+func NewGoogleProvider(ctx context.Context) (*GoogleProvider, error) {
+	crmService, err := cloudresourcemanager.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cloudresourcemanager.NewService: %w", err)
+	}
+
+	// Folders are only served by v2 and later of the Resource Manager API.
+	folderService, err := crmv2.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cloudresourcemanager/v2.NewService: %w", err)
+	}
+
+	iamService, err := iam.NewService(ctx)
+	if err != nil {
+		log.Printf("ERROR: Error creating IAM service: %v", err)
+		return nil, fmt.Errorf("iam.NewService: %w", err)
+	}
+
+	return &GoogleProvider{crmService: crmService, folderService: folderService, iamService: iamService}, nil
+}
+
+// GetPolicy reads the policy with the getIamPolicy call of the resource's kind.
+func (g *GoogleProvider) GetPolicy(ctx context.Context, resource string) (*cloudresourcemanager.Policy, error) {
+	switch {
+	case strings.HasPrefix(resource, FolderPrefix):
+		policy, err := g.folderService.Folders.GetIamPolicy(resource, &crmv2.GetIamPolicyRequest{
+			Options: &crmv2.GetPolicyOptions{RequestedPolicyVersion: conditionalPolicyVersion},
+		}).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("Folders.GetIamPolicy: %w", err)
+		}
+		return convertPolicy[cloudresourcemanager.Policy](policy)
+	case strings.HasPrefix(resource, OrganizationPrefix):
+		policy, err := g.crmService.Organizations.GetIamPolicy(resource, policyRequest()).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("Organizations.GetIamPolicy: %w", err)
+		}
+		return policy, nil
+	}
+
+	policy, err := g.crmService.Projects.GetIamPolicy(resource, policyRequest()).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Projects.GetIamPolicy: %w", err)
+	}
+	return policy, nil
+}
+
+// policyRequest asks for policy version 3, so conditional bindings are
+// returned with their conditions instead of being flattened.
+func policyRequest() *cloudresourcemanager.GetIamPolicyRequest {
+	return &cloudresourcemanager.GetIamPolicyRequest{
+		Options: &cloudresourcemanager.GetPolicyOptions{RequestedPolicyVersion: conditionalPolicyVersion},
+	}
+}
+
+// SetPolicy writes the policy with the setIamPolicy call of the resource's kind.
+func (g *GoogleProvider) SetPolicy(ctx context.Context, resource string, policy *cloudresourcemanager.Policy) (*cloudresourcemanager.Policy, error) {
+	switch {
+	case strings.HasPrefix(resource, FolderPrefix):
+		folderPolicy, err := convertPolicy[crmv2.Policy](policy)
+		if err != nil {
+			return nil, err
+		}
+		stored, err := g.folderService.Folders.SetIamPolicy(resource, &crmv2.SetIamPolicyRequest{Policy: folderPolicy}).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("Folders.SetIamPolicy: %w", err)
+		}
+		return convertPolicy[cloudresourcemanager.Policy](stored)
+	case strings.HasPrefix(resource, OrganizationPrefix):
+		stored, err := g.crmService.Organizations.SetIamPolicy(resource, &cloudresourcemanager.SetIamPolicyRequest{Policy: policy}).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("Organizations.SetIamPolicy: %w", err)
+		}
+		return stored, nil
+	}
+
+	request := new(cloudresourcemanager.SetIamPolicyRequest)
+	request.Policy = policy
+
+	policy, err := g.crmService.Projects.SetIamPolicy(resource, request).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Projects.SetIamPolicy: %w", err)
+	}
+	return policy, nil
+}
+
+// convertPolicy copies a policy between the API versions, whose Policy types
+// share the same JSON representation.
+func convertPolicy[T any](policy interface{}) (*T, error) {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to convert IAM policy: %w", err)
+	}
+	converted := new(T)
+	if err := json.Unmarshal(data, converted); err != nil {
+		return nil, fmt.Errorf("Failed to convert IAM policy: %w", err)
+	}
+	return converted, nil
+}
+
+func (g *GoogleProvider) CreateRole(ctx context.Context, projectID, roleID string, role *iam.Role) (*iam.Role, error) {
+	request := &iam.CreateRoleRequest{Role: role, RoleId: roleID}
+	role, err := g.iamService.Projects.Roles.Create("projects/"+projectID, request).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Projects.Roles.Create: %w", err)
+	}
+	return role, nil
+}
+
+func (g *GoogleProvider) GetRole(ctx context.Context, name string) (*iam.Role, error) {
+	role, err := g.iamService.Projects.Roles.Get(name).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Projects.Roles.Get: %w", err)
+	}
+	return role, nil
+}
+
+func (g *GoogleProvider) PatchRole(ctx context.Context, name string, role *iam.Role) (*iam.Role, error) {
+	role, err := g.iamService.Projects.Roles.Patch(name, role).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Projects.Roles.Patch: %w", err)
+	}
+	return role, nil
+}
+
+func (g *GoogleProvider) DeleteRole(ctx context.Context, name string) (*iam.Role, error) {
+	role, err := g.iamService.Projects.Roles.Delete(name).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Projects.Roles.Delete: %w", err)
+	}
+	return role, nil
+}
+
+func (g *GoogleProvider) UndeleteRole(ctx context.Context, name string) (*iam.Role, error) {
+	role, err := g.iamService.Projects.Roles.Undelete(name, &iam.UndeleteRoleRequest{}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Projects.Roles.Undelete: %w", err)
+	}
+	return role, nil
+}
+
+func (g *GoogleProvider) ListRoles(ctx context.Context, projectID string) ([]*iam.Role, error) {
+	var roles []*iam.Role
+	err := g.iamService.Projects.Roles.List("projects/"+projectID).Pages(ctx, func(response *iam.ListRolesResponse) error {
+		roles = append(roles, response.Roles...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Projects.Roles.List: %w", err)
+	}
+	return roles, nil
+}
@@ -1,49 +1,162 @@
 package main
 
 import (
+	"Task_04/authToken"
+	"Task_04/config"
 	"Task_04/controllerFunctions"
 	"Task_04/handlerFunctions"
+	"Task_04/iamRole"
+	"Task_04/notifier"
+	"context"
+	"flag"
+	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
-	controllerFunctions.InitializeFirestore()
+	configPath := flag.String("config", os.Getenv("EMS_CONFIG"), "YAML config file; EMS_* environment variables override it")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	log.Printf("INFO: Serving project %s with the %s store", cfg.ProjectID, cfg.Storage.Backend)
+
+	controllerFunctions.MaxFailedLogins = cfg.Auth.Lockout.MaxFailedLogins
+	controllerFunctions.LockoutBase = cfg.Auth.Lockout.Base
+	controllerFunctions.LockoutMax = cfg.Auth.Lockout.Max
+	controllerFunctions.PasswordPolicy = controllerFunctions.PasswordRules{
+		MinLength:  cfg.Auth.PasswordPolicy.MinLength,
+		MaxLength:  cfg.Auth.PasswordPolicy.MaxLength,
+		MinClasses: cfg.Auth.PasswordPolicy.MinClasses,
+	}
+	controllerFunctions.BreakGlassPolicy = controllerFunctions.BreakGlassRules{
+		Roles:       cfg.BreakGlass.Roles,
+		OnCallTeam:  cfg.BreakGlass.OnCallTeam,
+		MaxDuration: cfg.BreakGlass.MaxDuration,
+	}
+
+	if err := iamRole.InitializeProvider(cfg.IAM.Backend, cfg.IAM.StatePath); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+
+	controller, err := controllerFunctions.InitializeStore(cfg)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	controller.Notifier, err = notifier.New(cfg.Notifier.Backend, cfg.Notifier.File, notifier.SMTPConfig{
+		Addr:     cfg.Notifier.SMTP.Addr,
+		From:     cfg.Notifier.SMTP.From,
+		Username: cfg.Notifier.SMTP.Username,
+		Password: cfg.Notifier.SMTP.Password,
+	})
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	handlerFunctions.SetController(controller)
+
+	keys, err := authToken.LoadKeyRing(cfg.Auth.JWTKeys)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	handlerFunctions.SetKeyRing(keys)
+
+	// Rotate the signing keys by editing the key file and sending SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := keys.Reload(); err != nil {
+				log.Printf("ERROR: Keeping the current JWT keys: %v", err)
+			}
+		}
+	}()
+
+	// Apply the IAM changes recorded in the outbox in the background
+	go controller.Outbox.Run(context.Background())
+
+	// Remove time-bound IAM grants once they expired and close overdue access reviews
+	go controller.RunExpirySweeper(context.Background(), cfg.IAM.SweepInterval)
+
 	r := mux.NewRouter()
-	r.HandleFunc("/assignRole/{id}", handlerFunctions.AssignIAMRoleHandler).Methods("POST")
-	r.HandleFunc("/deleteMember/{id}", handlerFunctions.RemoveMemberHandler).Methods("DELETE")
-	r.HandleFunc("/createCustomRole", handlerFunctions.CreateCustomRoleHandler).Methods("POST")
-	r.HandleFunc("/deleteCustomRole", handlerFunctions.DeleteCustomRoleHandler).Methods("DELETE")
-	r.HandleFunc("/undeleteCustomRole", handlerFunctions.UndeleteCustomRoleHandler).Methods("PUT")
-	r.HandleFunc("/listCustomRoles/{projectID}", handlerFunctions.ListCustomRolesHandler).Methods("GET")
-	r.HandleFunc("/updateCustomRole", handlerFunctions.UpdateCustomRolesHandler).Methods("PATCH")
-	r.HandleFunc("/iamRoles/{empID}/removeRoles", handlerFunctions.RemoveIAMRolesHandler).Methods("PATCH")
+	r.HandleFunc("/auth/login", handlerFunctions.Login).Methods("POST")
+	r.HandleFunc("/auth/refresh", handlerFunctions.RefreshHandler).Methods("POST")
+	r.HandleFunc("/auth/logout", handlerFunctions.LogoutHandler).Methods("POST")
+	r.HandleFunc("/auth/password", handlerFunctions.SetPasswordHandler).Methods("POST")
+	r.HandleFunc("/auth/password/forgot", handlerFunctions.ForgotPasswordHandler).Methods("POST")
+	r.HandleFunc("/.well-known/jwks.json", handlerFunctions.JWKSHandler).Methods("GET")
+
+	// Every management endpoint requires a valid token
+	api := r.PathPrefix("/").Subrouter()
+	api.Use(handlerFunctions.AuthMiddleware)
+	api.HandleFunc("/auth/mfa/enroll", handlerFunctions.EnrollMFAHandler).Methods("POST")
+	api.HandleFunc("/auth/mfa/confirm", handlerFunctions.ConfirmMFAHandler).Methods("POST")
+	api.HandleFunc("/assignRole/{id}", handlerFunctions.AssignIAMRoleHandler).Methods("POST")
+	api.HandleFunc("/deleteMember/{id}", handlerFunctions.RemoveMemberHandler).Methods("DELETE")
+	api.HandleFunc("/createCustomRole", handlerFunctions.CreateCustomRoleHandler).Methods("POST")
+	api.HandleFunc("/deleteCustomRole", handlerFunctions.DeleteCustomRoleHandler).Methods("DELETE")
+	api.HandleFunc("/undeleteCustomRole", handlerFunctions.UndeleteCustomRoleHandler).Methods("PUT")
+	api.HandleFunc("/listCustomRoles/{projectID}", handlerFunctions.ListCustomRolesHandler).Methods("GET")
+	api.HandleFunc("/updateCustomRole", handlerFunctions.UpdateCustomRolesHandler).Methods("PATCH")
+	api.HandleFunc("/iamRoles/{empID}/removeRoles", handlerFunctions.RemoveIAMRolesHandler).Methods("PATCH")
+	api.HandleFunc("/iam/drift", handlerFunctions.IAMDriftHandler).Methods("GET")
+	api.HandleFunc("/iam/reconcile", handlerFunctions.ReconcileIAMHandler).Methods("POST")
+	api.HandleFunc("/iam/sweepExpired", handlerFunctions.SweepExpiredGrantsHandler).Methods("POST")
+
+	//Access Requests
+	api.HandleFunc("/accessRequests", handlerFunctions.RequestRolesHandler).Methods("POST")
+	api.HandleFunc("/accessRequests", handlerFunctions.ListRoleRequestsHandler).Methods("GET")
+	api.HandleFunc("/accessRequests/{requestID}", handlerFunctions.GetRoleRequestHandler).Methods("GET")
+	api.HandleFunc("/accessRequests/{requestID}/approve", handlerFunctions.ApproveRoleRequestHandler).Methods("POST")
+	api.HandleFunc("/accessRequests/{requestID}/deny", handlerFunctions.DenyRoleRequestHandler).Methods("POST")
+
+	//Break Glass
+	api.HandleFunc("/breakGlass", handlerFunctions.BreakGlassHandler).Methods("POST")
+	api.HandleFunc("/breakGlass", handlerFunctions.ListBreakGlassGrantsHandler).Methods("GET")
+	api.HandleFunc("/breakGlass/{grantID}", handlerFunctions.GetBreakGlassGrantHandler).Methods("GET")
+	api.HandleFunc("/breakGlass/{grantID}/closeReview", handlerFunctions.CloseBreakGlassReviewHandler).Methods("POST")
+
+	//Access Reviews
+	api.HandleFunc("/reviewCampaigns", handlerFunctions.LaunchReviewCampaignHandler).Methods("POST")
+	api.HandleFunc("/reviewCampaigns", handlerFunctions.ListReviewCampaignsHandler).Methods("GET")
+	api.HandleFunc("/reviewCampaigns/{campaignID}", handlerFunctions.GetReviewCampaignHandler).Methods("GET")
+	api.HandleFunc("/reviewCampaigns/{campaignID}/items/{itemID}", handlerFunctions.ReviewItemHandler).Methods("POST")
 
 	//Department Level
-	r.HandleFunc("/departments/create", handlerFunctions.CreateDepartmentHandler).Methods("POST")
-	r.HandleFunc("/departments/{dept_id}/delete", handlerFunctions.DeleteDepartmentHandler).Methods("DELETE")
-	r.HandleFunc("/departments/{dept_id}/update", handlerFunctions.UpadateDepartmentHandler).Methods("PATCH")
-	r.HandleFunc("/departments",handlerFunctions.ListDepartmentsHandler).Methods("GET")
+	api.HandleFunc("/departments/create", handlerFunctions.CreateDepartmentHandler).Methods("POST")
+	api.HandleFunc("/departments/{dept_id}/delete", handlerFunctions.DeleteDepartmentHandler).Methods("DELETE")
+	api.HandleFunc("/departments/{dept_id}/update", handlerFunctions.UpadateDepartmentHandler).Methods("PATCH")
+	api.HandleFunc("/departments",handlerFunctions.ListDepartmentsHandler).Methods("GET")
 
 	//Employee Level
-	r.HandleFunc("/employees/create", handlerFunctions.CreateEmployeeHandler).Methods("POST")
-	r.HandleFunc("/employees/{empID}/add",handlerFunctions.DeleteEmployeeHandler).Methods("POST")
-	r.HandleFunc("/employees/{empID}/delete",handlerFunctions.DeleteEmployeeHandler).Methods("DELETE")
-	r.HandleFunc("/employees/{empID}/update",handlerFunctions.UpdateEmployeeHandler).Methods("PATCH")
-	r.HandleFunc("/employees",handlerFunctions.ListEmployeeHandler).Methods("GET")
+	api.HandleFunc("/employees/create", handlerFunctions.CreateEmployeeHandler).Methods("POST")
+	api.HandleFunc("/employees/{empID}/delete",handlerFunctions.DeleteEmployeeHandler).Methods("DELETE")
+	api.HandleFunc("/employees/{empID}/update",handlerFunctions.UpdateEmployeeHandler).Methods("PATCH")
+	api.HandleFunc("/employees/{empID}/unlock",handlerFunctions.UnlockEmployeeHandler).Methods("POST")
+	api.HandleFunc("/employees/{empID}/revokeSessions",handlerFunctions.RevokeSessionsHandler).Methods("POST")
+	api.HandleFunc("/employees/{empID}/resetMFA",handlerFunctions.ResetMFAHandler).Methods("POST")
+	api.HandleFunc("/employees/{empID}/invite",handlerFunctions.InviteEmployeeHandler).Methods("POST")
+	api.HandleFunc("/employees/{empID}/iamBindings",handlerFunctions.EmployeeBindingsHandler).Methods("GET")
+	api.HandleFunc("/employees",handlerFunctions.ListEmployeeHandler).Methods("GET")
 
 	//Team Level
-	r.HandleFunc("/teams/create",handlerFunctions.CreateTeamHandler).Methods("POST")
-	r.HandleFunc("/teams/{teamID}/delete",handlerFunctions.DeleteTeamHandler).Methods("DELETE")
-	r.HandleFunc("/teams/{teamID}/update",handlerFunctions.UpdateTeamHandler).Methods("PATCH")
-	r.HandleFunc("/teams",handlerFunctions.ListTeamHandler).Methods("GET")
+	api.HandleFunc("/teams/create",handlerFunctions.CreateTeamHandler).Methods("POST")
+	api.HandleFunc("/teams/{teamID}/delete",handlerFunctions.DeleteTeamHandler).Methods("DELETE")
+	api.HandleFunc("/teams/{teamID}/update",handlerFunctions.UpdateTeamHandler).Methods("PATCH")
+	api.HandleFunc("/teams",handlerFunctions.ListTeamHandler).Methods("GET")
 
 	// Start the HTTP server using the Gorilla Mux router
 	http.Handle("/", r)
 
-	// Start the server on port 8080
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	// Start the server on the configured port
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), nil); err != nil {
 		panic(err)
 	}
 }
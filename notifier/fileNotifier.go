@@ -0,0 +1,44 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileNotifier appends every message to a file instead of sending it, as a
+// stand-in for mail during development. The file holds live password tokens,
+// so it is only readable by its owner.
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+var _ Notifier = (*FileNotifier)(nil)
+
+// NewFileNotifier returns a notifier appending to path.
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Send(ctx context.Context, msg Message) error {
+	data, err := formatMessage("ems@localhost", msg)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to open notification file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, "\r\n"...)); err != nil {
+		return fmt.Errorf("Failed to write notification: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Message is a plain text notification to one employee.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages to employees.
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPConfig is where the SMTP notifier delivers mail. Username may be
+// empty for relays that do not authenticate.
+type SMTPConfig struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+}
+
+// New selects the notifier by name: "file" (the default) appends messages
+// to filePath for local use, "smtp" sends them as mail.
+func New(backend string, filePath string, smtp SMTPConfig) (Notifier, error) {
+	switch backend {
+	case "", "file":
+		log.Printf("INFO: Writing notifications to %s; no mail is sent.", filePath)
+		return NewFileNotifier(filePath), nil
+	case "smtp":
+		return NewSMTPNotifier(smtp)
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", backend)
+	}
+}
+
+// formatMessage renders msg as an RFC 5322 message. Header values must not
+// contain line breaks, or a recipient could inject headers.
+func formatMessage(from string, msg Message) ([]byte, error) {
+	for _, value := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, errors.New("Line break in message header")
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String()), nil
+}
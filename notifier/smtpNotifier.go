@@ -0,0 +1,46 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+)
+
+// SMTPNotifier sends messages as mail through an SMTP server.
+type SMTPNotifier struct {
+	config SMTPConfig
+	auth   smtp.Auth
+}
+
+var _ Notifier = (*SMTPNotifier)(nil)
+
+// NewSMTPNotifier checks the configuration and returns a notifier using it.
+// net/smtp refuses to send credentials without TLS, except to localhost.
+func NewSMTPNotifier(config SMTPConfig) (*SMTPNotifier, error) {
+	if config.Addr == "" || config.From == "" {
+		return nil, errors.New("SMTP notifier needs an address and a sender")
+	}
+	host, _, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SMTP address %q: %v", config.Addr, err)
+	}
+
+	n := &SMTPNotifier{config: config}
+	if config.Username != "" {
+		n.auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+	return n, nil
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	data, err := formatMessage(n.config.From, msg)
+	if err != nil {
+		return err
+	}
+	if err := smtp.SendMail(n.config.Addr, n.auth, n.config.From, []string{msg.To}, data); err != nil {
+		return fmt.Errorf("Failed to send mail to %s: %v", msg.To, err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package reconciler
+
+import (
+	"Task_04/iamRole"
+	"Task_04/sharedpackage"
+	"Task_04/storage"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// MemberBinding is one member holding one role, under Condition if set.
+type MemberBinding struct {
+	Member    string                   `json:"member"`
+	Role      string                   `json:"role"`
+	Condition *sharedpackage.Condition `json:"condition,omitempty"`
+}
+
+// Grant is one role a member should hold, under Condition if set.
+type Grant struct {
+	Role      string
+	Condition *sharedpackage.Condition
+}
+
+// Expected maps the IAM member of every employee to the roles the employees
+// collection says it should hold in one project. Employees without roles
+// there are listed too, so their bindings are reported as extra rather than
+// as unknown members.
+type Expected map[string][]Grant
+
+// DriftReport compares a project's live IAM policy with the roles the
+// employees collection says each employee should hold.
+type DriftReport struct {
+	ProjectID string `json:"projectID"`
+	// MissingBindings are roles an employee should hold but does not.
+	MissingBindings []MemberBinding `json:"missingBindings"`
+	// ExtraBindings are roles an employee holds but should not.
+	ExtraBindings []MemberBinding `json:"extraBindings"`
+	// UnknownMembers are bindings of members that match no employee, such as
+	// service accounts, groups or people added outside this service.
+	UnknownMembers []MemberBinding `json:"unknownMembers"`
+	// OutboxPending is true while recorded IAM changes still wait to be
+	// applied; some drift is expected until the outbox is drained.
+	OutboxPending bool `json:"outboxPending"`
+}
+
+// ReconcileResult is a drift report together with the binding changes made,
+// or on a dry run that would be made, to remove the drift.
+type ReconcileResult struct {
+	DriftReport
+	Deltas []sharedpackage.BindingDelta `json:"deltas"`
+	DryRun bool                         `json:"dryRun"`
+}
+
+// DetectDrift reads the live policy of projectID and compares it with the
+// roles the employees should hold there.
+func DetectDrift(ctx context.Context, ops storage.OperationStore, projectID string, employees Expected) (*DriftReport, error) {
+	// Step 1: Collect the roles every employee should hold
+	expected := make(map[string]map[string]Grant)
+	names := make(map[string]string)
+	for name, grants := range employees {
+		member := memberKey(name)
+		if expected[member] == nil {
+			expected[member] = make(map[string]Grant)
+			names[member] = name
+		}
+		for _, grant := range grants {
+			if grant.Role != "" {
+				expected[member][grantKey(grant.Role, grant.Condition)] = grant
+			}
+		}
+	}
+
+	// Step 2: Read the live policy
+	live, err := iamRole.ProjectBindings(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read IAM policy of %s: %w", projectID, err)
+	}
+
+	// Step 3: Compare both sides
+	report := &DriftReport{
+		ProjectID:       projectID,
+		MissingBindings: []MemberBinding{},
+		ExtraBindings:   []MemberBinding{},
+		UnknownMembers:  []MemberBinding{},
+	}
+	held := make(map[string]map[string]bool)
+	for _, binding := range live {
+		bound := grantKey(binding.Role, binding.Condition)
+		for _, member := range binding.Members {
+			key := memberKey(member)
+			grants, known := expected[key]
+			found := MemberBinding{Member: member, Role: binding.Role, Condition: binding.Condition}
+			switch _, wanted := grants[bound]; {
+			case !known:
+				report.UnknownMembers = append(report.UnknownMembers, found)
+			case !wanted:
+				report.ExtraBindings = append(report.ExtraBindings, found)
+			}
+			if held[key] == nil {
+				held[key] = make(map[string]bool)
+			}
+			held[key][bound] = true
+		}
+	}
+	for member, grants := range expected {
+		for bound, grant := range grants {
+			if !held[member][bound] {
+				report.MissingBindings = append(report.MissingBindings, MemberBinding{Member: names[member], Role: grant.Role, Condition: grant.Condition})
+			}
+		}
+	}
+	sortBindings(report.MissingBindings)
+	sortBindings(report.ExtraBindings)
+	sortBindings(report.UnknownMembers)
+
+	// Step 4: Note whether the outbox still has changes to apply
+	pending, err := ops.PendingOperations(ctx, 1)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read IAM outbox: %w", err)
+	}
+	report.OutboxPending = len(pending) > 0
+
+	return report, nil
+}
+
+// Reconcile grants the missing bindings and revokes the extra ones found in
+// projectID. Bindings of unknown members are reported but never touched. On a
+// dry run the policy is left unchanged.
+func Reconcile(ctx context.Context, ops storage.OperationStore, projectID string, employees Expected, dryRun bool) (*ReconcileResult, error) {
+	report, err := DetectDrift(ctx, ops, projectID, employees)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReconcileResult{DriftReport: *report, Deltas: []sharedpackage.BindingDelta{}, DryRun: dryRun}
+	for _, binding := range report.MissingBindings {
+		result.Deltas = append(result.Deltas, sharedpackage.BindingDelta{Action: sharedpackage.BindingAdd, Role: binding.Role, Member: binding.Member, Condition: binding.Condition})
+	}
+	for _, binding := range report.ExtraBindings {
+		result.Deltas = append(result.Deltas, sharedpackage.BindingDelta{Action: sharedpackage.BindingRemove, Role: binding.Role, Member: binding.Member, Condition: binding.Condition})
+	}
+
+	if dryRun || len(result.Deltas) == 0 {
+		return result, nil
+	}
+	if err := iamRole.ApplyBindings(projectID, result.Deltas); err != nil {
+		return nil, fmt.Errorf("Failed to reconcile IAM policy of %s: %w", projectID, err)
+	}
+	log.Printf("INFO: Reconciled %s: %d bindings granted, %d revoked", projectID, len(report.MissingBindings), len(report.ExtraBindings))
+	return result, nil
+}
+
+// memberKey normalises a member for comparison; IAM treats email addresses
+// case-insensitively.
+func memberKey(member string) string {
+	return strings.ToLower(member)
+}
+
+// grantKey identifies a role under a condition.
+func grantKey(role string, condition *sharedpackage.Condition) string {
+	return role + "\x00" + iamRole.ConditionKey(condition)
+}
+
+func sortBindings(bindings []MemberBinding) {
+	sort.Slice(bindings, func(i, j int) bool {
+		if bindings[i].Member != bindings[j].Member {
+			return bindings[i].Member < bindings[j].Member
+		}
+		return grantKey(bindings[i].Role, bindings[i].Condition) < grantKey(bindings[j].Role, bindings[j].Condition)
+	})
+}
@@ -0,0 +1,159 @@
+package reconciler
+
+import (
+	"Task_04/iamRole"
+	"Task_04/sharedpackage"
+	"Task_04/storage"
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// Worker applies the IAM operations recorded in the outbox. Operations are
+// applied oldest first, grouped into one policy update per project; an
+// operation that fails is retried with backoff, so IAM converges on what the
+// database says even across IAM outages and server restarts.
+type Worker struct {
+	ops  storage.OperationStore
+	wake chan struct{}
+
+	// BatchSize is the number of operations read from the outbox at a time.
+	BatchSize int
+	// PollInterval is how often the outbox is checked without a Notify.
+	PollInterval time.Duration
+	// MaxAttempts is how often an operation is tried before it is marked failed.
+	MaxAttempts int
+	// InitialBackoff and MaxBackoff bound the wait after a failed round.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// NewWorker returns a Worker draining the outbox kept in ops.
+func NewWorker(ops storage.OperationStore) *Worker {
+	return &Worker{
+		ops:            ops,
+		wake:           make(chan struct{}, 1),
+		BatchSize:      100,
+		PollInterval:   30 * time.Second,
+		MaxAttempts:    10,
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Minute,
+	}
+}
+
+// Notify wakes the worker after new operations were recorded. It never blocks.
+func (w *Worker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run drains the outbox whenever it is notified or the poll interval passes,
+// until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	log.Println("INFO: IAM outbox worker started.")
+	backoff := w.InitialBackoff
+
+	for {
+		wait := w.PollInterval
+		if err := w.Drain(ctx); err != nil {
+			log.Printf("WARN: IAM outbox not drained, retrying in %v: %v", backoff, err)
+			wait = backoff
+			backoff *= 2
+			if backoff > w.MaxBackoff {
+				backoff = w.MaxBackoff
+			}
+		} else {
+			backoff = w.InitialBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("INFO: IAM outbox worker stopped.")
+			return
+		case <-w.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Drain applies pending operations until the outbox is empty or an
+// operation has to be retried later, in which case that error is returned.
+func (w *Worker) Drain(ctx context.Context) error {
+	for {
+		ops, err := w.ops.PendingOperations(ctx, w.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(ops) == 0 {
+			return nil
+		}
+		if err := w.process(ctx, ops); err != nil {
+			return err
+		}
+	}
+}
+
+// process applies one batch, keeping the order of operations per project.
+func (w *Worker) process(ctx context.Context, ops []sharedpackage.IAMOperation) error {
+	var projects []string
+	byProject := make(map[string][]sharedpackage.IAMOperation)
+	for _, op := range ops {
+		if _, seen := byProject[op.ProjectID]; !seen {
+			projects = append(projects, op.ProjectID)
+		}
+		byProject[op.ProjectID] = append(byProject[op.ProjectID], op)
+	}
+
+	var retryErr error
+	for _, projectID := range projects {
+		if err := w.applyProject(ctx, projectID, byProject[projectID]); err != nil {
+			retryErr = err
+		}
+	}
+	return retryErr
+}
+
+// applyProject applies the operations of one project in a single policy
+// update. If that fails they are applied one at a time to find the failing
+// operation; operations after a retryable failure wait for the next round.
+func (w *Worker) applyProject(ctx context.Context, projectID string, ops []sharedpackage.IAMOperation) error {
+	var deltas []sharedpackage.BindingDelta
+	opIDs := make([]string, 0, len(ops))
+	for _, op := range ops {
+		deltas = append(deltas, op.Deltas...)
+		opIDs = append(opIDs, op.ID)
+	}
+
+	if err := iamRole.ApplyBindings(projectID, deltas); err == nil {
+		log.Printf("INFO: Applied %d IAM operations to %s", len(ops), projectID)
+		return w.ops.CompleteOperations(ctx, opIDs)
+	}
+
+	for _, op := range ops {
+		err := iamRole.ApplyBindings(projectID, op.Deltas)
+		if err == nil {
+			if err := w.ops.CompleteOperations(ctx, []string{op.ID}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		permanent := isPermanent(err) || op.Attempts+1 >= w.MaxAttempts
+		if ferr := w.ops.FailOperation(ctx, op.ID, err.Error(), permanent); ferr != nil {
+			return ferr
+		}
+		if !permanent {
+			return err
+		}
+		log.Printf("ERROR: Giving up on IAM operation %s for employee %s after %d attempts: %v", op.ID, op.EmployeeID, op.Attempts+1, err)
+	}
+	return nil
+}
+
+// isPermanent reports whether retrying err cannot succeed.
+func isPermanent(err error) bool {
+	return errors.Is(err, iamRole.ErrInvalidRole) || errors.Is(err, iamRole.ErrInvalidProject) || errors.Is(err, iamRole.ErrNotFound)
+}
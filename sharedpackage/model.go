@@ -1,45 +1,99 @@
 package sharedpackage
 
-import "github.com/dgrijalva/jwt-go"
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
 
 type Employee struct {
+	ID        string              `firestore:"-" json:"id,omitempty"`
 	FirstName string              `firestore:"firstName" json:"firstName"`
 	LastName  string              `firestore:"lastName" json:"lastName"`
 	Email     string              `firestore:"mailID" json:"mailID"`
-	Password  string              `firestore:"password" json:"password"`
+	Password  string              `firestore:"password" json:"-"`
 	Role      string              `firestore:"role" json:"role"`
 	IAMRoles  map[string][]string `firestore:"iamRoles" json:"iamRoles"`
 	TeamIDs   []string            `firestore:"teamIDs" json:"teamIDs"`
 	DeptID    string              `firestore:"departmentID" json:"departmentID"`
+
+	// Failed login tracking; LockedUntil is RFC 3339 and empty when unlocked.
+	FailedLogins int    `firestore:"failedLogins" json:"failedLogins,omitempty"`
+	Lockouts     int    `firestore:"lockouts" json:"lockouts,omitempty"`
+	LockedUntil  string `firestore:"lockedUntil" json:"lockedUntil,omitempty"`
+
+	// TOTP multi-factor authentication. MFASecret is set on enrollment and
+	// MFAEnabled once a first code confirmed it. MFALastStep is the time step
+	// of the last accepted code; RecoveryCodes holds SHA-256 hashes. None of
+	// the secrets are ever sent to clients.
+	MFAEnabled    bool     `firestore:"mfaEnabled" json:"mfaEnabled"`
+	MFASecret     string   `firestore:"mfaSecret" json:"-"`
+	MFALastStep   int64    `firestore:"mfaLastStep" json:"-"`
+	RecoveryCodes []string `firestore:"recoveryCodes" json:"-"`
+
+	// RoleGrants qualifies roles in IAMRoles, by group key and then role.
+	// Roles without an entry are granted indefinitely.
+	RoleGrants map[string]map[string]RoleGrant `firestore:"roleGrants" json:"roleGrants,omitempty"`
+}
+
+// RoleGrant qualifies one role an employee holds through one group.
+type RoleGrant struct {
+	// ExpiresAt ends a time-bound grant. IAM stops honouring the binding at
+	// that time and the expiry sweeper removes the role afterwards.
+	ExpiresAt *time.Time `firestore:"expiresAt" json:"expiresAt,omitempty"`
+	// Condition restricts the grant to the requests it holds for.
+	Condition *Condition `firestore:"condition" json:"condition,omitempty"`
 }
 
+// Job roles with management rights. Any other role is a plain employee.
+const (
+	RoleAdmin = "Admin"
+	RoleHOD   = "HOD"
+	RoleLead  = "Lead"
+)
+
 type Department struct {
+	ID             string   `firestore:"-" json:"id,omitempty"`
 	DepartmentName string   `firestore:"departmentName" json:"departmentName"`
 	IAMRoles       []string `firestore:"iamRoles" json:"iamRoles"`
 	HeadID         string   `firestore:"headID" json:"headID"`
 	CreatedTime    string   `firestore:"createdTime" json:"createdTime"`
 	UpdatedTime    string   `firestore:"updatedTime" json:"updatedTime"`
+
+	// ProjectIDs are the GCP projects the department's IAM roles are
+	// granted in, or folders ("folders/123") and the organization
+	// ("organizations/123"). Without any, the configured default project is
+	// used.
+	ProjectIDs []string `firestore:"projectIDs" json:"projectIDs,omitempty"`
 }
 
 type Team struct {
+	ID           string   `firestore:"-" json:"id,omitempty"`
 	TeamName     string   `firestore:"teamName" json:"teamName"`
 	IAMRoles     []string `firestore:"iamRoles" json:"iamRoles"`
 	LeadID       string   `firestore:"leadID" json:"leadID"`
 	DepartmentID string   `firestore:"departmentID" json:"departmentID"`
 	CreatedTime  string   `firestore:"createdTime" json:"createdTime"`
 	UpdatedTime  string   `firestore:"updatedTime" json:"updatedTime"`
+
+	// ProjectIDs override the projects of the team's department.
+	ProjectIDs []string `firestore:"projectIDs" json:"projectIDs,omitempty"`
 }
 
 type AssignRole struct {
 	TeamID   string   `json:"teamID"`
 	DeptID   string   `json:"departmentID"`
 	IAMRoles []string `json:"iamRoles"`
-	Role     string   `json:role`
+	Role     string   `json:"role"`
+	// ExpiresAt makes the grant time-bound; without it the roles never expire.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Condition binds the roles under an IAM Condition.
+	Condition *Condition `json:"condition,omitempty"`
 }
 
 type RemoveRoles struct {
 	GroupID  string   `json:"grpID"`
-	IAMRoles []string `json:iamRoles`
+	IAMRoles []string `json:"iamRoles"`
 }
 
 type CustomRole struct {
@@ -61,19 +115,227 @@ type UpdateCR struct {
 
 type Claims struct {
 	Username string `json:"username"`
-	jwt.StandardClaims
+	jwt.RegisteredClaims
 }
 
 type Credentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// Code is a TOTP or recovery code, required once MFA is enabled.
+	Code string `json:"code,omitempty"`
 }
 
 type Binding struct {
-	Role    string   // Role name
-	Members []string // Members assigned to the role
+	Role      string     // Role name
+	Members   []string   // Members assigned to the role
+	Condition *Condition // Condition the role is granted under, nil if none
+}
+
+// Condition is an IAM Condition: a CEL expression that must hold for a
+// binding to apply. Bindings are told apart by role and condition.
+type Condition struct {
+	Expression  string `firestore:"expression" json:"expression"`
+	Title       string `firestore:"title" json:"title"`
+	Description string `firestore:"description" json:"description,omitempty"`
 }
 
 type Policy struct {
 	Bindings []Binding // List of role bindings
 }
+
+// Binding delta actions.
+const (
+	BindingAdd          = "add"          // add Member to Role
+	BindingRemove       = "remove"       // remove Member from Role
+	BindingRemoveMember = "removeMember" // remove Member from every role
+)
+
+// BindingDelta is a single change to a project's IAM bindings.
+type BindingDelta struct {
+	Action string `firestore:"action" json:"action"`
+	Role   string `firestore:"role" json:"role,omitempty"`
+	Member string `firestore:"member" json:"member"`
+	// Condition selects the conditional binding of Role an add or remove
+	// applies to; nil means the unconditional one.
+	Condition *Condition `firestore:"condition" json:"condition,omitempty"`
+}
+
+// IAM operation states.
+const (
+	OperationPending = "pending"
+	OperationDone    = "done"
+	OperationFailed  = "failed"
+)
+
+// IAMOperation is a change to a project's IAM policy waiting in the outbox.
+// It is recorded in the same transaction as the document write that caused it
+// and applied to IAM later by the reconciler.
+type IAMOperation struct {
+	ID         string         `firestore:"-" json:"id"`
+	ProjectID  string         `firestore:"projectID" json:"projectID"`
+	EmployeeID string         `firestore:"employeeID" json:"employeeID"`
+	Deltas     []BindingDelta `firestore:"deltas" json:"deltas"`
+	Status     string         `firestore:"status" json:"status"`
+	Attempts   int            `firestore:"attempts" json:"attempts"`
+	LastError  string         `firestore:"lastError" json:"lastError,omitempty"`
+	CreatedAt  time.Time      `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time      `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// RefreshToken is a long-lived session credential exchanged for new access
+// tokens. Only the SHA-256 hash of the token handed to the client is kept, as
+// the ID, so a leaked database does not leak usable sessions.
+type RefreshToken struct {
+	ID         string    `firestore:"-" json:"id"`
+	EmployeeID string    `firestore:"employeeID" json:"employeeID"`
+	CreatedAt  time.Time `firestore:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time `firestore:"expiresAt" json:"expiresAt"`
+	Revoked    bool      `firestore:"revoked" json:"revoked"`
+}
+
+// Purposes of a PasswordToken.
+const (
+	PasswordInvite = "invite"
+	PasswordReset  = "reset"
+)
+
+// PasswordToken lets an employee set their password once, after an invite
+// or a reset request. Like RefreshToken it is stored under the SHA-256 hash
+// of the token that was sent to the employee.
+type PasswordToken struct {
+	ID         string    `firestore:"-" json:"id"`
+	EmployeeID string    `firestore:"employeeID" json:"employeeID"`
+	Purpose    string    `firestore:"purpose" json:"purpose"`
+	CreatedAt  time.Time `firestore:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time `firestore:"expiresAt" json:"expiresAt"`
+	Used       bool      `firestore:"used" json:"used"`
+}
+
+// States of a RoleRequest.
+const (
+	RequestPending  = "pending"
+	RequestApproved = "approved"
+	RequestDenied   = "denied"
+)
+
+// RoleRequest is an employee's request for IAM roles in one of their groups.
+// It is routed to the team's Lead or the department's HOD, and the roles are
+// only granted once the approver accepts it.
+type RoleRequest struct {
+	ID         string   `firestore:"-" json:"id"`
+	EmployeeID string   `firestore:"employeeID" json:"employeeID"`
+	Roles      []string `firestore:"roles" json:"roles"`
+	// DepartmentID and TeamID are the scope the roles are requested in; for
+	// a team, DepartmentID is the team's department.
+	DepartmentID  string `firestore:"departmentID" json:"departmentID"`
+	TeamID        string `firestore:"teamID" json:"teamID,omitempty"`
+	Justification string `firestore:"justification" json:"justification"`
+	// Duration is how long the roles are granted for once approved, e.g.
+	// "72h". Empty grants them indefinitely.
+	Duration string `firestore:"duration" json:"duration,omitempty"`
+	// ApproverID is the employee the request is routed to. Empty means no
+	// Lead or HOD can decide it, so it waits for an Admin.
+	ApproverID string    `firestore:"approverID" json:"approverID,omitempty"`
+	CreatedAt  time.Time `firestore:"createdAt" json:"createdAt"`
+
+	RoleDecision
+}
+
+// RoleDecision is the outcome of a RoleRequest.
+type RoleDecision struct {
+	Status    string     `firestore:"status" json:"status"`
+	DecidedBy string     `firestore:"decidedBy" json:"decidedBy,omitempty"`
+	DecidedAt *time.Time `firestore:"decidedAt" json:"decidedAt,omitempty"`
+	Comment   string     `firestore:"comment" json:"comment,omitempty"`
+	// ExpiresAt is when the approved grant ends; nil if it does not.
+	ExpiresAt *time.Time `firestore:"expiresAt" json:"expiresAt,omitempty"`
+}
+
+// States of a BreakGlassReview.
+const (
+	ReviewOpen   = "open"
+	ReviewClosed = "closed"
+)
+
+// BreakGlassGrant is emergency access granted without approval: the
+// break-glass roles, through the on-call team, for a short time. Every grant
+// stays on record with a review an Admin has to close after the incident.
+type BreakGlassGrant struct {
+	ID         string   `firestore:"-" json:"id"`
+	EmployeeID string   `firestore:"employeeID" json:"employeeID"`
+	GrantedBy  string   `firestore:"grantedBy" json:"grantedBy"`
+	Roles      []string `firestore:"roles" json:"roles"`
+	// TeamID is the on-call team the roles are granted through.
+	TeamID        string    `firestore:"teamID" json:"teamID"`
+	Justification string    `firestore:"justification" json:"justification"`
+	GrantedAt     time.Time `firestore:"grantedAt" json:"grantedAt"`
+	ExpiresAt     time.Time `firestore:"expiresAt" json:"expiresAt"`
+
+	Review BreakGlassReview `firestore:"review" json:"review"`
+}
+
+// BreakGlassReview is the post-incident review of a BreakGlassGrant.
+type BreakGlassReview struct {
+	Status   string     `firestore:"status" json:"status"`
+	ClosedBy string     `firestore:"closedBy" json:"closedBy,omitempty"`
+	ClosedAt *time.Time `firestore:"closedAt" json:"closedAt,omitempty"`
+	// Notes are the findings of the review.
+	Notes string `firestore:"notes" json:"notes,omitempty"`
+}
+
+// States of a ReviewCampaign.
+const (
+	CampaignOpen   = "open"
+	CampaignClosed = "closed"
+)
+
+// Decisions on a ReviewItem.
+const (
+	ItemPending = "pending"
+	ItemKept    = "kept"
+	ItemRevoked = "revoked"
+	// ItemExpired marks an item no one reviewed by the deadline of a
+	// campaign without auto-revocation; the role is left in place.
+	ItemExpired = "expired"
+)
+
+// ReviewCampaign is an access recertification of the IAM roles granted
+// through a department, with its teams, or through a single team.
+type ReviewCampaign struct {
+	ID           string `firestore:"-" json:"id"`
+	Name         string `firestore:"name" json:"name"`
+	DepartmentID string `firestore:"departmentID" json:"departmentID"`
+	TeamID       string `firestore:"teamID" json:"teamID,omitempty"`
+	// Deadline is when the campaign closes. With AutoRevoke, roles whose
+	// items are still pending then are revoked.
+	Deadline   time.Time  `firestore:"deadline" json:"deadline"`
+	AutoRevoke bool       `firestore:"autoRevoke" json:"autoRevoke"`
+	CreatedBy  string     `firestore:"createdBy" json:"createdBy"`
+	CreatedAt  time.Time  `firestore:"createdAt" json:"createdAt"`
+	Status     string     `firestore:"status" json:"status"`
+	ClosedAt   *time.Time `firestore:"closedAt" json:"closedAt,omitempty"`
+
+	Items []ReviewItem `firestore:"items" json:"items"`
+}
+
+// ReviewItem asks a reviewer whether an employee keeps a role they hold
+// through a group.
+type ReviewItem struct {
+	ID         string `firestore:"id" json:"id"`
+	EmployeeID string `firestore:"employeeID" json:"employeeID"`
+	Group      string `firestore:"group" json:"group"`
+	Role       string `firestore:"role" json:"role"`
+	// ReviewerID is the group's Lead or HOD. Empty means no one but an
+	// Admin can review the item.
+	ReviewerID string `firestore:"reviewerID" json:"reviewerID,omitempty"`
+
+	ReviewDecision
+}
+
+// ReviewDecision is the outcome of a ReviewItem.
+type ReviewDecision struct {
+	Decision  string     `firestore:"decision" json:"decision"`
+	DecidedBy string     `firestore:"decidedBy" json:"decidedBy,omitempty"`
+	DecidedAt *time.Time `firestore:"decidedAt" json:"decidedAt,omitempty"`
+	Comment   string     `firestore:"comment" json:"comment,omitempty"`
+}
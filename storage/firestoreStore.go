@@ -0,0 +1,889 @@
+package storage
+
+import (
+	"Task_04/sharedpackage"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FirestoreStore implements Store on top of Cloud Firestore collections.
+type FirestoreStore struct {
+	client      *firestore.Client
+	employees   string
+	departments string
+	teams       string
+	operations  string
+	tokens      string
+	passwords   string
+	requests    string
+	breakGlass  string
+	campaigns   string
+}
+
+var _ Store = (*FirestoreStore)(nil)
+
+// Collections names the Firestore collection of every kind of document, so
+// several instances can share one database.
+type Collections struct {
+	Employees        string `yaml:"employees"`
+	Departments      string `yaml:"departments"`
+	Teams            string `yaml:"teams"`
+	IAMOperations    string `yaml:"iamOperations"`
+	RefreshTokens    string `yaml:"refreshTokens"`
+	PasswordTokens   string `yaml:"passwordTokens"`
+	RoleRequests     string `yaml:"roleRequests"`
+	BreakGlassGrants string `yaml:"breakGlassGrants"`
+	ReviewCampaigns  string `yaml:"reviewCampaigns"`
+}
+
+// DefaultCollections returns the collection names used unless configured otherwise.
+func DefaultCollections() Collections {
+	return Collections{
+		Employees:        "employees",
+		Departments:      "departments",
+		Teams:            "teams",
+		IAMOperations:    "iamOperations",
+		RefreshTokens:    "refreshTokens",
+		PasswordTokens:   "passwordTokens",
+		RoleRequests:     "roleRequests",
+		BreakGlassGrants: "breakGlassGrants",
+		ReviewCampaigns:  "reviewCampaigns",
+	}
+}
+
+// NewFirestoreStore creates a Firestore client for the given project and
+// returns a store backed by the given collections.
+func NewFirestoreStore(ctx context.Context, projectID string, collections Collections) (*FirestoreStore, error) {
+	client, err := firestore.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create Firestore client: %v", err)
+	}
+	log.Println("INFO: Firestore client successfully initialized.")
+
+	return &FirestoreStore{
+		client:      client,
+		employees:   collections.Employees,
+		departments: collections.Departments,
+		teams:       collections.Teams,
+		operations:  collections.IAMOperations,
+		tokens:      collections.RefreshTokens,
+		passwords:   collections.PasswordTokens,
+		requests:    collections.RoleRequests,
+		breakGlass:  collections.BreakGlassGrants,
+		campaigns:   collections.ReviewCampaigns,
+	}, nil
+}
+
+// Close closes the underlying Firestore client.
+func (s *FirestoreStore) Close() error {
+	return s.client.Close()
+}
+
+// getDoc fetches a document and decodes it into v, mapping a missing document to ErrNotFound.
+func (s *FirestoreStore) getDoc(ctx context.Context, collection, docID string, v interface{}) error {
+	if docID == "" {
+		return fmt.Errorf("%s: empty document ID: %w", collection, ErrNotFound)
+	}
+
+	docSnapshot, err := s.client.Collection(collection).Doc(docID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return fmt.Errorf("%s/%s: %w", collection, docID, ErrNotFound)
+		}
+		return fmt.Errorf("Error getting document %s/%s: %v", collection, docID, err)
+	}
+	if !docSnapshot.Exists() {
+		return fmt.Errorf("%s/%s: %w", collection, docID, ErrNotFound)
+	}
+
+	if err := docSnapshot.DataTo(v); err != nil {
+		return fmt.Errorf("Error converting document data: %v", err)
+	}
+	return nil
+}
+
+// collectIDs returns the IDs of every document in the collection.
+func (s *FirestoreStore) collectIDs(ctx context.Context, collection string) ([]string, error) {
+	refs, err := s.client.Collection(collection).DocumentRefs(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		ids = append(ids, ref.ID)
+	}
+	return ids, nil
+}
+
+// queryEmployees runs the query and decodes every matching employee document.
+func queryEmployees(ctx context.Context, query firestore.Query) ([]sharedpackage.Employee, error) {
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	var employees []sharedpackage.Employee
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error iterating over documents: %v", err)
+		}
+
+		var employee sharedpackage.Employee
+		if err := doc.DataTo(&employee); err != nil {
+			return nil, fmt.Errorf("Error converting document data: %v", err)
+		}
+		employee.ID = doc.Ref.ID
+		employees = append(employees, employee)
+	}
+	return employees, nil
+}
+
+func (s *FirestoreStore) GetEmployee(ctx context.Context, empID string) (*sharedpackage.Employee, error) {
+	var employee sharedpackage.Employee
+	if err := s.getDoc(ctx, s.employees, empID, &employee); err != nil {
+		return nil, err
+	}
+	employee.ID = empID
+	return &employee, nil
+}
+
+func (s *FirestoreStore) PutEmployee(ctx context.Context, empID string, employee sharedpackage.Employee) error {
+	_, err := s.client.Collection(s.employees).Doc(empID).Set(ctx, employee)
+	return err
+}
+
+func (s *FirestoreStore) DeleteEmployee(ctx context.Context, empID string) error {
+	_, err := s.client.Collection(s.employees).Doc(empID).Delete(ctx)
+	return err
+}
+
+func (s *FirestoreStore) ListEmployees(ctx context.Context) ([]sharedpackage.Employee, error) {
+	return queryEmployees(ctx, s.client.Collection(s.employees).Query)
+}
+
+func (s *FirestoreStore) FindEmployeesByDepartment(ctx context.Context, deptID string) ([]sharedpackage.Employee, error) {
+	return queryEmployees(ctx, s.client.Collection(s.employees).Where("departmentID", "==", deptID))
+}
+
+func (s *FirestoreStore) FindEmployeesByTeam(ctx context.Context, teamID string) ([]sharedpackage.Employee, error) {
+	return queryEmployees(ctx, s.client.Collection(s.employees).Where("teamIDs", "array-contains", teamID))
+}
+
+func (s *FirestoreStore) FindEmployeeByEmail(ctx context.Context, mail string) (*sharedpackage.Employee, error) {
+	employees, err := queryEmployees(ctx, s.client.Collection(s.employees).Where("mailID", "==", mail).Limit(1))
+	if err != nil {
+		return nil, err
+	}
+	if len(employees) == 0 {
+		return nil, fmt.Errorf("employee with mailID %s: %w", mail, ErrNotFound)
+	}
+	return &employees[0], nil
+}
+
+func (s *FirestoreStore) NextEmployeeID(ctx context.Context) (string, error) {
+	ids, err := s.collectIDs(ctx, s.employees)
+	if err != nil {
+		return "", err
+	}
+	return nextIncrementingID("emp_", ids), nil
+}
+
+func (s *FirestoreStore) UpdateEmployeeLockout(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	return s.updateEmployee(ctx, empID, withoutOperations(update), func(employee sharedpackage.Employee) []firestore.Update {
+		return []firestore.Update{
+			{Path: "failedLogins", Value: employee.FailedLogins},
+			{Path: "lockouts", Value: employee.Lockouts},
+			{Path: "lockedUntil", Value: employee.LockedUntil},
+		}
+	})
+}
+
+func (s *FirestoreStore) UpdateEmployeeMFA(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	return s.updateEmployee(ctx, empID, withoutOperations(update), func(employee sharedpackage.Employee) []firestore.Update {
+		return []firestore.Update{
+			{Path: "mfaEnabled", Value: employee.MFAEnabled},
+			{Path: "mfaSecret", Value: employee.MFASecret},
+			{Path: "mfaLastStep", Value: employee.MFALastStep},
+			{Path: "recoveryCodes", Value: employee.RecoveryCodes},
+		}
+	})
+}
+
+func (s *FirestoreStore) UpdateEmployeePassword(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	return s.updateEmployee(ctx, empID, withoutOperations(update), func(employee sharedpackage.Employee) []firestore.Update {
+		return []firestore.Update{
+			{Path: "password", Value: employee.Password},
+			{Path: "failedLogins", Value: employee.FailedLogins},
+			{Path: "lockouts", Value: employee.Lockouts},
+			{Path: "lockedUntil", Value: employee.LockedUntil},
+		}
+	})
+}
+
+// updateEmployee re-reads the employee in a transaction, applies update to
+// it, writes only the fields listed by fields and enqueues the ops update
+// returns. Firestore retries contended transactions, so update must only
+// depend on the employee it is given.
+func (s *FirestoreStore) updateEmployee(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) ([]sharedpackage.IAMOperation, error), fields func(employee sharedpackage.Employee) []firestore.Update) (*sharedpackage.Employee, error) {
+	var updated sharedpackage.Employee
+	ref := s.client.Collection(s.employees).Doc(empID)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return fmt.Errorf("%s/%s: %w", s.employees, empID, ErrNotFound)
+			}
+			return err
+		}
+		updated = sharedpackage.Employee{}
+		if err := doc.DataTo(&updated); err != nil {
+			return err
+		}
+		updated.ID = empID
+		ops, err := update(&updated)
+		if err != nil {
+			return err
+		}
+		if err := tx.Update(ref, fields(updated)); err != nil {
+			return err
+		}
+		return s.createOperations(tx, queueOperations(ops))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *FirestoreStore) GetDepartment(ctx context.Context, deptID string) (*sharedpackage.Department, error) {
+	var department sharedpackage.Department
+	if err := s.getDoc(ctx, s.departments, deptID, &department); err != nil {
+		return nil, err
+	}
+	department.ID = deptID
+	return &department, nil
+}
+
+func (s *FirestoreStore) PutDepartment(ctx context.Context, deptID string, department sharedpackage.Department) error {
+	_, err := s.client.Collection(s.departments).Doc(deptID).Set(ctx, department)
+	return err
+}
+
+func (s *FirestoreStore) DeleteDepartment(ctx context.Context, deptID string) error {
+	_, err := s.client.Collection(s.departments).Doc(deptID).Delete(ctx)
+	return err
+}
+
+func (s *FirestoreStore) ListDepartments(ctx context.Context) ([]sharedpackage.Department, error) {
+	iter := s.client.Collection(s.departments).Documents(ctx)
+	defer iter.Stop()
+
+	var departments []sharedpackage.Department
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error iterating over documents: %v", err)
+		}
+
+		var department sharedpackage.Department
+		if err := doc.DataTo(&department); err != nil {
+			return nil, fmt.Errorf("Error converting document data: %v", err)
+		}
+		department.ID = doc.Ref.ID
+		departments = append(departments, department)
+	}
+	return departments, nil
+}
+
+func (s *FirestoreStore) NextDepartmentID(ctx context.Context) (string, error) {
+	ids, err := s.collectIDs(ctx, s.departments)
+	if err != nil {
+		return "", err
+	}
+	return nextIncrementingID("dept_", ids), nil
+}
+
+func (s *FirestoreStore) GetTeam(ctx context.Context, teamID string) (*sharedpackage.Team, error) {
+	var team sharedpackage.Team
+	if err := s.getDoc(ctx, s.teams, teamID, &team); err != nil {
+		return nil, err
+	}
+	team.ID = teamID
+	return &team, nil
+}
+
+func (s *FirestoreStore) PutTeam(ctx context.Context, teamID string, team sharedpackage.Team) error {
+	_, err := s.client.Collection(s.teams).Doc(teamID).Set(ctx, team)
+	return err
+}
+
+func (s *FirestoreStore) DeleteTeam(ctx context.Context, teamID string) error {
+	_, err := s.client.Collection(s.teams).Doc(teamID).Delete(ctx)
+	return err
+}
+
+func (s *FirestoreStore) ListTeams(ctx context.Context) ([]sharedpackage.Team, error) {
+	return s.queryTeams(ctx, s.client.Collection(s.teams).Query)
+}
+
+func (s *FirestoreStore) FindTeamsByDepartment(ctx context.Context, deptID string) ([]sharedpackage.Team, error) {
+	return s.queryTeams(ctx, s.client.Collection(s.teams).Where("departmentID", "==", deptID))
+}
+
+// queryTeams runs the query and decodes every matching team document.
+func (s *FirestoreStore) queryTeams(ctx context.Context, query firestore.Query) ([]sharedpackage.Team, error) {
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	var teams []sharedpackage.Team
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error iterating over documents: %v", err)
+		}
+
+		var team sharedpackage.Team
+		if err := doc.DataTo(&team); err != nil {
+			return nil, fmt.Errorf("Error converting document data: %v", err)
+		}
+		team.ID = doc.Ref.ID
+		teams = append(teams, team)
+	}
+	return teams, nil
+}
+
+func (s *FirestoreStore) NextTeamID(ctx context.Context) (string, error) {
+	ids, err := s.collectIDs(ctx, s.teams)
+	if err != nil {
+		return "", err
+	}
+	return nextIncrementingID("team_", ids), nil
+}
+
+func (s *FirestoreStore) PutEmployeeWithOperations(ctx context.Context, empID string, employee sharedpackage.Employee, ops []sharedpackage.IAMOperation) error {
+	queued := queueOperations(ops)
+	if len(queued) == 0 {
+		return s.PutEmployee(ctx, empID, employee)
+	}
+
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Set(s.client.Collection(s.employees).Doc(empID), employee); err != nil {
+			return err
+		}
+		return s.createOperations(tx, queued)
+	})
+}
+
+func (s *FirestoreStore) UpdateEmployeeRolesWithOperations(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) ([]sharedpackage.IAMOperation, error)) (*sharedpackage.Employee, error) {
+	return s.updateEmployee(ctx, empID, update, func(employee sharedpackage.Employee) []firestore.Update {
+		return []firestore.Update{
+			{Path: "role", Value: employee.Role},
+			{Path: "departmentID", Value: employee.DeptID},
+			{Path: "teamIDs", Value: employee.TeamIDs},
+			{Path: "iamRoles", Value: employee.IAMRoles},
+			{Path: "roleGrants", Value: employee.RoleGrants},
+		}
+	})
+}
+
+// createOperations enqueues ops, already stamped by newOperation, in tx.
+func (s *FirestoreStore) createOperations(tx *firestore.Transaction, ops []sharedpackage.IAMOperation) error {
+	for _, op := range ops {
+		if err := tx.Create(s.client.Collection(s.operations).Doc(op.ID), op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FirestoreStore) PendingOperations(ctx context.Context, limit int) ([]sharedpackage.IAMOperation, error) {
+	iter := s.client.Collection(s.operations).
+		Where("status", "==", sharedpackage.OperationPending).
+		OrderBy(firestore.DocumentID, firestore.Asc).
+		Limit(limit).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var ops []sharedpackage.IAMOperation
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error iterating over operations: %v", err)
+		}
+
+		var op sharedpackage.IAMOperation
+		if err := doc.DataTo(&op); err != nil {
+			return nil, fmt.Errorf("Error converting operation data: %v", err)
+		}
+		op.ID = doc.Ref.ID
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+func (s *FirestoreStore) CompleteOperations(ctx context.Context, opIDs []string) error {
+	now := time.Now().UTC()
+	for _, opID := range opIDs {
+		_, err := s.client.Collection(s.operations).Doc(opID).Update(ctx, []firestore.Update{
+			{Path: "status", Value: sharedpackage.OperationDone},
+			{Path: "updatedAt", Value: now},
+		})
+		if err != nil {
+			return fmt.Errorf("Error completing operation %s: %v", opID, err)
+		}
+	}
+	return nil
+}
+
+func (s *FirestoreStore) FailOperation(ctx context.Context, opID string, lastError string, permanent bool) error {
+	updates := []firestore.Update{
+		{Path: "attempts", Value: firestore.Increment(1)},
+		{Path: "lastError", Value: lastError},
+		{Path: "updatedAt", Value: time.Now().UTC()},
+	}
+	if permanent {
+		updates = append(updates, firestore.Update{Path: "status", Value: sharedpackage.OperationFailed})
+	}
+	if _, err := s.client.Collection(s.operations).Doc(opID).Update(ctx, updates); err != nil {
+		return fmt.Errorf("Error recording failure of operation %s: %v", opID, err)
+	}
+	return nil
+}
+
+func (s *FirestoreStore) CreateRefreshToken(ctx context.Context, token sharedpackage.RefreshToken) error {
+	if _, err := s.client.Collection(s.tokens).Doc(token.ID).Create(ctx, token); err != nil {
+		return fmt.Errorf("Error creating refresh token: %v", err)
+	}
+	return nil
+}
+
+func (s *FirestoreStore) GetRefreshToken(ctx context.Context, tokenID string) (*sharedpackage.RefreshToken, error) {
+	var token sharedpackage.RefreshToken
+	if err := s.getDoc(ctx, s.tokens, tokenID, &token); err != nil {
+		return nil, err
+	}
+	token.ID = tokenID
+	return &token, nil
+}
+
+func (s *FirestoreStore) RevokeRefreshToken(ctx context.Context, tokenID string) (bool, error) {
+	revoked := false
+	ref := s.client.Collection(s.tokens).Doc(tokenID)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		revoked = false
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			return err
+		}
+		var token sharedpackage.RefreshToken
+		if err := doc.DataTo(&token); err != nil {
+			return err
+		}
+		if token.Revoked {
+			return nil
+		}
+		revoked = true
+		return tx.Update(ref, []firestore.Update{{Path: "revoked", Value: true}})
+	})
+	if err != nil {
+		return false, fmt.Errorf("Error revoking refresh token: %v", err)
+	}
+	return revoked, nil
+}
+
+func (s *FirestoreStore) RevokeEmployeeRefreshTokens(ctx context.Context, empID string) error {
+	iter := s.client.Collection(s.tokens).
+		Where("employeeID", "==", empID).
+		Where("revoked", "==", false).
+		Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error iterating over refresh tokens: %v", err)
+		}
+		if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: "revoked", Value: true}}); err != nil {
+			return fmt.Errorf("Error revoking refresh token: %v", err)
+		}
+	}
+}
+
+func (s *FirestoreStore) CreatePasswordToken(ctx context.Context, token sharedpackage.PasswordToken) error {
+	if _, err := s.client.Collection(s.passwords).Doc(token.ID).Create(ctx, token); err != nil {
+		return fmt.Errorf("Error creating password token: %v", err)
+	}
+	return nil
+}
+
+func (s *FirestoreStore) GetPasswordToken(ctx context.Context, tokenID string) (*sharedpackage.PasswordToken, error) {
+	var token sharedpackage.PasswordToken
+	if err := s.getDoc(ctx, s.passwords, tokenID, &token); err != nil {
+		return nil, err
+	}
+	token.ID = tokenID
+	return &token, nil
+}
+
+func (s *FirestoreStore) UsePasswordToken(ctx context.Context, tokenID string) (bool, error) {
+	used := false
+	ref := s.client.Collection(s.passwords).Doc(tokenID)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		used = false
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			return err
+		}
+		var token sharedpackage.PasswordToken
+		if err := doc.DataTo(&token); err != nil {
+			return err
+		}
+		if token.Used {
+			return nil
+		}
+		used = true
+		return tx.Update(ref, []firestore.Update{{Path: "used", Value: true}})
+	})
+	if err != nil {
+		return false, fmt.Errorf("Error using password token: %v", err)
+	}
+	return used, nil
+}
+
+func (s *FirestoreStore) UseEmployeePasswordTokens(ctx context.Context, empID string, purpose string) error {
+	query := s.client.Collection(s.passwords).
+		Where("employeeID", "==", empID).
+		Where("used", "==", false)
+	if purpose != "" {
+		query = query.Where("purpose", "==", purpose)
+	}
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error iterating over password tokens: %v", err)
+		}
+		if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: "used", Value: true}}); err != nil {
+			return fmt.Errorf("Error using password token: %v", err)
+		}
+	}
+}
+
+func (s *FirestoreStore) CountPasswordTokens(ctx context.Context, empID string, purpose string, since time.Time) (int, error) {
+	// Equality filters only, so no composite index is needed
+	iter := s.client.Collection(s.passwords).
+		Where("employeeID", "==", empID).
+		Where("purpose", "==", purpose).
+		Documents(ctx)
+	defer iter.Stop()
+
+	count := 0
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return count, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("Error iterating over password tokens: %v", err)
+		}
+		var token sharedpackage.PasswordToken
+		if err := doc.DataTo(&token); err != nil {
+			return 0, fmt.Errorf("Error converting password token: %v", err)
+		}
+		if !token.CreatedAt.Before(since) {
+			count++
+		}
+	}
+}
+
+func (s *FirestoreStore) CreateRoleRequest(ctx context.Context, request sharedpackage.RoleRequest) error {
+	if _, err := s.client.Collection(s.requests).Doc(request.ID).Create(ctx, request); err != nil {
+		return fmt.Errorf("Error creating role request: %v", err)
+	}
+	return nil
+}
+
+func (s *FirestoreStore) GetRoleRequest(ctx context.Context, requestID string) (*sharedpackage.RoleRequest, error) {
+	var request sharedpackage.RoleRequest
+	if err := s.getDoc(ctx, s.requests, requestID, &request); err != nil {
+		return nil, err
+	}
+	request.ID = requestID
+	return &request, nil
+}
+
+func (s *FirestoreStore) ListRoleRequests(ctx context.Context) ([]sharedpackage.RoleRequest, error) {
+	iter := s.client.Collection(s.requests).OrderBy("createdAt", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	var requests []sharedpackage.RoleRequest
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error iterating over role requests: %v", err)
+		}
+
+		var request sharedpackage.RoleRequest
+		if err := doc.DataTo(&request); err != nil {
+			return nil, fmt.Errorf("Error converting document data: %v", err)
+		}
+		request.ID = doc.Ref.ID
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+func (s *FirestoreStore) DecideRoleRequest(ctx context.Context, requestID string, from string, decision sharedpackage.RoleDecision) (bool, error) {
+	decided := false
+	ref := s.client.Collection(s.requests).Doc(requestID)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		decided = false
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			return err
+		}
+		var request sharedpackage.RoleRequest
+		if err := doc.DataTo(&request); err != nil {
+			return err
+		}
+		if request.Status != from {
+			return nil
+		}
+		decided = true
+		request.RoleDecision = decision
+		return tx.Set(ref, request)
+	})
+	if err != nil {
+		return false, fmt.Errorf("Error deciding role request: %v", err)
+	}
+	return decided, nil
+}
+
+func (s *FirestoreStore) NextRoleRequestID(ctx context.Context) (string, error) {
+	ids, err := s.collectIDs(ctx, s.requests)
+	if err != nil {
+		return "", err
+	}
+	return nextIncrementingID("req_", ids), nil
+}
+
+func (s *FirestoreStore) CreateBreakGlassGrant(ctx context.Context, grant sharedpackage.BreakGlassGrant) error {
+	if _, err := s.client.Collection(s.breakGlass).Doc(grant.ID).Create(ctx, grant); err != nil {
+		return fmt.Errorf("Error creating break-glass grant: %v", err)
+	}
+	return nil
+}
+
+func (s *FirestoreStore) GetBreakGlassGrant(ctx context.Context, grantID string) (*sharedpackage.BreakGlassGrant, error) {
+	var grant sharedpackage.BreakGlassGrant
+	if err := s.getDoc(ctx, s.breakGlass, grantID, &grant); err != nil {
+		return nil, err
+	}
+	grant.ID = grantID
+	return &grant, nil
+}
+
+func (s *FirestoreStore) ListBreakGlassGrants(ctx context.Context) ([]sharedpackage.BreakGlassGrant, error) {
+	iter := s.client.Collection(s.breakGlass).OrderBy("grantedAt", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	var grants []sharedpackage.BreakGlassGrant
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error iterating over break-glass grants: %v", err)
+		}
+
+		var grant sharedpackage.BreakGlassGrant
+		if err := doc.DataTo(&grant); err != nil {
+			return nil, fmt.Errorf("Error converting document data: %v", err)
+		}
+		grant.ID = doc.Ref.ID
+		grants = append(grants, grant)
+	}
+	return grants, nil
+}
+
+func (s *FirestoreStore) CloseBreakGlassReview(ctx context.Context, grantID string, review sharedpackage.BreakGlassReview) (bool, error) {
+	closed := false
+	ref := s.client.Collection(s.breakGlass).Doc(grantID)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		closed = false
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			return err
+		}
+		var grant sharedpackage.BreakGlassGrant
+		if err := doc.DataTo(&grant); err != nil {
+			return err
+		}
+		if grant.Review.Status != sharedpackage.ReviewOpen {
+			return nil
+		}
+		closed = true
+		return tx.Update(ref, []firestore.Update{{Path: "review", Value: review}})
+	})
+	if err != nil {
+		return false, fmt.Errorf("Error closing break-glass review: %v", err)
+	}
+	return closed, nil
+}
+
+func (s *FirestoreStore) NextBreakGlassGrantID(ctx context.Context) (string, error) {
+	ids, err := s.collectIDs(ctx, s.breakGlass)
+	if err != nil {
+		return "", err
+	}
+	return nextIncrementingID("bg_", ids), nil
+}
+
+func (s *FirestoreStore) CreateReviewCampaign(ctx context.Context, campaign sharedpackage.ReviewCampaign) error {
+	if _, err := s.client.Collection(s.campaigns).Doc(campaign.ID).Create(ctx, campaign); err != nil {
+		return fmt.Errorf("Error creating review campaign: %v", err)
+	}
+	return nil
+}
+
+func (s *FirestoreStore) GetReviewCampaign(ctx context.Context, campaignID string) (*sharedpackage.ReviewCampaign, error) {
+	var campaign sharedpackage.ReviewCampaign
+	if err := s.getDoc(ctx, s.campaigns, campaignID, &campaign); err != nil {
+		return nil, err
+	}
+	campaign.ID = campaignID
+	return &campaign, nil
+}
+
+func (s *FirestoreStore) ListReviewCampaigns(ctx context.Context) ([]sharedpackage.ReviewCampaign, error) {
+	iter := s.client.Collection(s.campaigns).OrderBy("createdAt", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	var campaigns []sharedpackage.ReviewCampaign
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error iterating over review campaigns: %v", err)
+		}
+
+		var campaign sharedpackage.ReviewCampaign
+		if err := doc.DataTo(&campaign); err != nil {
+			return nil, fmt.Errorf("Error converting document data: %v", err)
+		}
+		campaign.ID = doc.Ref.ID
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, nil
+}
+
+// updateReviewCampaign applies change to the campaign in a transaction and
+// writes it back if change reports a modification.
+func (s *FirestoreStore) updateReviewCampaign(ctx context.Context, campaignID string, change func(*sharedpackage.ReviewCampaign) bool) (bool, error) {
+	changed := false
+	ref := s.client.Collection(s.campaigns).Doc(campaignID)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		changed = false
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			return err
+		}
+		var campaign sharedpackage.ReviewCampaign
+		if err := doc.DataTo(&campaign); err != nil {
+			return err
+		}
+		if !change(&campaign) {
+			return nil
+		}
+		changed = true
+		return tx.Set(ref, campaign)
+	})
+	return changed, err
+}
+
+func (s *FirestoreStore) DecideReviewItem(ctx context.Context, campaignID string, itemID string, from string, decision sharedpackage.ReviewDecision) (bool, error) {
+	decided, err := s.updateReviewCampaign(ctx, campaignID, func(campaign *sharedpackage.ReviewCampaign) bool {
+		for i, item := range campaign.Items {
+			if item.ID == itemID && item.Decision == from {
+				campaign.Items[i].ReviewDecision = decision
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return false, fmt.Errorf("Error deciding review item: %v", err)
+	}
+	return decided, nil
+}
+
+func (s *FirestoreStore) CloseReviewCampaign(ctx context.Context, campaignID string, closedAt time.Time) (bool, error) {
+	closed, err := s.updateReviewCampaign(ctx, campaignID, func(campaign *sharedpackage.ReviewCampaign) bool {
+		if campaign.Status != sharedpackage.CampaignOpen {
+			return false
+		}
+		campaign.Status = sharedpackage.CampaignClosed
+		campaign.ClosedAt = &closedAt
+		return true
+	})
+	if err != nil {
+		return false, fmt.Errorf("Error closing review campaign: %v", err)
+	}
+	return closed, nil
+}
+
+func (s *FirestoreStore) NextReviewCampaignID(ctx context.Context) (string, error) {
+	ids, err := s.collectIDs(ctx, s.campaigns)
+	if err != nil {
+		return "", err
+	}
+	return nextIncrementingID("rc_", ids), nil
+}
@@ -0,0 +1,787 @@
+package storage
+
+import (
+	"Task_04/sharedpackage"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore implements Store in process memory. It is safe for concurrent
+// use and hands out copies, so callers never share state with the store.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	employees   map[string]sharedpackage.Employee
+	departments map[string]sharedpackage.Department
+	teams       map[string]sharedpackage.Team
+	operations  map[string]sharedpackage.IAMOperation
+	tokens      map[string]sharedpackage.RefreshToken
+	passwords   map[string]sharedpackage.PasswordToken
+	requests    map[string]sharedpackage.RoleRequest
+	breakGlass  map[string]sharedpackage.BreakGlassGrant
+	campaigns   map[string]sharedpackage.ReviewCampaign
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		employees:   make(map[string]sharedpackage.Employee),
+		departments: make(map[string]sharedpackage.Department),
+		teams:       make(map[string]sharedpackage.Team),
+		operations:  make(map[string]sharedpackage.IAMOperation),
+		tokens:      make(map[string]sharedpackage.RefreshToken),
+		passwords:   make(map[string]sharedpackage.PasswordToken),
+		requests:    make(map[string]sharedpackage.RoleRequest),
+		breakGlass:  make(map[string]sharedpackage.BreakGlassGrant),
+		campaigns:   make(map[string]sharedpackage.ReviewCampaign),
+	}
+}
+
+// copyEmployee returns a deep copy of employee so map and slice fields are not shared.
+func copyEmployee(employee sharedpackage.Employee) sharedpackage.Employee {
+	if employee.IAMRoles != nil {
+		roles := make(map[string][]string, len(employee.IAMRoles))
+		for key, value := range employee.IAMRoles {
+			roles[key] = append([]string(nil), value...)
+		}
+		employee.IAMRoles = roles
+	}
+	if employee.TeamIDs != nil {
+		employee.TeamIDs = append([]string{}, employee.TeamIDs...)
+	}
+	if employee.RecoveryCodes != nil {
+		employee.RecoveryCodes = append([]string{}, employee.RecoveryCodes...)
+	}
+	if employee.RoleGrants != nil {
+		grants := make(map[string]map[string]sharedpackage.RoleGrant, len(employee.RoleGrants))
+		for key, value := range employee.RoleGrants {
+			grants[key] = make(map[string]sharedpackage.RoleGrant, len(value))
+			for role, grant := range value {
+				if grant.ExpiresAt != nil {
+					expiresAt := *grant.ExpiresAt
+					grant.ExpiresAt = &expiresAt
+				}
+				if grant.Condition != nil {
+					condition := *grant.Condition
+					grant.Condition = &condition
+				}
+				grants[key][role] = grant
+			}
+		}
+		employee.RoleGrants = grants
+	}
+	return employee
+}
+
+func copyOperation(op sharedpackage.IAMOperation) sharedpackage.IAMOperation {
+	op.Deltas = append([]sharedpackage.BindingDelta(nil), op.Deltas...)
+	return op
+}
+
+func copyDepartment(department sharedpackage.Department) sharedpackage.Department {
+	if department.IAMRoles != nil {
+		department.IAMRoles = append([]string{}, department.IAMRoles...)
+	}
+	if department.ProjectIDs != nil {
+		department.ProjectIDs = append([]string{}, department.ProjectIDs...)
+	}
+	return department
+}
+
+func copyTeam(team sharedpackage.Team) sharedpackage.Team {
+	if team.IAMRoles != nil {
+		team.IAMRoles = append([]string{}, team.IAMRoles...)
+	}
+	if team.ProjectIDs != nil {
+		team.ProjectIDs = append([]string{}, team.ProjectIDs...)
+	}
+	return team
+}
+
+// copyRoleRequest returns a copy of request that shares no slice or pointer.
+func copyRoleRequest(request sharedpackage.RoleRequest) sharedpackage.RoleRequest {
+	if request.Roles != nil {
+		request.Roles = append([]string{}, request.Roles...)
+	}
+	if request.DecidedAt != nil {
+		decidedAt := *request.DecidedAt
+		request.DecidedAt = &decidedAt
+	}
+	if request.ExpiresAt != nil {
+		expiresAt := *request.ExpiresAt
+		request.ExpiresAt = &expiresAt
+	}
+	return request
+}
+
+// copyBreakGlassGrant returns a copy of grant that shares no slice or pointer.
+func copyBreakGlassGrant(grant sharedpackage.BreakGlassGrant) sharedpackage.BreakGlassGrant {
+	if grant.Roles != nil {
+		grant.Roles = append([]string{}, grant.Roles...)
+	}
+	if grant.Review.ClosedAt != nil {
+		closedAt := *grant.Review.ClosedAt
+		grant.Review.ClosedAt = &closedAt
+	}
+	return grant
+}
+
+// copyReviewCampaign returns a copy of campaign that shares no slice or pointer.
+func copyReviewCampaign(campaign sharedpackage.ReviewCampaign) sharedpackage.ReviewCampaign {
+	if campaign.ClosedAt != nil {
+		closedAt := *campaign.ClosedAt
+		campaign.ClosedAt = &closedAt
+	}
+	if campaign.Items != nil {
+		items := make([]sharedpackage.ReviewItem, len(campaign.Items))
+		for i, item := range campaign.Items {
+			if item.DecidedAt != nil {
+				decidedAt := *item.DecidedAt
+				item.DecidedAt = &decidedAt
+			}
+			items[i] = item
+		}
+		campaign.Items = items
+	}
+	return campaign
+}
+
+// sortedKeys returns the keys of m in ascending order so listings are stable.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// filterEmployees returns copies of the employees matching keep, ordered by ID.
+func (s *MemoryStore) filterEmployees(keep func(sharedpackage.Employee) bool) []sharedpackage.Employee {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var employees []sharedpackage.Employee
+	for _, empID := range sortedKeys(s.employees) {
+		employee := s.employees[empID]
+		if keep(employee) {
+			employees = append(employees, copyEmployee(employee))
+		}
+	}
+	return employees
+}
+
+func (s *MemoryStore) GetEmployee(ctx context.Context, empID string) (*sharedpackage.Employee, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	employee, ok := s.employees[empID]
+	if !ok {
+		return nil, fmt.Errorf("employees/%s: %w", empID, ErrNotFound)
+	}
+	employee = copyEmployee(employee)
+	return &employee, nil
+}
+
+func (s *MemoryStore) PutEmployee(ctx context.Context, empID string, employee sharedpackage.Employee) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	employee = copyEmployee(employee)
+	employee.ID = empID
+	s.employees[empID] = employee
+	return nil
+}
+
+func (s *MemoryStore) DeleteEmployee(ctx context.Context, empID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.employees, empID)
+	return nil
+}
+
+func (s *MemoryStore) ListEmployees(ctx context.Context) ([]sharedpackage.Employee, error) {
+	return s.filterEmployees(func(sharedpackage.Employee) bool { return true }), nil
+}
+
+func (s *MemoryStore) FindEmployeesByDepartment(ctx context.Context, deptID string) ([]sharedpackage.Employee, error) {
+	return s.filterEmployees(func(employee sharedpackage.Employee) bool {
+		return employee.DeptID == deptID
+	}), nil
+}
+
+func (s *MemoryStore) FindEmployeesByTeam(ctx context.Context, teamID string) ([]sharedpackage.Employee, error) {
+	return s.filterEmployees(func(employee sharedpackage.Employee) bool {
+		for _, id := range employee.TeamIDs {
+			if id == teamID {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (s *MemoryStore) FindEmployeeByEmail(ctx context.Context, mail string) (*sharedpackage.Employee, error) {
+	employees := s.filterEmployees(func(employee sharedpackage.Employee) bool {
+		return employee.Email == mail
+	})
+	if len(employees) == 0 {
+		return nil, fmt.Errorf("employee with mailID %s: %w", mail, ErrNotFound)
+	}
+	return &employees[0], nil
+}
+
+func (s *MemoryStore) NextEmployeeID(ctx context.Context) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return nextIncrementingID("emp_", sortedKeys(s.employees)), nil
+}
+
+func (s *MemoryStore) UpdateEmployeeLockout(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	return s.updateEmployee(empID, withoutOperations(update), func(stored *sharedpackage.Employee, updated sharedpackage.Employee) {
+		stored.FailedLogins = updated.FailedLogins
+		stored.Lockouts = updated.Lockouts
+		stored.LockedUntil = updated.LockedUntil
+	})
+}
+
+func (s *MemoryStore) UpdateEmployeeMFA(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	return s.updateEmployee(empID, withoutOperations(update), func(stored *sharedpackage.Employee, updated sharedpackage.Employee) {
+		stored.MFAEnabled = updated.MFAEnabled
+		stored.MFASecret = updated.MFASecret
+		stored.MFALastStep = updated.MFALastStep
+		stored.RecoveryCodes = updated.RecoveryCodes
+	})
+}
+
+func (s *MemoryStore) UpdateEmployeePassword(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	return s.updateEmployee(empID, withoutOperations(update), func(stored *sharedpackage.Employee, updated sharedpackage.Employee) {
+		stored.Password = updated.Password
+		stored.FailedLogins = updated.FailedLogins
+		stored.Lockouts = updated.Lockouts
+		stored.LockedUntil = updated.LockedUntil
+	})
+}
+
+// updateEmployee applies update to a copy of the stored employee, lets apply
+// copy the fields update may change back and enqueues the ops update
+// returns, all under the write lock.
+func (s *MemoryStore) updateEmployee(empID string, update func(employee *sharedpackage.Employee) ([]sharedpackage.IAMOperation, error), apply func(stored *sharedpackage.Employee, updated sharedpackage.Employee)) (*sharedpackage.Employee, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.employees[empID]
+	if !ok {
+		return nil, fmt.Errorf("employees/%s: %w", empID, ErrNotFound)
+	}
+	employee := copyEmployee(stored)
+	ops, err := update(&employee)
+	if err != nil {
+		return nil, err
+	}
+	apply(&stored, copyEmployee(employee))
+	s.employees[empID] = stored
+	s.queueOperations(ops)
+
+	employee = copyEmployee(stored)
+	return &employee, nil
+}
+
+func (s *MemoryStore) GetDepartment(ctx context.Context, deptID string) (*sharedpackage.Department, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	department, ok := s.departments[deptID]
+	if !ok {
+		return nil, fmt.Errorf("departments/%s: %w", deptID, ErrNotFound)
+	}
+	department = copyDepartment(department)
+	return &department, nil
+}
+
+func (s *MemoryStore) PutDepartment(ctx context.Context, deptID string, department sharedpackage.Department) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	department = copyDepartment(department)
+	department.ID = deptID
+	s.departments[deptID] = department
+	return nil
+}
+
+func (s *MemoryStore) DeleteDepartment(ctx context.Context, deptID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.departments, deptID)
+	return nil
+}
+
+func (s *MemoryStore) ListDepartments(ctx context.Context) ([]sharedpackage.Department, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var departments []sharedpackage.Department
+	for _, deptID := range sortedKeys(s.departments) {
+		departments = append(departments, copyDepartment(s.departments[deptID]))
+	}
+	return departments, nil
+}
+
+func (s *MemoryStore) NextDepartmentID(ctx context.Context) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return nextIncrementingID("dept_", sortedKeys(s.departments)), nil
+}
+
+func (s *MemoryStore) GetTeam(ctx context.Context, teamID string) (*sharedpackage.Team, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	team, ok := s.teams[teamID]
+	if !ok {
+		return nil, fmt.Errorf("teams/%s: %w", teamID, ErrNotFound)
+	}
+	team = copyTeam(team)
+	return &team, nil
+}
+
+func (s *MemoryStore) PutTeam(ctx context.Context, teamID string, team sharedpackage.Team) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team = copyTeam(team)
+	team.ID = teamID
+	s.teams[teamID] = team
+	return nil
+}
+
+func (s *MemoryStore) DeleteTeam(ctx context.Context, teamID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.teams, teamID)
+	return nil
+}
+
+func (s *MemoryStore) ListTeams(ctx context.Context) ([]sharedpackage.Team, error) {
+	return s.filterTeams(func(sharedpackage.Team) bool { return true }), nil
+}
+
+func (s *MemoryStore) FindTeamsByDepartment(ctx context.Context, deptID string) ([]sharedpackage.Team, error) {
+	return s.filterTeams(func(team sharedpackage.Team) bool {
+		return team.DepartmentID == deptID
+	}), nil
+}
+
+// filterTeams returns copies of the teams matching keep, ordered by ID.
+func (s *MemoryStore) filterTeams(keep func(sharedpackage.Team) bool) []sharedpackage.Team {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var teams []sharedpackage.Team
+	for _, teamID := range sortedKeys(s.teams) {
+		team := s.teams[teamID]
+		if keep(team) {
+			teams = append(teams, copyTeam(team))
+		}
+	}
+	return teams
+}
+
+func (s *MemoryStore) NextTeamID(ctx context.Context) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return nextIncrementingID("team_", sortedKeys(s.teams)), nil
+}
+
+func (s *MemoryStore) PutEmployeeWithOperations(ctx context.Context, empID string, employee sharedpackage.Employee, ops []sharedpackage.IAMOperation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	employee = copyEmployee(employee)
+	employee.ID = empID
+	s.employees[empID] = employee
+
+	s.queueOperations(ops)
+	return nil
+}
+
+func (s *MemoryStore) UpdateEmployeeRolesWithOperations(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) ([]sharedpackage.IAMOperation, error)) (*sharedpackage.Employee, error) {
+	return s.updateEmployee(empID, update, func(stored *sharedpackage.Employee, updated sharedpackage.Employee) {
+		stored.Role = updated.Role
+		stored.DeptID = updated.DeptID
+		stored.TeamIDs = updated.TeamIDs
+		stored.IAMRoles = updated.IAMRoles
+		stored.RoleGrants = updated.RoleGrants
+	})
+}
+
+// queueOperations enqueues the ops that carry deltas; s.mu must be held.
+func (s *MemoryStore) queueOperations(ops []sharedpackage.IAMOperation) {
+	for _, op := range queueOperations(ops) {
+		s.operations[op.ID] = copyOperation(op)
+	}
+}
+
+func (s *MemoryStore) PendingOperations(ctx context.Context, limit int) ([]sharedpackage.IAMOperation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ops []sharedpackage.IAMOperation
+	for _, opID := range sortedKeys(s.operations) {
+		if len(ops) == limit {
+			break
+		}
+		if op := s.operations[opID]; op.Status == sharedpackage.OperationPending {
+			ops = append(ops, copyOperation(op))
+		}
+	}
+	return ops, nil
+}
+
+func (s *MemoryStore) CompleteOperations(ctx context.Context, opIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, opID := range opIDs {
+		op, ok := s.operations[opID]
+		if !ok {
+			return fmt.Errorf("iamOperations/%s: %w", opID, ErrNotFound)
+		}
+		op.Status = sharedpackage.OperationDone
+		op.UpdatedAt = now
+		s.operations[opID] = op
+	}
+	return nil
+}
+
+func (s *MemoryStore) FailOperation(ctx context.Context, opID string, lastError string, permanent bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	op, ok := s.operations[opID]
+	if !ok {
+		return fmt.Errorf("iamOperations/%s: %w", opID, ErrNotFound)
+	}
+	op.Attempts++
+	op.LastError = lastError
+	op.UpdatedAt = time.Now().UTC()
+	if permanent {
+		op.Status = sharedpackage.OperationFailed
+	}
+	s.operations[opID] = op
+	return nil
+}
+
+func (s *MemoryStore) CreateRefreshToken(ctx context.Context, token sharedpackage.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.tokens[token.ID]; exists {
+		return fmt.Errorf("refreshTokens/%s already exists", token.ID)
+	}
+	s.tokens[token.ID] = token
+	return nil
+}
+
+func (s *MemoryStore) GetRefreshToken(ctx context.Context, tokenID string) (*sharedpackage.RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.tokens[tokenID]
+	if !ok {
+		return nil, fmt.Errorf("refreshTokens/%s: %w", tokenID, ErrNotFound)
+	}
+	return &token, nil
+}
+
+func (s *MemoryStore) RevokeRefreshToken(ctx context.Context, tokenID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenID]
+	if !ok || token.Revoked {
+		return false, nil
+	}
+	token.Revoked = true
+	s.tokens[tokenID] = token
+	return true, nil
+}
+
+func (s *MemoryStore) RevokeEmployeeRefreshTokens(ctx context.Context, empID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenID, token := range s.tokens {
+		if token.EmployeeID == empID && !token.Revoked {
+			token.Revoked = true
+			s.tokens[tokenID] = token
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) CreatePasswordToken(ctx context.Context, token sharedpackage.PasswordToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.passwords[token.ID]; exists {
+		return fmt.Errorf("passwordTokens/%s already exists", token.ID)
+	}
+	s.passwords[token.ID] = token
+	return nil
+}
+
+func (s *MemoryStore) GetPasswordToken(ctx context.Context, tokenID string) (*sharedpackage.PasswordToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.passwords[tokenID]
+	if !ok {
+		return nil, fmt.Errorf("passwordTokens/%s: %w", tokenID, ErrNotFound)
+	}
+	return &token, nil
+}
+
+func (s *MemoryStore) UsePasswordToken(ctx context.Context, tokenID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.passwords[tokenID]
+	if !ok || token.Used {
+		return false, nil
+	}
+	token.Used = true
+	s.passwords[tokenID] = token
+	return true, nil
+}
+
+func (s *MemoryStore) UseEmployeePasswordTokens(ctx context.Context, empID string, purpose string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenID, token := range s.passwords {
+		if token.EmployeeID == empID && !token.Used && (purpose == "" || token.Purpose == purpose) {
+			token.Used = true
+			s.passwords[tokenID] = token
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) CountPasswordTokens(ctx context.Context, empID string, purpose string, since time.Time) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, token := range s.passwords {
+		if token.EmployeeID == empID && token.Purpose == purpose && !token.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) CreateRoleRequest(ctx context.Context, request sharedpackage.RoleRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.requests[request.ID]; exists {
+		return fmt.Errorf("roleRequests/%s already exists", request.ID)
+	}
+	s.requests[request.ID] = copyRoleRequest(request)
+	return nil
+}
+
+func (s *MemoryStore) GetRoleRequest(ctx context.Context, requestID string) (*sharedpackage.RoleRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	request, ok := s.requests[requestID]
+	if !ok {
+		return nil, fmt.Errorf("roleRequests/%s: %w", requestID, ErrNotFound)
+	}
+	request = copyRoleRequest(request)
+	return &request, nil
+}
+
+func (s *MemoryStore) ListRoleRequests(ctx context.Context) ([]sharedpackage.RoleRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	requests := make([]sharedpackage.RoleRequest, 0, len(s.requests))
+	for _, requestID := range sortedKeys(s.requests) {
+		requests = append(requests, copyRoleRequest(s.requests[requestID]))
+	}
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+	})
+	return requests, nil
+}
+
+func (s *MemoryStore) DecideRoleRequest(ctx context.Context, requestID string, from string, decision sharedpackage.RoleDecision) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, ok := s.requests[requestID]
+	if !ok || request.Status != from {
+		return false, nil
+	}
+	request.RoleDecision = decision
+	s.requests[requestID] = copyRoleRequest(request)
+	return true, nil
+}
+
+func (s *MemoryStore) NextRoleRequestID(ctx context.Context) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return nextIncrementingID("req_", sortedKeys(s.requests)), nil
+}
+
+func (s *MemoryStore) CreateBreakGlassGrant(ctx context.Context, grant sharedpackage.BreakGlassGrant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.breakGlass[grant.ID]; exists {
+		return fmt.Errorf("breakGlassGrants/%s already exists", grant.ID)
+	}
+	s.breakGlass[grant.ID] = copyBreakGlassGrant(grant)
+	return nil
+}
+
+func (s *MemoryStore) GetBreakGlassGrant(ctx context.Context, grantID string) (*sharedpackage.BreakGlassGrant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	grant, ok := s.breakGlass[grantID]
+	if !ok {
+		return nil, fmt.Errorf("breakGlassGrants/%s: %w", grantID, ErrNotFound)
+	}
+	grant = copyBreakGlassGrant(grant)
+	return &grant, nil
+}
+
+func (s *MemoryStore) ListBreakGlassGrants(ctx context.Context) ([]sharedpackage.BreakGlassGrant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	grants := make([]sharedpackage.BreakGlassGrant, 0, len(s.breakGlass))
+	for _, grantID := range sortedKeys(s.breakGlass) {
+		grants = append(grants, copyBreakGlassGrant(s.breakGlass[grantID]))
+	}
+	sort.SliceStable(grants, func(i, j int) bool {
+		return grants[i].GrantedAt.Before(grants[j].GrantedAt)
+	})
+	return grants, nil
+}
+
+func (s *MemoryStore) CloseBreakGlassReview(ctx context.Context, grantID string, review sharedpackage.BreakGlassReview) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	grant, ok := s.breakGlass[grantID]
+	if !ok || grant.Review.Status != sharedpackage.ReviewOpen {
+		return false, nil
+	}
+	grant.Review = review
+	s.breakGlass[grantID] = copyBreakGlassGrant(grant)
+	return true, nil
+}
+
+func (s *MemoryStore) NextBreakGlassGrantID(ctx context.Context) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return nextIncrementingID("bg_", sortedKeys(s.breakGlass)), nil
+}
+
+func (s *MemoryStore) CreateReviewCampaign(ctx context.Context, campaign sharedpackage.ReviewCampaign) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.campaigns[campaign.ID]; exists {
+		return fmt.Errorf("reviewCampaigns/%s already exists", campaign.ID)
+	}
+	s.campaigns[campaign.ID] = copyReviewCampaign(campaign)
+	return nil
+}
+
+func (s *MemoryStore) GetReviewCampaign(ctx context.Context, campaignID string) (*sharedpackage.ReviewCampaign, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	campaign, ok := s.campaigns[campaignID]
+	if !ok {
+		return nil, fmt.Errorf("reviewCampaigns/%s: %w", campaignID, ErrNotFound)
+	}
+	campaign = copyReviewCampaign(campaign)
+	return &campaign, nil
+}
+
+func (s *MemoryStore) ListReviewCampaigns(ctx context.Context) ([]sharedpackage.ReviewCampaign, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	campaigns := make([]sharedpackage.ReviewCampaign, 0, len(s.campaigns))
+	for _, campaignID := range sortedKeys(s.campaigns) {
+		campaigns = append(campaigns, copyReviewCampaign(s.campaigns[campaignID]))
+	}
+	sort.SliceStable(campaigns, func(i, j int) bool {
+		return campaigns[i].CreatedAt.Before(campaigns[j].CreatedAt)
+	})
+	return campaigns, nil
+}
+
+func (s *MemoryStore) DecideReviewItem(ctx context.Context, campaignID string, itemID string, from string, decision sharedpackage.ReviewDecision) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	campaign, ok := s.campaigns[campaignID]
+	if !ok {
+		return false, nil
+	}
+	for i, item := range campaign.Items {
+		if item.ID == itemID {
+			if item.Decision != from {
+				return false, nil
+			}
+			campaign = copyReviewCampaign(campaign)
+			campaign.Items[i].ReviewDecision = decision
+			s.campaigns[campaignID] = copyReviewCampaign(campaign)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) CloseReviewCampaign(ctx context.Context, campaignID string, closedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	campaign, ok := s.campaigns[campaignID]
+	if !ok || campaign.Status != sharedpackage.CampaignOpen {
+		return false, nil
+	}
+	campaign.Status = sharedpackage.CampaignClosed
+	campaign.ClosedAt = &closedAt
+	s.campaigns[campaignID] = copyReviewCampaign(campaign)
+	return true, nil
+}
+
+func (s *MemoryStore) NextReviewCampaignID(ctx context.Context) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return nextIncrementingID("rc_", sortedKeys(s.campaigns)), nil
+}
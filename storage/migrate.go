@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is one versioned schema change with its up and down scripts.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// loadMigrations reads the embedded NNNN_name.up.sql / NNNN_name.down.sql
+// pairs and returns them ordered by version.
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		versionStr, name, ok := strings.Cut(fileName, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name.%s.sql", fileName, direction)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %v", fileName, err)
+		}
+
+		body, err := migrationFiles.ReadFile("migrations/" + fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: strings.TrimSuffix(name, "."+direction+".sql")}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s: both up and down scripts are required", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// SchemaVersion returns the highest applied migration version, or 0 for an empty database.
+func (s *SQLStore) SchemaVersion(ctx context.Context) (int, error) {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return 0, fmt.Errorf("Failed to create schema_migrations: %v", err)
+	}
+
+	var version sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("Failed to read schema version: %v", err)
+	}
+	return int(version.Int64), nil
+}
+
+// Migrate applies every pending up migration.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		return nil
+	}
+	return s.MigrateTo(ctx, migrations[len(migrations)-1].version)
+}
+
+// MigrateTo moves the schema up or down to the given version. Each migration
+// runs in its own transaction together with its schema_migrations bookkeeping.
+func (s *SQLStore) MigrateTo(ctx context.Context, target int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	current, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if target >= current {
+		for _, m := range migrations {
+			if m.version <= current || m.version > target {
+				continue
+			}
+			log.Printf("INFO: Applying migration %04d_%s", m.version, m.name)
+			if err := s.runMigration(ctx, m.up, `INSERT INTO schema_migrations (version) VALUES (?)`, m.version); err != nil {
+				return fmt.Errorf("migration %04d_%s up: %v", m.version, m.name, err)
+			}
+		}
+		return nil
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version > current || m.version <= target {
+			continue
+		}
+		log.Printf("INFO: Reverting migration %04d_%s", m.version, m.name)
+		if err := s.runMigration(ctx, m.down, `DELETE FROM schema_migrations WHERE version = ?`, m.version); err != nil {
+			return fmt.Errorf("migration %04d_%s down: %v", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// runMigration executes script and the bookkeeping statement in one transaction.
+func (s *SQLStore) runMigration(ctx context.Context, script, bookkeeping string, version int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(bookkeeping), version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,7 @@
+DROP TABLE employee_iam_roles;
+DROP TABLE employee_teams;
+DROP TABLE employees;
+DROP TABLE team_iam_roles;
+DROP TABLE teams;
+DROP TABLE department_iam_roles;
+DROP TABLE departments;
@@ -0,0 +1,71 @@
+-- Departments, teams and employees with their IAM roles and team memberships
+-- normalized into join tables. Foreign keys keep employees from pointing at
+-- departments or teams that no longer exist.
+
+CREATE TABLE departments (
+	id              TEXT PRIMARY KEY,
+	department_name TEXT NOT NULL DEFAULT '',
+	head_id         TEXT NOT NULL DEFAULT '',
+	created_time    TEXT NOT NULL DEFAULT '',
+	updated_time    TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE department_iam_roles (
+	department_id TEXT    NOT NULL REFERENCES departments (id) ON DELETE CASCADE,
+	position      INTEGER NOT NULL,
+	role          TEXT    NOT NULL,
+	PRIMARY KEY (department_id, position)
+);
+
+-- A team may exist without a department (department_id NULL). Deleting a
+-- department that still owns teams is refused.
+CREATE TABLE teams (
+	id            TEXT PRIMARY KEY,
+	team_name     TEXT NOT NULL DEFAULT '',
+	lead_id       TEXT NOT NULL DEFAULT '',
+	department_id TEXT REFERENCES departments (id) ON DELETE RESTRICT,
+	created_time  TEXT NOT NULL DEFAULT '',
+	updated_time  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX teams_department_id ON teams (department_id);
+
+CREATE TABLE team_iam_roles (
+	team_id  TEXT    NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	role     TEXT    NOT NULL,
+	PRIMARY KEY (team_id, position)
+);
+
+-- Deleting a department detaches its employees instead of leaving a dangling ID.
+CREATE TABLE employees (
+	id            TEXT PRIMARY KEY,
+	first_name    TEXT NOT NULL DEFAULT '',
+	last_name     TEXT NOT NULL DEFAULT '',
+	mail_id       TEXT NOT NULL DEFAULT '',
+	password      TEXT NOT NULL DEFAULT '',
+	role          TEXT NOT NULL DEFAULT '',
+	department_id TEXT REFERENCES departments (id) ON DELETE SET NULL
+);
+
+CREATE INDEX employees_mail_id ON employees (mail_id);
+CREATE INDEX employees_department_id ON employees (department_id);
+
+-- Deleting a team removes it from every employee's teamIDs.
+CREATE TABLE employee_teams (
+	employee_id TEXT    NOT NULL REFERENCES employees (id) ON DELETE CASCADE,
+	team_id     TEXT    NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+	position    INTEGER NOT NULL,
+	PRIMARY KEY (employee_id, team_id)
+);
+
+CREATE INDEX employee_teams_team_id ON employee_teams (team_id);
+
+-- One row per role of an iamRoles group. group_key is a department or team ID.
+CREATE TABLE employee_iam_roles (
+	employee_id TEXT    NOT NULL REFERENCES employees (id) ON DELETE CASCADE,
+	group_key   TEXT    NOT NULL,
+	position    INTEGER NOT NULL,
+	role        TEXT    NOT NULL,
+	PRIMARY KEY (employee_id, group_key, position)
+);
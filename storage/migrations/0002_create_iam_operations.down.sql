@@ -0,0 +1 @@
+DROP TABLE iam_operations;
@@ -0,0 +1,17 @@
+-- Outbox of IAM policy changes. A row is inserted in the same transaction as
+-- the employee change that caused it and applied by the reconciler, which
+-- marks it done. Rows outlive the employee, so there is no foreign key.
+
+CREATE TABLE iam_operations (
+	id          TEXT    PRIMARY KEY,
+	project_id  TEXT    NOT NULL,
+	employee_id TEXT    NOT NULL DEFAULT '',
+	deltas      TEXT    NOT NULL,
+	status      TEXT    NOT NULL,
+	attempts    INTEGER NOT NULL DEFAULT 0,
+	last_error  TEXT    NOT NULL DEFAULT '',
+	created_at  TEXT    NOT NULL,
+	updated_at  TEXT    NOT NULL
+);
+
+CREATE INDEX iam_operations_status ON iam_operations (status, id);
@@ -0,0 +1,3 @@
+ALTER TABLE employees DROP COLUMN locked_until;
+ALTER TABLE employees DROP COLUMN lockouts;
+ALTER TABLE employees DROP COLUMN failed_logins;
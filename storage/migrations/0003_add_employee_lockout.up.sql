@@ -0,0 +1,6 @@
+-- Failed login tracking for account lockout. locked_until is an RFC 3339
+-- timestamp, empty while the account is not locked.
+
+ALTER TABLE employees ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE employees ADD COLUMN lockouts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE employees ADD COLUMN locked_until TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+-- Refresh tokens of employee sessions, keyed by the SHA-256 hash of the token
+-- handed to the client. Revoked rows are kept so that reuse of a rotated
+-- token can be detected.
+
+CREATE TABLE refresh_tokens (
+	id          TEXT    PRIMARY KEY,
+	employee_id TEXT    NOT NULL,
+	created_at  TEXT    NOT NULL,
+	expires_at  TEXT    NOT NULL,
+	revoked     INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX refresh_tokens_employee_id ON refresh_tokens (employee_id);
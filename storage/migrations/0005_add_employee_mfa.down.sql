@@ -0,0 +1,4 @@
+ALTER TABLE employees DROP COLUMN recovery_codes;
+ALTER TABLE employees DROP COLUMN mfa_last_step;
+ALTER TABLE employees DROP COLUMN mfa_secret;
+ALTER TABLE employees DROP COLUMN mfa_enabled;
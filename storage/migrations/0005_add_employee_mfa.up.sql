@@ -0,0 +1,7 @@
+-- TOTP multi-factor authentication. recovery_codes is a JSON array of
+-- SHA-256 hashes, empty when the employee has none.
+
+ALTER TABLE employees ADD COLUMN mfa_enabled INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE employees ADD COLUMN mfa_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE employees ADD COLUMN mfa_last_step BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE employees ADD COLUMN recovery_codes TEXT NOT NULL DEFAULT '';
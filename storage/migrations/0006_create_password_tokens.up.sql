@@ -0,0 +1,13 @@
+-- Single-use tokens of password invites and resets, keyed by the SHA-256
+-- hash of the token sent to the employee.
+
+CREATE TABLE password_tokens (
+	id          TEXT    PRIMARY KEY,
+	employee_id TEXT    NOT NULL,
+	purpose     TEXT    NOT NULL,
+	created_at  TEXT    NOT NULL,
+	expires_at  TEXT    NOT NULL,
+	used        INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX password_tokens_employee_id ON password_tokens (employee_id);
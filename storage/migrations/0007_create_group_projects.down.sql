@@ -0,0 +1,2 @@
+DROP TABLE team_projects;
+DROP TABLE department_projects;
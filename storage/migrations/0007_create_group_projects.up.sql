@@ -0,0 +1,16 @@
+-- The GCP projects a department's or team's IAM roles are granted in, in
+-- the order they were given. A team without rows uses its department's.
+
+CREATE TABLE department_projects (
+	department_id TEXT    NOT NULL REFERENCES departments (id) ON DELETE CASCADE,
+	position      INTEGER NOT NULL,
+	project_id    TEXT    NOT NULL,
+	PRIMARY KEY (department_id, position)
+);
+
+CREATE TABLE team_projects (
+	team_id    TEXT    NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+	position   INTEGER NOT NULL,
+	project_id TEXT    NOT NULL,
+	PRIMARY KEY (team_id, position)
+);
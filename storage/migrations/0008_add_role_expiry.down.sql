@@ -0,0 +1 @@
+ALTER TABLE employee_iam_roles DROP COLUMN expires_at;
@@ -0,0 +1,4 @@
+-- Time-bound IAM grants. expires_at is RFC 3339, empty when the role is
+-- granted indefinitely.
+
+ALTER TABLE employee_iam_roles ADD COLUMN expires_at TEXT NOT NULL DEFAULT '';
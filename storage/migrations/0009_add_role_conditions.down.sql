@@ -0,0 +1,3 @@
+ALTER TABLE employee_iam_roles DROP COLUMN condition_description;
+ALTER TABLE employee_iam_roles DROP COLUMN condition_title;
+ALTER TABLE employee_iam_roles DROP COLUMN condition_expression;
@@ -0,0 +1,6 @@
+-- IAM Conditions of employee grants. All three columns are empty when the
+-- role is granted without a condition.
+
+ALTER TABLE employee_iam_roles ADD COLUMN condition_expression TEXT NOT NULL DEFAULT '';
+ALTER TABLE employee_iam_roles ADD COLUMN condition_title TEXT NOT NULL DEFAULT '';
+ALTER TABLE employee_iam_roles ADD COLUMN condition_description TEXT NOT NULL DEFAULT '';
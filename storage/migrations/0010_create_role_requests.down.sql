@@ -0,0 +1,2 @@
+DROP TABLE role_request_roles;
+DROP TABLE role_requests;
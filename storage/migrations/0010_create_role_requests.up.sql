@@ -0,0 +1,28 @@
+-- Employees' requests for IAM roles and the decisions on them. Requests are
+-- kept after their employee is deleted, as a history of who granted what.
+-- decided_at and expires_at are empty until set.
+
+CREATE TABLE role_requests (
+	id            TEXT PRIMARY KEY,
+	employee_id   TEXT NOT NULL,
+	department_id TEXT NOT NULL,
+	team_id       TEXT NOT NULL DEFAULT '',
+	justification TEXT NOT NULL,
+	duration      TEXT NOT NULL DEFAULT '',
+	approver_id   TEXT NOT NULL DEFAULT '',
+	created_at    TEXT NOT NULL,
+	status        TEXT NOT NULL,
+	decided_by    TEXT NOT NULL DEFAULT '',
+	decided_at    TEXT NOT NULL DEFAULT '',
+	comment       TEXT NOT NULL DEFAULT '',
+	expires_at    TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX role_requests_employee_id ON role_requests (employee_id);
+
+CREATE TABLE role_request_roles (
+	request_id TEXT    NOT NULL REFERENCES role_requests (id) ON DELETE CASCADE,
+	position   INTEGER NOT NULL,
+	role       TEXT    NOT NULL,
+	PRIMARY KEY (request_id, position)
+);
@@ -0,0 +1,2 @@
+DROP TABLE break_glass_roles;
+DROP TABLE break_glass_grants;
@@ -0,0 +1,25 @@
+-- Emergency access granted without approval, and the post-incident review
+-- of each grant. closed_at is empty while the review is open.
+
+CREATE TABLE break_glass_grants (
+	id            TEXT PRIMARY KEY,
+	employee_id   TEXT NOT NULL,
+	granted_by    TEXT NOT NULL,
+	team_id       TEXT NOT NULL,
+	justification TEXT NOT NULL,
+	granted_at    TEXT NOT NULL,
+	expires_at    TEXT NOT NULL,
+	review_status TEXT NOT NULL,
+	closed_by     TEXT NOT NULL DEFAULT '',
+	closed_at     TEXT NOT NULL DEFAULT '',
+	notes         TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX break_glass_grants_review_status ON break_glass_grants (review_status);
+
+CREATE TABLE break_glass_roles (
+	grant_id TEXT    NOT NULL REFERENCES break_glass_grants (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	role     TEXT    NOT NULL,
+	PRIMARY KEY (grant_id, position)
+);
@@ -0,0 +1,33 @@
+-- Access recertification campaigns and one item per role under review.
+-- closed_at and decided_at are empty until the campaign closes or the item
+-- is decided.
+
+CREATE TABLE review_campaigns (
+	id            TEXT    PRIMARY KEY,
+	name          TEXT    NOT NULL,
+	department_id TEXT    NOT NULL,
+	team_id       TEXT    NOT NULL DEFAULT '',
+	deadline      TEXT    NOT NULL,
+	auto_revoke   INTEGER NOT NULL DEFAULT 0,
+	created_by    TEXT    NOT NULL,
+	created_at    TEXT    NOT NULL,
+	status        TEXT    NOT NULL,
+	closed_at     TEXT    NOT NULL DEFAULT ''
+);
+
+CREATE INDEX review_campaigns_status ON review_campaigns (status);
+
+CREATE TABLE review_items (
+	campaign_id TEXT    NOT NULL REFERENCES review_campaigns (id) ON DELETE CASCADE,
+	id          TEXT    NOT NULL,
+	position    INTEGER NOT NULL,
+	employee_id TEXT    NOT NULL,
+	group_key   TEXT    NOT NULL,
+	role        TEXT    NOT NULL,
+	reviewer_id TEXT    NOT NULL DEFAULT '',
+	decision    TEXT    NOT NULL,
+	decided_by  TEXT    NOT NULL DEFAULT '',
+	decided_at  TEXT    NOT NULL DEFAULT '',
+	comment     TEXT    NOT NULL DEFAULT '',
+	PRIMARY KEY (campaign_id, id)
+);
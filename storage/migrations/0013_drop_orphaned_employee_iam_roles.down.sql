@@ -0,0 +1,2 @@
+-- The dropped rows named groups that no longer exist; there is nothing to restore.
+SELECT 1;
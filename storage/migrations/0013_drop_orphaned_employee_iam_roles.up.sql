@@ -0,0 +1,10 @@
+-- employee_iam_roles.group_key names a department or team without a foreign
+-- key, so deleting a group used to leave its rows behind, and the roles
+-- came back in the default project whenever the employee was rebound.
+-- Deleting a group now removes its rows (see SQLStore.DeleteDepartment and
+-- DeleteTeam); this drops those left by earlier deletes. Bindings they
+-- still hold show up as extra in the drift report.
+
+DELETE FROM employee_iam_roles
+WHERE (group_key LIKE 'dept\_%' ESCAPE '\' AND group_key NOT IN (SELECT id FROM departments))
+   OR (group_key LIKE 'team\_%' ESCAPE '\' AND group_key NOT IN (SELECT id FROM teams));
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"Task_04/sharedpackage"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Document change actions.
+const (
+	DocumentCreate = "create"
+	DocumentUpdate = "update"
+	DocumentDelete = "delete"
+)
+
+// DocumentChange describes how one document differs between two stores.
+type DocumentChange struct {
+	Collection string      `json:"collection"`
+	DocumentID string      `json:"documentID"`
+	Action     string      `json:"action"`
+	Before     interface{} `json:"before,omitempty"`
+	After      interface{} `json:"after,omitempty"`
+}
+
+// Snapshot copies every employee, department and team into a new
+// ScratchStore. Changes made to the copy never reach the original stores,
+// which is how dry runs execute the real business rules without applying
+// anything.
+func Snapshot(ctx context.Context, employees EmployeeStore, departments DepartmentStore, teams TeamStore) (*ScratchStore, error) {
+	snapshot := &ScratchStore{
+		MemoryStore: NewMemoryStore(),
+		employees:   make(map[string]*sharedpackage.Employee),
+		departments: make(map[string]*sharedpackage.Department),
+		teams:       make(map[string]*sharedpackage.Team),
+	}
+
+	employeeList, err := employees.ListEmployees(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to copy employees: %w", err)
+	}
+	for _, employee := range employeeList {
+		snapshot.MemoryStore.employees[employee.ID] = copyEmployee(employee)
+	}
+
+	departmentList, err := departments.ListDepartments(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to copy departments: %w", err)
+	}
+	for _, department := range departmentList {
+		snapshot.MemoryStore.departments[department.ID] = copyDepartment(department)
+	}
+
+	teamList, err := teams.ListTeams(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to copy teams: %w", err)
+	}
+	for _, team := range teamList {
+		snapshot.MemoryStore.teams[team.ID] = copyTeam(team)
+	}
+
+	return snapshot, nil
+}
+
+// ScratchStore is a MemoryStore that remembers the original of every
+// employee, department and team it writes, so Changes can report what a dry
+// run changed without keeping a second copy of the collections. A nil
+// original means the document did not exist.
+type ScratchStore struct {
+	*MemoryStore
+
+	originalsMu sync.Mutex
+	employees   map[string]*sharedpackage.Employee
+	departments map[string]*sharedpackage.Department
+	teams       map[string]*sharedpackage.Team
+}
+
+var _ Store = (*ScratchStore)(nil)
+
+func (s *ScratchStore) PutEmployee(ctx context.Context, empID string, employee sharedpackage.Employee) error {
+	s.rememberEmployee(empID)
+	return s.MemoryStore.PutEmployee(ctx, empID, employee)
+}
+
+func (s *ScratchStore) DeleteEmployee(ctx context.Context, empID string) error {
+	s.rememberEmployee(empID)
+	return s.MemoryStore.DeleteEmployee(ctx, empID)
+}
+
+func (s *ScratchStore) UpdateEmployeeLockout(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	s.rememberEmployee(empID)
+	return s.MemoryStore.UpdateEmployeeLockout(ctx, empID, update)
+}
+
+func (s *ScratchStore) UpdateEmployeeMFA(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	s.rememberEmployee(empID)
+	return s.MemoryStore.UpdateEmployeeMFA(ctx, empID, update)
+}
+
+func (s *ScratchStore) UpdateEmployeePassword(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	s.rememberEmployee(empID)
+	return s.MemoryStore.UpdateEmployeePassword(ctx, empID, update)
+}
+
+func (s *ScratchStore) PutEmployeeWithOperations(ctx context.Context, empID string, employee sharedpackage.Employee, ops []sharedpackage.IAMOperation) error {
+	s.rememberEmployee(empID)
+	return s.MemoryStore.PutEmployeeWithOperations(ctx, empID, employee, ops)
+}
+
+func (s *ScratchStore) UpdateEmployeeRolesWithOperations(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) ([]sharedpackage.IAMOperation, error)) (*sharedpackage.Employee, error) {
+	s.rememberEmployee(empID)
+	return s.MemoryStore.UpdateEmployeeRolesWithOperations(ctx, empID, update)
+}
+
+func (s *ScratchStore) PutDepartment(ctx context.Context, deptID string, department sharedpackage.Department) error {
+	s.rememberDepartment(deptID)
+	return s.MemoryStore.PutDepartment(ctx, deptID, department)
+}
+
+func (s *ScratchStore) DeleteDepartment(ctx context.Context, deptID string) error {
+	s.rememberDepartment(deptID)
+	return s.MemoryStore.DeleteDepartment(ctx, deptID)
+}
+
+func (s *ScratchStore) PutTeam(ctx context.Context, teamID string, team sharedpackage.Team) error {
+	s.rememberTeam(teamID)
+	return s.MemoryStore.PutTeam(ctx, teamID, team)
+}
+
+func (s *ScratchStore) DeleteTeam(ctx context.Context, teamID string) error {
+	s.rememberTeam(teamID)
+	return s.MemoryStore.DeleteTeam(ctx, teamID)
+}
+
+func (s *ScratchStore) rememberEmployee(empID string) {
+	s.originalsMu.Lock()
+	defer s.originalsMu.Unlock()
+	s.MemoryStore.mu.RLock()
+	defer s.MemoryStore.mu.RUnlock()
+
+	rememberDocument(s.employees, s.MemoryStore.employees, empID, copyEmployee)
+}
+
+func (s *ScratchStore) rememberDepartment(deptID string) {
+	s.originalsMu.Lock()
+	defer s.originalsMu.Unlock()
+	s.MemoryStore.mu.RLock()
+	defer s.MemoryStore.mu.RUnlock()
+
+	rememberDocument(s.departments, s.MemoryStore.departments, deptID, copyDepartment)
+}
+
+func (s *ScratchStore) rememberTeam(teamID string) {
+	s.originalsMu.Lock()
+	defer s.originalsMu.Unlock()
+	s.MemoryStore.mu.RLock()
+	defer s.MemoryStore.mu.RUnlock()
+
+	rememberDocument(s.teams, s.MemoryStore.teams, teamID, copyTeam)
+}
+
+// rememberDocument records a copy of the stored document as its original
+// unless an earlier write already did.
+func rememberDocument[V any](originals map[string]*V, stored map[string]V, id string, copyValue func(V) V) {
+	if _, seen := originals[id]; seen {
+		return
+	}
+	if document, ok := stored[id]; ok {
+		document = copyValue(document)
+		originals[id] = &document
+		return
+	}
+	originals[id] = nil
+}
+
+// Changes lists the employee, department and team documents written since
+// the snapshot that now differ from their originals, ordered by collection
+// and document ID.
+func (s *ScratchStore) Changes() []DocumentChange {
+	s.originalsMu.Lock()
+	defer s.originalsMu.Unlock()
+	s.MemoryStore.mu.RLock()
+	defer s.MemoryStore.mu.RUnlock()
+
+	var changes []DocumentChange
+	changes = append(changes, diffWritten("departments", s.departments, s.MemoryStore.departments)...)
+	changes = append(changes, diffWritten("employees", s.employees, s.MemoryStore.employees)...)
+	changes = append(changes, diffWritten("teams", s.teams, s.MemoryStore.teams)...)
+	return changes
+}
+
+// diffWritten compares the written documents of one collection with their
+// originals.
+func diffWritten[V any](collection string, originals map[string]*V, stored map[string]V) []DocumentChange {
+	before := make(map[string]V, len(originals))
+	after := make(map[string]V, len(originals))
+	for id, original := range originals {
+		if original != nil {
+			before[id] = *original
+		}
+		if document, ok := stored[id]; ok {
+			after[id] = document
+		}
+	}
+	return diffCollection(collection, before, after)
+}
+
+// diffCollection compares the documents of one collection by ID.
+func diffCollection[V any](collection string, before, after map[string]V) []DocumentChange {
+	seen := make(map[string]bool)
+	for id := range before {
+		seen[id] = true
+	}
+	for id := range after {
+		seen[id] = true
+	}
+	ids := sortedKeys(seen)
+
+	var changes []DocumentChange
+	for _, id := range ids {
+		old, existed := before[id]
+		updated, exists := after[id]
+		change := DocumentChange{Collection: collection, DocumentID: id}
+		switch {
+		case !existed:
+			change.Action = DocumentCreate
+			change.After = updated
+		case !exists:
+			change.Action = DocumentDelete
+			change.Before = old
+		case !reflect.DeepEqual(old, updated):
+			change.Action = DocumentUpdate
+			change.Before = old
+			change.After = updated
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
@@ -0,0 +1,1277 @@
+package storage
+
+import (
+	"Task_04/sharedpackage"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLStore implements Store on PostgreSQL or SQLite. IAM roles and team
+// memberships are kept in join tables; see migrations/ for the schema.
+type SQLStore struct {
+	db     *sql.DB
+	driver string
+}
+
+var _ Store = (*SQLStore)(nil)
+
+// OpenSQLStore connects to the database and applies pending migrations.
+// driver is "postgres" or "sqlite3".
+func OpenSQLStore(ctx context.Context, driver, dsn string) (*SQLStore, error) {
+	switch driver {
+	case "postgres":
+	case "sqlite3":
+		// SQLite only enforces foreign keys when asked to, per connection.
+		if !strings.Contains(dsn, "_foreign_keys") && !strings.Contains(dsn, "_fk") {
+			if strings.Contains(dsn, "?") {
+				dsn += "&_foreign_keys=on"
+			} else {
+				dsn += "?_foreign_keys=on"
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SQL driver %q", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s database: %v", driver, err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to connect to %s database: %v", driver, err)
+	}
+
+	if driver == "sqlite3" {
+		// SQLite allows a single writer; serialise access through one connection.
+		db.SetMaxOpenConns(1)
+	}
+
+	store := &SQLStore{db: db, driver: driver}
+	if err := store.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	log.Printf("INFO: %s store successfully initialized.", driver)
+	return store, nil
+}
+
+// Close closes the database connection pool.
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// rebind rewrites ? placeholders to $1, $2, ... for PostgreSQL.
+func (s *SQLStore) rebind(query string) string {
+	if s.driver != "postgres" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// inTx runs fn inside a transaction and commits it if fn succeeds.
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// nullable maps an empty ID to SQL NULL so optional foreign keys stay valid.
+func nullable(id string) interface{} {
+	if id == "" {
+		return nil
+	}
+	return id
+}
+
+// queryStrings runs a single-column query and returns the values in order.
+func (s *SQLStore) queryStrings(ctx context.Context, q queryer, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// replaceRoles rewrites the ordered role rows of one owner in a join table.
+func (s *SQLStore) replaceRoles(ctx context.Context, tx *sql.Tx, table, ownerColumn, ownerID string, roles []string) error {
+	return s.replaceList(ctx, tx, table, ownerColumn, "role", ownerID, roles)
+}
+
+// replaceList rewrites the ordered value rows of one owner in a join table.
+func (s *SQLStore) replaceList(ctx context.Context, tx *sql.Tx, table, ownerColumn, valueColumn, ownerID string, values []string) error {
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM `+table+` WHERE `+ownerColumn+` = ?`), ownerID); err != nil {
+		return err
+	}
+	for position, value := range values {
+		if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO `+table+` (`+ownerColumn+`, position, `+valueColumn+`) VALUES (?, ?, ?)`), ownerID, position, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapWriteError turns foreign key violations into a readable error.
+func mapWriteError(kind, id string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if strings.Contains(strings.ToLower(err.Error()), "foreign key") {
+		return fmt.Errorf("%s %s references a department or team that does not exist: %v", kind, id, err)
+	}
+	return fmt.Errorf("Failed to write %s %s: %v", kind, id, err)
+}
+
+const employeeColumns = `id, first_name, last_name, mail_id, password, role, COALESCE(department_id, ''), failed_logins, lockouts, locked_until,
+	mfa_enabled, mfa_secret, mfa_last_step, recovery_codes`
+
+// loadEmployees runs an employee query and fills in team and IAM role rows.
+func (s *SQLStore) loadEmployees(ctx context.Context, where string, args ...interface{}) ([]sharedpackage.Employee, error) {
+	return s.queryEmployees(ctx, s.db, where, args...)
+}
+
+// queryEmployees is loadEmployees on q, which may be a transaction.
+func (s *SQLStore) queryEmployees(ctx context.Context, q queryer, where string, args ...interface{}) ([]sharedpackage.Employee, error) {
+	rows, err := q.QueryContext(ctx, s.rebind(`SELECT `+employeeColumns+` FROM employees `+where+` ORDER BY id`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying employees: %v", err)
+	}
+
+	var employees []sharedpackage.Employee
+	for rows.Next() {
+		var employee sharedpackage.Employee
+		var mfaEnabled int
+		var recoveryCodes string
+		if err := rows.Scan(&employee.ID, &employee.FirstName, &employee.LastName, &employee.Email,
+			&employee.Password, &employee.Role, &employee.DeptID,
+			&employee.FailedLogins, &employee.Lockouts, &employee.LockedUntil,
+			&mfaEnabled, &employee.MFASecret, &employee.MFALastStep, &recoveryCodes); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("Error converting employee row: %v", err)
+		}
+		employee.MFAEnabled = mfaEnabled != 0
+		if recoveryCodes != "" {
+			if err := json.Unmarshal([]byte(recoveryCodes), &employee.RecoveryCodes); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("Error decoding recovery codes of employee %s: %v", employee.ID, err)
+			}
+		}
+		employees = append(employees, employee)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range employees {
+		if err := s.loadEmployeeChildren(ctx, q, &employees[i]); err != nil {
+			return nil, err
+		}
+	}
+	return employees, nil
+}
+
+// loadEmployeeChildren reads the teamIDs and iamRoles join rows of the employee.
+func (s *SQLStore) loadEmployeeChildren(ctx context.Context, q queryer, employee *sharedpackage.Employee) error {
+	teamIDs, err := s.queryStrings(ctx, q, `SELECT team_id FROM employee_teams WHERE employee_id = ? ORDER BY position`, employee.ID)
+	if err != nil {
+		return fmt.Errorf("Error querying employee teams: %v", err)
+	}
+	employee.TeamIDs = teamIDs
+	if employee.TeamIDs == nil {
+		employee.TeamIDs = []string{}
+	}
+
+	rows, err := q.QueryContext(ctx, s.rebind(`
+		SELECT group_key, role, expires_at, condition_expression, condition_title, condition_description
+		FROM employee_iam_roles WHERE employee_id = ? ORDER BY group_key, position`), employee.ID)
+	if err != nil {
+		return fmt.Errorf("Error querying employee IAM roles: %v", err)
+	}
+	defer rows.Close()
+
+	employee.IAMRoles = make(map[string][]string)
+	for rows.Next() {
+		var key, role, expiresAt string
+		var condition sharedpackage.Condition
+		if err := rows.Scan(&key, &role, &expiresAt, &condition.Expression, &condition.Title, &condition.Description); err != nil {
+			return err
+		}
+		employee.IAMRoles[key] = append(employee.IAMRoles[key], role)
+
+		if expiresAt == "" && condition == (sharedpackage.Condition{}) {
+			continue
+		}
+		var grant sharedpackage.RoleGrant
+		if expiresAt != "" {
+			expiry, err := time.Parse(time.RFC3339Nano, expiresAt)
+			if err != nil {
+				return fmt.Errorf("Error decoding expiry of %s in %s: %v", role, key, err)
+			}
+			grant.ExpiresAt = &expiry
+		}
+		if condition != (sharedpackage.Condition{}) {
+			grant.Condition = &condition
+		}
+		if employee.RoleGrants == nil {
+			employee.RoleGrants = make(map[string]map[string]sharedpackage.RoleGrant)
+		}
+		if employee.RoleGrants[key] == nil {
+			employee.RoleGrants[key] = make(map[string]sharedpackage.RoleGrant)
+		}
+		employee.RoleGrants[key][role] = grant
+	}
+	return rows.Err()
+}
+
+func (s *SQLStore) GetEmployee(ctx context.Context, empID string) (*sharedpackage.Employee, error) {
+	employees, err := s.loadEmployees(ctx, `WHERE id = ?`, empID)
+	if err != nil {
+		return nil, err
+	}
+	if len(employees) == 0 {
+		return nil, fmt.Errorf("employees/%s: %w", empID, ErrNotFound)
+	}
+	return &employees[0], nil
+}
+
+func (s *SQLStore) PutEmployee(ctx context.Context, empID string, employee sharedpackage.Employee) error {
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.putEmployee(ctx, tx, empID, employee)
+	})
+	return mapWriteError("employee", empID, err)
+}
+
+// putEmployee upserts the employee row and rewrites its join rows within tx.
+func (s *SQLStore) putEmployee(ctx context.Context, tx *sql.Tx, empID string, employee sharedpackage.Employee) error {
+	var recoveryCodes []byte
+	if len(employee.RecoveryCodes) > 0 {
+		var err error
+		if recoveryCodes, err = json.Marshal(employee.RecoveryCodes); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, s.rebind(`
+		INSERT INTO employees (id, first_name, last_name, mail_id, password, role, department_id, failed_logins, lockouts, locked_until,
+			mfa_enabled, mfa_secret, mfa_last_step, recovery_codes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			first_name = excluded.first_name,
+			last_name = excluded.last_name,
+			mail_id = excluded.mail_id,
+			password = excluded.password,
+			role = excluded.role,
+			department_id = excluded.department_id,
+			failed_logins = excluded.failed_logins,
+			lockouts = excluded.lockouts,
+			locked_until = excluded.locked_until,
+			mfa_enabled = excluded.mfa_enabled,
+			mfa_secret = excluded.mfa_secret,
+			mfa_last_step = excluded.mfa_last_step,
+			recovery_codes = excluded.recovery_codes`),
+		empID, employee.FirstName, employee.LastName, employee.Email, employee.Password, employee.Role, nullable(employee.DeptID),
+		employee.FailedLogins, employee.Lockouts, employee.LockedUntil,
+		boolInt(employee.MFAEnabled), employee.MFASecret, employee.MFALastStep, string(recoveryCodes))
+	if err != nil {
+		return err
+	}
+
+	if err := s.putEmployeeTeams(ctx, tx, empID, employee); err != nil {
+		return err
+	}
+	return s.putEmployeeRoles(ctx, tx, empID, employee)
+}
+
+// putEmployeeTeams rewrites the team membership rows of the employee within tx.
+func (s *SQLStore) putEmployeeTeams(ctx context.Context, tx *sql.Tx, empID string, employee sharedpackage.Employee) error {
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM employee_teams WHERE employee_id = ?`), empID); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, teamID := range employee.TeamIDs {
+		// An empty or repeated team ID carries no membership
+		if teamID == "" || seen[teamID] {
+			continue
+		}
+		seen[teamID] = true
+		if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO employee_teams (employee_id, team_id, position) VALUES (?, ?, ?)`), empID, teamID, len(seen)-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putEmployeeRoles rewrites the iamRoles join rows of the employee within tx.
+func (s *SQLStore) putEmployeeRoles(ctx context.Context, tx *sql.Tx, empID string, employee sharedpackage.Employee) error {
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM employee_iam_roles WHERE employee_id = ?`), empID); err != nil {
+		return err
+	}
+	for key, roles := range employee.IAMRoles {
+		for position, role := range roles {
+			expiresAt := ""
+			var condition sharedpackage.Condition
+			if grant, ok := employee.RoleGrants[key][role]; ok {
+				if grant.ExpiresAt != nil {
+					expiresAt = grant.ExpiresAt.UTC().Format(time.RFC3339Nano)
+				}
+				if grant.Condition != nil {
+					condition = *grant.Condition
+				}
+			}
+			if _, err := tx.ExecContext(ctx, s.rebind(`
+				INSERT INTO employee_iam_roles (employee_id, group_key, position, role, expires_at, condition_expression, condition_title, condition_description)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+				empID, key, position, role, expiresAt, condition.Expression, condition.Title, condition.Description); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) DeleteEmployee(ctx context.Context, empID string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM employees WHERE id = ?`), empID)
+	return err
+}
+
+func (s *SQLStore) ListEmployees(ctx context.Context) ([]sharedpackage.Employee, error) {
+	return s.loadEmployees(ctx, ``)
+}
+
+func (s *SQLStore) FindEmployeesByDepartment(ctx context.Context, deptID string) ([]sharedpackage.Employee, error) {
+	if deptID == "" {
+		return s.loadEmployees(ctx, `WHERE department_id IS NULL`)
+	}
+	return s.loadEmployees(ctx, `WHERE department_id = ?`, deptID)
+}
+
+func (s *SQLStore) FindEmployeesByTeam(ctx context.Context, teamID string) ([]sharedpackage.Employee, error) {
+	return s.loadEmployees(ctx, `WHERE id IN (SELECT employee_id FROM employee_teams WHERE team_id = ?)`, teamID)
+}
+
+func (s *SQLStore) FindEmployeeByEmail(ctx context.Context, mail string) (*sharedpackage.Employee, error) {
+	employees, err := s.loadEmployees(ctx, `WHERE mail_id = ?`, mail)
+	if err != nil {
+		return nil, err
+	}
+	if len(employees) == 0 {
+		return nil, fmt.Errorf("employee with mailID %s: %w", mail, ErrNotFound)
+	}
+	return &employees[0], nil
+}
+
+func (s *SQLStore) NextEmployeeID(ctx context.Context) (string, error) {
+	ids, err := s.queryStrings(ctx, s.db, `SELECT id FROM employees`)
+	if err != nil {
+		return "", err
+	}
+	return nextIncrementingID("emp_", ids), nil
+}
+
+func (s *SQLStore) UpdateEmployeeLockout(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	return s.updateEmployee(ctx, empID, withoutOperations(update), func(tx *sql.Tx, employee sharedpackage.Employee) error {
+		_, err := tx.ExecContext(ctx, s.rebind(`UPDATE employees SET failed_logins = ?, lockouts = ?, locked_until = ? WHERE id = ?`),
+			employee.FailedLogins, employee.Lockouts, employee.LockedUntil, empID)
+		return err
+	})
+}
+
+func (s *SQLStore) UpdateEmployeeMFA(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	return s.updateEmployee(ctx, empID, withoutOperations(update), func(tx *sql.Tx, employee sharedpackage.Employee) error {
+		var recoveryCodes []byte
+		if len(employee.RecoveryCodes) > 0 {
+			var err error
+			if recoveryCodes, err = json.Marshal(employee.RecoveryCodes); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, s.rebind(`UPDATE employees SET mfa_enabled = ?, mfa_secret = ?, mfa_last_step = ?, recovery_codes = ? WHERE id = ?`),
+			boolInt(employee.MFAEnabled), employee.MFASecret, employee.MFALastStep, string(recoveryCodes), empID)
+		return err
+	})
+}
+
+func (s *SQLStore) UpdateEmployeePassword(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	return s.updateEmployee(ctx, empID, withoutOperations(update), func(tx *sql.Tx, employee sharedpackage.Employee) error {
+		_, err := tx.ExecContext(ctx, s.rebind(`UPDATE employees SET password = ?, failed_logins = ?, lockouts = ?, locked_until = ? WHERE id = ?`),
+			employee.Password, employee.FailedLogins, employee.Lockouts, employee.LockedUntil, empID)
+		return err
+	})
+}
+
+// updateEmployee re-reads the employee within a transaction, applies update
+// to it, lets write store the fields update may change and enqueues the ops
+// update returns. On PostgreSQL the row stays locked until commit; SQLite
+// serialises through its one connection.
+func (s *SQLStore) updateEmployee(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) ([]sharedpackage.IAMOperation, error), write func(tx *sql.Tx, employee sharedpackage.Employee) error) (*sharedpackage.Employee, error) {
+	var updated *sharedpackage.Employee
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if s.driver == "postgres" {
+			if _, err := tx.ExecContext(ctx, s.rebind(`SELECT id FROM employees WHERE id = ? FOR UPDATE`), empID); err != nil {
+				return fmt.Errorf("Error locking employee %s: %v", empID, err)
+			}
+		}
+		employees, err := s.queryEmployees(ctx, tx, `WHERE id = ?`, empID)
+		if err != nil {
+			return err
+		}
+		if len(employees) == 0 {
+			return fmt.Errorf("employees/%s: %w", empID, ErrNotFound)
+		}
+
+		employee := employees[0]
+		ops, err := update(&employee)
+		if err != nil {
+			return err
+		}
+		if err := write(tx, employee); err != nil {
+			return fmt.Errorf("Failed to update employee %s: %v", empID, err)
+		}
+		if err := s.insertOperations(ctx, tx, queueOperations(ops)); err != nil {
+			return fmt.Errorf("Failed to enqueue IAM operations of %s: %v", empID, err)
+		}
+		updated = &employee
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// loadDepartments runs a department query and fills in the IAM role rows.
+func (s *SQLStore) loadDepartments(ctx context.Context, where string, args ...interface{}) ([]sharedpackage.Department, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT id, department_name, head_id, created_time, updated_time FROM departments `+where+` ORDER BY id`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying departments: %v", err)
+	}
+
+	var departments []sharedpackage.Department
+	for rows.Next() {
+		var department sharedpackage.Department
+		if err := rows.Scan(&department.ID, &department.DepartmentName, &department.HeadID, &department.CreatedTime, &department.UpdatedTime); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("Error converting department row: %v", err)
+		}
+		departments = append(departments, department)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range departments {
+		roles, err := s.queryStrings(ctx, s.db, `SELECT role FROM department_iam_roles WHERE department_id = ? ORDER BY position`, departments[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("Error querying department IAM roles: %v", err)
+		}
+		departments[i].IAMRoles = roles
+
+		projects, err := s.queryStrings(ctx, s.db, `SELECT project_id FROM department_projects WHERE department_id = ? ORDER BY position`, departments[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("Error querying department projects: %v", err)
+		}
+		departments[i].ProjectIDs = projects
+	}
+	return departments, nil
+}
+
+func (s *SQLStore) GetDepartment(ctx context.Context, deptID string) (*sharedpackage.Department, error) {
+	departments, err := s.loadDepartments(ctx, `WHERE id = ?`, deptID)
+	if err != nil {
+		return nil, err
+	}
+	if len(departments) == 0 {
+		return nil, fmt.Errorf("departments/%s: %w", deptID, ErrNotFound)
+	}
+	return &departments[0], nil
+}
+
+func (s *SQLStore) PutDepartment(ctx context.Context, deptID string, department sharedpackage.Department) error {
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, s.rebind(`
+			INSERT INTO departments (id, department_name, head_id, created_time, updated_time)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				department_name = excluded.department_name,
+				head_id = excluded.head_id,
+				created_time = excluded.created_time,
+				updated_time = excluded.updated_time`),
+			deptID, department.DepartmentName, department.HeadID, department.CreatedTime, department.UpdatedTime)
+		if err != nil {
+			return err
+		}
+		if err := s.replaceRoles(ctx, tx, "department_iam_roles", "department_id", deptID, department.IAMRoles); err != nil {
+			return err
+		}
+		return s.replaceList(ctx, tx, "department_projects", "department_id", "project_id", deptID, department.ProjectIDs)
+	})
+	return mapWriteError("department", deptID, err)
+}
+
+// DeleteDepartment deletes the department together with the employee IAM
+// roles held through it, which no foreign key covers.
+func (s *SQLStore) DeleteDepartment(ctx context.Context, deptID string) error {
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := s.deleteGroupRoles(ctx, tx, deptID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM departments WHERE id = ?`), deptID)
+		return err
+	})
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "foreign key") {
+		return fmt.Errorf("department %s still has teams: %v", deptID, err)
+	}
+	return err
+}
+
+func (s *SQLStore) ListDepartments(ctx context.Context) ([]sharedpackage.Department, error) {
+	return s.loadDepartments(ctx, ``)
+}
+
+func (s *SQLStore) NextDepartmentID(ctx context.Context) (string, error) {
+	ids, err := s.queryStrings(ctx, s.db, `SELECT id FROM departments`)
+	if err != nil {
+		return "", err
+	}
+	return nextIncrementingID("dept_", ids), nil
+}
+
+// loadTeams runs a team query and fills in the IAM role rows.
+func (s *SQLStore) loadTeams(ctx context.Context, where string, args ...interface{}) ([]sharedpackage.Team, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT id, team_name, lead_id, COALESCE(department_id, ''), created_time, updated_time FROM teams `+where+` ORDER BY id`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying teams: %v", err)
+	}
+
+	var teams []sharedpackage.Team
+	for rows.Next() {
+		var team sharedpackage.Team
+		if err := rows.Scan(&team.ID, &team.TeamName, &team.LeadID, &team.DepartmentID, &team.CreatedTime, &team.UpdatedTime); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("Error converting team row: %v", err)
+		}
+		teams = append(teams, team)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range teams {
+		roles, err := s.queryStrings(ctx, s.db, `SELECT role FROM team_iam_roles WHERE team_id = ? ORDER BY position`, teams[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("Error querying team IAM roles: %v", err)
+		}
+		teams[i].IAMRoles = roles
+
+		projects, err := s.queryStrings(ctx, s.db, `SELECT project_id FROM team_projects WHERE team_id = ? ORDER BY position`, teams[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("Error querying team projects: %v", err)
+		}
+		teams[i].ProjectIDs = projects
+	}
+	return teams, nil
+}
+
+func (s *SQLStore) GetTeam(ctx context.Context, teamID string) (*sharedpackage.Team, error) {
+	teams, err := s.loadTeams(ctx, `WHERE id = ?`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if len(teams) == 0 {
+		return nil, fmt.Errorf("teams/%s: %w", teamID, ErrNotFound)
+	}
+	return &teams[0], nil
+}
+
+func (s *SQLStore) PutTeam(ctx context.Context, teamID string, team sharedpackage.Team) error {
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, s.rebind(`
+			INSERT INTO teams (id, team_name, lead_id, department_id, created_time, updated_time)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				team_name = excluded.team_name,
+				lead_id = excluded.lead_id,
+				department_id = excluded.department_id,
+				created_time = excluded.created_time,
+				updated_time = excluded.updated_time`),
+			teamID, team.TeamName, team.LeadID, nullable(team.DepartmentID), team.CreatedTime, team.UpdatedTime)
+		if err != nil {
+			return err
+		}
+		if err := s.replaceRoles(ctx, tx, "team_iam_roles", "team_id", teamID, team.IAMRoles); err != nil {
+			return err
+		}
+		return s.replaceList(ctx, tx, "team_projects", "team_id", "project_id", teamID, team.ProjectIDs)
+	})
+	return mapWriteError("team", teamID, err)
+}
+
+// DeleteTeam deletes the team together with the employee IAM roles held
+// through it, which no foreign key covers.
+func (s *SQLStore) DeleteTeam(ctx context.Context, teamID string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := s.deleteGroupRoles(ctx, tx, teamID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM teams WHERE id = ?`), teamID)
+		return err
+	})
+}
+
+// deleteGroupRoles drops the employee_iam_roles rows of a department or
+// team. The controller detaches employees and revokes their bindings
+// before deleting a group, so this only catches employees who joined the
+// group meanwhile; their bindings are reported as drift.
+func (s *SQLStore) deleteGroupRoles(ctx context.Context, tx *sql.Tx, group string) error {
+	_, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM employee_iam_roles WHERE group_key = ?`), group)
+	return err
+}
+
+func (s *SQLStore) ListTeams(ctx context.Context) ([]sharedpackage.Team, error) {
+	return s.loadTeams(ctx, ``)
+}
+
+func (s *SQLStore) FindTeamsByDepartment(ctx context.Context, deptID string) ([]sharedpackage.Team, error) {
+	if deptID == "" {
+		return s.loadTeams(ctx, `WHERE department_id IS NULL`)
+	}
+	return s.loadTeams(ctx, `WHERE department_id = ?`, deptID)
+}
+
+func (s *SQLStore) NextTeamID(ctx context.Context) (string, error) {
+	ids, err := s.queryStrings(ctx, s.db, `SELECT id FROM teams`)
+	if err != nil {
+		return "", err
+	}
+	return nextIncrementingID("team_", ids), nil
+}
+
+func (s *SQLStore) PutEmployeeWithOperations(ctx context.Context, empID string, employee sharedpackage.Employee, ops []sharedpackage.IAMOperation) error {
+	queued := queueOperations(ops)
+	if len(queued) == 0 {
+		return s.PutEmployee(ctx, empID, employee)
+	}
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := s.putEmployee(ctx, tx, empID, employee); err != nil {
+			return err
+		}
+		return s.insertOperations(ctx, tx, queued)
+	})
+	return mapWriteError("employee", empID, err)
+}
+
+func (s *SQLStore) UpdateEmployeeRolesWithOperations(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) ([]sharedpackage.IAMOperation, error)) (*sharedpackage.Employee, error) {
+	return s.updateEmployee(ctx, empID, update, func(tx *sql.Tx, employee sharedpackage.Employee) error {
+		_, err := tx.ExecContext(ctx, s.rebind(`UPDATE employees SET role = ?, department_id = ? WHERE id = ?`),
+			employee.Role, nullable(employee.DeptID), empID)
+		if err != nil {
+			return err
+		}
+		if err := s.putEmployeeTeams(ctx, tx, empID, employee); err != nil {
+			return err
+		}
+		return s.putEmployeeRoles(ctx, tx, empID, employee)
+	})
+}
+
+// insertOperations enqueues ops, already stamped by newOperation, within tx.
+func (s *SQLStore) insertOperations(ctx context.Context, tx *sql.Tx, ops []sharedpackage.IAMOperation) error {
+	for _, op := range ops {
+		deltas, err := json.Marshal(op.Deltas)
+		if err != nil {
+			return fmt.Errorf("Failed to encode binding deltas: %v", err)
+		}
+		_, err = tx.ExecContext(ctx, s.rebind(`
+			INSERT INTO iam_operations (id, project_id, employee_id, deltas, status, attempts, last_error, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			op.ID, op.ProjectID, op.EmployeeID, string(deltas), op.Status, op.Attempts, op.LastError,
+			op.CreatedAt.Format(time.RFC3339Nano), op.UpdatedAt.Format(time.RFC3339Nano))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) PendingOperations(ctx context.Context, limit int) ([]sharedpackage.IAMOperation, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`
+		SELECT id, project_id, employee_id, deltas, status, attempts, last_error, created_at, updated_at
+		FROM iam_operations WHERE status = ? ORDER BY id LIMIT ?`), sharedpackage.OperationPending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying operations: %v", err)
+	}
+	defer rows.Close()
+
+	var ops []sharedpackage.IAMOperation
+	for rows.Next() {
+		var op sharedpackage.IAMOperation
+		var deltas, createdAt, updatedAt string
+		if err := rows.Scan(&op.ID, &op.ProjectID, &op.EmployeeID, &deltas, &op.Status, &op.Attempts, &op.LastError, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("Error converting operation row: %v", err)
+		}
+		if err := json.Unmarshal([]byte(deltas), &op.Deltas); err != nil {
+			return nil, fmt.Errorf("Error decoding deltas of operation %s: %v", op.ID, err)
+		}
+		op.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		op.UpdatedAt, _ = time.Parse(time.RFC3339Nano, updatedAt)
+		ops = append(ops, op)
+	}
+	return ops, rows.Err()
+}
+
+func (s *SQLStore) CompleteOperations(ctx context.Context, opIDs []string) error {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, opID := range opIDs {
+			if _, err := tx.ExecContext(ctx, s.rebind(`UPDATE iam_operations SET status = ?, updated_at = ? WHERE id = ?`),
+				sharedpackage.OperationDone, now, opID); err != nil {
+				return fmt.Errorf("Error completing operation %s: %v", opID, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLStore) FailOperation(ctx context.Context, opID string, lastError string, permanent bool) error {
+	status := sharedpackage.OperationPending
+	if permanent {
+		status = sharedpackage.OperationFailed
+	}
+	_, err := s.db.ExecContext(ctx, s.rebind(`
+		UPDATE iam_operations SET attempts = attempts + 1, last_error = ?, status = ?, updated_at = ?
+		WHERE id = ?`), lastError, status, time.Now().UTC().Format(time.RFC3339Nano), opID)
+	if err != nil {
+		return fmt.Errorf("Error recording failure of operation %s: %v", opID, err)
+	}
+	return nil
+}
+
+func (s *SQLStore) CreateRefreshToken(ctx context.Context, token sharedpackage.RefreshToken) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`
+		INSERT INTO refresh_tokens (id, employee_id, created_at, expires_at, revoked)
+		VALUES (?, ?, ?, ?, ?)`),
+		token.ID, token.EmployeeID, token.CreatedAt.UTC().Format(time.RFC3339Nano), token.ExpiresAt.UTC().Format(time.RFC3339Nano), boolInt(token.Revoked))
+	if err != nil {
+		return fmt.Errorf("Error creating refresh token: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetRefreshToken(ctx context.Context, tokenID string) (*sharedpackage.RefreshToken, error) {
+	var token sharedpackage.RefreshToken
+	var createdAt, expiresAt string
+	var revoked int
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT id, employee_id, created_at, expires_at, revoked FROM refresh_tokens WHERE id = ?`), tokenID).
+		Scan(&token.ID, &token.EmployeeID, &createdAt, &expiresAt, &revoked)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("refreshTokens/%s: %w", tokenID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error querying refresh token: %v", err)
+	}
+	token.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+	token.ExpiresAt, _ = time.Parse(time.RFC3339Nano, expiresAt)
+	token.Revoked = revoked != 0
+	return &token, nil
+}
+
+func (s *SQLStore) RevokeRefreshToken(ctx context.Context, tokenID string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, s.rebind(`UPDATE refresh_tokens SET revoked = 1 WHERE id = ? AND revoked = 0`), tokenID)
+	if err != nil {
+		return false, fmt.Errorf("Error revoking refresh token: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *SQLStore) RevokeEmployeeRefreshTokens(ctx context.Context, empID string) error {
+	if _, err := s.db.ExecContext(ctx, s.rebind(`UPDATE refresh_tokens SET revoked = 1 WHERE employee_id = ? AND revoked = 0`), empID); err != nil {
+		return fmt.Errorf("Error revoking refresh tokens: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) CreatePasswordToken(ctx context.Context, token sharedpackage.PasswordToken) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`
+		INSERT INTO password_tokens (id, employee_id, purpose, created_at, expires_at, used)
+		VALUES (?, ?, ?, ?, ?, ?)`),
+		token.ID, token.EmployeeID, token.Purpose, token.CreatedAt.UTC().Format(time.RFC3339Nano), token.ExpiresAt.UTC().Format(time.RFC3339Nano), boolInt(token.Used))
+	if err != nil {
+		return fmt.Errorf("Error creating password token: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetPasswordToken(ctx context.Context, tokenID string) (*sharedpackage.PasswordToken, error) {
+	var token sharedpackage.PasswordToken
+	var createdAt, expiresAt string
+	var used int
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT id, employee_id, purpose, created_at, expires_at, used FROM password_tokens WHERE id = ?`), tokenID).
+		Scan(&token.ID, &token.EmployeeID, &token.Purpose, &createdAt, &expiresAt, &used)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("passwordTokens/%s: %w", tokenID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error querying password token: %v", err)
+	}
+	token.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+	token.ExpiresAt, _ = time.Parse(time.RFC3339Nano, expiresAt)
+	token.Used = used != 0
+	return &token, nil
+}
+
+func (s *SQLStore) UsePasswordToken(ctx context.Context, tokenID string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, s.rebind(`UPDATE password_tokens SET used = 1 WHERE id = ? AND used = 0`), tokenID)
+	if err != nil {
+		return false, fmt.Errorf("Error using password token: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *SQLStore) UseEmployeePasswordTokens(ctx context.Context, empID string, purpose string) error {
+	if _, err := s.db.ExecContext(ctx, s.rebind(`UPDATE password_tokens SET used = 1 WHERE employee_id = ? AND used = 0 AND (? = '' OR purpose = ?)`),
+		empID, purpose, purpose); err != nil {
+		return fmt.Errorf("Error using password tokens: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) CountPasswordTokens(ctx context.Context, empID string, purpose string, since time.Time) (int, error) {
+	// RFC 3339 with trimmed fractions does not sort as text; compare parsed times
+	createdAts, err := s.queryStrings(ctx, s.db, `SELECT created_at FROM password_tokens WHERE employee_id = ? AND purpose = ?`, empID, purpose)
+	if err != nil {
+		return 0, fmt.Errorf("Error querying password tokens: %v", err)
+	}
+	count := 0
+	for _, createdAt := range createdAts {
+		if created, err := time.Parse(time.RFC3339Nano, createdAt); err == nil && !created.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+const roleRequestColumns = `id, employee_id, department_id, team_id, justification, duration, approver_id, created_at,
+	status, decided_by, decided_at, comment, expires_at`
+
+// loadRoleRequests runs a role request query and fills in the role rows.
+func (s *SQLStore) loadRoleRequests(ctx context.Context, where string, args ...interface{}) ([]sharedpackage.RoleRequest, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+roleRequestColumns+` FROM role_requests `+where+` ORDER BY created_at, id`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying role requests: %v", err)
+	}
+
+	var requests []sharedpackage.RoleRequest
+	for rows.Next() {
+		var request sharedpackage.RoleRequest
+		var createdAt, decidedAt, expiresAt string
+		if err := rows.Scan(&request.ID, &request.EmployeeID, &request.DepartmentID, &request.TeamID, &request.Justification, &request.Duration,
+			&request.ApproverID, &createdAt, &request.Status, &request.DecidedBy, &decidedAt, &request.Comment, &expiresAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("Error converting role request row: %v", err)
+		}
+		request.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		request.DecidedAt = parseOptionalTime(decidedAt)
+		request.ExpiresAt = parseOptionalTime(expiresAt)
+		requests = append(requests, request)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range requests {
+		roles, err := s.queryStrings(ctx, s.db, `SELECT role FROM role_request_roles WHERE request_id = ? ORDER BY position`, requests[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("Error querying role request roles: %v", err)
+		}
+		requests[i].Roles = roles
+	}
+	return requests, nil
+}
+
+func (s *SQLStore) CreateRoleRequest(ctx context.Context, request sharedpackage.RoleRequest) error {
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, s.rebind(`
+			INSERT INTO role_requests (`+roleRequestColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			request.ID, request.EmployeeID, request.DepartmentID, request.TeamID, request.Justification, request.Duration,
+			request.ApproverID, request.CreatedAt.UTC().Format(time.RFC3339Nano),
+			request.Status, request.DecidedBy, formatOptionalTime(request.DecidedAt), request.Comment, formatOptionalTime(request.ExpiresAt))
+		if err != nil {
+			return err
+		}
+		return s.replaceRoles(ctx, tx, "role_request_roles", "request_id", request.ID, request.Roles)
+	})
+	if err != nil {
+		return fmt.Errorf("Error creating role request: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetRoleRequest(ctx context.Context, requestID string) (*sharedpackage.RoleRequest, error) {
+	requests, err := s.loadRoleRequests(ctx, `WHERE id = ?`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("roleRequests/%s: %w", requestID, ErrNotFound)
+	}
+	return &requests[0], nil
+}
+
+func (s *SQLStore) ListRoleRequests(ctx context.Context) ([]sharedpackage.RoleRequest, error) {
+	return s.loadRoleRequests(ctx, ``)
+}
+
+func (s *SQLStore) DecideRoleRequest(ctx context.Context, requestID string, from string, decision sharedpackage.RoleDecision) (bool, error) {
+	result, err := s.db.ExecContext(ctx, s.rebind(`
+		UPDATE role_requests SET status = ?, decided_by = ?, decided_at = ?, comment = ?, expires_at = ?
+		WHERE id = ? AND status = ?`),
+		decision.Status, decision.DecidedBy, formatOptionalTime(decision.DecidedAt), decision.Comment, formatOptionalTime(decision.ExpiresAt),
+		requestID, from)
+	if err != nil {
+		return false, fmt.Errorf("Error deciding role request: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *SQLStore) NextRoleRequestID(ctx context.Context) (string, error) {
+	ids, err := s.queryStrings(ctx, s.db, `SELECT id FROM role_requests`)
+	if err != nil {
+		return "", err
+	}
+	return nextIncrementingID("req_", ids), nil
+}
+
+const breakGlassColumns = `id, employee_id, granted_by, team_id, justification, granted_at, expires_at,
+	review_status, closed_by, closed_at, notes`
+
+// loadBreakGlassGrants runs a break-glass grant query and fills in the role rows.
+func (s *SQLStore) loadBreakGlassGrants(ctx context.Context, where string, args ...interface{}) ([]sharedpackage.BreakGlassGrant, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+breakGlassColumns+` FROM break_glass_grants `+where+` ORDER BY granted_at, id`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying break-glass grants: %v", err)
+	}
+
+	var grants []sharedpackage.BreakGlassGrant
+	for rows.Next() {
+		var grant sharedpackage.BreakGlassGrant
+		var grantedAt, expiresAt, closedAt string
+		if err := rows.Scan(&grant.ID, &grant.EmployeeID, &grant.GrantedBy, &grant.TeamID, &grant.Justification, &grantedAt, &expiresAt,
+			&grant.Review.Status, &grant.Review.ClosedBy, &closedAt, &grant.Review.Notes); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("Error converting break-glass grant row: %v", err)
+		}
+		grant.GrantedAt, _ = time.Parse(time.RFC3339Nano, grantedAt)
+		grant.ExpiresAt, _ = time.Parse(time.RFC3339Nano, expiresAt)
+		grant.Review.ClosedAt = parseOptionalTime(closedAt)
+		grants = append(grants, grant)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range grants {
+		roles, err := s.queryStrings(ctx, s.db, `SELECT role FROM break_glass_roles WHERE grant_id = ? ORDER BY position`, grants[i].ID)
+		if err != nil {
+			return nil, fmt.Errorf("Error querying break-glass roles: %v", err)
+		}
+		grants[i].Roles = roles
+	}
+	return grants, nil
+}
+
+func (s *SQLStore) CreateBreakGlassGrant(ctx context.Context, grant sharedpackage.BreakGlassGrant) error {
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, s.rebind(`
+			INSERT INTO break_glass_grants (`+breakGlassColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			grant.ID, grant.EmployeeID, grant.GrantedBy, grant.TeamID, grant.Justification,
+			grant.GrantedAt.UTC().Format(time.RFC3339Nano), grant.ExpiresAt.UTC().Format(time.RFC3339Nano),
+			grant.Review.Status, grant.Review.ClosedBy, formatOptionalTime(grant.Review.ClosedAt), grant.Review.Notes)
+		if err != nil {
+			return err
+		}
+		return s.replaceRoles(ctx, tx, "break_glass_roles", "grant_id", grant.ID, grant.Roles)
+	})
+	if err != nil {
+		return fmt.Errorf("Error creating break-glass grant: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetBreakGlassGrant(ctx context.Context, grantID string) (*sharedpackage.BreakGlassGrant, error) {
+	grants, err := s.loadBreakGlassGrants(ctx, `WHERE id = ?`, grantID)
+	if err != nil {
+		return nil, err
+	}
+	if len(grants) == 0 {
+		return nil, fmt.Errorf("breakGlassGrants/%s: %w", grantID, ErrNotFound)
+	}
+	return &grants[0], nil
+}
+
+func (s *SQLStore) ListBreakGlassGrants(ctx context.Context) ([]sharedpackage.BreakGlassGrant, error) {
+	return s.loadBreakGlassGrants(ctx, ``)
+}
+
+func (s *SQLStore) CloseBreakGlassReview(ctx context.Context, grantID string, review sharedpackage.BreakGlassReview) (bool, error) {
+	result, err := s.db.ExecContext(ctx, s.rebind(`
+		UPDATE break_glass_grants SET review_status = ?, closed_by = ?, closed_at = ?, notes = ?
+		WHERE id = ? AND review_status = ?`),
+		review.Status, review.ClosedBy, formatOptionalTime(review.ClosedAt), review.Notes, grantID, sharedpackage.ReviewOpen)
+	if err != nil {
+		return false, fmt.Errorf("Error closing break-glass review: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *SQLStore) NextBreakGlassGrantID(ctx context.Context) (string, error) {
+	ids, err := s.queryStrings(ctx, s.db, `SELECT id FROM break_glass_grants`)
+	if err != nil {
+		return "", err
+	}
+	return nextIncrementingID("bg_", ids), nil
+}
+
+const reviewCampaignColumns = `id, name, department_id, team_id, deadline, auto_revoke, created_by, created_at, status, closed_at`
+
+const reviewItemColumns = `campaign_id, id, position, employee_id, group_key, role, reviewer_id,
+	decision, decided_by, decided_at, comment`
+
+// loadReviewCampaigns runs a review campaign query and fills in the item rows.
+func (s *SQLStore) loadReviewCampaigns(ctx context.Context, where string, args ...interface{}) ([]sharedpackage.ReviewCampaign, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+reviewCampaignColumns+` FROM review_campaigns `+where+` ORDER BY created_at, id`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying review campaigns: %v", err)
+	}
+
+	var campaigns []sharedpackage.ReviewCampaign
+	for rows.Next() {
+		var campaign sharedpackage.ReviewCampaign
+		var deadline, createdAt, closedAt string
+		var autoRevoke int
+		if err := rows.Scan(&campaign.ID, &campaign.Name, &campaign.DepartmentID, &campaign.TeamID, &deadline, &autoRevoke,
+			&campaign.CreatedBy, &createdAt, &campaign.Status, &closedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("Error converting review campaign row: %v", err)
+		}
+		campaign.Deadline, _ = time.Parse(time.RFC3339Nano, deadline)
+		campaign.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		campaign.AutoRevoke = autoRevoke != 0
+		campaign.ClosedAt = parseOptionalTime(closedAt)
+		campaigns = append(campaigns, campaign)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range campaigns {
+		items, err := s.loadReviewItems(ctx, campaigns[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		campaigns[i].Items = items
+	}
+	return campaigns, nil
+}
+
+// loadReviewItems returns the items of a campaign in their original order.
+func (s *SQLStore) loadReviewItems(ctx context.Context, campaignID string) ([]sharedpackage.ReviewItem, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`
+		SELECT id, employee_id, group_key, role, reviewer_id, decision, decided_by, decided_at, comment
+		FROM review_items WHERE campaign_id = ? ORDER BY position`), campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying review items: %v", err)
+	}
+	defer rows.Close()
+
+	items := []sharedpackage.ReviewItem{}
+	for rows.Next() {
+		var item sharedpackage.ReviewItem
+		var decidedAt string
+		if err := rows.Scan(&item.ID, &item.EmployeeID, &item.Group, &item.Role, &item.ReviewerID,
+			&item.Decision, &item.DecidedBy, &decidedAt, &item.Comment); err != nil {
+			return nil, fmt.Errorf("Error converting review item row: %v", err)
+		}
+		item.DecidedAt = parseOptionalTime(decidedAt)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *SQLStore) CreateReviewCampaign(ctx context.Context, campaign sharedpackage.ReviewCampaign) error {
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, s.rebind(`
+			INSERT INTO review_campaigns (`+reviewCampaignColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			campaign.ID, campaign.Name, campaign.DepartmentID, campaign.TeamID,
+			campaign.Deadline.UTC().Format(time.RFC3339Nano), boolInt(campaign.AutoRevoke), campaign.CreatedBy,
+			campaign.CreatedAt.UTC().Format(time.RFC3339Nano), campaign.Status, formatOptionalTime(campaign.ClosedAt))
+		if err != nil {
+			return err
+		}
+		for position, item := range campaign.Items {
+			_, err := tx.ExecContext(ctx, s.rebind(`
+				INSERT INTO review_items (`+reviewItemColumns+`)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+				campaign.ID, item.ID, position, item.EmployeeID, item.Group, item.Role, item.ReviewerID,
+				item.Decision, item.DecidedBy, formatOptionalTime(item.DecidedAt), item.Comment)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error creating review campaign: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) GetReviewCampaign(ctx context.Context, campaignID string) (*sharedpackage.ReviewCampaign, error) {
+	campaigns, err := s.loadReviewCampaigns(ctx, `WHERE id = ?`, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	if len(campaigns) == 0 {
+		return nil, fmt.Errorf("reviewCampaigns/%s: %w", campaignID, ErrNotFound)
+	}
+	return &campaigns[0], nil
+}
+
+func (s *SQLStore) ListReviewCampaigns(ctx context.Context) ([]sharedpackage.ReviewCampaign, error) {
+	return s.loadReviewCampaigns(ctx, ``)
+}
+
+func (s *SQLStore) DecideReviewItem(ctx context.Context, campaignID string, itemID string, from string, decision sharedpackage.ReviewDecision) (bool, error) {
+	result, err := s.db.ExecContext(ctx, s.rebind(`
+		UPDATE review_items SET decision = ?, decided_by = ?, decided_at = ?, comment = ?
+		WHERE campaign_id = ? AND id = ? AND decision = ?`),
+		decision.Decision, decision.DecidedBy, formatOptionalTime(decision.DecidedAt), decision.Comment, campaignID, itemID, from)
+	if err != nil {
+		return false, fmt.Errorf("Error deciding review item: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *SQLStore) CloseReviewCampaign(ctx context.Context, campaignID string, closedAt time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, s.rebind(`
+		UPDATE review_campaigns SET status = ?, closed_at = ?
+		WHERE id = ? AND status = ?`),
+		sharedpackage.CampaignClosed, formatOptionalTime(&closedAt), campaignID, sharedpackage.CampaignOpen)
+	if err != nil {
+		return false, fmt.Errorf("Error closing review campaign: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *SQLStore) NextReviewCampaignID(ctx context.Context) (string, error) {
+	ids, err := s.queryStrings(ctx, s.db, `SELECT id FROM review_campaigns`)
+	if err != nil {
+		return "", err
+	}
+	return nextIncrementingID("rc_", ids), nil
+}
+
+// formatOptionalTime stores an optional time as RFC 3339 text, empty for nil.
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseOptionalTime reads a time stored by formatOptionalTime.
+func parseOptionalTime(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// boolInt stores a bool as 0 or 1, which both databases accept in an INTEGER column.
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
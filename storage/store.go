@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"Task_04/sharedpackage"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotFound is returned when the requested document does not exist.
+var ErrNotFound = errors.New("document not found")
+
+// EmployeeStore persists employee documents.
+type EmployeeStore interface {
+	// GetEmployee returns the employee with the given ID or ErrNotFound.
+	GetEmployee(ctx context.Context, empID string) (*sharedpackage.Employee, error)
+	// PutEmployee creates or replaces the employee with the given ID.
+	PutEmployee(ctx context.Context, empID string, employee sharedpackage.Employee) error
+	// DeleteEmployee removes the employee with the given ID.
+	DeleteEmployee(ctx context.Context, empID string) error
+	// ListEmployees returns every employee.
+	ListEmployees(ctx context.Context) ([]sharedpackage.Employee, error)
+	// FindEmployeesByDepartment returns employees whose departmentID equals deptID.
+	FindEmployeesByDepartment(ctx context.Context, deptID string) ([]sharedpackage.Employee, error)
+	// FindEmployeesByTeam returns employees whose teamIDs contain teamID.
+	FindEmployeesByTeam(ctx context.Context, teamID string) ([]sharedpackage.Employee, error)
+	// FindEmployeeByEmail returns the employee whose mailID equals mail or ErrNotFound.
+	FindEmployeeByEmail(ctx context.Context, mail string) (*sharedpackage.Employee, error)
+	// NextEmployeeID returns an unused incrementing ID of the form emp_N.
+	NextEmployeeID(ctx context.Context) (string, error)
+	// UpdateEmployeeLockout re-reads the employee, applies update to it and
+	// stores only failedLogins, lockouts and lockedUntil, atomically. An
+	// error from update aborts the write and is returned as is. It returns
+	// the updated employee or ErrNotFound.
+	UpdateEmployeeLockout(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error)
+	// UpdateEmployeeMFA is UpdateEmployeeLockout for mfaEnabled, mfaSecret,
+	// mfaLastStep and recoveryCodes.
+	UpdateEmployeeMFA(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error)
+	// UpdateEmployeePassword is UpdateEmployeeLockout for password,
+	// failedLogins, lockouts and lockedUntil.
+	UpdateEmployeePassword(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) error) (*sharedpackage.Employee, error)
+}
+
+// DepartmentStore persists department documents.
+type DepartmentStore interface {
+	GetDepartment(ctx context.Context, deptID string) (*sharedpackage.Department, error)
+	PutDepartment(ctx context.Context, deptID string, department sharedpackage.Department) error
+	// DeleteDepartment removes the department. Employees are not detached;
+	// callers take them off it, revoking their roles, first.
+	DeleteDepartment(ctx context.Context, deptID string) error
+	ListDepartments(ctx context.Context) ([]sharedpackage.Department, error)
+	// NextDepartmentID returns an unused incrementing ID of the form dept_N.
+	NextDepartmentID(ctx context.Context) (string, error)
+}
+
+// TeamStore persists team documents.
+type TeamStore interface {
+	GetTeam(ctx context.Context, teamID string) (*sharedpackage.Team, error)
+	PutTeam(ctx context.Context, teamID string, team sharedpackage.Team) error
+	// DeleteTeam is DeleteDepartment for teams.
+	DeleteTeam(ctx context.Context, teamID string) error
+	ListTeams(ctx context.Context) ([]sharedpackage.Team, error)
+	// FindTeamsByDepartment returns teams whose departmentID equals deptID.
+	FindTeamsByDepartment(ctx context.Context, deptID string) ([]sharedpackage.Team, error)
+	// NextTeamID returns an unused incrementing ID of the form team_N.
+	NextTeamID(ctx context.Context) (string, error)
+}
+
+// OperationStore keeps the outbox of IAM operations waiting to be applied.
+type OperationStore interface {
+	// PutEmployeeWithOperations writes the employee and enqueues ops, one per
+	// project, in one transaction, so the document and its IAM changes commit
+	// or fail together. Ops without deltas are not enqueued.
+	PutEmployeeWithOperations(ctx context.Context, empID string, employee sharedpackage.Employee, ops []sharedpackage.IAMOperation) error
+	// UpdateEmployeeRolesWithOperations re-reads the employee, applies update
+	// to it and stores only its membership, that is role, departmentID,
+	// teamIDs, iamRoles and roleGrants, together with the ops update returns,
+	// in one transaction. An error from update aborts the
+	// write and is returned as is. It returns the updated employee or
+	// ErrNotFound.
+	UpdateEmployeeRolesWithOperations(ctx context.Context, empID string, update func(employee *sharedpackage.Employee) ([]sharedpackage.IAMOperation, error)) (*sharedpackage.Employee, error)
+	// PendingOperations returns up to limit pending operations, oldest first.
+	PendingOperations(ctx context.Context, limit int) ([]sharedpackage.IAMOperation, error)
+	// CompleteOperations marks the operations done.
+	CompleteOperations(ctx context.Context, opIDs []string) error
+	// FailOperation records a failed attempt to apply the operation. A
+	// permanent failure marks it failed so it is no longer pending.
+	FailOperation(ctx context.Context, opID string, lastError string, permanent bool) error
+}
+
+// RefreshTokenStore keeps the refresh tokens of the employees' sessions.
+type RefreshTokenStore interface {
+	// CreateRefreshToken stores a new token under token.ID.
+	CreateRefreshToken(ctx context.Context, token sharedpackage.RefreshToken) error
+	// GetRefreshToken returns the token with the given ID or ErrNotFound.
+	GetRefreshToken(ctx context.Context, tokenID string) (*sharedpackage.RefreshToken, error)
+	// RevokeRefreshToken marks the token revoked and reports whether it was
+	// still active, so that concurrent callers cannot both use it.
+	RevokeRefreshToken(ctx context.Context, tokenID string) (bool, error)
+	// RevokeEmployeeRefreshTokens revokes every token of the employee.
+	RevokeEmployeeRefreshTokens(ctx context.Context, empID string) error
+}
+
+// PasswordTokenStore keeps the single-use tokens of password invites and resets.
+type PasswordTokenStore interface {
+	// CreatePasswordToken stores a new token under token.ID.
+	CreatePasswordToken(ctx context.Context, token sharedpackage.PasswordToken) error
+	// GetPasswordToken returns the token with the given ID or ErrNotFound.
+	GetPasswordToken(ctx context.Context, tokenID string) (*sharedpackage.PasswordToken, error)
+	// UsePasswordToken marks the token used and reports whether it was
+	// still unused, so that concurrent callers cannot both use it.
+	UsePasswordToken(ctx context.Context, tokenID string) (bool, error)
+	// UseEmployeePasswordTokens marks the tokens of the employee with the
+	// given purpose used, or every token of the employee if purpose is empty.
+	UseEmployeePasswordTokens(ctx context.Context, empID string, purpose string) error
+	// CountPasswordTokens returns how many tokens with the given purpose were
+	// created for the employee at or after since.
+	CountPasswordTokens(ctx context.Context, empID string, purpose string, since time.Time) (int, error)
+}
+
+// RoleRequestStore keeps the employees' requests for IAM roles.
+type RoleRequestStore interface {
+	// CreateRoleRequest stores a new request under request.ID.
+	CreateRoleRequest(ctx context.Context, request sharedpackage.RoleRequest) error
+	// GetRoleRequest returns the request with the given ID or ErrNotFound.
+	GetRoleRequest(ctx context.Context, requestID string) (*sharedpackage.RoleRequest, error)
+	// ListRoleRequests returns every request, oldest first.
+	ListRoleRequests(ctx context.Context) ([]sharedpackage.RoleRequest, error)
+	// DecideRoleRequest records decision on the request if its status is
+	// still from, and reports whether it was, so that concurrent approvers
+	// cannot both decide it.
+	DecideRoleRequest(ctx context.Context, requestID string, from string, decision sharedpackage.RoleDecision) (bool, error)
+	// NextRoleRequestID returns an unused incrementing ID of the form req_N.
+	NextRoleRequestID(ctx context.Context) (string, error)
+}
+
+// BreakGlassStore keeps the break-glass grants and their reviews.
+type BreakGlassStore interface {
+	// CreateBreakGlassGrant stores a new grant under grant.ID.
+	CreateBreakGlassGrant(ctx context.Context, grant sharedpackage.BreakGlassGrant) error
+	// GetBreakGlassGrant returns the grant with the given ID or ErrNotFound.
+	GetBreakGlassGrant(ctx context.Context, grantID string) (*sharedpackage.BreakGlassGrant, error)
+	// ListBreakGlassGrants returns every grant, oldest first.
+	ListBreakGlassGrants(ctx context.Context) ([]sharedpackage.BreakGlassGrant, error)
+	// CloseBreakGlassReview records review on the grant if its review is
+	// still open, and reports whether it was, so it is closed only once.
+	CloseBreakGlassReview(ctx context.Context, grantID string, review sharedpackage.BreakGlassReview) (bool, error)
+	// NextBreakGlassGrantID returns an unused incrementing ID of the form bg_N.
+	NextBreakGlassGrantID(ctx context.Context) (string, error)
+}
+
+// ReviewCampaignStore keeps the access recertification campaigns.
+type ReviewCampaignStore interface {
+	// CreateReviewCampaign stores a new campaign and its items under campaign.ID.
+	CreateReviewCampaign(ctx context.Context, campaign sharedpackage.ReviewCampaign) error
+	// GetReviewCampaign returns the campaign with the given ID or ErrNotFound.
+	GetReviewCampaign(ctx context.Context, campaignID string) (*sharedpackage.ReviewCampaign, error)
+	// ListReviewCampaigns returns every campaign, oldest first.
+	ListReviewCampaigns(ctx context.Context) ([]sharedpackage.ReviewCampaign, error)
+	// DecideReviewItem records decision on an item if its decision is still
+	// from, and reports whether it was, so that an item is decided only once.
+	DecideReviewItem(ctx context.Context, campaignID string, itemID string, from string, decision sharedpackage.ReviewDecision) (bool, error)
+	// CloseReviewCampaign marks an open campaign closed and reports whether
+	// it was still open.
+	CloseReviewCampaign(ctx context.Context, campaignID string, closedAt time.Time) (bool, error)
+	// NextReviewCampaignID returns an unused incrementing ID of the form rc_N.
+	NextReviewCampaignID(ctx context.Context) (string, error)
+}
+
+// Store bundles every store a backend provides.
+type Store interface {
+	EmployeeStore
+	DepartmentStore
+	TeamStore
+	OperationStore
+	RefreshTokenStore
+	PasswordTokenStore
+	RoleRequestStore
+	BreakGlassStore
+	ReviewCampaignStore
+}
+
+// nextIncrementingID returns prefix followed by one more than the highest
+// numeric suffix found in ids. IDs without a numeric suffix are ignored.
+func nextIncrementingID(prefix string, ids []string) string {
+	existingIDs := make(map[string]bool)
+	highestID := 0
+
+	for _, docID := range ids {
+		if !strings.HasPrefix(docID, prefix) {
+			continue
+		}
+
+		// Extract the numeric part of the document ID
+		id, err := strconv.Atoi(docID[len(prefix):])
+		if err != nil {
+			continue // Ignore non-numeric IDs
+		}
+
+		if id > highestID {
+			highestID = id
+		}
+		existingIDs[docID] = true
+	}
+
+	// Generate a new incrementing document ID
+	for {
+		newIDStr := fmt.Sprintf("%s%d", prefix, highestID+1)
+		if !existingIDs[newIDStr] {
+			return newIDStr
+		}
+		highestID++
+	}
+}
+
+// operationSeq breaks ties between operations created in the same nanosecond.
+var operationSeq uint64
+
+// withoutOperations adapts an employee update that queues no IAM operations.
+func withoutOperations(update func(employee *sharedpackage.Employee) error) func(employee *sharedpackage.Employee) ([]sharedpackage.IAMOperation, error) {
+	return func(employee *sharedpackage.Employee) ([]sharedpackage.IAMOperation, error) {
+		return nil, update(employee)
+	}
+}
+
+// queueOperations stamps the ops that carry deltas with newOperation and
+// drops the others.
+func queueOperations(ops []sharedpackage.IAMOperation) []sharedpackage.IAMOperation {
+	var queued []sharedpackage.IAMOperation
+	for _, op := range ops {
+		if len(op.Deltas) > 0 {
+			queued = append(queued, newOperation(op))
+		}
+	}
+	return queued
+}
+
+// newOperation stamps op with a fresh ID and the pending state. IDs sort in
+// creation order, which is the order the outbox is applied in.
+func newOperation(op sharedpackage.IAMOperation) sharedpackage.IAMOperation {
+	now := time.Now().UTC()
+	op.ID = fmt.Sprintf("op_%020d_%06d", now.UnixNano(), atomic.AddUint64(&operationSeq, 1)%1000000)
+	op.Status = sharedpackage.OperationPending
+	op.Attempts = 0
+	op.LastError = ""
+	op.CreatedAt = now
+	op.UpdatedAt = now
+	return op
+}